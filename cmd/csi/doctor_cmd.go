@@ -0,0 +1,79 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/fireflycons/hypervcsi/internal/linux/driver"
+	"github.com/spf13/cobra"
+)
+
+var (
+	doctorParams     driver.DoctorParams
+	doctorOutputFlag string
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the prerequisites of the node and the connection to the Windows service",
+	Long: `
+Checks the prerequisites which most often cause a failed installation: the Hyper-V KVP
+pools and the VM name and ID, the udev links of attached disks, the tools used to format
+and mount volumes, and the mount propagation of the kubelet directory.
+
+In controller mode, when the API key is given, it also checks that the Windows service is
+reachable, that its certificate is trusted, that the API key is accepted and that the
+service is the same version as the plugin. The node API key is checked if given.
+
+The flags default to the environment variables of the plugin, so run it within the pod:
+
+` + "```\nkubectl exec -n kube-system csi-hv-node-xxxxx -c csi-hv-plugin -- hyperv-csi-plugin doctor\n```\n" + `
+The exit code is non-zero if any check fails.`,
+	RunE: runDoctor,
+}
+
+func init() {
+	doctorCmd.Flags().StringVarP(&doctorParams.URL, "url", "u", os.Getenv("URL"), "URL of khypervprovider Windows Service")
+	doctorCmd.Flags().StringVarP(&doctorParams.ApiKey, "api-key", "k", os.Getenv("API_KEY"), "API key to access Hyper-V service backend. Checks the controller if given.")
+	doctorCmd.Flags().StringVar(&doctorParams.NodeApiKey, "node-api-key", os.Getenv("NODE_API_KEY"), "Node API key to access Hyper-V service backend for ephemeral volumes")
+	doctorCmd.Flags().StringVar(&doctorParams.VmName, "vm-name", os.Getenv("VM_NAME"), "Name of this VM in Hyper-V, if it cannot be read from Hyper-V KVP or the BIOS")
+	doctorCmd.Flags().StringVar(&doctorParams.VmId, "vm-id", os.Getenv("VM_ID"), "ID of this VM in Hyper-V, if it cannot be read from Hyper-V KVP or the BIOS")
+	doctorCmd.Flags().StringVar(&doctorParams.KubeletDir, "kubelet-dir", envOrDefaultString("KUBELET_DIR", driver.DefaultKubeletDir), "Directory in which kubelet mounts volumes")
+	doctorCmd.Flags().StringVarP(&doctorOutputFlag, "output", "o", "table", "Output format: table or json")
+
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctor(cmd *cobra.Command, _ []string) error {
+
+	if doctorOutputFlag != "table" && doctorOutputFlag != "json" {
+		return fmt.Errorf("invalid output format %q, must be table or json", doctorOutputFlag)
+	}
+
+	// Usage is not relevant to failed checks
+	cmd.SilenceUsage = true
+
+	report := driver.Doctor(context.Background(), &doctorParams)
+
+	var err error
+
+	if doctorOutputFlag == "json" {
+		err = report.WriteJSON(cmd.OutOrStdout())
+	} else {
+		err = report.WriteTable(cmd.OutOrStdout())
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if report.Failed() {
+		cmd.SilenceErrors = true
+		os.Exit(1)
+	}
+
+	return nil
+}
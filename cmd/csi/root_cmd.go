@@ -9,10 +9,10 @@ import (
 	"os/signal"
 	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/fireflycons/hypervcsi/cmd/shared"
 	"github.com/fireflycons/hypervcsi/internal/linux/driver"
-	"github.com/fireflycons/hypervcsi/internal/linux/kvp"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -23,7 +23,22 @@ var (
 	driverNameFlag string
 	debugAddrFlag  string
 	apiKeyFlag     string
+	nodeApiKeyFlag string
+	vmNameFlag     string
+	vmIdFlag       string
+	maxVolumesFlag uint
 	logLevelFlag   uint32
+
+	orphanScanIntervalFlag time.Duration
+	orphanGracePeriodFlag  time.Duration
+	deleteOrphansFlag      bool
+
+	attachmentScanIntervalFlag time.Duration
+	staleAttachmentDelayFlag   time.Duration
+
+	forceDetachGracePeriodFlag time.Duration
+
+	publishNodeStatusFlag bool
 )
 
 var rootCmd = &cobra.Command{
@@ -47,10 +62,22 @@ func init() {
 	rootCmd.Flags().StringVarP(&endpointFlag, "endpoint", "e", envOrDefaultString("ENDPOINT", "unix:///var/lib/kubelet/plugins/"+driver.DefaultDriverName+"/csi.sock"), "CSI endpoint")
 	rootCmd.Flags().StringVarP(&urlFlag, "url", "u", os.Getenv("URL"), "URL of khypervprovider Windows Service")
 	rootCmd.Flags().StringVarP(&driverNameFlag, "driver-name", "n", driver.DefaultDriverName, "Name for the driver")
-	rootCmd.Flags().StringVarP(&debugAddrFlag, "debug-addr", "d", "", "Address to serve the HTTP debug server on")
+	rootCmd.Flags().StringVarP(&debugAddrFlag, "debug-addr", "d", os.Getenv("DEBUG_ADDR"), "Address to serve the HTTP debug server on")
 	rootCmd.Flags().StringVarP(&apiKeyFlag, "api-key", "k", os.Getenv("API_KEY"), "API key to access Hyper-V service backend")
+	rootCmd.Flags().StringVar(&nodeApiKeyFlag, "node-api-key", os.Getenv("NODE_API_KEY"), "Node API key to access Hyper-V service backend for ephemeral volumes. Omit to disable ephemeral volumes.")
+	rootCmd.Flags().StringVar(&vmNameFlag, "vm-name", os.Getenv("VM_NAME"), "Name of this VM in Hyper-V, if it cannot be read from Hyper-V KVP or the BIOS")
+	rootCmd.Flags().StringVar(&vmIdFlag, "vm-id", os.Getenv("VM_ID"), "ID of this VM in Hyper-V, if it cannot be read from Hyper-V KVP or the BIOS")
+	rootCmd.Flags().UintVar(&maxVolumesFlag, "max-volumes", uint(envOrDefaultUint32("MAX_VOLUMES", 0)), "Number of volumes which may be attached to the node, if it cannot be found from the VM's SCSI controllers. Zero is unlimited.")
 	rootCmd.Flags().Uint32VarP(&logLevelFlag, "log-level", "v", envOrDefaultUint32("LOG_LEVEL", uint32(logrus.InfoLevel)), "Log level (higher = more verbose)")
 
+	rootCmd.Flags().DurationVar(&orphanScanIntervalFlag, "orphan-scan-interval", envOrDefaultDuration("ORPHAN_SCAN_INTERVAL", 0), "How often the controller scans for volumes with no PersistentVolume. Zero disables the scan.")
+	rootCmd.Flags().DurationVar(&orphanGracePeriodFlag, "orphan-grace-period", envOrDefaultDuration("ORPHAN_GRACE_PERIOD", driver.DefaultOrphanGracePeriod), "How long a volume must have been orphaned before it is deleted")
+	rootCmd.Flags().BoolVar(&deleteOrphansFlag, "delete-orphans", envOrDefaultBool("DELETE_ORPHANS", false), "Delete orphaned volumes once the grace period has expired")
+	rootCmd.Flags().DurationVar(&attachmentScanIntervalFlag, "attachment-scan-interval", envOrDefaultDuration("ATTACHMENT_SCAN_INTERVAL", 0), "How often the controller scans for volumes attached with no VolumeAttachment. Zero disables the scan.")
+	rootCmd.Flags().DurationVar(&staleAttachmentDelayFlag, "stale-attachment-delay", envOrDefaultDuration("STALE_ATTACHMENT_DELAY", driver.DefaultStaleAttachmentDelay), "How long a volume must have been attached with no VolumeAttachment before it is detached")
+	rootCmd.Flags().DurationVar(&forceDetachGracePeriodFlag, "force-detach-grace-period", envOrDefaultDuration("FORCE_DETACH_GRACE_PERIOD", 0), "How long a VM must have been Off before a volume attached to it may be detached to publish it to another node. Zero disables forced detach.")
+	rootCmd.Flags().BoolVar(&publishNodeStatusFlag, "publish-node-status", envOrDefaultBool("PUBLISH_NODE_STATUS", false), "Publish the status of the node plugin to the Hyper-V host through the KVP guest pool")
+
 	shared.InitDocCmd(rootCmd)
 	shared.InitSysinfoCmd(rootCmd)
 }
@@ -79,6 +106,36 @@ func envOrDefaultUint32(varname string, defaultValue uint32) uint32 {
 	return defaultValue
 }
 
+func envOrDefaultDuration(varname string, defaultValue time.Duration) time.Duration {
+
+	if v, present := os.LookupEnv(varname); present {
+		d, err := time.ParseDuration(v)
+
+		if err != nil {
+			return defaultValue
+		}
+
+		return d
+	}
+
+	return defaultValue
+}
+
+func envOrDefaultBool(varname string, defaultValue bool) bool {
+
+	if v, present := os.LookupEnv(varname); present {
+		b, err := strconv.ParseBool(v)
+
+		if err != nil {
+			return defaultValue
+		}
+
+		return b
+	}
+
+	return defaultValue
+}
+
 func runDriver(*cobra.Command, []string) {
 
 	drv, err := driver.NewDriver(
@@ -87,8 +144,23 @@ func runDriver(*cobra.Command, []string) {
 			URL:        urlFlag,
 			DriverName: driverNameFlag,
 			DebugAddr:  debugAddrFlag,
-			Metadata:   kvp.New(),
+			VmName:     vmNameFlag,
+			VmId:       vmIdFlag,
 			ApiKey:     apiKeyFlag,
+			NodeApiKey: nodeApiKeyFlag,
+
+			VolumeLimit: maxVolumesFlag,
+
+			OrphanScanInterval: orphanScanIntervalFlag,
+			OrphanGracePeriod:  orphanGracePeriodFlag,
+			DeleteOrphans:      deleteOrphansFlag,
+
+			AttachmentScanInterval: attachmentScanIntervalFlag,
+			StaleAttachmentDelay:   staleAttachmentDelayFlag,
+
+			ForceDetachGracePeriod: forceDetachGracePeriodFlag,
+
+			PublishNodeStatus: publishNodeStatusFlag,
 			LogLevel: func() logrus.Level {
 				if logLevelFlag > uint32(logrus.TraceLevel) {
 					return logrus.TraceLevel
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/spf13/cobra"
+)
+
+var readOnlyFlag bool
+
+var attachCmd = &cobra.Command{
+	Use:   "attach VOLUME_ID VM_ID",
+	Short: "Attach a volume to a VM",
+	Args:  cobra.ExactArgs(2),
+	RunE: withClient(func(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+		if err := c.PublishVolume(ctx, args[0], args[1], readOnlyFlag); err != nil {
+			return err
+		}
+
+		return out.message("volume %s attached to %s", args[0], args[1])
+	}),
+}
+
+var detachCmd = &cobra.Command{
+	Use:   "detach VOLUME_ID VM_ID",
+	Short: "Detach a volume from a VM",
+	Args:  cobra.ExactArgs(2),
+	RunE: withClient(func(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+		if err := c.UnpublishVolume(ctx, args[0], args[1]); err != nil {
+			return err
+		}
+
+		return out.message("volume %s detached from %s", args[0], args[1])
+	}),
+}
+
+func init() {
+	attachCmd.Flags().BoolVar(&readOnlyFlag, "read-only", false, "Attach the volume read-only")
+
+	rootCmd.AddCommand(attachCmd, detachCmd)
+}
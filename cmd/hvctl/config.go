@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Environment variables which override the config file
+const (
+	urlEnvVar                = "HVCTL_URL"
+	apiKeyEnvVar             = "HVCTL_API_KEY"
+	caCertEnvVar             = "HVCTL_CA_CERT"
+	insecureSkipVerifyEnvVar = "HVCTL_INSECURE_SKIP_VERIFY"
+)
+
+// config is the connection to the Windows service, read from the config file
+// and overridden by the environment and then by command line flags
+type config struct {
+
+	// URL of the khypervprovider Windows service
+	URL string `json:"url,omitempty"`
+
+	// APIKey to access the service
+	APIKey string `json:"apiKey,omitempty"`
+
+	// CACert is the path to a PEM file of certificate authorities to trust
+	// in addition to the system roots, e.g. for a self-signed service certificate
+	CACert string `json:"caCert,omitempty"`
+
+	// InsecureSkipVerify disables verification of the service certificate
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// defaultConfigPath returns the path of the config file in the user's config directory,
+// e.g. ~/.config/hvctl/config.yaml on Linux or %AppData%\hvctl\config.yaml on Windows
+func defaultConfigPath() string {
+
+	dir, err := os.UserConfigDir()
+
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "hvctl", "config.yaml")
+}
+
+// loadConfig reads the config file at the given path and applies the environment.
+// A missing file is only an error if it was named explicitly.
+func loadConfig(path string, explicit bool) (*config, error) {
+
+	cfg := &config{}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+
+		switch {
+		case err == nil:
+			if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+				return nil, fmt.Errorf("cannot parse config file %s: %w", path, err)
+			}
+		case errors.Is(err, os.ErrNotExist) && !explicit:
+		default:
+			return nil, fmt.Errorf("cannot read config file: %w", err)
+		}
+	}
+
+	if v, present := os.LookupEnv(urlEnvVar); present {
+		cfg.URL = v
+	}
+
+	if v, present := os.LookupEnv(apiKeyEnvVar); present {
+		cfg.APIKey = v
+	}
+
+	if v, present := os.LookupEnv(caCertEnvVar); present {
+		cfg.CACert = v
+	}
+
+	if v, present := os.LookupEnv(insecureSkipVerifyEnvVar); present {
+		b, err := strconv.ParseBool(v)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", insecureSkipVerifyEnvVar, err)
+		}
+
+		cfg.InsecureSkipVerify = b
+	}
+
+	return cfg, nil
+}
+
+// validate checks that the config has what is needed to call the service
+func (c *config) validate() error {
+
+	if c.URL == "" {
+		return fmt.Errorf("the URL of the Windows service must be given with --url, %s or the config file", urlEnvVar)
+	}
+
+	if c.APIKey == "" {
+		return fmt.Errorf("the API key must be given with --api-key, %s or the config file", apiKeyEnvVar)
+	}
+
+	return nil
+}
+
+// httpClient returns an HTTP client which trusts the configured certificate authorities
+func (c *config) httpClient() (*http.Client, error) {
+
+	if c.CACert == "" && !c.InsecureSkipVerify {
+		return &http.Client{}, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		//nolint:gosec // only when asked for, for self-signed certificates
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CACert != "" {
+		pem, err := os.ReadFile(c.CACert)
+
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA certificates: %w", err)
+		}
+
+		roots, err := x509.SystemCertPool()
+
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CACert)
+		}
+
+		tlsConfig.RootCAs = roots
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
+}
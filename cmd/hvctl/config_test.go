@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("url: https://hyperv:8443\napiKey: file-key\ncaCert: /etc/ca.pem\n"), 0600))
+
+	t.Run("file", func(t *testing.T) {
+		cfg, err := loadConfig(path, true)
+
+		require.NoError(t, err)
+		require.Equal(t, &config{URL: "https://hyperv:8443", APIKey: "file-key", CACert: "/etc/ca.pem"}, cfg)
+		require.NoError(t, cfg.validate())
+	})
+
+	t.Run("environment overrides file", func(t *testing.T) {
+		t.Setenv(apiKeyEnvVar, "env-key")
+		t.Setenv(insecureSkipVerifyEnvVar, "true")
+
+		cfg, err := loadConfig(path, true)
+
+		require.NoError(t, err)
+		require.Equal(t, "https://hyperv:8443", cfg.URL)
+		require.Equal(t, "env-key", cfg.APIKey)
+		require.True(t, cfg.InsecureSkipVerify)
+	})
+
+	t.Run("missing default file", func(t *testing.T) {
+		t.Setenv(urlEnvVar, "https://hyperv:8443")
+
+		cfg, err := loadConfig(filepath.Join(t.TempDir(), "config.yaml"), false)
+
+		require.NoError(t, err)
+		require.Equal(t, "https://hyperv:8443", cfg.URL)
+		require.ErrorContains(t, cfg.validate(), apiKeyEnvVar)
+	})
+
+	t.Run("missing explicit file", func(t *testing.T) {
+		_, err := loadConfig(filepath.Join(t.TempDir(), "config.yaml"), true)
+
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("uri: https://hyperv:8443\n"), 0600))
+
+		_, err := loadConfig(path, true)
+
+		require.ErrorContains(t, err, "uri")
+	})
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fileFlag   string
+	resumeFlag bool
+)
+
+var volumesExportCmd = &cobra.Command{
+	Use:   "export VOLUME_ID",
+	Short: "Download the VHDX of a volume, which must not be attached",
+	Long: `
+Downloads the VHDX of a volume to a file and verifies it against the SHA-256 digest
+the service reports. An interrupted download continues from the end of the file
+with --resume. Large volumes may need a longer --timeout, or 0 to wait indefinitely.`,
+	Args: cobra.ExactArgs(1),
+	RunE: withClient(runVolumesExport),
+}
+
+var volumesImportCmd = &cobra.Command{
+	Use:   "import NAME",
+	Short: "Upload a VHDX as a new volume",
+	Long: `
+Uploads a VHDX file as a new volume with the given name. The service validates the
+VHDX and gives it a new disk identifier, which becomes the volume ID. An interrupted
+upload continues from where the service stopped receiving it with --resume. Large
+files may need a longer --timeout, or 0 to wait indefinitely.`,
+	Args: cobra.ExactArgs(1),
+	RunE: withClient(runVolumesImport),
+}
+
+func init() {
+	volumesExportCmd.Flags().StringVarP(&fileFlag, "file", "f", "", "File to which to write the VHDX")
+	volumesExportCmd.Flags().BoolVar(&resumeFlag, "resume", false, "Continue an interrupted export from the end of the file")
+	_ = volumesExportCmd.MarkFlagRequired("file")
+
+	volumesImportCmd.Flags().StringVarP(&fileFlag, "file", "f", "", "VHDX file to upload")
+	volumesImportCmd.Flags().BoolVar(&resumeFlag, "resume", false, "Continue an interrupted import")
+	volumesImportCmd.Flags().StringVar(&namespaceFlag, "namespace", "", "Kubernetes namespace against whose quota the volume is counted")
+	_ = volumesImportCmd.MarkFlagRequired("file")
+
+	volumesCmd.AddCommand(volumesExportCmd, volumesImportCmd)
+}
+
+var errDigestMismatch = errors.New("the digest of the file does not match the volume; export it again without --resume")
+
+// exportVolume downloads the VHDX of a volume to a file, optionally resuming from the end of
+// an existing file, and verifies the whole file against the digest from the service.
+func exportVolume(ctx context.Context, c hyperv.Client, volumeId, path string, resume bool) (int64, error) {
+
+	var (
+		offset int64
+		flag   = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	)
+
+	if resume {
+		flag = os.O_WRONLY | os.O_CREATE
+
+		if info, err := os.Stat(path); err == nil {
+			offset = info.Size()
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return 0, err
+		}
+	}
+
+	content, err := c.ExportVolume(ctx, volumeId, offset)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer content.Close()
+
+	f, err := os.OpenFile(path, flag, 0600)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return 0, err
+	}
+
+	if _, err := io.Copy(f, content); err != nil {
+		_ = f.Close()
+		return 0, fmt.Errorf("export interrupted, continue it with --resume: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := verifyDigest(path, content.Digest); err != nil {
+		return 0, err
+	}
+
+	return content.Size, nil
+}
+
+func verifyDigest(path string, digest []byte) error {
+
+	f, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(h.Sum(nil), digest) {
+		return errDigestMismatch
+	}
+
+	return nil
+}
+
+func runVolumesExport(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+	size, err := exportVolume(ctx, c, args[0], fileFlag, resumeFlag)
+
+	if err != nil {
+		return err
+	}
+
+	return out.message("volume %s exported to %s (%s)", args[0], fileFlag, common.FormatBytes(size))
+}
+
+func runVolumesImport(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+	f, err := os.Open(fileFlag)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+
+	if resumeFlag {
+		if offset, err = c.GetImportOffset(ctx, args[0], info.Size()); err != nil {
+			return err
+		}
+
+		if offset == info.Size() {
+			return out.message("the import of %s has already completed", args[0])
+		}
+
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	v, err := c.ImportVolume(ctx, args[0], namespaceFlag, f, offset, info.Size())
+
+	if err != nil {
+		return err
+	}
+
+	return printVolume(out, v)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/stretchr/testify/require"
+)
+
+// contentClient serves ExportVolume from a fixed VHDX
+type contentClient struct {
+	hyperv.Client
+	data    []byte
+	digest  []byte
+	offsets []int64
+}
+
+func (c *contentClient) ExportVolume(_ context.Context, _ string, offset int64) (*hyperv.VolumeContent, error) {
+
+	c.offsets = append(c.offsets, offset)
+
+	return &hyperv.VolumeContent{
+		ReadCloser: io.NopCloser(bytes.NewReader(c.data[offset:])),
+		FileName:   "pv1.vhdx",
+		Offset:     offset,
+		Size:       int64(len(c.data)),
+		Digest:     c.digest,
+	}, nil
+}
+
+func TestExportVolume(t *testing.T) {
+
+	data := []byte("vhdxfile0123456789abcdef")
+	sum := sha256.Sum256(data)
+	c := &contentClient{data: data, digest: sum[:]}
+	path := filepath.Join(t.TempDir(), "pv1.vhdx")
+
+	t.Run("resume", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, data[:10], 0600))
+
+		size, err := exportVolume(t.Context(), c, "1", path, true)
+
+		require.NoError(t, err)
+		require.Equal(t, int64(len(data)), size)
+		require.Equal(t, []int64{10}, c.offsets)
+
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, data, b)
+	})
+
+	t.Run("resume of a different volume", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("0123456789"), 0600))
+
+		_, err := exportVolume(t.Context(), c, "1", path, true)
+
+		require.ErrorIs(t, err, errDigestMismatch)
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, make([]byte, 100), 0600))
+
+		_, err := exportVolume(t.Context(), c, "1", path, false)
+
+		require.NoError(t, err)
+
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, data, b)
+	})
+}
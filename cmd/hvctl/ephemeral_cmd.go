@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/spf13/cobra"
+)
+
+var ephemeralCmd = &cobra.Command{
+	Use:   "ephemeral",
+	Short: "Manage the volumes of CSI ephemeral inline volumes",
+	Long: `
+Creates and deletes the volumes of CSI ephemeral inline volumes, which are attached to the
+VM when they are created. These calls need the node API key.`,
+}
+
+var ephemeralCreateCmd = &cobra.Command{
+	Use:   "create NAME VM_ID",
+	Short: "Create an ephemeral volume and attach it to a VM",
+	Args:  cobra.ExactArgs(2),
+	RunE: withClient(func(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+		size, err := common.ParseBytes(sizeFlag)
+
+		if err != nil {
+			return fmt.Errorf("invalid size %q: %w", sizeFlag, err)
+		}
+
+		v, err := c.CreateEphemeralVolume(ctx, args[0], args[1], size)
+
+		if err != nil {
+			return err
+		}
+
+		return printVolume(out, v)
+	}),
+}
+
+var ephemeralDeleteCmd = &cobra.Command{
+	Use:   "delete NAME VM_ID",
+	Short: "Detach an ephemeral volume from a VM and delete it",
+	Args:  cobra.ExactArgs(2),
+	RunE: withClient(func(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+		if err := c.DeleteEphemeralVolume(ctx, args[0], args[1]); err != nil {
+			return err
+		}
+
+		return out.message("ephemeral volume %s deleted", args[0])
+	}),
+}
+
+func init() {
+	ephemeralCreateCmd.Flags().StringVarP(&sizeFlag, "size", "s", "", "Size of the volume in bytes, or with a binary suffix, e.g. 1Gi")
+	_ = ephemeralCreateCmd.MarkFlagRequired("size")
+
+	ephemeralCmd.AddCommand(ephemeralCreateCmd, ephemeralDeleteCmd)
+	rootCmd.AddCommand(ephemeralCmd)
+}
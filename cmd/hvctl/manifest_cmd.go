@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// manifestOptions are the settings of a static PersistentVolume which cannot be read from the volume
+type manifestOptions struct {
+	name          string
+	driver        string
+	storageClass  string
+	accessMode    string
+	volumeMode    string
+	fsType        string
+	reclaimPolicy string
+	claim         string
+}
+
+var (
+	manifestFlags manifestOptions
+	pathFlag      string
+)
+
+var volumesAdoptCmd = &cobra.Command{
+	Use:   "adopt NAME",
+	Short: "Move an existing VHDX into the PV store and print a static PersistentVolume for it",
+	Long: `
+Moves a VHDX on the Hyper-V host which is not in the PV store, e.g. a disk of an older VM,
+into the store as a volume with the given name, and prints a PersistentVolume manifest for
+it which may be applied with kubectl. The VHDX must not be attached to a running VM or be a
+differencing disk. Copying it from another drive may need a longer --timeout.
+
+Bind the volume to an existing or planned claim with --claim NAMESPACE/NAME, whose
+storageClassName must match --storage-class.`,
+	Example: `  hvctl volumes adopt data --path 'D:\VMs\old-vm\data.vhdx' --claim default/data | kubectl apply -f -`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    withClient(runVolumesAdopt),
+}
+
+var volumesManifestCmd = &cobra.Command{
+	Use:   "manifest VOLUME_ID",
+	Short: "Print a static PersistentVolume for a volume",
+	Args:  cobra.ExactArgs(1),
+	RunE:  withClient(runVolumesManifest),
+}
+
+func init() {
+	volumesAdoptCmd.Flags().StringVar(&pathFlag, "path", "", "Absolute path of the VHDX on the Hyper-V host")
+	volumesAdoptCmd.Flags().StringVar(&namespaceFlag, "namespace", "", "Kubernetes namespace against whose quota the volume is counted, by default that of --claim")
+	_ = volumesAdoptCmd.MarkFlagRequired("path")
+
+	for _, cmd := range []*cobra.Command{volumesAdoptCmd, volumesManifestCmd} {
+		flags := cmd.Flags()
+		flags.StringVar(&manifestFlags.name, "pv-name", "", "Name of the PersistentVolume, by default the name of the volume")
+		flags.StringVar(&manifestFlags.driver, "driver", constants.DriverName, "Name of the CSI driver")
+		flags.StringVar(&manifestFlags.storageClass, "storage-class", "", "StorageClass of the PersistentVolume, which claims must request")
+		flags.StringVar(&manifestFlags.accessMode, "access-mode", string(corev1.ReadWriteOnce), "Access mode: ReadWriteOnce, ReadOnlyMany or ReadWriteMany")
+		flags.StringVar(&manifestFlags.volumeMode, "volume-mode", string(corev1.PersistentVolumeFilesystem), "Volume mode: Filesystem or Block")
+		flags.StringVar(&manifestFlags.fsType, "fs-type", "", "Filesystem on the volume, e.g. ext4")
+		flags.StringVar(&manifestFlags.reclaimPolicy, "reclaim-policy", string(corev1.PersistentVolumeReclaimRetain), "Reclaim policy: Retain or Delete")
+		flags.StringVar(&manifestFlags.claim, "claim", "", "Claim to which to bind the PersistentVolume, as NAMESPACE/NAME")
+	}
+
+	volumesCmd.AddCommand(volumesAdoptCmd, volumesManifestCmd)
+}
+
+func runVolumesAdopt(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+	// Check the options before the VHDX is moved
+	if _, err := buildPersistentVolume(&rest.GetVolumeResponse{Name: args[0]}, &manifestFlags); err != nil {
+		return err
+	}
+
+	namespace := namespaceFlag
+
+	if namespace == "" && manifestFlags.claim != "" {
+		namespace, _, _ = strings.Cut(manifestFlags.claim, "/")
+	}
+
+	v, err := c.AdoptVolume(ctx, args[0], pathFlag, namespace)
+
+	if err != nil {
+		return err
+	}
+
+	return printManifest(out, v, &manifestFlags)
+}
+
+func runVolumesManifest(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+	v, err := c.GetVolume(ctx, args[0])
+
+	if err != nil {
+		return err
+	}
+
+	return printManifest(out, v, &manifestFlags)
+}
+
+// printManifest writes a PersistentVolume for the volume as YAML, or as JSON with -o json
+func printManifest(out *printer, v *rest.GetVolumeResponse, opts *manifestOptions) error {
+
+	pv, err := buildPersistentVolume(v, opts)
+
+	if err != nil {
+		return err
+	}
+
+	if out.format == outputTable {
+		out = &printer{format: outputYAML, w: out.w}
+	}
+
+	return out.print(pv, nil)
+}
+
+// buildPersistentVolume makes a static PersistentVolume whose CSI volume handle is the volume ID
+func buildPersistentVolume(v *rest.GetVolumeResponse, opts *manifestOptions) (*corev1.PersistentVolume, error) {
+
+	name := opts.name
+
+	if name == "" {
+		name = v.Name
+	}
+
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid PersistentVolume name %q, set one with --pv-name: %s", name, strings.Join(errs, ", "))
+	}
+
+	accessMode := corev1.PersistentVolumeAccessMode(opts.accessMode)
+
+	switch accessMode {
+	case corev1.ReadWriteOnce, corev1.ReadOnlyMany, corev1.ReadWriteMany:
+	default:
+		return nil, fmt.Errorf("invalid access mode %q", opts.accessMode)
+	}
+
+	volumeMode := corev1.PersistentVolumeMode(opts.volumeMode)
+
+	switch volumeMode {
+	case corev1.PersistentVolumeFilesystem, corev1.PersistentVolumeBlock:
+	default:
+		return nil, fmt.Errorf("invalid volume mode %q", opts.volumeMode)
+	}
+
+	// As CreateVolume requires, only a VHD Set may be written by several nodes, and only as a block device
+	if accessMode == corev1.ReadWriteMany {
+		if !v.Shared {
+			return nil, fmt.Errorf("volume %s is not shared, so cannot be ReadWriteMany", v.Name)
+		}
+
+		if volumeMode != corev1.PersistentVolumeBlock {
+			return nil, fmt.Errorf("a ReadWriteMany volume must have volume mode %s", corev1.PersistentVolumeBlock)
+		}
+	}
+
+	reclaimPolicy := corev1.PersistentVolumeReclaimPolicy(opts.reclaimPolicy)
+
+	switch reclaimPolicy {
+	case corev1.PersistentVolumeReclaimRetain, corev1.PersistentVolumeReclaimDelete:
+	default:
+		return nil, fmt.Errorf("invalid reclaim policy %q", opts.reclaimPolicy)
+	}
+
+	pv := &corev1.PersistentVolume{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "PersistentVolume",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: corev1.PersistentVolumeSpec{
+			Capacity: corev1.ResourceList{
+				corev1.ResourceStorage: *resource.NewQuantity(v.Size, resource.BinarySI),
+			},
+			AccessModes:                   []corev1.PersistentVolumeAccessMode{accessMode},
+			VolumeMode:                    &volumeMode,
+			PersistentVolumeReclaimPolicy: reclaimPolicy,
+			StorageClassName:              opts.storageClass,
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:       opts.driver,
+					VolumeHandle: v.ID,
+					FSType:       opts.fsType,
+				},
+			},
+		},
+	}
+
+	if v.Shared {
+		// As set by CreateVolume, so the node attaches the VHD Set with persistent reservations
+		pv.Spec.CSI.VolumeAttributes = map[string]string{"shared": "true"}
+	}
+
+	if opts.claim != "" {
+		namespace, claimName, found := strings.Cut(opts.claim, "/")
+
+		if !found || namespace == "" || claimName == "" {
+			return nil, fmt.Errorf("invalid claim %q, must be NAMESPACE/NAME", opts.claim)
+		}
+
+		pv.Spec.ClaimRef = &corev1.ObjectReference{
+			Namespace: namespace,
+			Name:      claimName,
+		}
+	}
+
+	return pv, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// adoptClient serves AdoptVolume, recording its arguments
+type adoptClient struct {
+	hyperv.Client
+	id        string
+	path      string
+	namespace string
+}
+
+func (c *adoptClient) AdoptVolume(_ context.Context, name, path, namespace string) (*rest.GetVolumeResponse, error) {
+
+	c.path = path
+	c.namespace = namespace
+
+	return &rest.GetVolumeResponse{
+		Name: name,
+		ID:   c.id,
+		Size: 10 * constants.GiB,
+	}, nil
+}
+
+func defaultManifestOptions() *manifestOptions {
+
+	return &manifestOptions{
+		driver:        constants.DriverName,
+		accessMode:    string(corev1.ReadWriteOnce),
+		volumeMode:    string(corev1.PersistentVolumeFilesystem),
+		reclaimPolicy: string(corev1.PersistentVolumeReclaimRetain),
+	}
+}
+
+func TestBuildPersistentVolume(t *testing.T) {
+
+	v := &rest.GetVolumeResponse{
+		Name: "data",
+		ID:   uuid.NewString(),
+		Size: 10 * constants.GiB,
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		pv, err := buildPersistentVolume(v, defaultManifestOptions())
+
+		require.NoError(t, err)
+		require.Equal(t, "data", pv.Name)
+		require.Equal(t, constants.DriverName, pv.Spec.CSI.Driver)
+		require.Equal(t, v.ID, pv.Spec.CSI.VolumeHandle)
+		require.True(t, resource.NewQuantity(v.Size, resource.BinarySI).Equal(pv.Spec.Capacity[corev1.ResourceStorage]))
+		require.Equal(t, corev1.PersistentVolumeReclaimRetain, pv.Spec.PersistentVolumeReclaimPolicy)
+		require.Nil(t, pv.Spec.ClaimRef)
+		require.Nil(t, pv.Spec.CSI.VolumeAttributes)
+	})
+
+	t.Run("shared", func(t *testing.T) {
+		shared := *v
+		shared.Shared = true
+
+		pv, err := buildPersistentVolume(&shared, defaultManifestOptions())
+
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"shared": "true"}, pv.Spec.CSI.VolumeAttributes)
+	})
+
+	t.Run("shared ReadWriteMany", func(t *testing.T) {
+		shared := *v
+		shared.Shared = true
+		opts := defaultManifestOptions()
+		opts.accessMode = string(corev1.ReadWriteMany)
+		opts.volumeMode = string(corev1.PersistentVolumeBlock)
+
+		pv, err := buildPersistentVolume(&shared, opts)
+
+		require.NoError(t, err)
+		require.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}, pv.Spec.AccessModes)
+	})
+
+	t.Run("shared ReadWriteMany filesystem", func(t *testing.T) {
+		shared := *v
+		shared.Shared = true
+		opts := defaultManifestOptions()
+		opts.accessMode = string(corev1.ReadWriteMany)
+
+		_, err := buildPersistentVolume(&shared, opts)
+
+		require.Error(t, err)
+	})
+
+	t.Run("claim", func(t *testing.T) {
+		opts := defaultManifestOptions()
+		opts.claim = "apps/data"
+
+		pv, err := buildPersistentVolume(v, opts)
+
+		require.NoError(t, err)
+		require.Equal(t, &corev1.ObjectReference{Namespace: "apps", Name: "data"}, pv.Spec.ClaimRef)
+	})
+
+	invalid := map[string]func(*manifestOptions){
+		"PV name":        func(o *manifestOptions) { o.name = "Data_1" },
+		"access mode":    func(o *manifestOptions) { o.accessMode = "ReadWriteSometimes" },
+		"volume mode":    func(o *manifestOptions) { o.volumeMode = "File" },
+		"reclaim policy": func(o *manifestOptions) { o.reclaimPolicy = "Recycle" },
+		"claim":          func(o *manifestOptions) { o.claim = "data" },
+		"ReadWriteMany": func(o *manifestOptions) {
+			o.accessMode = string(corev1.ReadWriteMany)
+			o.volumeMode = string(corev1.PersistentVolumeBlock)
+		},
+	}
+
+	for name, modify := range invalid {
+		t.Run("invalid "+name, func(t *testing.T) {
+			opts := defaultManifestOptions()
+			modify(opts)
+
+			_, err := buildPersistentVolume(v, opts)
+
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestVolumesAdoptCommand(t *testing.T) {
+
+	const path = `D:\VMs\old-vm\data.vhdx`
+
+	c := &adoptClient{id: uuid.NewString()}
+
+	origNewClient := newClient
+	newClient = func(*config) (hyperv.Client, error) { return c, nil }
+	t.Cleanup(func() { newClient = origNewClient })
+
+	t.Setenv(urlEnvVar, "https://hyperv:8443")
+	t.Setenv(apiKeyEnvVar, "api-key")
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetArgs([]string{"volumes", "adopt", "data", "--path", path, "--claim", "apps/data", "-c", ""})
+	t.Cleanup(func() { rootCmd.SetOut(nil) })
+
+	require.NoError(t, rootCmd.ExecuteContext(t.Context()))
+	require.Equal(t, path, c.path)
+	require.Equal(t, "apps", c.namespace)
+
+	pv := &corev1.PersistentVolume{}
+	require.NoError(t, yaml.UnmarshalStrict(out.Bytes(), pv))
+	require.Equal(t, "PersistentVolume", pv.Kind)
+	require.Equal(t, c.id, pv.Spec.CSI.VolumeHandle)
+	require.Equal(t, "data", pv.Spec.ClaimRef.Name)
+}
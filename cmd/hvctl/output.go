@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// printer writes the responses of the service in the selected output format
+type printer struct {
+	format string
+	w      io.Writer
+}
+
+func newPrinter(format string, w io.Writer) (*printer, error) {
+
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return &printer{format: format, w: w}, nil
+	default:
+		return nil, fmt.Errorf("invalid output format %q, must be table, json or yaml", format)
+	}
+}
+
+// print writes v as JSON or YAML, or as a table of the rows written by the given function.
+// JSON and YAML use the field names of the REST API.
+func (p *printer) print(v any, rows func(t *table)) error {
+
+	switch p.format {
+	case outputJSON:
+		b, err := json.MarshalIndent(v, "", "  ")
+
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(p.w, string(b))
+		return err
+
+	case outputYAML:
+		b, err := yaml.Marshal(v)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = p.w.Write(b)
+		return err
+
+	default:
+		t := &table{tw: tabwriter.NewWriter(p.w, 0, 0, 3, ' ', 0)}
+		rows(t)
+		return t.tw.Flush()
+	}
+}
+
+// message writes a confirmation of an operation which returns nothing.
+// It is only written for table output, so that JSON and YAML output may be piped.
+func (p *printer) message(format string, args ...any) error {
+
+	if p.format != outputTable {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(p.w, format+"\n", args...)
+	return err
+}
+
+// table is a tab aligned table of columns
+type table struct {
+	tw *tabwriter.Writer
+}
+
+// row writes a row of the table
+func (t *table) row(columns ...any) {
+
+	cells := make([]string, 0, len(columns))
+
+	for _, c := range columns {
+		cells = append(cells, fmt.Sprint(c))
+	}
+
+	_, _ = fmt.Fprintln(t.tw, strings.Join(cells, "\t"))
+}
+
+// orNone returns the value of an optional string, or a placeholder if not set
+func orNone(s *string) string {
+
+	if s == nil || *s == "" {
+		return "<none>"
+	}
+
+	return *s
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fireflycons/hypervcsi/cmd/shared"
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configFlag             string
+	urlFlag                string
+	apiKeyFlag             string
+	caCertFlag             string
+	insecureSkipVerifyFlag bool
+	outputFlag             string
+	timeoutFlag            time.Duration
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "hvctl",
+	Short: "Administer the volumes of the Hyper-V CSI Windows service",
+	Long: `
+Calls the REST API of the khypervprovider Windows service to list, create and delete
+volumes, attach them to and detach them from VMs, and inspect the VMs and the capacity
+of the PV store.
+
+The connection is read from a YAML config file, by default hvctl/config.yaml in the
+user's config directory:
+
+` + "```yaml\nurl: https://hyperv-host:8443\napiKey: <API key>\ncaCert: /path/to/ca.pem\n```\n" + `
+The environment variables HVCTL_URL, HVCTL_API_KEY, HVCTL_CA_CERT and
+HVCTL_INSECURE_SKIP_VERIFY override the config file, and flags override both.`,
+}
+
+// newClient creates the client of the Windows service. It is replaced in tests.
+var newClient = func(cfg *config) (hyperv.Client, error) {
+
+	httpClient, err := cfg.httpClient()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return hyperv.NewClient(cfg.URL, httpClient, cfg.APIKey, nil)
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&configFlag, "config", "c", defaultConfigPath(), "Path to the config file")
+	rootCmd.PersistentFlags().StringVarP(&urlFlag, "url", "u", "", "URL of khypervprovider Windows Service")
+	rootCmd.PersistentFlags().StringVarP(&apiKeyFlag, "api-key", "k", "", "API key to access Hyper-V service backend")
+	rootCmd.PersistentFlags().StringVar(&caCertFlag, "ca-cert", "", "PEM file of certificate authorities to trust, e.g. for a self-signed service certificate")
+	rootCmd.PersistentFlags().BoolVar(&insecureSkipVerifyFlag, "insecure-skip-verify", false, "Do not verify the service certificate")
+	rootCmd.PersistentFlags().StringVarP(&outputFlag, "output", "o", outputTable, "Output format: table, json or yaml")
+	rootCmd.PersistentFlags().DurationVar(&timeoutFlag, "timeout", 2*time.Minute, "How long to wait for the service to complete the command, or 0 to wait indefinitely")
+
+	shared.InitDocCmd(rootCmd)
+}
+
+// runFunc is the implementation of a command which calls the Windows service
+type runFunc func(ctx context.Context, c hyperv.Client, out *printer, args []string) error
+
+// withClient wraps a command implementation, connecting it to the service
+// with the config file, environment and flags
+func withClient(f runFunc) func(*cobra.Command, []string) error {
+
+	return func(cmd *cobra.Command, args []string) error {
+
+		out, err := newPrinter(outputFlag, cmd.OutOrStdout())
+
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig(configFlag, cmd.Flags().Changed("config"))
+
+		if err != nil {
+			return err
+		}
+
+		flags := cmd.Flags()
+
+		if flags.Changed("url") {
+			cfg.URL = urlFlag
+		}
+
+		if flags.Changed("api-key") {
+			cfg.APIKey = apiKeyFlag
+		}
+
+		if flags.Changed("ca-cert") {
+			cfg.CACert = caCertFlag
+		}
+
+		if flags.Changed("insecure-skip-verify") {
+			cfg.InsecureSkipVerify = insecureSkipVerifyFlag
+		}
+
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+
+		c, err := newClient(cfg)
+
+		if err != nil {
+			return err
+		}
+
+		// Usage is not relevant to errors from the service
+		cmd.SilenceUsage = true
+
+		ctx := cmd.Context()
+
+		if timeoutFlag > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeoutFlag)
+			defer cancel()
+		}
+
+		return f(ctx, c, out, args)
+	}
+}
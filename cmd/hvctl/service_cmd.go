@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/spf13/cobra"
+)
+
+var capacityCmd = &cobra.Command{
+	Use:   "capacity",
+	Short: "Get the free space of the PV store",
+	Args:  cobra.NoArgs,
+	RunE: withClient(func(ctx context.Context, c hyperv.Client, out *printer, _ []string) error {
+
+		resp, err := c.GetCapacity(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		return out.print(resp, func(t *table) {
+			t.row("AVAILABLE", "MINIMUM VOLUME SIZE")
+			t.row(common.FormatBytes(resp.AvailableCapacity), common.FormatBytes(resp.MinimumVolumeSize))
+		})
+	}),
+}
+
+var healthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Check the health and version of the Windows service",
+	Args:  cobra.NoArgs,
+	RunE: withClient(func(ctx context.Context, c hyperv.Client, out *printer, _ []string) error {
+
+		resp, err := c.HealthCheck(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		return out.print(resp, func(t *table) {
+			t.row("STATUS", "VERSION")
+			t.row(resp.Status, resp.Version)
+		})
+	}),
+}
+
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "List the template VHDs from which volumes may be created",
+	Args:  cobra.NoArgs,
+	RunE: withClient(func(ctx context.Context, c hyperv.Client, out *printer, _ []string) error {
+
+		resp, err := c.ListTemplates(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		return out.print(resp, func(t *table) {
+			t.row("NAME", "SIZE", "FILE SIZE")
+
+			for _, tmpl := range resp.Templates {
+				t.row(tmpl.Name, common.FormatBytes(tmpl.Size), common.FormatBytes(tmpl.FileSize))
+			}
+		})
+	}),
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print version and exit",
+	Run: func(*cobra.Command, []string) {
+		common.PrintVersion()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(capacityCmd, healthCmd, templatesCmd, versionCmd)
+}
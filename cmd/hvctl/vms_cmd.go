@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/spf13/cobra"
+)
+
+var vmsCmd = &cobra.Command{
+	Use:     "vms",
+	Aliases: []string{"vm"},
+	Short:   "Inspect the VMs of the Hyper-V server",
+}
+
+var vmsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all VMs",
+	Args:  cobra.NoArgs,
+	RunE:  withClient(runVmsList),
+}
+
+var vmsGetCmd = &cobra.Command{
+	Use:   "get VM_ID",
+	Short: "Get a VM with its resources, SCSI controllers and network adapters",
+	Args:  cobra.ExactArgs(1),
+	RunE:  withClient(runVmsGet),
+}
+
+var vmsAttachmentsCmd = &cobra.Command{
+	Use:   "attachments VM_ID",
+	Short: "List the disks attached to the SCSI controllers of a VM",
+	Args:  cobra.ExactArgs(1),
+	RunE:  withClient(runVmsAttachments),
+}
+
+func init() {
+	vmsCmd.AddCommand(vmsListCmd, vmsGetCmd, vmsAttachmentsCmd)
+	rootCmd.AddCommand(vmsCmd)
+}
+
+func runVmsList(ctx context.Context, c hyperv.Client, out *printer, _ []string) error {
+
+	resp, err := c.ListVms(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return out.print(resp, func(t *table) {
+		t.row("ID", "NAME", "STATE", "UPTIME", "CPUS", "MEMORY", "VOLUMES")
+
+		for _, vm := range resp.VMs {
+			t.row(vm.ID, vm.Name, vm.State, vm.Uptime(), vm.ProcessorCount, common.FormatBytes(vm.MemoryAssigned), fmt.Sprintf("%d/%d", vm.VolumeDrives, vm.MaxVolumes()))
+		}
+	})
+}
+
+func runVmsGet(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+	vm, err := c.GetVm(ctx, args[0])
+
+	if err != nil {
+		return err
+	}
+
+	return out.print(vm, func(t *table) {
+		t.row("ID:", vm.ID)
+		t.row("Name:", vm.Name)
+		t.row("State:", vm.State)
+		t.row("Generation:", vm.Generation)
+		t.row("Uptime:", vm.Uptime())
+		t.row("Processors:", vm.ProcessorCount)
+		t.row("Memory:", common.FormatBytes(vm.MemoryAssigned))
+
+		if vm.DynamicMemoryEnabled {
+			t.row("Dynamic memory:", fmt.Sprintf("%s - %s, %s at startup",
+				common.FormatBytes(vm.MemoryMinimum), common.FormatBytes(vm.MemoryMaximum), common.FormatBytes(vm.MemoryStartup)))
+		}
+
+		t.row("SCSI controllers:", len(vm.ScsiControllers))
+		t.row("SCSI drives:", vm.ScsiDrives())
+		t.row("Volumes:", fmt.Sprintf("%d of %d", vm.VolumeDrives, vm.MaxVolumes()))
+
+		for _, a := range vm.NetworkAdapters {
+			switchName := a.SwitchName
+
+			if !a.Connected {
+				switchName = "<disconnected>"
+			}
+
+			t.row("Network adapter:", fmt.Sprintf("%s %s on %s %s", a.Name, a.MacAddress, switchName, strings.Join(a.IPAddresses, ",")))
+		}
+	})
+}
+
+func runVmsAttachments(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+	resp, err := c.ListVmAttachments(ctx, args[0])
+
+	if err != nil {
+		return err
+	}
+
+	return out.print(resp, func(t *table) {
+		t.row("CONTROLLER", "LOCATION", "NAME", "ID", "SIZE", "VOLUME", "SHARED")
+
+		for _, a := range resp.Attachments {
+			t.row(a.ControllerNumber, a.ControllerLocation, a.Name, a.DiskIdentifier, common.FormatBytes(a.Size), a.Volume, a.Shared)
+		}
+	})
+}
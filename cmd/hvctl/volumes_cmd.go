@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pageSizeFlag     int
+	sizeFlag         string
+	sharedFlag       bool
+	templateFlag     string
+	differencingFlag bool
+	namespaceFlag    string
+)
+
+var volumesCmd = &cobra.Command{
+	Use:     "volumes",
+	Aliases: []string{"volume", "vol"},
+	Short:   "Manage the volumes in the PV store",
+}
+
+var volumesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all volumes, fetching every page",
+	Args:  cobra.NoArgs,
+	RunE:  withClient(runVolumesList),
+}
+
+var volumesGetCmd = &cobra.Command{
+	Use:   "get VOLUME_ID",
+	Short: "Get a volume",
+	Args:  cobra.ExactArgs(1),
+	RunE:  withClient(runVolumesGet),
+}
+
+var volumesStatusCmd = &cobra.Command{
+	Use:   "status VOLUME_ID",
+	Short: "Get the attachments and condition of a volume",
+	Args:  cobra.ExactArgs(1),
+	RunE:  withClient(runVolumesStatus),
+}
+
+var volumesCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create a volume",
+	Args:  cobra.ExactArgs(1),
+	RunE:  withClient(runVolumesCreate),
+}
+
+var volumesDeleteCmd = &cobra.Command{
+	Use:   "delete VOLUME_ID",
+	Short: "Delete a volume, which must not be attached",
+	Args:  cobra.ExactArgs(1),
+	RunE:  withClient(runVolumesDelete),
+}
+
+var volumesExpandCmd = &cobra.Command{
+	Use:   "expand VOLUME_ID",
+	Short: "Expand a volume to a new size",
+	Args:  cobra.ExactArgs(1),
+	RunE:  withClient(runVolumesExpand),
+}
+
+func init() {
+	volumesListCmd.Flags().IntVar(&pageSizeFlag, "page-size", 100, "Number of volumes to fetch per request")
+
+	volumesCreateCmd.Flags().StringVarP(&sizeFlag, "size", "s", "", "Size of the volume in bytes, or with a binary suffix, e.g. 10Gi")
+	volumesCreateCmd.Flags().BoolVar(&sharedFlag, "shared", false, "Create a VHD Set that may be attached to several VMs at once")
+	volumesCreateCmd.Flags().StringVar(&templateFlag, "template", "", "Name of a template VHD from which to create the volume")
+	volumesCreateCmd.Flags().BoolVar(&differencingFlag, "differencing", false, "Create a differencing disk whose parent is the template")
+	volumesCreateCmd.Flags().StringVar(&namespaceFlag, "namespace", "", "Kubernetes namespace against whose quota the volume is counted")
+	_ = volumesCreateCmd.MarkFlagRequired("size")
+
+	volumesExpandCmd.Flags().StringVarP(&sizeFlag, "size", "s", "", "New size of the volume in bytes, or with a binary suffix, e.g. 20Gi")
+	_ = volumesExpandCmd.MarkFlagRequired("size")
+
+	volumesCmd.AddCommand(volumesListCmd, volumesGetCmd, volumesStatusCmd, volumesCreateCmd, volumesDeleteCmd, volumesExpandCmd)
+	rootCmd.AddCommand(volumesCmd)
+}
+
+var errRepeatedToken = errors.New("the service returned the same next token twice")
+
+// listAllVolumes fetches every page of volumes, following the next token
+func listAllVolumes(ctx context.Context, c hyperv.Client, pageSize int) ([]*models.GetVHDResponse, error) {
+
+	var (
+		volumes   []*models.GetVHDResponse
+		nextToken string
+	)
+
+	for {
+		resp, err := c.ListVolumes(ctx, pageSize, nextToken)
+
+		if err != nil {
+			return nil, err
+		}
+
+		volumes = append(volumes, resp.Volumes...)
+
+		if resp.NextToken == "" {
+			return volumes, nil
+		}
+
+		if resp.NextToken == nextToken {
+			return nil, errRepeatedToken
+		}
+
+		nextToken = resp.NextToken
+	}
+}
+
+func runVolumesList(ctx context.Context, c hyperv.Client, out *printer, _ []string) error {
+
+	volumes, err := listAllVolumes(ctx, c, pageSizeFlag)
+
+	if err != nil {
+		return err
+	}
+
+	return out.print(&rest.ListVolumesResponse{Volumes: volumes}, func(t *table) {
+		t.row("ID", "NAME", "SIZE", "FILE SIZE", "SHARED", "ATTACHED TO")
+
+		for _, v := range volumes {
+			t.row(v.DiskIdentifier, v.Name, common.FormatBytes(v.Size), common.FormatBytes(v.FileSize), v.Shared, orNone(v.Host))
+		}
+	})
+}
+
+func printVolume(out *printer, v *rest.GetVolumeResponse) error {
+
+	return out.print(v, func(t *table) {
+		t.row("ID", "NAME", "SIZE", "SHARED", "ATTACHED TO")
+		t.row(v.ID, v.Name, common.FormatBytes(v.Size), v.Shared, orNone(v.Host))
+	})
+}
+
+func runVolumesGet(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+	v, err := c.GetVolume(ctx, args[0])
+
+	if err != nil {
+		return err
+	}
+
+	return printVolume(out, v)
+}
+
+func runVolumesStatus(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+	s, err := c.GetVolumeStatus(ctx, args[0])
+
+	if err != nil {
+		return err
+	}
+
+	return out.print(s, func(t *table) {
+
+		attachments := make([]string, 0, len(s.Attachments))
+
+		for _, a := range s.Attachments {
+			if a.ReadOnly {
+				attachments = append(attachments, a.NodeID+" (ro)")
+			} else {
+				attachments = append(attachments, a.NodeID)
+			}
+		}
+
+		if len(attachments) == 0 {
+			attachments = append(attachments, "<none>")
+		}
+
+		condition := "Healthy"
+
+		if s.Condition.Abnormal {
+			condition = "Abnormal: " + s.Condition.Message
+		}
+
+		t.row("ID", "NAME", "SIZE", "ATTACHED TO", "CONDITION")
+		t.row(s.ID, s.Name, common.FormatBytes(s.Size), strings.Join(attachments, ","), condition)
+	})
+}
+
+func runVolumesCreate(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+	size, err := common.ParseBytes(sizeFlag)
+
+	if err != nil {
+		return fmt.Errorf("invalid size %q: %w", sizeFlag, err)
+	}
+
+	v, err := c.CreateVolume(ctx, args[0], size, rest.CreateVolumeOptions{
+		Shared:       sharedFlag,
+		Template:     templateFlag,
+		Differencing: differencingFlag,
+		Namespace:    namespaceFlag,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return printVolume(out, v)
+}
+
+func runVolumesDelete(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+	if err := c.DeleteVolume(ctx, args[0]); err != nil {
+		return err
+	}
+
+	return out.message("volume %s deleted", args[0])
+}
+
+func runVolumesExpand(ctx context.Context, c hyperv.Client, out *printer, args []string) error {
+
+	size, err := common.ParseBytes(sizeFlag)
+
+	if err != nil {
+		return fmt.Errorf("invalid size %q: %w", sizeFlag, err)
+	}
+
+	resp, err := c.ExpandVolume(ctx, args[0], size)
+
+	if err != nil {
+		return err
+	}
+
+	return out.print(resp, func(t *table) {
+		t.row("ID", "SIZE", "NODE EXPANSION REQUIRED")
+		t.row(args[0], common.FormatBytes(resp.CapacityBytes), resp.NodeExpansionRequired)
+	})
+}
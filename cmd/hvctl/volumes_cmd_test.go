@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+// fakeClient serves ListVolumes from a fixed set of volumes.
+// Calling any other method panics.
+type fakeClient struct {
+	hyperv.Client
+	volumes []*models.GetVHDResponse
+	calls   int
+}
+
+func (f *fakeClient) ListVolumes(_ context.Context, maxEntries int, nextToken string) (*rest.ListVolumesResponse, error) {
+
+	f.calls++
+
+	start := 0
+
+	if nextToken != "" {
+		var err error
+
+		if start, err = strconv.Atoi(nextToken); err != nil {
+			return nil, err
+		}
+	}
+
+	end := min(start+maxEntries, len(f.volumes))
+	resp := &rest.ListVolumesResponse{Volumes: f.volumes[start:end]}
+
+	if end < len(f.volumes) {
+		resp.NextToken = strconv.Itoa(end)
+	}
+
+	return resp, nil
+}
+
+func newFakeClient(n int) *fakeClient {
+
+	f := &fakeClient{}
+
+	for i := range n {
+		f.volumes = append(f.volumes, &models.GetVHDResponse{
+			Name:           "pvc-" + strconv.Itoa(i),
+			DiskIdentifier: uuid.NewString(),
+			Size:           1 << 30,
+		})
+	}
+
+	return f
+}
+
+func TestListAllVolumes(t *testing.T) {
+
+	f := newFakeClient(25)
+
+	volumes, err := listAllVolumes(t.Context(), f, 10)
+
+	require.NoError(t, err)
+	require.Equal(t, f.volumes, volumes)
+	require.Equal(t, 3, f.calls)
+}
+
+type repeatingClient struct {
+	hyperv.Client
+}
+
+func (repeatingClient) ListVolumes(context.Context, int, string) (*rest.ListVolumesResponse, error) {
+	return &rest.ListVolumesResponse{NextToken: "1"}, nil
+}
+
+func TestListAllVolumesRepeatedToken(t *testing.T) {
+
+	_, err := listAllVolumes(t.Context(), repeatingClient{}, 10)
+
+	require.ErrorIs(t, err, errRepeatedToken)
+}
+
+func TestVolumesListCommand(t *testing.T) {
+
+	f := newFakeClient(3)
+
+	origNewClient := newClient
+	newClient = func(*config) (hyperv.Client, error) { return f, nil }
+	t.Cleanup(func() { newClient = origNewClient })
+
+	t.Setenv(urlEnvVar, "https://hyperv:8443")
+	t.Setenv(apiKeyEnvVar, "api-key")
+
+	run := func(format string) []byte {
+		t.Helper()
+
+		var out bytes.Buffer
+		rootCmd.SetOut(&out)
+		rootCmd.SetArgs([]string{"volumes", "list", "--page-size", "2", "-o", format, "-c", ""})
+		t.Cleanup(func() { rootCmd.SetOut(nil) })
+
+		require.NoError(t, rootCmd.ExecuteContext(t.Context()))
+		return out.Bytes()
+	}
+
+	table := string(run(outputTable))
+	require.Contains(t, table, "ATTACHED TO")
+	require.Contains(t, table, f.volumes[2].DiskIdentifier)
+	require.Contains(t, table, "1Gi")
+
+	resp := &rest.ListVolumesResponse{}
+	require.NoError(t, json.Unmarshal(run(outputJSON), resp))
+	require.Equal(t, f.volumes, resp.Volumes)
+
+	resp = &rest.ListVolumesResponse{}
+	require.NoError(t, yaml.Unmarshal(run(outputYAML), resp))
+	require.Equal(t, f.volumes, resp.Volumes)
+}
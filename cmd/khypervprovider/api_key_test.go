@@ -0,0 +1,75 @@
+//go:build windows
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/windows/controller"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApiKeyMiddleware(t *testing.T) {
+
+	const (
+		apiKey     = "api-key"
+		nodeApiKey = "node-api-key"
+	)
+
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(apiKeyMiddleware(logrus.New(), apiKey, nodeApiKey))
+
+	ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+
+	router.GET("/", ok)
+	router.GET("/healthz", ok)
+	router.GET("/volumes", ok)
+	// Requests made with the node key are marked for the routes to check the caller
+	router.DELETE(ephemeralPathPrefix+":nodeid/volume/:name", func(ctx *gin.Context) {
+		if ctx.GetBool(controller.NodeCallerKey) {
+			ctx.Status(http.StatusAccepted)
+			return
+		}
+
+		ctx.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		key      string
+		expected int
+	}{
+		{name: "root without key", method: http.MethodGet, path: "/", expected: http.StatusOK},
+		{name: "health check without key", method: http.MethodGet, path: "/healthz", expected: http.StatusOK},
+		{name: "volumes without key", method: http.MethodGet, path: "/volumes", expected: http.StatusForbidden},
+		{name: "volumes with wrong key", method: http.MethodGet, path: "/volumes", key: "wrong", expected: http.StatusForbidden},
+		{name: "volumes with key", method: http.MethodGet, path: "/volumes", key: apiKey, expected: http.StatusOK},
+		{name: "volumes with node key", method: http.MethodGet, path: "/volumes", key: nodeApiKey, expected: http.StatusForbidden},
+		{name: "ephemeral volume with node key", method: http.MethodDelete, path: ephemeralPathPrefix + "node/volume/pv1", key: nodeApiKey, expected: http.StatusAccepted},
+		{name: "ephemeral volume with key", method: http.MethodDelete, path: ephemeralPathPrefix + "node/volume/pv1", key: apiKey, expected: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, http.NoBody)
+
+			if tt.key != "" {
+				req.Header.Set(constants.ApiKeyHeader, tt.key)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
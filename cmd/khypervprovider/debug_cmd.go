@@ -39,6 +39,7 @@ func init() {
 
 	debugCmd.Flags().Uint32VarP(&portFlag, "port", "p", constants.DefaultServicePort, "Port services listens on")
 	debugCmd.Flags().StringVarP(&apiKeyFlag, "api-key", "k", "debug", "API key to assert on REST interface")
+	debugCmd.Flags().StringVar(&nodeApiKeyFlag, "node-api-key", "debug-node", "API key to assert on REST interface for ephemeral volume requests from nodes")
 
 	rootCmd.AddCommand(debugCmd)
 }
@@ -27,6 +27,7 @@ var (
 	certFlag                  string
 	keyFlag                   string
 	pvDirectoryFlag           string
+	templateDirectoryFlag     string
 	distinguishedNameCAFlag   string
 	distinguishedNameCertFlag string
 )
@@ -47,6 +48,16 @@ If you omit this flag, the service will locate the locally attached drive with
 the most free storage and create directory "Kubernetes Persistent Volumes" at
 its root.
 
+Use --templates to specify where the service finds template VHDs from which
+volumes may be created. If you omit this flag, templates are read from the
+directory "Templates" within the PV store directory.
+
+VHDs are created as dynamic disks which only use space as they are written to,
+so by default far more storage may be provisioned than the disk can hold. Use
+--overcommit-ratio to limit the total size of all volumes to a multiple of the
+size of the disk, --reserved-space to keep space free on the disk, and
+--namespace-quota to limit the total size of the volumes of a namespace.
+
 `,
 
 	Run: executeInstall,
@@ -61,6 +72,10 @@ func init() {
 	installCmd.Flags().StringVarP(&certFlag, "cert", "c", "", "Provided certificate to use for HTTPS serving")
 	installCmd.Flags().StringVarP(&keyFlag, "key", "k", "", "Key associated with the provided certificate")
 	installCmd.Flags().StringVarP(&pvDirectoryFlag, "directory", "d", "", "Directory to store PV disks in. Omit to have the service choose.")
+	installCmd.Flags().StringVar(&templateDirectoryFlag, "templates", "", "Directory containing template VHDs. Omit to use the Templates directory in the PV store.")
+	installCmd.Flags().Float64Var(&overcommitRatioFlag, "overcommit-ratio", 0, "Maximum ratio of the total size of all volumes to the size of the PV store disk. Omit for no limit.")
+	installCmd.Flags().StringVar(&reservedSpaceFlag, "reserved-space", "", "Space on the PV store disk that must remain free, e.g. 50Gi. Omit for no reservation.")
+	installCmd.Flags().StringToStringVar(&namespaceQuotaFlag, "namespace-quota", nil, "Maximum total size of the volumes of a namespace as namespace=size, e.g. team-a=100Gi. May be repeated.")
 
 	installCmd.MarkFlagsRequiredTogether("cert", "key")
 	installCmd.MarkFlagsMutuallyExclusive("ssl", "cert")
@@ -103,6 +118,28 @@ func doInstall() error { //nolint:gocyclo // not worth splitting up
 			}...)
 	}
 
+	//nolint:govet // intentional redeclaration of err
+	if _, err := storageLimits(); err != nil {
+		return err
+	}
+
+	serviceArgs = append(serviceArgs, storageLimitArgs()...)
+
+	if templateDirectoryFlag != "" {
+		//nolint:govet // intentional redeclaration of err
+		if err := os.MkdirAll(templateDirectoryFlag, 0755); err != nil {
+			if !errors.Is(err, os.ErrExist) {
+				return fmt.Errorf("cannot create directory %s: %w", templateDirectoryFlag, err)
+			}
+		}
+
+		serviceArgs = append(
+			serviceArgs, []string{
+				"--templates",
+				templateDirectoryFlag,
+			}...)
+	}
+
 	assertElevatedPrivilege()
 
 	//nolint:govet // intentional redeclaration of err
@@ -146,13 +183,16 @@ func doInstall() error { //nolint:gocyclo // not worth splitting up
 		return fmt.Errorf("service %s already exists", constants.ServiceName)
 	}
 
-	// Generate a random API key
+	// Generate random API keys. The node key is limited to ephemeral volumes.
 	apiKey := uuid.NewString()
+	nodeApiKey := uuid.NewString()
 
 	serviceArgs = append(
 		serviceArgs, []string{
 			"--api-key",
 			apiKey,
+			"--node-api-key",
+			nodeApiKey,
 		}...)
 
 	if portFlag != constants.DefaultServicePort {
@@ -216,10 +256,12 @@ func doInstall() error { //nolint:gocyclo // not worth splitting up
 	psmodule.InstallLog.Printf(`Service Installed with the following configuration:
 
 API Key         : %s
+Node API Key    : %s
 Service Endpoint: %s
 
 `,
 		apiKey,
+		nodeApiKey,
 		endpoint,
 	)
 
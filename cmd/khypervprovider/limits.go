@@ -0,0 +1,79 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/windows/controller"
+)
+
+var (
+	overcommitRatioFlag float64
+	reservedSpaceFlag   string
+	namespaceQuotaFlag  map[string]string
+)
+
+// storageLimits builds the storage limits from the command line flags
+func storageLimits() (controller.StorageLimits, error) {
+
+	limits := controller.StorageLimits{
+		OvercommitRatio: overcommitRatioFlag,
+		NamespaceQuotas: map[string]int64{},
+	}
+
+	if overcommitRatioFlag < 0 {
+		return limits, errors.New("--overcommit-ratio cannot be negative")
+	}
+
+	if reservedSpaceFlag != "" {
+		reserved, err := common.ParseBytes(reservedSpaceFlag)
+		if err != nil {
+			return limits, fmt.Errorf("invalid --reserved-space %q: %w", reservedSpaceFlag, err)
+		}
+
+		limits.ReservedBytes = reserved
+	}
+
+	for namespace, v := range namespaceQuotaFlag {
+		quota, err := common.ParseBytes(v)
+		if err != nil {
+			return limits, fmt.Errorf("invalid --namespace-quota for %s %q: %w", namespace, v, err)
+		}
+
+		limits.NamespaceQuotas[namespace] = quota
+	}
+
+	return limits, nil
+}
+
+// storageLimitArgs returns the command line arguments that pass the storage limits to the service
+func storageLimitArgs() []string {
+
+	args := []string{}
+
+	if overcommitRatioFlag > 0 {
+		args = append(args, "--overcommit-ratio", strconv.FormatFloat(overcommitRatioFlag, 'f', -1, 64))
+	}
+
+	if reservedSpaceFlag != "" {
+		args = append(args, "--reserved-space", reservedSpaceFlag)
+	}
+
+	namespaces := make([]string, 0, len(namespaceQuotaFlag))
+	for namespace := range namespaceQuotaFlag {
+		namespaces = append(namespaces, namespace)
+	}
+
+	sort.Strings(namespaces)
+
+	for _, namespace := range namespaces {
+		args = append(args, "--namespace-quota", namespace+"="+namespaceQuotaFlag[namespace])
+	}
+
+	return args
+}
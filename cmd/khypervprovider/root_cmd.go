@@ -36,8 +36,9 @@ import (
 )
 
 var (
-	portFlag   uint32
-	apiKeyFlag string
+	portFlag       uint32
+	apiKeyFlag     string
+	nodeApiKeyFlag string
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -75,9 +76,14 @@ func init() {
 
 	rootCmd.Flags().Uint32Var(&portFlag, "port", constants.DefaultServicePort, "Port services listens on")
 	rootCmd.Flags().StringVar(&apiKeyFlag, "api-key", "", "API key to assert on REST interface")
+	rootCmd.Flags().StringVar(&nodeApiKeyFlag, "node-api-key", "", "API key to assert on REST interface for ephemeral volume requests from nodes. Omit to disable ephemeral volumes.")
 	rootCmd.Flags().StringVar(&certFlag, "cert", "", "Certificate to use for HTTPS serving")
 	rootCmd.Flags().StringVar(&keyFlag, "key", "", "Key to use for HTTPS serving")
 	rootCmd.Flags().StringVar(&pvDirectoryFlag, "directory", "", "Directory to store PV disks in. Omit to have the service choose.")
+	rootCmd.Flags().StringVar(&templateDirectoryFlag, "templates", "", "Directory containing template VHDs. Omit to use the Templates directory in the PV store.")
+	rootCmd.Flags().Float64Var(&overcommitRatioFlag, "overcommit-ratio", 0, "Maximum ratio of the total size of all volumes to the size of the PV store disk. Omit for no limit.")
+	rootCmd.Flags().StringVar(&reservedSpaceFlag, "reserved-space", "", "Space on the PV store disk that must remain free, e.g. 50Gi. Omit for no reservation.")
+	rootCmd.Flags().StringToStringVar(&namespaceQuotaFlag, "namespace-quota", nil, "Maximum total size of the volumes of a namespace as namespace=size, e.g. team-a=100Gi. May be repeated.")
 
 	shared.InitDocCmd(rootCmd)
 	shared.InitSysinfoCmd(rootCmd)
@@ -104,7 +104,14 @@ func runService(name string, isDebug bool) {
 		run = debug.Run
 	}
 
-	cntrl, err := controller.NewController(logger, pvDirectoryFlag)
+	limits, err := storageLimits()
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("%s service failed: %v", name, err))
+		return
+	}
+
+	cntrl, err := controller.NewController(logger, pvDirectoryFlag, templateDirectoryFlag, limits)
 
 	if err != nil {
 		logger.Error(fmt.Sprintf("%s service failed: %v", name, err))
@@ -152,7 +159,7 @@ func (s *hyperVService) serve(ctx context.Context, changes chan<- svc.Status, ca
 func (s *hyperVService) runServer(changes chan<- svc.Status, cancel context.CancelFunc) *http.Server {
 
 	router := gin.New()
-	router.Use(apiKeyMiddleware(s.Logger(), apiKeyFlag), gin.Recovery())
+	router.Use(apiKeyMiddleware(s.Logger(), apiKeyFlag, nodeApiKeyFlag), gin.Recovery())
 
 	// Add Swagger
 	swaggerui.SwaggerInfo.BasePath = "/"
@@ -163,7 +170,11 @@ func (s *hyperVService) runServer(changes chan<- svc.Status, cancel context.Canc
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 	router.GET("/volume/:name", s.controller.HandleGetVolume)
+	router.GET("/volume/:name/status", s.controller.HandleGetVolumeStatus)
+	router.GET("/volume/:name/content", s.controller.HandleExportVolume)
+	router.PUT("/volume/:id/content", s.controller.HandleImportVolume)
 	router.POST("/volume/:name/size/:size", s.controller.HandleCreateVolume)
+	router.POST("/volume/:name/adopt", s.controller.HandleAdoptVolume)
 	router.DELETE("/volume/:id", s.controller.HandleDeleteVolume)
 	router.PUT("/volume/:id/size/:size", s.controller.HandleExpandVolume)
 	router.GET("/volumes", s.controller.HandleListVolumes)
@@ -173,6 +184,10 @@ func (s *hyperVService) runServer(changes chan<- svc.Status, cancel context.Canc
 	router.GET("/healthz", s.controller.HandleHealthCheck)
 	router.GET("/vms", s.controller.HandleListVMs)
 	router.GET("/vm", s.controller.HandleGetVM)
+	router.GET("/vm/:id/attachments", s.controller.HandleListVMAttachments)
+	router.GET("/templates", s.controller.HandleListTemplates)
+	router.PUT(ephemeralPathPrefix+":nodeid/volume/:name/size/:size", s.controller.HandleCreateEphemeralVolume)
+	router.DELETE(ephemeralPathPrefix+":nodeid/volume/:name", s.controller.HandleDeleteEphemeralVolume)
 	router.GET("/", func(ctx *gin.Context) {
 		ctx.Redirect(http.StatusFound, "/swagger/index.html")
 	})
@@ -221,16 +236,31 @@ func (s *hyperVService) runServer(changes chan<- svc.Status, cancel context.Canc
 	return httpServer
 }
 
+// ephemeralPathPrefix is the prefix of the routes that may be called with the node API key
+const ephemeralPathPrefix = "/ephemeral/"
+
+// nodeRoute checks whether a route may be called with the node API key. These are the ephemeral
+// volume routes, and getting a VM, which the node plugin uses to find how many volumes it can attach.
+func nodeRoute(method, path string) bool {
+	return strings.HasPrefix(path, ephemeralPathPrefix) || (method == http.MethodGet && path == "/vm")
+}
+
 // apiKeyMiddleware is a Gin middleware that checks for a valid API key
 // in the "X-Api-Key" header of incoming requests.
+// The node API key, if set, is only valid for the routes the node plugin calls.
 // If the API key is missing or invalid, it aborts the request with a 403 Forbidden response.
-func apiKeyMiddleware(logger *logrus.Logger, apiKey string) gin.HandlerFunc {
+func apiKeyMiddleware(logger *logrus.Logger, apiKey, nodeApiKey string) gin.HandlerFunc {
 
 	return func(ctx *gin.Context) {
 
+		path := ctx.Request.URL.Path
+
 		needApiKey := func() bool {
-			path := ctx.Request.URL.Path
-			for _, p := range []string{"/", "/swagger", "/healthz"} {
+			if path == "/" {
+				return false
+			}
+
+			for _, p := range []string{"/swagger", "/healthz"} {
 				if p == path || strings.HasPrefix(path, p) {
 					return false
 				}
@@ -238,10 +268,28 @@ func apiKeyMiddleware(logger *logrus.Logger, apiKey string) gin.HandlerFunc {
 			return true
 		}()
 
+		validKey := func(key string) bool {
+			if key == "" {
+				return false
+			}
+
+			if strings.EqualFold(key, apiKey) {
+				return true
+			}
+
+			if nodeApiKey != "" && strings.EqualFold(key, nodeApiKey) && nodeRoute(ctx.Request.Method, path) {
+				// The routes check that the caller is the node it acts for
+				ctx.Set(controller.NodeCallerKey, true)
+				return true
+			}
+
+			return false
+		}
+
 		if needApiKey {
 			key := ctx.Request.Header.Get(constants.ApiKeyHeader)
 
-			if key == "" || !strings.EqualFold(key, apiKey) {
+			if !validKey(key) {
 				remoteAddr := func() string {
 					switch {
 					case ctx.ClientIP() != "":
@@ -0,0 +1,42 @@
+package common
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+)
+
+// byteSuffixes are the binary quantity suffixes accepted by ParseBytes
+var byteSuffixes = map[string]int64{
+	"Ki": constants.KiB,
+	"Mi": constants.MiB,
+	"Gi": constants.GiB,
+	"Ti": constants.TiB,
+}
+
+// ParseBytes parses a byte count with an optional binary suffix, e.g. 512Mi or 10Gi.
+// It is the inverse of FormatBytes for whole numbers.
+func ParseBytes(s string) (int64, error) {
+	multiplier := int64(1)
+	for suffix, m := range byteSuffixes {
+		if strings.HasSuffix(s, suffix) {
+			s = strings.TrimSuffix(s, suffix)
+			multiplier = m
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errors.New("must be a whole number of bytes with an optional suffix of Ki, Mi, Gi or Ti")
+	}
+
+	if n < 0 || n > math.MaxInt64/multiplier {
+		return 0, errors.New("size is out of range")
+	}
+
+	return n * multiplier, nil
+}
@@ -0,0 +1,60 @@
+package common_test
+
+import (
+	"testing"
+
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{
+			name:  "bytes",
+			input: "512",
+			want:  512,
+		},
+		{
+			name:  "mebibytes",
+			input: "5Mi",
+			want:  5 * 1024 * 1024,
+		},
+		{
+			name:  "gibibytes",
+			input: "10Gi",
+			want:  10 * 1024 * 1024 * 1024,
+		},
+		{
+			name:    "decimal suffix",
+			input:   "10G",
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			input:   "-1Gi",
+			wantErr: true,
+		},
+		{
+			name:    "overflow",
+			input:   "9999999999Ti",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := common.ParseBytes(tt.input)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
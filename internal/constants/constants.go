@@ -39,12 +39,28 @@ const (
 const (
 	// Default VHD format
 	VhdType = ".vhdx"
+
+	// Prefix of the names of VHDs created for CSI ephemeral inline volumes
+	EphemeralVolumePrefix = "ephemeral-"
+
+	// Directory within the PV store that holds template VHDs,
+	// unless the service is given a different directory
+	TemplatesDirectory = "Templates"
+
+	// Number of locations on a Hyper-V SCSI controller to which disks may be attached
+	ScsiLocationsPerController = 64
 )
 
 const (
 	DefaultServicePort = 8080
 )
 
+const (
+	// DriverName is the name of the CSI driver in Kubernetes,
+	// unless the driver is given a different name
+	DriverName = "hyperv.csi.fireflycons.io"
+)
+
 const (
 	RepoName         = "khyperv-csi"
 	PowerShellModule = RepoName
@@ -53,4 +69,8 @@ const (
 const (
 	//nolint:gosec // this is a header name not a value
 	ApiKeyHeader = "X-Api-Key"
+
+	// ReprDigestHeader carries the SHA-256 digest of the whole VHDX of an exported
+	// volume as defined by RFC 9530, so it applies to every range of the content
+	ReprDigestHeader = "Repr-Digest"
 )
@@ -0,0 +1,45 @@
+package hyperv
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+func (s *ClientTestSuite) TestAdoptVolume() {
+
+	const path = `D:\VMs\old-vm\data.vhdx`
+
+	expected := &rest.GetVolumeResponse{
+		Name: "data",
+		ID:   uuid.NewString(),
+		Size: 10 * constants.GiB,
+	}
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(req *http.Request) bool {
+		return req.Method == "POST" &&
+			req.URL.Path == "/volume/data/adopt" &&
+			req.URL.Query().Get("path") == path &&
+			req.URL.Query().Get("namespace") == "ns1"
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusCreated,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(
+					s.MustMarshalJSON(expected),
+				),
+			},
+		},
+		nil,
+	)
+
+	actual, err := s.client.AdoptVolume(context.Background(), "data", path, "ns1")
+
+	s.Require().NoError(err)
+	s.Require().Equal(expected, actual)
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/fireflycons/hypervcsi/internal/constants"
 	"github.com/fireflycons/hypervcsi/internal/models/rest"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
 )
 
 const (
@@ -26,8 +27,8 @@ const (
 
 type Client interface {
 
-	// CreateVolume creates a new VHD with the given name and size
-	CreateVolume(ctx context.Context, name string, sizeBytes int64) (*rest.GetVolumeResponse, error)
+	// CreateVolume creates a new VHD with the given name, size and options
+	CreateVolume(ctx context.Context, name string, sizeBytes int64, opts rest.CreateVolumeOptions) (*rest.GetVolumeResponse, error)
 
 	// DeleteVolume deletes a VHD with the given ID
 	DeleteVolume(ctx context.Context, volumeId string) error
@@ -35,14 +36,17 @@ type Client interface {
 	// GetVolume retrieves a VHD with the given ID
 	GetVolume(ctx context.Context, volumeId string) (*rest.GetVolumeResponse, error)
 
+	// GetVolumeStatus retrieves the attachment and health condition of a VHD with the given ID
+	GetVolumeStatus(ctx context.Context, volumeId string) (*rest.GetVolumeStatusResponse, error)
+
 	// ListVolumes returns a list of provisioned VHDs
 	ListVolumes(ctx context.Context, maxEntries int, nextToken string) (*rest.ListVolumesResponse, error)
 
 	// GetCapacity returns the free space remaining for provisioning new VHDs
 	GetCapacity(ctx context.Context) (*rest.GetCapacityResponse, error)
 
-	// PublishVolume mounts a volume to a node
-	PublishVolume(ctx context.Context, volumeId, nodeId string) error
+	// PublishVolume mounts a volume to a node, optionally read-only
+	PublishVolume(ctx context.Context, volumeId, nodeId string, readOnly bool) error
 
 	// UnpublishVolume dismounts a volume from a node
 	UnpublishVolume(ctx context.Context, volumeId, nodeId string) error
@@ -56,8 +60,35 @@ type Client interface {
 	// GetVm gets the VM with the given ID
 	GetVm(ctx context.Context, nodeId string) (*rest.GetVMResponse, error)
 
+	// GetVmByBIOSGUID gets the VM with the given BIOS GUID, which its guest reads as the BIOS UUID
+	GetVmByBIOSGUID(ctx context.Context, biosGuid string) (*rest.GetVMResponse, error)
+
+	// ListVmAttachments returns the disks attached to the SCSI controllers of the VM with the given ID
+	ListVmAttachments(ctx context.Context, nodeId string) (*rest.ListVMAttachmentsResponse, error)
+
 	// HealthCheck performs a health check on the Hyper-V REST service
 	HealthCheck(ctx context.Context) (*rest.HealthyResponse, error)
+
+	// CreateEphemeralVolume creates a VHD for a CSI ephemeral inline volume and attaches it to a node
+	CreateEphemeralVolume(ctx context.Context, name, nodeId string, sizeBytes int64) (*rest.GetVolumeResponse, error)
+
+	// DeleteEphemeralVolume detaches the VHD for a CSI ephemeral inline volume from a node and deletes it
+	DeleteEphemeralVolume(ctx context.Context, name, nodeId string) error
+
+	// ListTemplates returns a list of the template VHDs from which volumes may be created
+	ListTemplates(ctx context.Context) (*rest.ListTemplatesResponse, error)
+
+	// ExportVolume streams the VHDX of an unattached volume from the given offset, which resumes an interrupted export
+	ExportVolume(ctx context.Context, volumeId string, offset int64) (*VolumeContent, error)
+
+	// ImportVolume uploads a VHDX of the given size as a new volume from the given offset, which resumes an interrupted import
+	ImportVolume(ctx context.Context, name, namespace string, content io.Reader, offset, size int64) (*rest.GetVolumeResponse, error)
+
+	// GetImportOffset returns how many bytes of a VHDX of the given size have been received for a volume being imported
+	GetImportOffset(ctx context.Context, name string, size int64) (int64, error)
+
+	// AdoptVolume moves an existing VHDX on the Hyper-V host into the PV store as a volume with the given name
+	AdoptVolume(ctx context.Context, name, path, namespace string) (*rest.GetVolumeResponse, error)
 }
 
 type noResult struct{}
@@ -89,8 +120,8 @@ func NewClient(baseURL string, httpClient httpClient, apiKey string, logger *log
 
 var errNegativeValue = errors.New("argument value cannot be negative")
 
-// CreateVolume creates a new VHD with the given name and size
-func (c client) CreateVolume(ctx context.Context, name string, sizeBytes int64) (*rest.GetVolumeResponse, error) {
+// CreateVolume creates a new VHD with the given name, size and options
+func (c client) CreateVolume(ctx context.Context, name string, sizeBytes int64, opts rest.CreateVolumeOptions) (*rest.GetVolumeResponse, error) {
 
 	if sizeBytes < 0 {
 		return nil, errNegativeValue
@@ -100,9 +131,50 @@ func (c client) CreateVolume(ctx context.Context, name string, sizeBytes int64)
 		Path: "volume/" + name + "/size/" + strconv.FormatInt(sizeBytes, 10),
 	})
 
+	query := url.Values{}
+
+	if opts.Shared {
+		query.Set("shared", "true")
+	}
+
+	if opts.Template != "" {
+		query.Set("template", opts.Template)
+	}
+
+	if opts.Differencing {
+		query.Set("differencing", "true")
+	}
+
+	if opts.Namespace != "" {
+		query.Set("namespace", opts.Namespace)
+	}
+
+	target.RawQuery = query.Encode()
+
 	return apiCall[*rest.GetVolumeResponse](ctx, c, "create volume", target, "POST")
 }
 
+// AdoptVolume moves an existing VHDX on the Hyper-V host, e.g. a disk of an older VM, into the PV store as a volume
+// with the given name. If a namespace is given, the volume is counted against its quota.
+func (c client) AdoptVolume(ctx context.Context, name, path, namespace string) (*rest.GetVolumeResponse, error) {
+
+	target := c.addr.ResolveReference(&url.URL{
+		Path: "volume/" + name + "/adopt",
+	})
+
+	query := url.Values{
+		"path": {path},
+	}
+
+	if namespace != "" {
+		query.Set("namespace", namespace)
+	}
+
+	target.RawQuery = query.Encode()
+
+	return apiCall[*rest.GetVolumeResponse](ctx, c, "adopt volume", target, "POST")
+}
+
 // DeleteVolume deletes a VHD with the given ID
 func (c client) DeleteVolume(ctx context.Context, volumeId string) error {
 
@@ -123,6 +195,16 @@ func (c client) GetVolume(ctx context.Context, volumeId string) (*rest.GetVolume
 	return apiCall[*rest.GetVolumeResponse](ctx, c, "get volume", target, "GET")
 }
 
+// GetVolumeStatus retrieves the attachment and health condition of a VHD with the given ID
+func (c client) GetVolumeStatus(ctx context.Context, volumeId string) (*rest.GetVolumeStatusResponse, error) {
+
+	target := c.addr.ResolveReference(&url.URL{
+		Path: "volume/" + volumeId + "/status",
+	})
+
+	return apiCall[*rest.GetVolumeStatusResponse](ctx, c, "get volume status", target, "GET")
+}
+
 // ListVolumes returns a list of provisioned VHDs
 func (c client) ListVolumes(ctx context.Context, maxEntries int, nextToken string) (*rest.ListVolumesResponse, error) {
 
@@ -161,11 +243,21 @@ func (c client) ListVms(ctx context.Context) (*rest.ListVMResponse, error) {
 	return apiCall[*rest.ListVMResponse](ctx, c, "list vms", target, "GET")
 }
 
+// ListTemplates returns a list of the template VHDs from which volumes may be created
+func (c client) ListTemplates(ctx context.Context) (*rest.ListTemplatesResponse, error) {
+
+	target := c.addr.ResolveReference(&url.URL{
+		Path: "templates",
+	})
+
+	return apiCall[*rest.ListTemplatesResponse](ctx, c, "list templates", target, "GET")
+}
+
 // GetVm gets the VM with the given ID
 func (c client) GetVm(ctx context.Context, nodeId string) (*rest.GetVMResponse, error) {
 
 	target := c.addr.ResolveReference(&url.URL{
-		Path: "vms",
+		Path: "vm",
 		RawQuery: url.Values{
 			"id": {nodeId},
 		}.Encode(),
@@ -175,6 +267,29 @@ func (c client) GetVm(ctx context.Context, nodeId string) (*rest.GetVMResponse,
 
 }
 
+// GetVmByBIOSGUID gets the VM with the given BIOS GUID, which its guest reads as the BIOS UUID
+func (c client) GetVmByBIOSGUID(ctx context.Context, biosGuid string) (*rest.GetVMResponse, error) {
+
+	target := c.addr.ResolveReference(&url.URL{
+		Path: "vm",
+		RawQuery: url.Values{
+			"biosguid": {biosGuid},
+		}.Encode(),
+	})
+
+	return apiCall[*rest.GetVMResponse](ctx, c, "get vm", target, "GET")
+}
+
+// ListVmAttachments returns the disks attached to the SCSI controllers of the VM with the given ID
+func (c client) ListVmAttachments(ctx context.Context, nodeId string) (*rest.ListVMAttachmentsResponse, error) {
+
+	target := c.addr.ResolveReference(&url.URL{
+		Path: "vm/" + nodeId + "/attachments",
+	})
+
+	return apiCall[*rest.ListVMAttachmentsResponse](ctx, c, "list vm attachments", target, "GET")
+}
+
 type publishOp int
 
 const (
@@ -182,16 +297,16 @@ const (
 	unpublish
 )
 
-// PublishVolume mounts a volume to a node
-func (c client) PublishVolume(ctx context.Context, volumeId, nodeId string) error {
+// PublishVolume mounts a volume to a node, optionally read-only
+func (c client) PublishVolume(ctx context.Context, volumeId, nodeId string, readOnly bool) error {
 
-	return c.publisher(ctx, volumeId, nodeId, publish)
+	return c.publisher(ctx, volumeId, nodeId, publish, readOnly)
 }
 
 // UnpublishVolume dismounts a volume from a node
 func (c client) UnpublishVolume(ctx context.Context, volumeId, nodeId string) error {
 
-	return c.publisher(ctx, volumeId, nodeId, unpublish)
+	return c.publisher(ctx, volumeId, nodeId, unpublish, false)
 }
 
 // ExpandVolume expands a volume to the given new size
@@ -218,7 +333,32 @@ func (c client) HealthCheck(ctx context.Context) (*rest.HealthyResponse, error)
 	return apiCall[*rest.HealthyResponse](ctx, c, "health check", target, "GET")
 }
 
-func (c client) publisher(ctx context.Context, volumeId, nodeId string, op publishOp) error {
+// CreateEphemeralVolume creates a VHD for a CSI ephemeral inline volume and attaches it to a node
+func (c client) CreateEphemeralVolume(ctx context.Context, name, nodeId string, sizeBytes int64) (*rest.GetVolumeResponse, error) {
+
+	if sizeBytes < 0 {
+		return nil, errNegativeValue
+	}
+
+	target := c.addr.ResolveReference(&url.URL{
+		Path: "ephemeral/" + nodeId + "/volume/" + name + "/size/" + strconv.FormatInt(sizeBytes, 10),
+	})
+
+	return apiCall[*rest.GetVolumeResponse](ctx, c, "create ephemeral volume", target, "PUT")
+}
+
+// DeleteEphemeralVolume detaches the VHD for a CSI ephemeral inline volume from a node and deletes it
+func (c client) DeleteEphemeralVolume(ctx context.Context, name, nodeId string) error {
+
+	target := c.addr.ResolveReference(&url.URL{
+		Path: "ephemeral/" + nodeId + "/volume/" + name,
+	})
+
+	_, err := apiCall[*noResult](ctx, c, "delete ephemeral volume", target, "DELETE")
+	return err
+}
+
+func (c client) publisher(ctx context.Context, volumeId, nodeId string, op publishOp, readOnly bool) error {
 
 	method, opName := func() (string, string) {
 		if op == publish {
@@ -231,6 +371,12 @@ func (c client) publisher(ctx context.Context, volumeId, nodeId string, op publi
 		Path: "attachment/" + nodeId + "/volume/" + volumeId,
 	})
 
+	if readOnly {
+		target.RawQuery = url.Values{
+			"readonly": {"true"},
+		}.Encode()
+	}
+
 	_, err := apiCall[*noResult](ctx, c, opName+" volume", target, method)
 	return err
 }
@@ -247,7 +393,25 @@ func apiCall[T *Q, Q any](ctx context.Context, c client, operation string, targe
 		defer cancel()
 	}
 
-	request, err := http.NewRequestWithContext(requestCtx, method, target.String(), http.NoBody)
+	request, err := c.newRequest(requestCtx, operation, method, target, http.NoBody)
+
+	if err != nil {
+		return nil, err
+	}
+
+	httpResponse, err := c.do(operation, request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeResponse[T](operation, httpResponse)
+}
+
+// newRequest creates a request to the service, authorized with the API key
+func (c client) newRequest(ctx context.Context, operation, method string, target *url.URL, body io.Reader) (*http.Request, error) {
+
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), body)
 
 	if err != nil {
 		return nil, fmt.Errorf("%s: cannot create request: %w", operation, err)
@@ -255,6 +419,12 @@ func apiCall[T *Q, Q any](ctx context.Context, c client, operation string, targe
 
 	request.Header.Set(constants.ApiKeyHeader, c.apiKey)
 
+	return request, nil
+}
+
+// do sends a request to the service. An error response is returned as a *rest.Error.
+func (c client) do(operation string, request *http.Request) (*http.Response, error) {
+
 	if c.logger != nil {
 		c.logger.WithFields(logrus.Fields{
 			"curl":      requestToCurl(request),
@@ -268,27 +438,38 @@ func apiCall[T *Q, Q any](ctx context.Context, c client, operation string, targe
 		return nil, fmt.Errorf("%s: error making request: %w", operation, err)
 	}
 
-	var bodyData []byte
-
-	if httpResponse.Body != nil {
+	if httpResponse.StatusCode < http.StatusBadRequest {
+		return httpResponse, nil
+	}
 
-		bodyData, err = io.ReadAll(httpResponse.Body)
+	if httpResponse.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// Returned by streaming routes, which do not return a JSON error
 		_ = httpResponse.Body.Close()
+		return nil, rest.NewError(codes.OutOfRange, "the requested offset is beyond the end of the content")
+	}
 
-		if err != nil {
-			return nil, fmt.Errorf("%s: error reading result: %w", operation, err)
-		}
+	bodyData, err := readBody(httpResponse)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: error reading result: %w", operation, err)
 	}
 
-	if httpResponse.StatusCode >= http.StatusBadRequest {
+	errorObj := &rest.Error{}
 
-		errorObj := &rest.Error{}
+	if err := json.Unmarshal(bodyData, errorObj); err != nil {
+		return nil, fmt.Errorf("%s: error unmarshaling error response: %w", operation, err)
+	}
 
-		if err := json.Unmarshal(bodyData, errorObj); err != nil {
-			return nil, fmt.Errorf("%s: error unmarshaling error response: %w", operation, err)
-		}
+	return nil, errorObj
+}
 
-		return nil, errorObj
+// decodeResponse reads the JSON body of a successful response
+func decodeResponse[T *Q, Q any](operation string, httpResponse *http.Response) (T, error) {
+
+	bodyData, err := readBody(httpResponse)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: error reading result: %w", operation, err)
 	}
 
 	var q Q
@@ -304,6 +485,17 @@ func apiCall[T *Q, Q any](ctx context.Context, c client, operation string, targe
 	return apiResponse, nil
 }
 
+func readBody(httpResponse *http.Response) ([]byte, error) {
+
+	if httpResponse.Body == nil {
+		return nil, nil
+	}
+
+	defer httpResponse.Body.Close()
+
+	return io.ReadAll(httpResponse.Body)
+}
+
 func requestToCurl(req *http.Request) string {
 
 	if req == nil {
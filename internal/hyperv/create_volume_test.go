@@ -35,7 +35,106 @@ func (s *ClientTestSuite) TestCreateVolume() {
 		nil,
 	)
 
-	actual, err := s.client.CreateVolume(context.Background(), "test", size)
+	actual, err := s.client.CreateVolume(context.Background(), "test", size, rest.CreateVolumeOptions{})
+
+	s.Require().NoError(err)
+	s.Require().Equal(expected, actual)
+}
+
+func (s *ClientTestSuite) TestCreateSharedVolume() {
+
+	var (
+		id   = uuid.NewString()
+		size = int64(constants.MiB * 10)
+	)
+
+	expected := &rest.GetVolumeResponse{
+		ID:     id,
+		Size:   size,
+		Shared: true,
+	}
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(req *http.Request) bool {
+		return req.Method == "POST" && req.URL.Query().Get("shared") == "true"
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusCreated,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(
+					s.MustMarshalJSON(expected),
+				),
+			},
+		},
+		nil,
+	)
+
+	actual, err := s.client.CreateVolume(context.Background(), "test", size, rest.CreateVolumeOptions{Shared: true})
+
+	s.Require().NoError(err)
+	s.Require().Equal(expected, actual)
+}
+
+func (s *ClientTestSuite) TestCreateVolumeFromTemplate() {
+
+	var (
+		id   = uuid.NewString()
+		size = int64(constants.GiB)
+	)
+
+	expected := &rest.GetVolumeResponse{
+		ID:   id,
+		Size: size,
+	}
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(req *http.Request) bool {
+		q := req.URL.Query()
+		return req.Method == "POST" && q.Get("template") == "postgres-fixtures" && q.Get("differencing") == "true" &&
+			q.Get("namespace") == "team-a" && !q.Has("shared")
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusCreated,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(
+					s.MustMarshalJSON(expected),
+				),
+			},
+		},
+		nil,
+	)
+
+	actual, err := s.client.CreateVolume(context.Background(), "test", size, rest.CreateVolumeOptions{Template: "postgres-fixtures", Differencing: true, Namespace: "team-a"})
+
+	s.Require().NoError(err)
+	s.Require().Equal(expected, actual)
+}
+
+func (s *ClientTestSuite) TestListTemplates() {
+
+	expected := &rest.ListTemplatesResponse{
+		Templates: []rest.Template{
+			{
+				Name:     "postgres-fixtures",
+				Size:     constants.GiB,
+				FileSize: 200 * constants.MiB,
+			},
+		},
+	}
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(req *http.Request) bool {
+		return req.Method == "GET" && req.URL.Path == "/templates"
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusOK,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(
+					s.MustMarshalJSON(expected),
+				),
+			},
+		},
+		nil,
+	)
+
+	actual, err := s.client.ListTemplates(context.Background())
 
 	s.Require().NoError(err)
 	s.Require().Equal(expected, actual)
@@ -43,7 +142,7 @@ func (s *ClientTestSuite) TestCreateVolume() {
 
 func (s *ClientTestSuite) TestCreateVolumeNegativeSizeIsError() {
 
-	_, err := s.client.CreateVolume(context.Background(), "test", -1)
+	_, err := s.client.CreateVolume(context.Background(), "test", -1, rest.CreateVolumeOptions{})
 	s.Require().Error(err)
 	s.Require().ErrorIs(err, errNegativeValue)
 }
@@ -0,0 +1,67 @@
+package hyperv
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+func (s *ClientTestSuite) TestCreateEphemeralVolume() {
+
+	var (
+		id     = uuid.NewString()
+		nodeId = uuid.NewString()
+		size   = int64(constants.MiB * 10)
+	)
+
+	expected := &rest.GetVolumeResponse{
+		ID:   id,
+		Name: constants.EphemeralVolumePrefix + "csi-1234",
+		Size: size,
+	}
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(req *http.Request) bool {
+		return req.Method == "PUT" && strings.HasSuffix(req.URL.Path, "/ephemeral/"+nodeId+"/volume/csi-1234/size/10485760")
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusCreated,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(
+					s.MustMarshalJSON(expected),
+				),
+			},
+		},
+		nil,
+	)
+
+	actual, err := s.client.CreateEphemeralVolume(context.Background(), "csi-1234", nodeId, size)
+
+	s.Require().NoError(err)
+	s.Require().Equal(expected, actual)
+}
+
+func (s *ClientTestSuite) TestDeleteEphemeralVolume() {
+
+	nodeId := uuid.NewString()
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(req *http.Request) bool {
+		return req.Method == "DELETE" && strings.HasSuffix(req.URL.Path, "/ephemeral/"+nodeId+"/volume/csi-1234")
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusNoContent,
+			Body: &closeableBuffer{
+				buf: &bytes.Buffer{},
+			},
+		},
+		nil,
+	)
+
+	err := s.client.DeleteEphemeralVolume(context.Background(), "csi-1234", nodeId)
+	s.Require().NoError(err)
+}
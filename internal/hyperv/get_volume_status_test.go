@@ -0,0 +1,50 @@
+package hyperv
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+func (s *ClientTestSuite) TestGetVolumeStatus() {
+
+	var (
+		id     = uuid.NewString()
+		nodeId = uuid.NewString()
+	)
+
+	expected := &rest.GetVolumeStatusResponse{
+		Name: "pv1",
+		ID:   id,
+		Size: constants.MiB * 10,
+		Host: &nodeId,
+		Condition: rest.VolumeCondition{
+			Abnormal: true,
+			Message:  "integrity check failed",
+		},
+	}
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(r *http.Request) bool {
+		return r.Method == "GET" && r.URL.Path == "/volume/"+id+"/status"
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusOK,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(
+					s.MustMarshalJSON(expected),
+				),
+			},
+		},
+		nil,
+	)
+
+	actual, err := s.client.GetVolumeStatus(context.Background(), id)
+
+	s.Require().NoError(err)
+	s.Require().Equal(expected, actual)
+}
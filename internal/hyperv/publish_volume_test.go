@@ -26,6 +26,29 @@ func (s *ClientTestSuite) TestPublishVolume() {
 		nil,
 	)
 
-	err := s.client.PublishVolume(context.Background(), volId, nodeId)
+	err := s.client.PublishVolume(context.Background(), volId, nodeId, false)
+	s.Require().NoError(err)
+}
+
+func (s *ClientTestSuite) TestPublishVolumeReadOnly() {
+
+	var (
+		nodeId = uuid.NewString()
+		volId  = uuid.NewString()
+	)
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(req *http.Request) bool {
+		return req.Method == "PUT" && req.URL.Query().Get("readonly") == "true"
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusNoContent,
+			Body: &closeableBuffer{
+				buf: &bytes.Buffer{},
+			},
+		},
+		nil,
+	)
+
+	err := s.client.PublishVolume(context.Background(), volId, nodeId, true)
 	s.Require().NoError(err)
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/fireflycons/hypervcsi/internal/constants"
 	"github.com/fireflycons/hypervcsi/internal/models/rest"
@@ -49,6 +50,7 @@ func (s *ClientTestSuite) TestGetVms() {
 		ID:         constants.ZeroUUID,
 		Path:       "C:\\vms\\vm1",
 		Generation: 2,
+		State:      rest.VMStateRunning,
 	}
 
 	s.mockHttp.EXPECT().Do(mock.Anything).Return(
@@ -68,3 +70,193 @@ func (s *ClientTestSuite) TestGetVms() {
 	s.Require().NoError(err)
 	s.Require().Equal(expected, actual)
 }
+
+func (s *ClientTestSuite) TestGetVmNumericState() {
+
+	// ConvertTo-Json serializes the VMState enum as a number
+	s.mockHttp.EXPECT().Do(mock.Anything).Return(
+		&http.Response{
+			StatusCode: http.StatusOK,
+			Body: &closeableBuffer{
+				buf: bytes.NewBufferString(`{"Name":"vm1","Id":"` + constants.ZeroUUID + `","State":6}`),
+			},
+		},
+		nil,
+	)
+
+	actual, err := apiCall[*rest.GetVMResponse](context.Background(), s.client, "test", s.mustRequestURL(), "GET")
+
+	s.Require().NoError(err)
+	s.Require().Equal(rest.VMStateSaved, actual.State)
+	s.Require().True(actual.State.IsSaved())
+	s.Require().False(actual.State.IsStopped())
+}
+
+func (s *ClientTestSuite) TestGetVmScsiControllers() {
+
+	// Two controllers, with an OS disk and two volumes attached
+	s.mockHttp.EXPECT().Do(mock.Anything).Return(
+		&http.Response{
+			StatusCode: http.StatusOK,
+			Body: &closeableBuffer{
+				buf: bytes.NewBufferString(`{"Name":"vm1","Id":"` + constants.ZeroUUID + `","ScsiControllers":[` +
+					`{"ControllerNumber":0,"Drives":[{"ControllerLocation":0},{"ControllerLocation":1}]},` +
+					`{"ControllerNumber":1,"Drives":[{"ControllerLocation":0}]}],"VolumeDrives":2}`),
+			},
+		},
+		nil,
+	)
+
+	actual, err := apiCall[*rest.GetVMResponse](context.Background(), s.client, "test", s.mustRequestURL(), "GET")
+
+	s.Require().NoError(err)
+	s.Require().Len(actual.ScsiControllers, 2)
+	s.Require().Equal(3, actual.ScsiDrives())
+	s.Require().Equal(2*constants.ScsiLocationsPerController-3, actual.FreeScsiLocations())
+	s.Require().Equal(2*constants.ScsiLocationsPerController-1, actual.MaxVolumes())
+}
+
+func (s *ClientTestSuite) TestGetVmInventory() {
+
+	expected := &rest.GetVMResponse{
+		Name:                 "vm1",
+		ID:                   constants.ZeroUUID,
+		State:                rest.VMStateRunning,
+		UptimeSeconds:        3600,
+		ProcessorCount:       4,
+		MemoryAssigned:       4 * constants.GiB,
+		MemoryStartup:        2 * constants.GiB,
+		MemoryMinimum:        512 * constants.MiB,
+		MemoryMaximum:        8 * constants.GiB,
+		DynamicMemoryEnabled: true,
+		NetworkAdapters: []rest.VMNetworkAdapter{
+			{
+				Name:        "Network Adapter",
+				SwitchName:  "Default Switch",
+				MacAddress:  "00155D000001",
+				IPAddresses: []string{"172.20.0.10", "fe80::215:5dff:fe00:1"},
+				Connected:   true,
+			},
+		},
+	}
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(r *http.Request) bool {
+		return r.Method == "GET" && r.URL.Path == "/vm" && r.URL.Query().Get("id") == constants.ZeroUUID
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusOK,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(
+					s.MustMarshalJSON(expected),
+				),
+			},
+		},
+		nil,
+	)
+
+	actual, err := s.client.GetVm(context.Background(), constants.ZeroUUID)
+
+	s.Require().NoError(err)
+	s.Require().Equal(expected, actual)
+	s.Require().Equal(time.Hour, actual.Uptime())
+}
+
+func (s *ClientTestSuite) TestListVmAttachments() {
+
+	expected := &rest.ListVMAttachmentsResponse{
+		Attachments: []*rest.VMAttachment{
+			{
+				ControllerNumber:   0,
+				ControllerLocation: 0,
+				Path:               "C:\\vms\\vm1\\os.vhdx",
+				Name:               "os",
+				DiskIdentifier:     constants.ZeroUUID,
+				Size:               20 * constants.GiB,
+			},
+			{
+				ControllerNumber:   0,
+				ControllerLocation: 1,
+				Path:               "D:\\Kubernetes Persistent Volumes\\pv1;" + constants.ZeroUUID + ".vhdx",
+				Name:               "pv1",
+				DiskIdentifier:     constants.ZeroUUID,
+				Size:               10 * constants.MiB,
+				Volume:             true,
+			},
+		},
+	}
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(r *http.Request) bool {
+		return r.Method == "GET" && r.URL.Path == "/vm/"+constants.ZeroUUID+"/attachments"
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusOK,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(
+					s.MustMarshalJSON(expected),
+				),
+			},
+		},
+		nil,
+	)
+
+	actual, err := s.client.ListVmAttachments(context.Background(), constants.ZeroUUID)
+
+	s.Require().NoError(err)
+	s.Require().Equal(expected, actual)
+}
+
+func (s *ClientTestSuite) TestGetVm() {
+
+	expected := &rest.GetVMResponse{
+		Name:  "vm1",
+		ID:    constants.ZeroUUID,
+		State: rest.VMStateRunning,
+	}
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(r *http.Request) bool {
+		return r.Method == "GET" && r.URL.Path == "/vm" && r.URL.Query().Get("id") == constants.ZeroUUID
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusOK,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(
+					s.MustMarshalJSON(expected),
+				),
+			},
+		},
+		nil,
+	)
+
+	actual, err := s.client.GetVm(context.Background(), constants.ZeroUUID)
+
+	s.Require().NoError(err)
+	s.Require().Equal(expected, actual)
+}
+
+func (s *ClientTestSuite) TestGetVmByBIOSGUID() {
+
+	expected := &rest.GetVMResponse{
+		Name:     "vm1",
+		ID:       constants.ZeroUUID,
+		BIOSGUID: "12345678-1234-5678-9abc-def012345678",
+	}
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(r *http.Request) bool {
+		return r.Method == "GET" && r.URL.Path == "/vm" && r.URL.Query().Get("biosguid") == expected.BIOSGUID && !r.URL.Query().Has("id")
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusOK,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(
+					s.MustMarshalJSON(expected),
+				),
+			},
+		},
+		nil,
+	)
+
+	actual, err := s.client.GetVmByBIOSGUID(context.Background(), expected.BIOSGUID)
+
+	s.Require().NoError(err)
+	s.Require().Equal(expected, actual)
+}
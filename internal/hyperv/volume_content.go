@@ -0,0 +1,260 @@
+package hyperv
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+)
+
+// VolumeContent is the VHDX of a volume being exported. The caller must close it.
+type VolumeContent struct {
+	io.ReadCloser
+
+	// FileName is the name the service gives the VHDX
+	FileName string
+
+	// Offset in the VHDX of the start of the content
+	Offset int64
+
+	// Size of the whole VHDX
+	Size int64
+
+	// Digest is the SHA-256 digest of the whole VHDX, against
+	// which an export which has been resumed may be verified
+	Digest []byte
+}
+
+var (
+	errUnexpectedRange = errors.New("the service did not return the requested range")
+	errNoDigest        = errors.New("the service did not return a SHA-256 digest")
+)
+
+// ExportVolume streams the VHDX of an unattached volume from the given offset, which resumes an interrupted export
+func (c client) ExportVolume(ctx context.Context, volumeId string, offset int64) (*VolumeContent, error) {
+
+	const operation = "export volume"
+
+	if offset < 0 {
+		return nil, errNegativeValue
+	}
+
+	target := c.addr.ResolveReference(&url.URL{
+		Path: "volume/" + volumeId + "/content",
+	})
+
+	request, err := c.newRequest(ctx, operation, "GET", target, http.NoBody)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	httpResponse, err := c.do(operation, request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := readContentHeaders(httpResponse, offset)
+
+	if err != nil {
+		_ = httpResponse.Body.Close()
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+
+	return content, nil
+}
+
+func readContentHeaders(httpResponse *http.Response, offset int64) (*VolumeContent, error) {
+
+	content := &VolumeContent{
+		ReadCloser: httpResponse.Body,
+		Offset:     offset,
+	}
+
+	switch httpResponse.StatusCode {
+	case http.StatusOK:
+		if offset > 0 {
+			return nil, errUnexpectedRange
+		}
+
+		content.Size = httpResponse.ContentLength
+
+	case http.StatusPartialContent:
+		start, size, err := parseContentRange(httpResponse.Header.Get("Content-Range"))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if start != offset {
+			return nil, errUnexpectedRange
+		}
+
+		content.Size = size
+
+	default:
+		return nil, fmt.Errorf("unexpected status %s", httpResponse.Status)
+	}
+
+	digest, err := parseReprDigest(httpResponse.Header.Get(constants.ReprDigestHeader))
+
+	if err != nil {
+		return nil, err
+	}
+
+	content.Digest = digest
+
+	if _, params, err := mime.ParseMediaType(httpResponse.Header.Get("Content-Disposition")); err == nil {
+		content.FileName = params["filename"]
+	}
+
+	return content, nil
+}
+
+// parseContentRange parses the start and complete length from a Content-Range header of the form "bytes start-end/size"
+func parseContentRange(header string) (start, size int64, err error) {
+
+	rangeSpec, found := strings.CutPrefix(header, "bytes ")
+	startEnd, sizeSpec, found2 := strings.Cut(rangeSpec, "/")
+	startSpec, _, found3 := strings.Cut(startEnd, "-")
+
+	if !found || !found2 || !found3 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", header)
+	}
+
+	if start, err = strconv.ParseInt(startSpec, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q: %w", header, err)
+	}
+
+	if size, err = strconv.ParseInt(sizeSpec, 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q: %w", header, err)
+	}
+
+	return start, size, nil
+}
+
+// parseReprDigest finds the SHA-256 digest in a Repr-Digest header, e.g. "sha-256=:<base64>:"
+func parseReprDigest(header string) ([]byte, error) {
+
+	for _, member := range strings.Split(header, ",") {
+		value, found := strings.CutPrefix(strings.TrimSpace(member), "sha-256=:")
+
+		if !found {
+			continue
+		}
+
+		return base64.StdEncoding.DecodeString(strings.TrimSuffix(value, ":"))
+	}
+
+	return nil, errNoDigest
+}
+
+// ImportVolume uploads a VHDX of the given size as a new volume from the given offset, which resumes an interrupted import.
+// The content is read from the given offset of the VHDX to its end. If a namespace is given, the volume is counted against its quota.
+func (c client) ImportVolume(ctx context.Context, name, namespace string, content io.Reader, offset, size int64) (*rest.GetVolumeResponse, error) {
+
+	const operation = "import volume"
+
+	if offset < 0 || size < 0 {
+		return nil, errNegativeValue
+	}
+
+	if offset >= size {
+		return nil, fmt.Errorf("%s: offset %d is not within the VHDX of size %d", operation, offset, size)
+	}
+
+	request, err := c.newRequest(ctx, operation, "PUT", c.importTarget(name, namespace), content)
+
+	if err != nil {
+		return nil, err
+	}
+
+	request.ContentLength = size - offset
+	request.Header.Set("Content-Type", "application/octet-stream")
+	request.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, size-1, size))
+
+	httpResponse, err := c.do(operation, request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if httpResponse.StatusCode == http.StatusAccepted {
+		progress, err := decodeResponse[*rest.ImportVolumeProgress](operation, httpResponse)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%s: incomplete, %d of %d bytes were received", operation, progress.Received, progress.Size)
+	}
+
+	return decodeResponse[*rest.GetVolumeResponse](operation, httpResponse)
+}
+
+// GetImportOffset returns how many bytes of a VHDX of the given size have been received for a volume being imported.
+// If all of them have, the import is completed and the size is returned.
+func (c client) GetImportOffset(ctx context.Context, name string, size int64) (int64, error) {
+
+	const operation = "get import offset"
+
+	if size < 0 {
+		return 0, errNegativeValue
+	}
+
+	request, err := c.newRequest(ctx, operation, "PUT", c.importTarget(name, ""), http.NoBody)
+
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+
+	httpResponse, err := c.do(operation, request)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if httpResponse.StatusCode != http.StatusAccepted {
+		_ = httpResponse.Body.Close()
+		return size, nil
+	}
+
+	progress, err := decodeResponse[*rest.ImportVolumeProgress](operation, httpResponse)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return progress.Received, nil
+}
+
+func (c client) importTarget(name, namespace string) *url.URL {
+
+	target := c.addr.ResolveReference(&url.URL{
+		Path: "volume/" + name + "/content",
+	})
+
+	if namespace != "" {
+		target.RawQuery = url.Values{
+			"namespace": {namespace},
+		}.Encode()
+	}
+
+	return target
+}
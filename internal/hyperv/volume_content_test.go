@@ -0,0 +1,134 @@
+package hyperv
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/stretchr/testify/mock"
+)
+
+func (s *ClientTestSuite) TestExportVolumeResume() {
+
+	data := []byte("vhdxfile0123456789ab")
+	sum := sha256.Sum256(data)
+
+	header := http.Header{}
+	header.Set("Content-Range", "bytes 10-19/20")
+	header.Set("Content-Disposition", `attachment; filename="pv1.vhdx"`)
+	header.Set(constants.ReprDigestHeader, "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(r *http.Request) bool {
+		return r.Method == "GET" && r.URL.Path == "/volume/1/content" && r.Header.Get("Range") == "bytes=10-"
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusPartialContent,
+			Header:     header,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(data[10:]),
+			},
+		},
+		nil,
+	)
+
+	content, err := s.client.ExportVolume(context.Background(), "1", 10)
+
+	s.Require().NoError(err)
+	s.Require().Equal("pv1.vhdx", content.FileName)
+	s.Require().Equal(int64(10), content.Offset)
+	s.Require().Equal(int64(20), content.Size)
+	s.Require().Equal(sum[:], content.Digest)
+
+	b, err := io.ReadAll(content)
+	s.Require().NoError(err)
+	s.Require().Equal(data[10:], b)
+	s.Require().NoError(content.Close())
+}
+
+func (s *ClientTestSuite) TestExportVolumeRangeIgnored() {
+
+	s.mockHttp.EXPECT().Do(mock.Anything).Return(
+		&http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body: &closeableBuffer{
+				buf: &bytes.Buffer{},
+			},
+		},
+		nil,
+	)
+
+	_, err := s.client.ExportVolume(context.Background(), "1", 10)
+
+	s.Require().ErrorIs(err, errUnexpectedRange)
+}
+
+func (s *ClientTestSuite) TestImportVolume() {
+
+	expected := &rest.GetVolumeResponse{
+		Name: "pv1",
+		ID:   "1",
+		Size: constants.GiB,
+	}
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(r *http.Request) bool {
+		return r.Method == "PUT" && r.URL.Path == "/volume/pv1/content" && r.URL.Query().Get("namespace") == "ns1" &&
+			r.Header.Get("Content-Range") == "bytes 5-9/10" && r.ContentLength == 5
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusCreated,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(s.MustMarshalJSON(expected)),
+			},
+		},
+		nil,
+	)
+
+	actual, err := s.client.ImportVolume(context.Background(), "pv1", "ns1", strings.NewReader("56789"), 5, 10)
+
+	s.Require().NoError(err)
+	s.Require().Equal(expected, actual)
+}
+
+func (s *ClientTestSuite) TestImportVolumeIncomplete() {
+
+	s.mockHttp.EXPECT().Do(mock.Anything).Return(
+		&http.Response{
+			StatusCode: http.StatusAccepted,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(s.MustMarshalJSON(&rest.ImportVolumeProgress{Received: 7, Size: 10})),
+			},
+		},
+		nil,
+	)
+
+	_, err := s.client.ImportVolume(context.Background(), "pv1", "", strings.NewReader("56789"), 5, 10)
+
+	s.Require().ErrorContains(err, "7 of 10 bytes")
+}
+
+func (s *ClientTestSuite) TestGetImportOffset() {
+
+	s.mockHttp.EXPECT().Do(mock.MatchedBy(func(r *http.Request) bool {
+		return r.Method == "PUT" && r.Header.Get("Content-Range") == "bytes */10"
+	})).Return(
+		&http.Response{
+			StatusCode: http.StatusAccepted,
+			Body: &closeableBuffer{
+				buf: bytes.NewBuffer(s.MustMarshalJSON(&rest.ImportVolumeProgress{Received: 5, Size: 10})),
+			},
+		},
+		nil,
+	)
+
+	offset, err := s.client.GetImportOffset(context.Background(), "pv1", 10)
+
+	s.Require().NoError(err)
+	s.Require().Equal(int64(5), offset)
+}
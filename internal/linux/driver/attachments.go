@@ -0,0 +1,365 @@
+//go:build linux
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultStaleAttachmentDelay is how long an attachment must have had no
+// VolumeAttachment before it is detached
+const DefaultStaleAttachmentDelay = 10 * time.Minute
+
+// attachment identifies a volume attached to a node
+type attachment struct {
+	volumeId string
+	nodeId   string
+}
+
+// attachmentReconciler periodically compares the volumes attached to VMs by the
+// backend with the VolumeAttachment objects in the cluster that belong to this driver.
+// An attachment with no VolumeAttachment is stale, which can happen if the attacher
+// loses track of it, for instance when a node is deleted while volumes are attached.
+// A stale attachment stops the volume from being attached elsewhere, so it is detached
+// once it has been stale for the safety delay.
+//
+// Only read-write attachments are reconciled, as these are the attachments
+// the backend reports when listing volumes, and only attachments to VMs which
+// are nodes of this driver, so disks attached to other VMs are left alone.
+type attachmentReconciler struct {
+	hypervClient hyperv.Client
+	kubeClient   kubernetes.Interface
+	log          *logrus.Entry
+
+	// unpublish detaches a volume from a node
+	unpublish func(ctx context.Context, volumeId, nodeId string) error
+
+	driverName string
+	interval   time.Duration
+	delay      time.Duration
+	pageSize   int
+
+	// now returns the current time, and is replaced in tests
+	now func() time.Time
+
+	// firstSeen is when each stale attachment was first found
+	firstSeen map[attachment]time.Time
+
+	stale          prometheus.Gauge
+	detached       prometheus.Counter
+	detachFailures prometheus.Counter
+	scanFailures   prometheus.Counter
+}
+
+// attachmentReconcilerParams defines the parameters that can be passed to newAttachmentReconciler.
+type attachmentReconcilerParams struct {
+	HypervClient hyperv.Client
+	KubeClient   kubernetes.Interface
+	Unpublish    func(ctx context.Context, volumeId, nodeId string) error
+	Registerer   prometheus.Registerer
+	Log          *logrus.Entry
+	DriverName   string
+	Interval     time.Duration
+	Delay        time.Duration
+	PageSize     int
+}
+
+func newAttachmentReconciler(p *attachmentReconcilerParams) *attachmentReconciler {
+
+	r := &attachmentReconciler{
+		hypervClient: p.HypervClient,
+		kubeClient:   p.KubeClient,
+		unpublish:    p.Unpublish,
+		log:          p.Log.WithField("component", "attachment-reconciler"),
+		driverName:   p.DriverName,
+		interval:     p.Interval,
+		delay:        p.Delay,
+		pageSize:     p.PageSize,
+		now:          time.Now,
+		firstSeen:    map[attachment]time.Time{},
+		stale: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "hyperv_csi_stale_attachments",
+			Help: "Number of volumes attached to a VM with no VolumeAttachment.",
+		}),
+		detached: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hyperv_csi_stale_attachments_detached_total",
+			Help: "Number of stale attachments detached.",
+		}),
+		detachFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hyperv_csi_stale_attachment_detach_failures_total",
+			Help: "Number of failed attempts to detach a stale attachment.",
+		}),
+		scanFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hyperv_csi_attachment_scan_failures_total",
+			Help: "Number of scans for stale attachments that failed.",
+		}),
+	}
+
+	if r.delay <= 0 {
+		r.delay = DefaultStaleAttachmentDelay
+	}
+
+	p.Registerer.MustRegister(r.stale, r.detached, r.detachFailures, r.scanFailures)
+
+	return r
+}
+
+// Run scans for stale attachments at each interval until the context is cancelled.
+func (r *attachmentReconciler) Run(ctx context.Context) error {
+
+	r.log.WithFields(logrus.Fields{
+		"interval": r.interval,
+		"delay":    r.delay,
+	}).Info("starting stale attachment reconciler")
+
+	runPeriodically(ctx, r.interval, func(ctx context.Context) {
+		if err := r.reconcile(ctx); err != nil {
+			r.scanFailures.Inc()
+			r.log.WithError(err).Error("scan for stale attachments failed")
+		}
+	})
+
+	return nil
+}
+
+// reconcile makes one scan for stale attachments, detaching those
+// which have been stale for the safety delay.
+func (r *attachmentReconciler) reconcile(ctx context.Context) error {
+
+	// List the VolumeAttachments first, since the attacher creates a VolumeAttachment
+	// before the volume is attached. The delay covers a volume being attached
+	// between the two calls.
+	nodeIds, err := r.nodeIds(ctx)
+	if err != nil {
+		return err
+	}
+
+	expected, err := r.expectedAttachments(ctx, nodeIds)
+	if err != nil {
+		return err
+	}
+
+	nodes := make(map[string]struct{}, len(nodeIds))
+	for _, id := range nodeIds {
+		nodes[id] = struct{}{}
+	}
+
+	now := r.now()
+	seen := map[attachment]struct{}{}
+	token := ""
+
+	for {
+		resp, err := r.hypervClient.ListVolumes(ctx, r.pageSize, token)
+		if err != nil {
+			return fmt.Errorf("cannot list volumes: %w", err)
+		}
+
+		for _, vol := range resp.Volumes {
+
+			if vol.Host == nil {
+				continue
+			}
+
+			if _, ok := nodes[strings.ToLower(*vol.Host)]; !ok {
+				continue
+			}
+
+			// Ephemeral inline volumes are attached by the node plugin without a VolumeAttachment
+			if strings.HasPrefix(vol.Name, constants.EphemeralVolumePrefix) {
+				continue
+			}
+
+			if expectedNodes, ok := expected[strings.ToLower(vol.DiskIdentifier)]; ok {
+				if expectedNodes == nil {
+					continue
+				}
+
+				if _, ok := expectedNodes[strings.ToLower(*vol.Host)]; ok {
+					continue
+				}
+			}
+
+			a := attachment{volumeId: vol.DiskIdentifier, nodeId: *vol.Host}
+			seen[a] = struct{}{}
+
+			log := r.log.WithFields(logrus.Fields{
+				"volume_id":   a.volumeId,
+				"volume_name": vol.Name,
+				"node_id":     a.nodeId,
+			})
+
+			firstSeen, ok := r.firstSeen[a]
+			if !ok {
+				firstSeen = now
+				r.firstSeen[a] = now
+				log.Warn("found volume attached with no VolumeAttachment")
+			}
+
+			if now.Sub(firstSeen) < r.delay {
+				continue
+			}
+
+			if err := r.unpublish(ctx, a.volumeId, a.nodeId); err != nil {
+				r.detachFailures.Inc()
+				log.WithError(err).Error("cannot detach stale attachment")
+				continue
+			}
+
+			r.detached.Inc()
+			delete(r.firstSeen, a)
+			delete(seen, a)
+			log.WithField("stale_since", firstSeen.Format(time.RFC3339)).Info("detached stale attachment")
+		}
+
+		if resp.NextToken == "" {
+			break
+		}
+
+		token = resp.NextToken
+	}
+
+	// Forget attachments which have since been detached or gained a VolumeAttachment
+	for a := range r.firstSeen {
+		if _, ok := seen[a]; !ok {
+			delete(r.firstSeen, a)
+		}
+	}
+
+	r.stale.Set(float64(len(seen)))
+
+	return nil
+}
+
+// expectedAttachments returns the IDs of the nodes to which each volume should be attached
+// according to the VolumeAttachments of this driver, keyed by volume ID, given the node IDs
+// returned by nodeIds. Volume and node IDs are lower case. The set is nil for a volume with
+// a VolumeAttachment for a node whose ID cannot be found, as it is then not known which
+// attachments of the volume are expected.
+func (r *attachmentReconciler) expectedAttachments(ctx context.Context, nodeIds map[string]string) (map[string]map[string]struct{}, error) {
+
+	var attachments []attachmentSource
+	opts := metav1.ListOptions{Limit: kubeListPageSize}
+
+	for {
+		vas, err := r.kubeClient.StorageV1().VolumeAttachments().List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list volume attachments: %w", err)
+		}
+
+		for i := range vas.Items {
+			va := &vas.Items[i]
+
+			if va.Spec.Attacher != r.driverName {
+				continue
+			}
+
+			source := attachmentSource{nodeName: va.Spec.NodeName}
+
+			switch {
+			case va.Spec.Source.PersistentVolumeName != nil:
+				source.pvName = *va.Spec.Source.PersistentVolumeName
+			case va.Spec.Source.InlineVolumeSpec != nil && va.Spec.Source.InlineVolumeSpec.CSI != nil:
+				source.volumeId = va.Spec.Source.InlineVolumeSpec.CSI.VolumeHandle
+			default:
+				continue
+			}
+
+			attachments = append(attachments, source)
+		}
+
+		if vas.Continue == "" {
+			break
+		}
+
+		opts.Continue = vas.Continue
+	}
+
+	handles, err := volumeHandles(ctx, r.kubeClient, r.driverName)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := map[string]map[string]struct{}{}
+
+	for _, a := range attachments {
+
+		volumeId := a.volumeId
+		if a.pvName != "" {
+			if volumeId = handles[a.pvName]; volumeId == "" {
+				r.log.WithField("pv_name", a.pvName).Warn("VolumeAttachment refers to an unknown PersistentVolume")
+				continue
+			}
+		}
+
+		volumeId = strings.ToLower(volumeId)
+
+		nodes, ok := expected[volumeId]
+		if ok && nodes == nil {
+			continue
+		}
+
+		nodeId, ok := nodeIds[a.nodeName]
+		if !ok {
+			r.log.WithFields(logrus.Fields{
+				"volume_id": volumeId,
+				"node_name": a.nodeName,
+			}).Warn("VolumeAttachment refers to a node with no ID for this driver")
+			expected[volumeId] = nil
+			continue
+		}
+
+		if nodes == nil {
+			nodes = map[string]struct{}{}
+			expected[volumeId] = nodes
+		}
+
+		nodes[nodeId] = struct{}{}
+	}
+
+	return expected, nil
+}
+
+// attachmentSource is the volume and node of a VolumeAttachment
+type attachmentSource struct {
+	pvName   string
+	volumeId string
+	nodeName string
+}
+
+// nodeIds returns the lower case ID that this driver registered on each node, keyed by node name.
+func (r *attachmentReconciler) nodeIds(ctx context.Context) (map[string]string, error) {
+
+	ids := map[string]string{}
+	opts := metav1.ListOptions{Limit: kubeListPageSize}
+
+	for {
+		nodes, err := r.kubeClient.StorageV1().CSINodes().List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list CSI nodes: %w", err)
+		}
+
+		for i := range nodes.Items {
+			for _, d := range nodes.Items[i].Spec.Drivers {
+				if d.Name == r.driverName {
+					ids[nodes.Items[i].Name] = strings.ToLower(d.NodeID)
+				}
+			}
+		}
+
+		if nodes.Continue == "" {
+			return ids, nil
+		}
+
+		opts.Continue = nodes.Continue
+	}
+}
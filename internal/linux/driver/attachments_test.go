@@ -0,0 +1,152 @@
+//go:build linux
+
+package driver
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAttachmentReconciler(t *testing.T) {
+
+	var (
+		nodeA   = uuid.NewString()
+		nodeB   = uuid.NewString()
+		nodeC   = uuid.NewString()
+		otherVm = uuid.NewString()
+
+		attachedId  = uuid.NewString()
+		staleId     = uuid.NewString()
+		movedId     = uuid.NewString()
+		unknownId   = uuid.NewString()
+		ephemeralId = uuid.NewString()
+		otherVmId   = uuid.NewString()
+	)
+
+	newPV := func(name, handle string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{
+						Driver:       DefaultDriverName,
+						VolumeHandle: handle,
+					},
+				},
+			},
+		}
+	}
+
+	newVA := func(pvName, nodeName string) *storagev1.VolumeAttachment {
+		return &storagev1.VolumeAttachment{
+			ObjectMeta: metav1.ObjectMeta{Name: "csi-" + pvName},
+			Spec: storagev1.VolumeAttachmentSpec{
+				Attacher: DefaultDriverName,
+				NodeName: nodeName,
+				Source: storagev1.VolumeAttachmentSource{
+					PersistentVolumeName: &pvName,
+				},
+			},
+		}
+	}
+
+	newCSINode := func(name, nodeId string) *storagev1.CSINode {
+		return &storagev1.CSINode{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: storagev1.CSINodeSpec{
+				Drivers: []storagev1.CSINodeDriver{
+					{Name: DefaultDriverName, NodeID: nodeId},
+				},
+			},
+		}
+	}
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	client := &fakeClient{
+		volumes: map[string]*models.GetVHDResponse{
+			attachedId:  {Name: "pvc-attached", DiskIdentifier: attachedId, Host: &nodeA},
+			staleId:     {Name: "pvc-stale", DiskIdentifier: staleId, Host: &nodeB},
+			movedId:     {Name: "pvc-moved", DiskIdentifier: movedId, Host: &nodeA},
+			unknownId:   {Name: "pvc-unknown", DiskIdentifier: unknownId, Host: &nodeC},
+			ephemeralId: {Name: constants.EphemeralVolumePrefix + "pod", DiskIdentifier: ephemeralId, Host: &nodeB},
+			otherVmId:   {Name: "adopted", DiskIdentifier: otherVmId, Host: &otherVm},
+		},
+	}
+
+	kubeClient := fake.NewClientset(
+		// Volume IDs are compared without regard to case
+		newPV("pvc-attached", strings.ToUpper(attachedId)),
+		newPV("pvc-stale", staleId),
+		newPV("pvc-moved", movedId),
+		newPV("pvc-unknown", unknownId),
+		// Node IDs are compared without regard to case
+		newCSINode("node-a", strings.ToUpper(nodeA)),
+		newCSINode("node-b", nodeB),
+		newVA("pvc-attached", "node-a"),
+		// The volume has since been attached to node B, but remains attached to node A
+		newVA("pvc-moved", "node-b"),
+		// With no CSINode for the node, it is not known which attachment is expected
+		newVA("pvc-unknown", "node-c"),
+	)
+
+	d := &Driver{
+		log:          logger.WithField("test", true),
+		hypervClient: client,
+	}
+
+	metrics := prometheus.NewRegistry()
+
+	r := newAttachmentReconciler(&attachmentReconcilerParams{
+		HypervClient: client,
+		KubeClient:   kubeClient,
+		Unpublish:    d.unpublish,
+		Registerer:   metrics,
+		Log:          d.log,
+		DriverName:   DefaultDriverName,
+		Interval:     time.Minute,
+		Delay:        10 * time.Minute,
+	})
+
+	start := time.Now()
+	r.now = func() time.Time { return start }
+
+	require.NoError(t, r.reconcile(t.Context()))
+	require.Equal(t, float64(2), metricValue(t, metrics, "hyperv_csi_stale_attachments"))
+	require.Contains(t, r.firstSeen, attachment{volumeId: staleId, nodeId: nodeB})
+	require.Contains(t, r.firstSeen, attachment{volumeId: movedId, nodeId: nodeA})
+
+	// Within the delay, nothing is detached
+	r.now = func() time.Time { return start.Add(5 * time.Minute) }
+	require.NoError(t, r.reconcile(t.Context()))
+	require.NotNil(t, client.volumes[staleId].Host)
+	require.NotNil(t, client.volumes[movedId].Host)
+
+	r.now = func() time.Time { return start.Add(10 * time.Minute) }
+	require.NoError(t, r.reconcile(t.Context()))
+
+	require.Nil(t, client.volumes[staleId].Host)
+	require.Nil(t, client.volumes[movedId].Host)
+	require.Equal(t, nodeA, *client.volumes[attachedId].Host)
+	require.Equal(t, nodeC, *client.volumes[unknownId].Host)
+	require.Equal(t, nodeB, *client.volumes[ephemeralId].Host)
+	// A VM which is not a node of this driver is left alone
+	require.Equal(t, otherVm, *client.volumes[otherVmId].Host)
+
+	require.Equal(t, float64(0), metricValue(t, metrics, "hyperv_csi_stale_attachments"))
+	require.Equal(t, float64(2), metricValue(t, metrics, "hyperv_csi_stale_attachments_detached_total"))
+	require.Empty(t, r.firstSeen)
+}
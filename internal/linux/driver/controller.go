@@ -26,11 +26,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/fireflycons/hypervcsi/internal/common"
 	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
 	"github.com/fireflycons/hypervcsi/internal/models/rest"
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
@@ -43,14 +46,61 @@ import (
 )
 
 var (
-	// We currently only support a single volume to be attached to a single node
-	// in read/write mode. This corresponds to `accessModes.ReadWriteOnce` in a
-	// PVC resource on Kubernetes
-	supportedAccessMode = &csi.VolumeCapability_AccessMode{
-		Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+	// We support a volume being attached to a single node in read/write mode,
+	// which corresponds to `accessModes.ReadWriteOnce` in a PVC resource on
+	// Kubernetes, or to any number of nodes in read-only mode, which
+	// corresponds to `accessModes.ReadOnlyMany`. Shared volumes (VHD Sets)
+	// in block mode may also be attached to any number of nodes in read/write
+	// mode, which corresponds to `accessModes.ReadWriteMany`.
+	supportedAccessModes = []csi.VolumeCapability_AccessMode_Mode{
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
 	}
 )
 
+const (
+	// sharedParameter is the StorageClass parameter which requests that volumes be
+	// created as VHD Sets, which may be attached to several nodes at once with
+	// SCSI persistent reservations.
+	sharedParameter = "shared"
+
+	// encryptedParameter is the StorageClass parameter which requests that volumes
+	// be encrypted at rest with LUKS when they are staged on the node.
+	encryptedParameter = "encrypted"
+
+	// mkfsOptionsParameter is the StorageClass parameter which gives additional
+	// options to pass to mkfs when a volume is first formatted. Options for a
+	// single fs type may be given as mkfsOptions.<fstype>, e.g. mkfsOptions.xfs,
+	// which take precedence over mkfsOptions when formatting with that fs type.
+	mkfsOptionsParameter = "mkfsOptions"
+
+	// templateParameter is the StorageClass parameter which names a template
+	// VHD on the Hyper-V server from which volumes are created.
+	templateParameter = "template"
+
+	// templateModeParameter is the StorageClass parameter which selects
+	// how a volume is created from its template.
+	templateModeParameter = "templateMode"
+
+	// templateModeCopy creates the volume as a full copy of the template. This is the default.
+	templateModeCopy = "copy"
+
+	// templateModeDifferencing creates the volume as a differencing disk whose parent
+	// is the template. This is quicker and uses less space than a copy, but the
+	// template must not be changed or removed while any such volume exists.
+	templateModeDifferencing = "differencing"
+
+	// pvcNamespaceParameter is added to the parameters by the external provisioner when run with
+	// --extra-create-metadata. It is passed to the backend to enforce per-namespace quotas.
+	pvcNamespaceParameter = "csi.storage.k8s.io/pvc/namespace"
+)
+
+var templateModes = []string{
+	templateModeCopy,
+	templateModeDifferencing,
+}
+
 type (
 	volumeIdentifier string
 	nodeIdentifier   string
@@ -71,16 +121,64 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("volume capabilities cannot be satisified: %s", strings.Join(violations, "; ")))
 	}
 
+	shared, err := boolParameter(req.Parameters, sharedParameter)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if violations := validateSharedCapabilities(req.VolumeCapabilities, shared); len(violations) > 0 {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("volume capabilities cannot be satisified: %s", strings.Join(violations, "; ")))
+	}
+
+	encrypted, err := boolParameter(req.Parameters, encryptedParameter)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if violations := validateEncryptedCapabilities(req.VolumeCapabilities, encrypted); len(violations) > 0 {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("volume capabilities cannot be satisified: %s", strings.Join(violations, "; ")))
+	}
+
+	mkfsOptions, err := mkfsOptionsParameters(req.Parameters)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	fsckPolicy := req.Parameters[fsckPolicyParameter]
+	if fsckPolicy != "" && !slices.Contains(fsckPolicies, fsckPolicy) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid value %q for parameter %q, must be one of %s", fsckPolicy, fsckPolicyParameter, strings.Join(fsckPolicies, ", "))
+	}
+
+	template := req.Parameters[templateParameter]
+	templateMode := req.Parameters[templateModeParameter]
+
+	if templateMode != "" && !slices.Contains(templateModes, templateMode) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid value %q for parameter %q, must be one of %s", templateMode, templateModeParameter, strings.Join(templateModes, ", "))
+	}
+
+	if template != "" && (shared || encrypted) {
+		return nil, status.Errorf(codes.InvalidArgument, "parameter %q cannot be used with %q or %q", templateParameter, sharedParameter, encryptedParameter)
+	}
+
 	size, err := d.extractStorage(req.CapacityRange)
 	if err != nil {
 		return nil, status.Errorf(codes.OutOfRange, "invalid capacity range: %v", err)
 	}
 
+	if template != "" {
+		if size, err = d.templateStorage(ctx, template, size, req.CapacityRange); err != nil {
+			return nil, err
+		}
+	}
+
 	volumeName := req.Name
 
 	log := d.log.WithFields(logrus.Fields{
 		"volume_name":         volumeName,
 		"storage_size":        common.FormatBytes(size),
+		"shared":              shared,
+		"encrypted":           encrypted,
+		"template":            template,
 		"method":              "create_volume",
 		"volume_capabilities": req.VolumeCapabilities,
 	})
@@ -91,7 +189,12 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 	// If it already exists and is a different size, it will return an error.
 	// Else it will attempt to create the volume and return the status
 
-	vol, err := d.hypervClient.CreateVolume(ctx, volumeName, size)
+	vol, err := d.hypervClient.CreateVolume(ctx, volumeName, size, rest.CreateVolumeOptions{
+		Shared:       shared,
+		Template:     template,
+		Differencing: templateMode == templateModeDifferencing,
+		Namespace:    req.Parameters[pvcNamespaceParameter],
+	})
 
 	if err != nil {
 		return nil, processErrorReturn(err, log, "create volume")
@@ -104,10 +207,56 @@ func (d *Driver) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest)
 		},
 	}
 
+	// Options applied by the node when the volume is staged are passed in the volume context
+	volumeContext := mkfsOptions
+
+	if vol.Shared {
+		volumeContext[sharedParameter] = "true"
+	}
+
+	if encrypted {
+		volumeContext[encryptedParameter] = "true"
+	}
+
+	if fsckPolicy != "" && fsckPolicy != fsckPolicyNone {
+		volumeContext[fsckPolicyParameter] = fsckPolicy
+	}
+
+	if len(volumeContext) > 0 {
+		resp.Volume.VolumeContext = volumeContext
+	}
+
 	log.WithField("response", resp).Info("volume created successfully")
 	return resp, nil
 }
 
+// templateStorage returns the size of a volume to be created from the named template,
+// which cannot be smaller than the template itself.
+func (d *Driver) templateStorage(ctx context.Context, name string, size int64, capRange *csi.CapacityRange) (int64, error) {
+
+	templates, err := d.hypervClient.ListTemplates(ctx)
+	if err != nil {
+		return 0, processErrorReturn(err, d.log.WithField("template", name), "list templates")
+	}
+
+	i := slices.IndexFunc(templates.Templates, func(t rest.Template) bool {
+		return t.Name == name
+	})
+
+	if i < 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "template %q not found", name)
+	}
+
+	template := templates.Templates[i]
+
+	if limit := capRange.GetLimitBytes(); limit > 0 && template.Size > limit {
+		return 0, status.Errorf(codes.OutOfRange, "template %q size %s exceeds limit size %s",
+			name, common.FormatBytes(template.Size), common.FormatBytes(limit))
+	}
+
+	return max(size, template.Size), nil
+}
+
 // DeleteVolume deletes the given volume. The function is idempotent,
 // thus an invalid volume ID means nothing other than "it was already deleted"
 func (d *Driver) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
@@ -142,45 +291,132 @@ func (d *Driver) ControllerPublishVolume(ctx context.Context, req *csi.Controlle
 		return nil, status.Error(codes.InvalidArgument, "ControllerPublishVolume Volume capability must be provided")
 	}
 
-	if req.Readonly {
-		// TODO we should return codes.InvalidArgument, but the CSI
-		// test fails, because according to the CSI Spec, this flag cannot be
-		// changed on the same volume. However we don't use this flag at all,
-		// as there are no `readonly` attachable volumes.
-		return nil, status.Error(codes.AlreadyExists, "read only Volumes are not supported")
+	if violations := validateCapabilities([]*csi.VolumeCapability{req.VolumeCapability}); len(violations) > 0 {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("volume capability cannot be satisified: %s", strings.Join(violations, "; ")))
 	}
 
+	// A volume published for a read-only access mode is attached read-only
+	// so that it may be attached to other nodes at the same time.
+	readOnly := req.Readonly || isReadOnlyAccessMode(req.VolumeCapability)
+
 	log := d.log.WithFields(logrus.Fields{
 		"volume_id": req.VolumeId,
 		"node_id":   req.NodeId,
+		"read_only": readOnly,
 		"method":    "controller_publish_volume",
 	})
 	log.Info("controller publish volume called")
 
 	// Verify the volume exists
-	_, err := d.hypervClient.GetVolume(ctx, req.VolumeId)
+	vol, err := d.hypervClient.GetVolume(ctx, req.VolumeId)
 	if err != nil {
 		return nil, processErrorReturn(err, log, "publish volume - volume does not exist")
 	}
 
+	if violations := validateSharedCapabilities([]*csi.VolumeCapability{req.VolumeCapability}, vol.Shared); len(violations) > 0 {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("volume capability cannot be satisified: %s", strings.Join(violations, "; ")))
+	}
+
 	// Verify the node exists
-	if _, err := d.hypervClient.GetVm(ctx, req.NodeId); err != nil {
+	vm, err := d.hypervClient.GetVm(ctx, req.NodeId)
+	if err != nil {
 		return nil, processErrorReturn(err, log, "publish volume - node does not exist")
 	}
 
-	if err := d.hypervClient.PublishVolume(ctx, req.VolumeId, req.NodeId); err != nil {
+	// A volume that is not a VHD Set may only be attached read-write to one node.
+	// Attaching it to a second node would corrupt its filesystem.
+	if vol.Host != nil && !vol.Shared && !strings.EqualFold(*vol.Host, req.NodeId) {
+
+		// The volume may be taken from a VM that has been stopped for the grace period
+		detached, err := d.forceDetach(ctx, log, req.VolumeId, *vol.Host)
+		if err != nil {
+			return nil, err
+		}
+
+		if !detached {
+			return nil, status.Errorf(codes.FailedPrecondition, "volume %s is already attached to VM %s", req.VolumeId, d.vmDescription(ctx, *vol.Host))
+		}
+
+		vol.Host = nil
+	}
+
+	if vol.Host != nil && !vol.Shared {
+
+		if readOnly {
+			return nil, status.Errorf(codes.AlreadyExists, "volume %s is already attached read-write to node %s", req.VolumeId, req.NodeId)
+		}
+
+		log.Info("volume is already published to the node")
+
+		return &csi.ControllerPublishVolumeResponse{
+			PublishContext: d.publishContext(req.VolumeId, false),
+		}, nil
+	}
+
+	// Hyper-V would fail the attach with an obscure error if the SCSI controllers of the VM are full.
+	// A backend that does not report the SCSI controllers is left to try.
+	if len(vm.ScsiControllers) > 0 && vm.FreeScsiLocations() == 0 {
+		if err := d.checkAttachedToFullVm(ctx, log, req.VolumeId, vm); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.hypervClient.PublishVolume(ctx, req.VolumeId, req.NodeId, readOnly); err != nil {
 		return nil, processErrorReturn(err, log, "publish volume")
 	}
 
 	log.Info("volume was published")
 
 	return &csi.ControllerPublishVolumeResponse{
-		PublishContext: map[string]string{
-			d.publishInfoVolumeName: req.VolumeId,
-		},
+		PublishContext: d.publishContext(req.VolumeId, readOnly),
 	}, nil
 }
 
+// checkAttachedToFullVm returns ResourceExhausted unless the volume is already attached to the
+// given VM, which has no free SCSI location, in which case publishing it again does nothing.
+func (d *Driver) checkAttachedToFullVm(ctx context.Context, log *logrus.Entry, volumeId string, vm *rest.GetVMResponse) error {
+
+	attachments, err := d.hypervClient.ListVmAttachments(ctx, vm.ID)
+	if err != nil {
+		return processErrorReturn(err, log, "publish volume - cannot list attachments of node")
+	}
+
+	for _, a := range attachments.Attachments {
+		if strings.EqualFold(a.DiskIdentifier, volumeId) {
+			return nil
+		}
+	}
+
+	log.WithField("scsi_controllers", len(vm.ScsiControllers)).Warn("no free SCSI location on node")
+
+	return status.Errorf(codes.ResourceExhausted, "no free SCSI location on VM %s to attach volume %s", d.vmDescription(ctx, vm.ID), volumeId)
+}
+
+// publishContext returns the context passed from ControllerPublishVolume to the node
+func (d *Driver) publishContext(volumeId string, readOnly bool) map[string]string {
+
+	publishContext := map[string]string{
+		d.publishInfoVolumeName: volumeId,
+	}
+
+	if readOnly {
+		publishContext[d.publishInfoReadOnly] = "true"
+	}
+
+	return publishContext
+}
+
+// vmDescription returns the name and ID of the VM with the given ID, or just the ID if the VM cannot be found.
+func (d *Driver) vmDescription(ctx context.Context, vmId string) string {
+
+	vm, err := d.hypervClient.GetVm(ctx, vmId)
+	if err != nil || vm.Name == "" {
+		return vmId
+	}
+
+	return fmt.Sprintf("%s (%s)", vm.Name, vmId)
+}
+
 // ControllerUnpublishVolume deattaches the given volume from the node
 func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
 
@@ -205,6 +441,15 @@ func (d *Driver) ControllerUnpublishVolume(ctx context.Context, req *csi.Control
 	return &csi.ControllerUnpublishVolumeResponse{}, nil
 }
 
+// unpublish detaches a volume from a node via ControllerUnpublishVolume
+func (d *Driver) unpublish(ctx context.Context, volumeId, nodeId string) error {
+	_, err := d.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{
+		VolumeId: volumeId,
+		NodeId:   nodeId,
+	})
+	return err
+}
+
 func (d *Driver) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
 
 	if err := validateIds("ControllerExpandVolume", volumeIdentifier(req.VolumeId)); err != nil {
@@ -272,26 +517,36 @@ func (d *Driver) ValidateVolumeCapabilities(ctx context.Context, req *csi.Valida
 	log := d.log.WithFields(logrus.Fields{
 		"volume_id":              req.VolumeId,
 		"volume_capabilities":    req.VolumeCapabilities,
-		"supported_capabilities": supportedAccessMode,
+		"supported_capabilities": supportedAccessModes,
 		"method":                 "validate_volume_capabilities",
 	})
 	log.Info("validate volume capabilities called")
 
 	// check if volume exists before trying to validate it
-	_, err := d.hypervClient.GetVolume(ctx, req.VolumeId)
+	vol, err := d.hypervClient.GetVolume(ctx, req.VolumeId)
 
 	if err != nil {
 		return nil, processErrorReturn(err, log, "get volume")
 	}
 
+	violations := validateCapabilities(req.VolumeCapabilities)
+	violations = append(violations, validateSharedCapabilities(req.VolumeCapabilities, vol.Shared)...)
+
+	if len(violations) > 0 {
+		resp := &csi.ValidateVolumeCapabilitiesResponse{
+			Message: fmt.Sprintf("volume capabilities cannot be satisified: %s", strings.Join(violations, "; ")),
+		}
+
+		log.WithField("violations", violations).Info("unsupported capabilities")
+		return resp, nil
+	}
+
 	// Since we don't have topology constraints, then because it exists, it's valid
 	resp := &csi.ValidateVolumeCapabilitiesResponse{
 		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
-			VolumeCapabilities: []*csi.VolumeCapability{
-				{
-					AccessMode: supportedAccessMode,
-				},
-			},
+			VolumeContext:      req.VolumeContext,
+			VolumeCapabilities: req.VolumeCapabilities,
+			Parameters:         req.Parameters,
 		},
 	}
 
@@ -322,19 +577,52 @@ func (d *Driver) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (
 
 	resp := &csi.ListVolumesResponse{
 		NextToken: volumesResp.NextToken,
-		Entries:   make([]*csi.ListVolumesResponse_Entry, 0, len(volumesResp.Volumes)),
+		Entries:   volumeEntries(volumesResp.Volumes),
 	}
 
-	for _, v := range volumesResp.Volumes {
-		resp.Entries = append(resp.Entries, &csi.ListVolumesResponse_Entry{
-			Volume: &csi.Volume{
-				VolumeId:      v.DiskIdentifier,
-				CapacityBytes: v.Size,
+	log.WithField("num_volume_entries", len(resp.Entries)).Info("volumes listed")
+	return resp, nil
+}
+
+// ControllerGetVolume returns the current state of the given volume,
+// including the node it is published to and its health condition.
+func (d *Driver) ControllerGetVolume(ctx context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+
+	if err := validateIds("ControllerGetVolume", volumeIdentifier(req.VolumeId)); err != nil {
+		return nil, err
+	}
+
+	log := d.log.WithFields(logrus.Fields{
+		"volume_id": req.VolumeId,
+		"method":    "controller_get_volume",
+	})
+	log.Info("controller get volume called")
+
+	vol, err := d.hypervClient.GetVolumeStatus(ctx, req.VolumeId)
+
+	if err != nil {
+		return nil, processErrorReturn(err, log, "get volume")
+	}
+
+	resp := &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      vol.ID,
+			CapacityBytes: vol.Size,
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			PublishedNodeIds: attachedNodeIds(vol),
+			VolumeCondition: &csi.VolumeCondition{
+				Abnormal: vol.Condition.Abnormal,
+				Message:  vol.Condition.Message,
 			},
-		})
+		},
 	}
 
-	log.WithField("num_volume_entries", len(resp.Entries)).Info("volumes listed")
+	if vol.Condition.Abnormal {
+		log.WithField("condition", vol.Condition.Message).Warn("volume is in an abnormal condition")
+	}
+
+	log.WithField("response", resp).Info("volume retrieved")
 	return resp, nil
 }
 
@@ -391,6 +679,9 @@ func (d *Driver) ControllerGetCapabilities(ctx context.Context, req *csi.Control
 		// csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
 		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 		csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES,
+		csi.ControllerServiceCapability_RPC_GET_VOLUME,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+		csi.ControllerServiceCapability_RPC_PUBLISH_READONLY,
 	} {
 		caps = append(caps, newCap(cap))
 	}
@@ -418,12 +709,83 @@ func processErrorReturn(err error, log *logrus.Entry, action string) error {
 	return status.Errorf(codes.Internal, "%s failed: %v", action, err)
 }
 
+// publishedNodeIds converts the host a volume is attached to,
+// if any, into a list of node IDs.
+func publishedNodeIds(host *string) []string {
+
+	if host == nil || *host == "" {
+		return nil
+	}
+
+	return []string{*host}
+}
+
+// volumeEntries converts listed volumes into ListVolumes entries. The backend lists
+// a volume once for each VM it is attached to, so these are merged into one entry
+// published to all of those nodes.
+func volumeEntries(volumes []*models.GetVHDResponse) []*csi.ListVolumesResponse_Entry {
+
+	entries := make([]*csi.ListVolumesResponse_Entry, 0, len(volumes))
+	byId := make(map[string]*csi.ListVolumesResponse_Entry, len(volumes))
+
+	for _, v := range volumes {
+		id := strings.ToLower(v.DiskIdentifier)
+
+		if e, ok := byId[id]; ok {
+			for _, n := range publishedNodeIds(v.Host) {
+				if !slices.Contains(e.Status.PublishedNodeIds, n) {
+					e.Status.PublishedNodeIds = append(e.Status.PublishedNodeIds, n)
+				}
+			}
+
+			continue
+		}
+
+		e := &csi.ListVolumesResponse_Entry{
+			Volume: &csi.Volume{
+				VolumeId:      v.DiskIdentifier,
+				CapacityBytes: v.Size,
+			},
+			Status: &csi.ListVolumesResponse_VolumeStatus{
+				PublishedNodeIds: publishedNodeIds(v.Host),
+			},
+		}
+
+		byId[id] = e
+		entries = append(entries, e)
+	}
+
+	return entries
+}
+
+// attachedNodeIds returns the IDs of all nodes the volume is attached to.
+// A volume attached read-only may be attached to several nodes.
+func attachedNodeIds(vol *rest.GetVolumeStatusResponse) []string {
+
+	if len(vol.Attachments) == 0 {
+		return publishedNodeIds(vol.Host)
+	}
+
+	ids := make([]string, 0, len(vol.Attachments))
+	for _, a := range vol.Attachments {
+		ids = append(ids, a.NodeID)
+	}
+
+	return ids
+}
+
+// isReadOnlyAccessMode returns true if the capability requests an access mode
+// for which the volume should be attached read-only.
+func isReadOnlyAccessMode(cap *csi.VolumeCapability) bool {
+	return cap.GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY
+}
+
 // validateCapabilities validates the requested capabilities.
 // It returns a list of violations which may be empty if no violations were found.
 func validateCapabilities(caps []*csi.VolumeCapability) []string {
 	violations := sets.NewString()
 	for _, cap := range caps {
-		if cap.GetAccessMode().GetMode() != supportedAccessMode.GetMode() {
+		if !slices.Contains(supportedAccessModes, cap.GetAccessMode().GetMode()) {
 			violations.Insert(fmt.Sprintf("unsupported access mode %s", cap.GetAccessMode().GetMode().String()))
 		}
 
@@ -431,6 +793,13 @@ func validateCapabilities(caps []*csi.VolumeCapability) []string {
 		switch accessType.(type) {
 		case *csi.VolumeCapability_Block:
 		case *csi.VolumeCapability_Mount:
+			if cap.GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER {
+				violations.Insert("access mode MULTI_NODE_MULTI_WRITER is only supported for block volumes")
+			}
+
+			if fsType := cap.GetMount().GetFsType(); fsType != "" && !slices.Contains(supportedFsTypes, fsType) {
+				violations.Insert(fmt.Sprintf("unsupported fs type %q, must be one of %s", fsType, strings.Join(supportedFsTypes, ", ")))
+			}
 		default:
 			violations.Insert("unsupported access type")
 		}
@@ -439,6 +808,79 @@ func validateCapabilities(caps []*csi.VolumeCapability) []string {
 	return violations.List()
 }
 
+// validateSharedCapabilities validates the requested capabilities against whether the volume
+// is shared. Shared volumes are only supported in block mode, and only shared volumes may be
+// attached read/write to several nodes.
+// It returns a list of violations which may be empty if no violations were found.
+func validateSharedCapabilities(caps []*csi.VolumeCapability, shared bool) []string {
+	violations := sets.NewString()
+	for _, cap := range caps {
+		if shared {
+			if _, ok := cap.GetAccessType().(*csi.VolumeCapability_Block); !ok {
+				violations.Insert("shared volumes are only supported for block volumes")
+			}
+		} else if cap.GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER {
+			violations.Insert(fmt.Sprintf("access mode MULTI_NODE_MULTI_WRITER requires the %q parameter", sharedParameter))
+		}
+	}
+
+	return violations.List()
+}
+
+// validateEncryptedCapabilities validates the requested capabilities against whether the volume
+// is encrypted. Encryption is applied when the filesystem is staged, so block volumes cannot be encrypted.
+// It returns a list of violations which may be empty if no violations were found.
+func validateEncryptedCapabilities(caps []*csi.VolumeCapability, encrypted bool) []string {
+	violations := sets.NewString()
+	if !encrypted {
+		return violations.List()
+	}
+
+	for _, cap := range caps {
+		if _, ok := cap.GetAccessType().(*csi.VolumeCapability_Block); ok {
+			violations.Insert("encrypted volumes are only supported for filesystem volumes")
+		}
+	}
+
+	return violations.List()
+}
+
+// mkfsOptionsParameters validates the mkfs options StorageClass parameters,
+// returning them for inclusion in the volume context.
+func mkfsOptionsParameters(params map[string]string) (map[string]string, error) {
+
+	options := map[string]string{}
+	for name, v := range params {
+		if name != mkfsOptionsParameter && !strings.HasPrefix(name, mkfsOptionsParameter+".") {
+			continue
+		}
+
+		if fsType, ok := strings.CutPrefix(name, mkfsOptionsParameter+"."); ok && !slices.Contains(supportedFsTypes, fsType) {
+			return nil, fmt.Errorf("invalid parameter %q: unsupported fs type %q, must be one of %s", name, fsType, strings.Join(supportedFsTypes, ", "))
+		}
+
+		options[name] = v
+	}
+
+	return options, nil
+}
+
+// boolParameter parses an optional boolean StorageClass parameter.
+func boolParameter(params map[string]string, name string) (bool, error) {
+
+	v, ok := params[name]
+	if !ok || v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid value %q for parameter %q: %w", v, name, err)
+	}
+
+	return b, nil
+}
+
 // extractStorage extracts the storage size in bytes from the given capacity
 // range. If the capacity range is not satisfied it returns the default volume
 // size. If the capacity range is above supported sizes, it returns an
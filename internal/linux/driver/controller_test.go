@@ -3,13 +3,22 @@
 package driver
 
 import (
+	"context"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/client-go/tools/record"
 )
 
 func TestExtractStorage(t *testing.T) {
@@ -32,3 +41,798 @@ func TestExtractStorage(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, requested, actual)
 }
+
+func TestControllerGetVolume(t *testing.T) {
+
+	var (
+		volId  = uuid.NewString()
+		nodeId = uuid.NewString()
+	)
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	d := &Driver{
+		log: logger.WithField("test", true),
+		hypervClient: &fakeClient{
+			volumes: map[string]*models.GetVHDResponse{
+				volId: {
+					Name:           "pv1",
+					DiskIdentifier: volId,
+					Size:           constants.DefaultVolumeSizeInBytes,
+					Host:           &nodeId,
+				},
+			},
+		},
+	}
+
+	t.Run("published volume", func(t *testing.T) {
+		resp, err := d.ControllerGetVolume(context.Background(), &csi.ControllerGetVolumeRequest{VolumeId: volId})
+		require.NoError(t, err)
+		require.Equal(t, volId, resp.Volume.VolumeId)
+		require.Equal(t, []string{nodeId}, resp.Status.PublishedNodeIds)
+		require.False(t, resp.Status.VolumeCondition.Abnormal)
+	})
+
+	t.Run("volume not found", func(t *testing.T) {
+		_, err := d.ControllerGetVolume(context.Background(), &csi.ControllerGetVolumeRequest{VolumeId: uuid.NewString()})
+		require.Error(t, err)
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("list volumes reports published nodes", func(t *testing.T) {
+		resp, err := d.ListVolumes(context.Background(), &csi.ListVolumesRequest{})
+		require.NoError(t, err)
+		require.Len(t, resp.Entries, 1)
+		require.Equal(t, []string{nodeId}, resp.Entries[0].Status.PublishedNodeIds)
+	})
+}
+
+func TestVolumeEntries(t *testing.T) {
+
+	var (
+		volId   = uuid.NewString()
+		otherId = uuid.NewString()
+		node1   = uuid.NewString()
+		node2   = uuid.NewString()
+	)
+
+	// A volume attached to two nodes is listed once for each of them
+	entries := volumeEntries([]*models.GetVHDResponse{
+		{DiskIdentifier: volId, Size: constants.GiB, Host: &node1},
+		{DiskIdentifier: otherId, Size: constants.GiB},
+		{DiskIdentifier: strings.ToUpper(volId), Size: constants.GiB, Host: &node2},
+	})
+
+	require.Len(t, entries, 2)
+	require.Equal(t, volId, entries[0].Volume.VolumeId)
+	require.Equal(t, []string{node1, node2}, entries[0].Status.PublishedNodeIds)
+	require.Equal(t, otherId, entries[1].Volume.VolumeId)
+	require.Empty(t, entries[1].Status.PublishedNodeIds)
+}
+
+func TestControllerPublishVolumeReadOnly(t *testing.T) {
+
+	var (
+		volId = uuid.NewString()
+		node1 = uuid.NewString()
+		node2 = uuid.NewString()
+	)
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	d := &Driver{
+		log:                   logger.WithField("test", true),
+		publishInfoVolumeName: DefaultDriverName + "/volume-name",
+		publishInfoReadOnly:   DefaultDriverName + "/readonly",
+		hypervClient: &fakeClient{
+			volumes: map[string]*models.GetVHDResponse{
+				volId: {
+					Name:           "pv1",
+					DiskIdentifier: volId,
+					Size:           constants.DefaultVolumeSizeInBytes,
+				},
+			},
+			nodes: map[int]string{
+				0: node1,
+				1: node2,
+			},
+		},
+	}
+
+	capability := func(mode csi.VolumeCapability_AccessMode_Mode) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: mode,
+			},
+		}
+	}
+
+	t.Run("publishes read-only to several nodes", func(t *testing.T) {
+		for _, nodeId := range []string{node1, node2} {
+			resp, err := d.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+				VolumeId:         volId,
+				NodeId:           nodeId,
+				VolumeCapability: capability(csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY),
+			})
+			require.NoError(t, err)
+			require.Equal(t, "true", resp.PublishContext[d.publishInfoReadOnly])
+		}
+
+		resp, err := d.ControllerGetVolume(context.Background(), &csi.ControllerGetVolumeRequest{VolumeId: volId})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{node1, node2}, resp.Status.PublishedNodeIds)
+	})
+
+	t.Run("read-write publish fails while published read-only", func(t *testing.T) {
+		_, err := d.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+			VolumeId:         volId,
+			NodeId:           node1,
+			VolumeCapability: capability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+		})
+		require.Error(t, err)
+		require.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+
+	t.Run("validates supported access modes", func(t *testing.T) {
+		resp, err := d.ValidateVolumeCapabilities(context.Background(), &csi.ValidateVolumeCapabilitiesRequest{
+			VolumeId:           volId,
+			VolumeCapabilities: []*csi.VolumeCapability{capability(csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY)},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, resp.Confirmed)
+
+		resp, err = d.ValidateVolumeCapabilities(context.Background(), &csi.ValidateVolumeCapabilitiesRequest{
+			VolumeId:           volId,
+			VolumeCapabilities: []*csi.VolumeCapability{capability(csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER)},
+		})
+		require.NoError(t, err)
+		require.Nil(t, resp.Confirmed)
+		require.NotEmpty(t, resp.Message)
+	})
+}
+
+func TestControllerPublishVolumeSingleAttachment(t *testing.T) {
+
+	var (
+		volId = uuid.NewString()
+		node1 = uuid.NewString()
+		node2 = uuid.NewString()
+	)
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	client := &fakeClient{
+		volumes: map[string]*models.GetVHDResponse{
+			volId: {
+				Name:           "pv1",
+				DiskIdentifier: volId,
+				Size:           constants.DefaultVolumeSizeInBytes,
+			},
+		},
+		nodes: map[int]string{
+			0: node1,
+			1: node2,
+		},
+	}
+
+	d := &Driver{
+		log:                   logger.WithField("test", true),
+		publishInfoVolumeName: DefaultDriverName + "/volume-name",
+		publishInfoReadOnly:   DefaultDriverName + "/readonly",
+		hypervClient:          client,
+	}
+
+	publish := func(nodeId string) (*csi.ControllerPublishVolumeResponse, error) {
+		return d.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+			VolumeId: volId,
+			NodeId:   nodeId,
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+	}
+
+	_, err := publish(node1)
+	require.NoError(t, err)
+	require.Equal(t, node1, *client.volumes[volId].Host)
+
+	t.Run("is idempotent for the same node", func(t *testing.T) {
+		resp, err := publish(strings.ToUpper(node1))
+		require.NoError(t, err)
+		require.Equal(t, volId, resp.PublishContext[d.publishInfoVolumeName])
+	})
+
+	t.Run("fails for another node", func(t *testing.T) {
+		_, err := publish(node2)
+		require.Error(t, err)
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.Contains(t, status.Convert(err).Message(), node1)
+		require.Equal(t, node1, *client.volumes[volId].Host)
+	})
+}
+
+func TestControllerPublishVolumeScsiFull(t *testing.T) {
+
+	var (
+		attachedId = uuid.NewString()
+		volId      = uuid.NewString()
+		nodeId     = uuid.NewString()
+	)
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	client := &fakeClient{
+		volumes: map[string]*models.GetVHDResponse{
+			attachedId: {
+				Name:           "pv1",
+				DiskIdentifier: attachedId,
+				Size:           constants.DefaultVolumeSizeInBytes,
+			},
+			volId: {
+				Name:           "pv2",
+				DiskIdentifier: volId,
+				Size:           constants.DefaultVolumeSizeInBytes,
+			},
+		},
+		readers: map[string]map[string]struct{}{
+			attachedId: {nodeId: {}},
+		},
+		nodes: map[int]string{
+			0: nodeId,
+		},
+		vmScsi: map[string]rest.GetVMResponse{
+			nodeId: {ScsiControllers: scsiControllers(constants.ScsiLocationsPerController)},
+		},
+	}
+
+	d := &Driver{
+		log:                   logger.WithField("test", true),
+		publishInfoVolumeName: DefaultDriverName + "/volume-name",
+		publishInfoReadOnly:   DefaultDriverName + "/readonly",
+		hypervClient:          client,
+	}
+
+	publish := func(volumeId string) (*csi.ControllerPublishVolumeResponse, error) {
+		return d.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+			VolumeId: volumeId,
+			NodeId:   nodeId,
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+				},
+			},
+		})
+	}
+
+	t.Run("fails for a volume not attached to the node", func(t *testing.T) {
+		_, err := publish(volId)
+		require.Error(t, err)
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		require.Empty(t, client.readers[volId])
+	})
+
+	t.Run("is idempotent for a volume attached to the node", func(t *testing.T) {
+		resp, err := publish(attachedId)
+		require.NoError(t, err)
+		require.Equal(t, attachedId, resp.PublishContext[d.publishInfoVolumeName])
+	})
+}
+
+func TestControllerPublishVolumeForceDetach(t *testing.T) {
+
+	var (
+		volId = uuid.NewString()
+		node1 = uuid.NewString()
+		node2 = uuid.NewString()
+	)
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	client := &fakeClient{
+		volumes: map[string]*models.GetVHDResponse{
+			volId: {
+				Name:           "pv1",
+				DiskIdentifier: volId,
+				Size:           constants.DefaultVolumeSizeInBytes,
+				Host:           &node1,
+			},
+		},
+		nodes: map[int]string{
+			0: node1,
+			1: node2,
+		},
+		vmStates: map[string]rest.VMState{
+			node1: rest.VMStateRunning,
+			node2: rest.VMStateRunning,
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+
+	d := &Driver{
+		log:                    logger.WithField("test", true),
+		name:                   DefaultDriverName,
+		publishInfoVolumeName:  DefaultDriverName + "/volume-name",
+		publishInfoReadOnly:    DefaultDriverName + "/readonly",
+		hypervClient:           client,
+		recorder:               recorder,
+		forceDetachGracePeriod: time.Hour,
+	}
+
+	publish := func() error {
+		_, err := d.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+			VolumeId: volId,
+			NodeId:   node2,
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		})
+		return err
+	}
+
+	t.Run("does not detach from a running VM", func(t *testing.T) {
+		err := publish()
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.Empty(t, d.vmStoppedSince)
+	})
+
+	t.Run("does not detach from a saved VM", func(t *testing.T) {
+		client.vmStates[node1] = rest.VMStateSaved
+
+		err := publish()
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.Empty(t, d.vmStoppedSince)
+	})
+
+	t.Run("does not detach within the grace period", func(t *testing.T) {
+		client.vmStates[node1] = rest.VMStateOff
+
+		err := publish()
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.Contains(t, d.vmStoppedSince, node1)
+		require.Equal(t, node1, *client.volumes[volId].Host)
+		require.Empty(t, recorder.Events)
+	})
+
+	t.Run("detaches after the grace period", func(t *testing.T) {
+		d.vmStoppedSince[node1] = time.Now().Add(-2 * time.Hour)
+
+		require.NoError(t, publish())
+		require.Equal(t, node2, *client.volumes[volId].Host)
+		require.Len(t, recorder.Events, 1)
+		require.True(t, strings.HasPrefix(<-recorder.Events, "Warning ForcedDetach"))
+	})
+
+	t.Run("is disabled without a grace period", func(t *testing.T) {
+		d.forceDetachGracePeriod = 0
+		client.volumes[volId].Host = &node1
+		d.vmStoppedSince[node1] = time.Now().Add(-2 * time.Hour)
+
+		err := publish()
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.Equal(t, node1, *client.volumes[volId].Host)
+	})
+}
+
+func TestSharedVolume(t *testing.T) {
+
+	var (
+		node1 = uuid.NewString()
+		node2 = uuid.NewString()
+	)
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	d := &Driver{
+		log:                   logger.WithField("test", true),
+		publishInfoVolumeName: DefaultDriverName + "/volume-name",
+		publishInfoReadOnly:   DefaultDriverName + "/readonly",
+		hypervClient: &fakeClient{
+			volumes: map[string]*models.GetVHDResponse{},
+			nodes: map[int]string{
+				0: node1,
+				1: node2,
+			},
+		},
+	}
+
+	capability := func(mode csi.VolumeCapability_AccessMode_Mode, block bool) *csi.VolumeCapability {
+		c := &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: mode,
+			},
+		}
+
+		if block {
+			c.AccessType = &csi.VolumeCapability_Block{
+				Block: &csi.VolumeCapability_BlockVolume{},
+			}
+		}
+
+		return c
+	}
+
+	multiWriter := capability(csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER, true)
+
+	t.Run("filesystem shared volume is rejected", func(t *testing.T) {
+		_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:               "shared-fs",
+			VolumeCapabilities: []*csi.VolumeCapability{capability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER, false)},
+			Parameters:         map[string]string{sharedParameter: "true"},
+		})
+		require.Error(t, err)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("multi-writer requires shared volume", func(t *testing.T) {
+		_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:               "not-shared",
+			VolumeCapabilities: []*csi.VolumeCapability{multiWriter},
+		})
+		require.Error(t, err)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("multi-writer filesystem is rejected", func(t *testing.T) {
+		_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:               "shared-fs",
+			VolumeCapabilities: []*csi.VolumeCapability{capability(csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER, false)},
+			Parameters:         map[string]string{sharedParameter: "true"},
+		})
+		require.Error(t, err)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("publishes read-write to several nodes", func(t *testing.T) {
+		vol, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:               "shared",
+			VolumeCapabilities: []*csi.VolumeCapability{multiWriter},
+			Parameters:         map[string]string{sharedParameter: "true"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "true", vol.Volume.VolumeContext[sharedParameter])
+
+		for _, nodeId := range []string{node1, node2} {
+			resp, err := d.ControllerPublishVolume(context.Background(), &csi.ControllerPublishVolumeRequest{
+				VolumeId:         vol.Volume.VolumeId,
+				NodeId:           nodeId,
+				VolumeCapability: multiWriter,
+			})
+			require.NoError(t, err)
+			require.Empty(t, resp.PublishContext[d.publishInfoReadOnly])
+		}
+
+		resp, err := d.ControllerGetVolume(context.Background(), &csi.ControllerGetVolumeRequest{VolumeId: vol.Volume.VolumeId})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{node1, node2}, resp.Status.PublishedNodeIds)
+	})
+}
+
+func TestCreateEncryptedVolume(t *testing.T) {
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	d := &Driver{
+		log: logger.WithField("test", true),
+		hypervClient: &fakeClient{
+			volumes: map[string]*models.GetVHDResponse{},
+		},
+	}
+
+	capability := func(block bool) *csi.VolumeCapability {
+		c := &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		}
+
+		if block {
+			c.AccessType = &csi.VolumeCapability_Block{
+				Block: &csi.VolumeCapability_BlockVolume{},
+			}
+		}
+
+		return c
+	}
+
+	t.Run("encryption is recorded in volume context", func(t *testing.T) {
+		vol, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:               "encrypted",
+			VolumeCapabilities: []*csi.VolumeCapability{capability(false)},
+			Parameters:         map[string]string{encryptedParameter: "true"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "true", vol.Volume.VolumeContext[encryptedParameter])
+	})
+
+	t.Run("encrypted block volume is rejected", func(t *testing.T) {
+		_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:               "encrypted-block",
+			VolumeCapabilities: []*csi.VolumeCapability{capability(true)},
+			Parameters:         map[string]string{encryptedParameter: "true"},
+		})
+		require.Error(t, err)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("invalid parameter value", func(t *testing.T) {
+		_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:               "encrypted-bad",
+			VolumeCapabilities: []*csi.VolumeCapability{capability(false)},
+			Parameters:         map[string]string{encryptedParameter: "yes please"},
+		})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+}
+
+func TestCreateVolumeMkfsOptions(t *testing.T) {
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	d := &Driver{
+		log: logger.WithField("test", true),
+		hypervClient: &fakeClient{
+			volumes: map[string]*models.GetVHDResponse{},
+		},
+	}
+
+	capability := func(fsType string) []*csi.VolumeCapability {
+		return []*csi.VolumeCapability{
+			{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{
+						FsType: fsType,
+					},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		}
+	}
+
+	t.Run("options are recorded in volume context", func(t *testing.T) {
+		params := map[string]string{
+			mkfsOptionsParameter:                   "-L data",
+			mkfsOptionsParameter + "." + fstypeXfs: "-m reflink=1",
+			"unrelated":                            "value",
+		}
+
+		vol, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:               "mkfs-options",
+			VolumeCapabilities: capability(fstypeXfs),
+			Parameters:         params,
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			mkfsOptionsParameter:                   "-L data",
+			mkfsOptionsParameter + "." + fstypeXfs: "-m reflink=1",
+		}, vol.Volume.VolumeContext)
+	})
+
+	t.Run("options for unsupported fs type are rejected", func(t *testing.T) {
+		_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:               "mkfs-options-bad",
+			VolumeCapabilities: capability(fstypeExt4),
+			Parameters:         map[string]string{mkfsOptionsParameter + ".zfs": "-O compression=on"},
+		})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("unsupported fs type is rejected", func(t *testing.T) {
+		_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:               "ntfs",
+			VolumeCapabilities: capability("ntfs"),
+		})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("btrfs is supported", func(t *testing.T) {
+		vol, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+			Name:               "btrfs",
+			VolumeCapabilities: capability(fstypeBtrfs),
+		})
+		require.NoError(t, err)
+		require.Empty(t, vol.Volume.VolumeContext)
+	})
+}
+
+func TestCreateVolumeFsckPolicy(t *testing.T) {
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	d := &Driver{
+		log: logger.WithField("test", true),
+		hypervClient: &fakeClient{
+			volumes: map[string]*models.GetVHDResponse{},
+		},
+	}
+
+	capabilities := []*csi.VolumeCapability{
+		{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
+	}
+
+	tests := []struct {
+		policy   string
+		code     codes.Code
+		expected string
+	}{
+		{policy: fsckPolicyNone, code: codes.OK},
+		{policy: fsckPolicyCheck, code: codes.OK, expected: fsckPolicyCheck},
+		{policy: fsckPolicyRepair, code: codes.OK, expected: fsckPolicyRepair},
+		{policy: "always", code: codes.InvalidArgument},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			vol, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+				Name:               "fsck-" + test.policy,
+				VolumeCapabilities: capabilities,
+				Parameters:         map[string]string{fsckPolicyParameter: test.policy},
+			})
+			require.Equal(t, test.code, status.Code(err))
+
+			if err == nil {
+				require.Equal(t, test.expected, vol.Volume.VolumeContext[fsckPolicyParameter])
+			}
+		})
+	}
+}
+
+func TestCreateVolumeTemplate(t *testing.T) {
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	d := &Driver{
+		log: logger.WithField("test", true),
+		hypervClient: &fakeClient{
+			volumes:   map[string]*models.GetVHDResponse{},
+			templates: map[string]int64{"fixtures": 20 * constants.GiB},
+		},
+	}
+
+	capabilities := []*csi.VolumeCapability{
+		{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{},
+			},
+			AccessMode: &csi.VolumeCapability_AccessMode{
+				Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		capacity   *csi.CapacityRange
+		code       codes.Code
+		size       int64
+	}{
+		{
+			name:       "copy grows to template size",
+			parameters: map[string]string{templateParameter: "fixtures"},
+			code:       codes.OK,
+			size:       20 * constants.GiB,
+		},
+		{
+			name:       "differencing larger than template",
+			parameters: map[string]string{templateParameter: "fixtures", templateModeParameter: templateModeDifferencing},
+			capacity:   &csi.CapacityRange{RequiredBytes: 30 * constants.GiB},
+			code:       codes.OK,
+			size:       30 * constants.GiB,
+		},
+		{
+			name:       "template exceeds limit",
+			parameters: map[string]string{templateParameter: "fixtures"},
+			capacity:   &csi.CapacityRange{LimitBytes: 10 * constants.GiB},
+			code:       codes.OutOfRange,
+		},
+		{
+			name:       "unknown template",
+			parameters: map[string]string{templateParameter: "missing"},
+			code:       codes.InvalidArgument,
+		},
+		{
+			name:       "invalid mode",
+			parameters: map[string]string{templateParameter: "fixtures", templateModeParameter: "link"},
+			code:       codes.InvalidArgument,
+		},
+		{
+			name:       "encrypted",
+			parameters: map[string]string{templateParameter: "fixtures", encryptedParameter: "true"},
+			code:       codes.InvalidArgument,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vol, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+				Name:               "template-" + strconv.Itoa(i),
+				VolumeCapabilities: capabilities,
+				CapacityRange:      test.capacity,
+				Parameters:         test.parameters,
+			})
+			require.Equal(t, test.code, status.Code(err))
+
+			if err == nil {
+				require.Equal(t, test.size, vol.Volume.CapacityBytes)
+			}
+		})
+	}
+}
+
+func TestCreateVolumePassesNamespace(t *testing.T) {
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	client := &fakeClient{
+		volumes: map[string]*models.GetVHDResponse{},
+	}
+
+	d := &Driver{
+		log:          logger.WithField("test", true),
+		hypervClient: client,
+	}
+
+	_, err := d.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+		Name: "namespaced",
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+		},
+		Parameters: map[string]string{
+			pvcNamespaceParameter:         "team-a",
+			"csi.storage.k8s.io/pvc/name": "data",
+		},
+	})
+
+	require.NoError(t, err)
+	require.Equal(t, "team-a", client.createOptions.Namespace)
+}
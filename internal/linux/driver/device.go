@@ -0,0 +1,327 @@
+//go:build linux
+
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// deviceDiscoveryTimeout is how long to wait for the device of a newly attached disk to appear
+	deviceDiscoveryTimeout = 30 * time.Second
+
+	devicePollInterval = time.Second
+
+	// scsiRescanDelay is how long to wait for the device to appear before rescanning the SCSI hosts
+	scsiRescanDelay = 5 * time.Second
+
+	sysfsDir = "/sys"
+
+	blockdevCmd = "blockdev"
+
+	// vpdPageDeviceIdentification is the code of the SCSI VPD page of device identifiers
+	vpdPageDeviceIdentification = 0x83
+
+	// vpdDesignatorTypeNAA is the type of a device identifier which is a WWN
+	vpdDesignatorTypeNAA = 0x3
+)
+
+// deviceStrategy is how the device of a disk was found
+type deviceStrategy string
+
+const (
+	deviceByUdevLink  deviceStrategy = "udev-link"
+	deviceBySysfsWWID deviceStrategy = "sysfs-wwid"
+	deviceByVPD       deviceStrategy = "vpd-page-0x83"
+)
+
+// deviceManager finds the block device of an attached disk from its WWN, and removes
+// the device from the guest before the disk is detached.
+//
+// To find a device, it looks first for the link that udev creates in /dev/disk/by-id. If udev has not yet
+// created it, or has no rules to do so, the WWN is matched against the identifiers the
+// kernel exposes in sysfs for each block device. If the device does not appear within
+// the rescan delay, the SCSI hosts are rescanned once, in case the kernel missed the attach.
+type deviceManager struct {
+	resolve      func(devicePath string) (string, error)
+	sysDir       string
+	devDir       string
+	timeout      time.Duration
+	pollInterval time.Duration
+	rescanDelay  time.Duration
+	flush        func(device string) error
+}
+
+func newDeviceManager(m Mounter) *deviceManager {
+	return &deviceManager{
+		resolve:      m.ResolveDevice,
+		sysDir:       sysfsDir,
+		devDir:       "/dev",
+		timeout:      deviceDiscoveryTimeout,
+		pollInterval: devicePollInterval,
+		rescanDelay:  scsiRescanDelay,
+		flush:        flushDeviceBuffers,
+	}
+}
+
+// find waits for the device of the given volume to appear and returns its path,
+// which is the udev link if there is one.
+func (f *deviceManager) find(ctx context.Context, log *logrus.Entry, volumeId string) (string, error) {
+
+	wwn, err := hypervWWN(volumeId)
+	if err != nil {
+		return "", fmt.Errorf("cannot determine disk WWN: %w", err)
+	}
+
+	link := diskByIDPath(wwn)
+
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(f.pollInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	rescanned := false
+
+	for {
+		device, strategy, err := f.lookup(link, wwn)
+		if err == nil {
+			log.WithFields(logrus.Fields{
+				"device":           device,
+				"device_strategy":  strategy,
+				"device_wait":      time.Since(start).Round(time.Millisecond),
+				"device_rescan":    rescanned,
+				"device_udev_link": link,
+			}).Info("found disk device")
+
+			return device, nil
+		}
+
+		if !rescanned && time.Since(start) >= f.rescanDelay {
+			log.WithField("udev_link", link).Warn("disk device has not appeared; rescanning SCSI hosts")
+
+			if err := f.rescan(); err != nil {
+				log.WithError(err).Warn("cannot rescan SCSI hosts")
+			}
+
+			rescanned = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("disk device %s did not appear: %w", link, err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// lookup returns the device with the given WWN if it is present, and how it was found.
+func (f *deviceManager) lookup(link string, wwn []byte) (string, deviceStrategy, error) {
+
+	if _, err := f.resolve(link); err == nil {
+		return link, deviceByUdevLink, nil
+	}
+
+	blockDir := filepath.Join(f.sysDir, "block")
+
+	entries, err := os.ReadDir(blockDir)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot list block devices: %w", err)
+	}
+
+	naa := "naa." + hex.EncodeToString(wwn)
+
+	for _, e := range entries {
+		deviceDir := filepath.Join(blockDir, e.Name(), "device")
+
+		if wwid, err := os.ReadFile(filepath.Join(deviceDir, "wwid")); err == nil {
+			if strings.EqualFold(strings.TrimSpace(string(wwid)), naa) {
+				return filepath.Join(f.devDir, e.Name()), deviceBySysfsWWID, nil
+			}
+
+			continue
+		}
+
+		if page, err := os.ReadFile(filepath.Join(deviceDir, "vpd_pg83")); err == nil && vpdHasNAA(page, wwn) {
+			return filepath.Join(f.devDir, e.Name()), deviceByVPD, nil
+		}
+	}
+
+	return "", "", errors.New("no block device has the WWN of the disk")
+}
+
+// rescan asks each SCSI host to scan for new devices.
+func (f *deviceManager) rescan() error {
+
+	hosts, err := filepath.Glob(filepath.Join(f.sysDir, "class", "scsi_host", "host*", "scan"))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, scan := range hosts {
+		// All channels, targets and LUNs
+		if err := os.WriteFile(scan, []byte("- - -"), 0200); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// vpdHasNAA checks whether a device identification VPD page has a NAA designator with the given WWN.
+//
+// The page has a 4 byte header with the page code and length, followed by designators each
+// with a 4 byte header, whose low 4 bits of the second byte are the designator type and
+// whose fourth byte is the length of the designator.
+func vpdHasNAA(page, wwn []byte) bool {
+
+	if len(page) < 4 || page[1] != vpdPageDeviceIdentification {
+		return false
+	}
+
+	pageLength := int(page[2])<<8 | int(page[3])
+	designators := page[4:min(len(page), 4+pageLength)]
+
+	for len(designators) >= 4 {
+		length := int(designators[3])
+		if len(designators) < 4+length {
+			break
+		}
+
+		if designators[1]&0x0f == vpdDesignatorTypeNAA && bytes.Equal(designators[4:4+length], wwn) {
+			return true
+		}
+
+		designators = designators[4+length:]
+	}
+
+	return false
+}
+
+// remove flushes the buffers of the device of the given volume and deletes the SCSI device,
+// so that the guest does not keep a stale device once the disk is detached. It is not an
+// error if the device is not present. The device must not have holders, such as a device
+// mapper or LUKS mapping, which would be left without a device.
+func (f *deviceManager) remove(log *logrus.Entry, volumeId string) error {
+
+	wwn, err := hypervWWN(volumeId)
+	if err != nil {
+		return fmt.Errorf("cannot determine disk WWN: %w", err)
+	}
+
+	device, strategy, err := f.lookup(diskByIDPath(wwn), wwn)
+	if err != nil {
+		log.WithError(err).Info("disk device is not present")
+		return nil
+	}
+
+	if strategy == deviceByUdevLink {
+		if device, err = f.resolve(device); err != nil {
+			log.WithError(err).Info("disk device is not present")
+			return nil
+		}
+	}
+
+	return f.removeDevice(log, device)
+}
+
+// removeDevice flushes and deletes the given block device from the guest,
+// unless it has holders. It does nothing if the device is not present.
+func (f *deviceManager) removeDevice(log *logrus.Entry, device string) error {
+
+	name := filepath.Base(device)
+	blockDir := filepath.Join(f.sysDir, "block", name)
+
+	if _, err := os.Stat(blockDir); err != nil {
+		log.WithField("device", device).Info("disk device is not present")
+		return nil
+	}
+
+	holders, err := f.holders(blockDir)
+	if err != nil {
+		return err
+	}
+
+	if len(holders) > 0 {
+		return &deviceInUseError{device: device, holders: holders}
+	}
+
+	log = log.WithField("device", device)
+
+	log.Info("flushing buffers of the disk device")
+	if err := f.flush(filepath.Join(f.devDir, name)); err != nil {
+		return err
+	}
+
+	log.Info("deleting the SCSI device")
+	if err := os.WriteFile(filepath.Join(blockDir, "device", "delete"), []byte("1"), 0200); err != nil {
+		return fmt.Errorf("error deleting SCSI device %s: %w", device, err)
+	}
+
+	return nil
+}
+
+// holders returns the holders of a block device and of its partitions.
+func (f *deviceManager) holders(blockDir string) ([]string, error) {
+
+	dirs, err := filepath.Glob(filepath.Join(blockDir, filepath.Base(blockDir)+"*", "holders"))
+	if err != nil {
+		return nil, err
+	}
+
+	var holders []string
+
+	for _, dir := range append([]string{filepath.Join(blockDir, "holders")}, dirs...) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("error reading holders of device: %w", err)
+		}
+
+		for _, e := range entries {
+			holders = append(holders, e.Name())
+		}
+	}
+
+	return holders, nil
+}
+
+// deviceInUseError is returned when a device to be removed has holders
+type deviceInUseError struct {
+	device  string
+	holders []string
+}
+
+func (e *deviceInUseError) Error() string {
+	return fmt.Sprintf("device %s is in use by %s", e.device, strings.Join(e.holders, ", "))
+}
+
+// flushDeviceBuffers writes any buffered data of the block device to the disk.
+func flushDeviceBuffers(device string) error {
+
+	if _, err := exec.LookPath(blockdevCmd); err != nil {
+		return fmt.Errorf("%q executable not found in $PATH", blockdevCmd)
+	}
+
+	if out, err := runCommand(blockdevCmd, "--flushbufs", device); err != nil {
+		return fmt.Errorf("flushing buffers of device %s failed: %w, output: %q", device, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+//go:build linux
+
+package driver
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceManager(t *testing.T) {
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+	log := logger.WithField("test", true)
+
+	volId := uuid.NewString()
+	wwn, err := hypervWWN(volId)
+	require.NoError(t, err)
+
+	link, err := hypervDiskByID(volId)
+	require.NoError(t, err)
+
+	// vpdPage builds a device identification page with a T10 vendor ID and a NAA designator
+	vpdPage := func(naa []byte) []byte {
+		designators := []byte{0x02, 0x01, 0x00, 0x08}
+		designators = append(designators, []byte("MSFT    ")...)
+		designators = append(designators, 0x01, 0x03, 0x00, byte(len(naa)))
+		designators = append(designators, naa...)
+
+		return append([]byte{0x00, vpdPageDeviceIdentification, 0x00, byte(len(designators))}, designators...)
+	}
+
+	newManager := func(t *testing.T, udev bool) (*deviceManager, string) {
+		sysDir := t.TempDir()
+
+		return &deviceManager{
+			resolve: func(devicePath string) (string, error) {
+				if udev && devicePath == link {
+					return "/dev/sdb", nil
+				}
+				return "", errors.New("no such file or directory")
+			},
+			sysDir:       sysDir,
+			devDir:       "/dev",
+			timeout:      200 * time.Millisecond,
+			pollInterval: 10 * time.Millisecond,
+			rescanDelay:  50 * time.Millisecond,
+		}, sysDir
+	}
+
+	writeFile := func(t *testing.T, path string, data []byte) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, data, 0644))
+	}
+
+	t.Run("udev link", func(t *testing.T) {
+		f, _ := newManager(t, true)
+
+		device, err := f.find(t.Context(), log, volId)
+		require.NoError(t, err)
+		require.Equal(t, link, device)
+	})
+
+	t.Run("sysfs wwid", func(t *testing.T) {
+		f, sysDir := newManager(t, false)
+		writeFile(t, filepath.Join(sysDir, "block", "sda", "device", "wwid"), []byte("naa.60022480000000000000000000000000\n"))
+		writeFile(t, filepath.Join(sysDir, "block", "sdb", "device", "wwid"), []byte("naa."+hex.EncodeToString(wwn)+"\n"))
+
+		device, strategy, err := f.lookup(link, wwn)
+		require.NoError(t, err)
+		require.Equal(t, "/dev/sdb", device)
+		require.Equal(t, deviceBySysfsWWID, strategy)
+	})
+
+	t.Run("vpd page 0x83", func(t *testing.T) {
+		f, sysDir := newManager(t, false)
+		writeFile(t, filepath.Join(sysDir, "block", "sda", "device", "vpd_pg83"), vpdPage(make([]byte, 16)))
+		writeFile(t, filepath.Join(sysDir, "block", "sdc", "device", "vpd_pg83"), vpdPage(wwn))
+
+		device, strategy, err := f.lookup(link, wwn)
+		require.NoError(t, err)
+		require.Equal(t, "/dev/sdc", device)
+		require.Equal(t, deviceByVPD, strategy)
+	})
+
+	t.Run("rescans SCSI hosts when device does not appear", func(t *testing.T) {
+		f, sysDir := newManager(t, false)
+		require.NoError(t, os.MkdirAll(filepath.Join(sysDir, "block"), 0755))
+		scan := filepath.Join(sysDir, "class", "scsi_host", "host0", "scan")
+		writeFile(t, scan, nil)
+
+		_, err := f.find(t.Context(), log, volId)
+		require.Error(t, err)
+
+		data, err := os.ReadFile(scan)
+		require.NoError(t, err)
+		require.Equal(t, "- - -", string(data))
+	})
+
+	t.Run("malformed vpd page", func(t *testing.T) {
+		require.False(t, vpdHasNAA(nil, wwn))
+		require.False(t, vpdHasNAA([]byte{0x00, 0x80, 0x00, 0x00}, wwn))
+
+		page := vpdPage(wwn)
+		require.False(t, vpdHasNAA(page[:len(page)-1], wwn))
+	})
+
+	t.Run("remove deletes the SCSI device", func(t *testing.T) {
+		f, sysDir := newManager(t, true)
+		deleteFile := filepath.Join(sysDir, "block", "sdb", "device", "delete")
+		writeFile(t, deleteFile, nil)
+		require.NoError(t, os.MkdirAll(filepath.Join(sysDir, "block", "sdb", "holders"), 0755))
+
+		var flushed []string
+		f.flush = func(device string) error {
+			flushed = append(flushed, device)
+			return nil
+		}
+
+		require.NoError(t, f.remove(log, volId))
+		require.Equal(t, []string{"/dev/sdb"}, flushed)
+
+		data, err := os.ReadFile(deleteFile)
+		require.NoError(t, err)
+		require.Equal(t, "1", string(data))
+	})
+
+	t.Run("remove refuses a device with holders", func(t *testing.T) {
+		f, sysDir := newManager(t, true)
+		deleteFile := filepath.Join(sysDir, "block", "sdb", "device", "delete")
+		writeFile(t, deleteFile, nil)
+		require.NoError(t, os.MkdirAll(filepath.Join(sysDir, "block", "sdb", "sdb1", "holders", "dm-0"), 0755))
+
+		f.flush = func(string) error {
+			t.Fatal("device with holders must not be flushed")
+			return nil
+		}
+
+		err := f.remove(log, volId)
+		inUse := &deviceInUseError{}
+		require.ErrorAs(t, err, &inUse)
+		require.Equal(t, []string{"dm-0"}, inUse.holders)
+
+		data, err := os.ReadFile(deleteFile)
+		require.NoError(t, err)
+		require.Empty(t, data)
+	})
+
+	t.Run("remove ignores a missing device", func(t *testing.T) {
+		f, sysDir := newManager(t, false)
+		require.NoError(t, os.MkdirAll(filepath.Join(sysDir, "block"), 0755))
+
+		require.NoError(t, f.remove(log, volId))
+	})
+}
@@ -0,0 +1,691 @@
+//go:build linux
+
+package driver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/fireflycons/hypervcsi/internal/linux/kvp"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"google.golang.org/grpc/codes"
+	"k8s.io/mount-utils"
+)
+
+const (
+	// DefaultKubeletDir is the directory in which kubelet mounts volumes
+	DefaultKubeletDir = "/var/lib/kubelet"
+
+	mountInfoPath = "/proc/self/mountinfo"
+
+	// doctorDialTimeout is how long to wait to connect to the backend
+	doctorDialTimeout = 10 * time.Second
+)
+
+// CheckStatus is the outcome of a doctor check
+type CheckStatus string
+
+const (
+	CheckPass CheckStatus = "pass"
+	CheckWarn CheckStatus = "warn"
+	CheckFail CheckStatus = "fail"
+	CheckSkip CheckStatus = "skip"
+)
+
+// CheckResult is the outcome of one doctor check
+type CheckResult struct {
+	Name    string      `json:"name"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message"`
+
+	// Hint suggests how to fix a check which did not pass
+	Hint string `json:"hint,omitempty"`
+}
+
+// DoctorReport is the outcome of all doctor checks
+type DoctorReport struct {
+
+	// Mode is "controller" if the API key was given, otherwise "node"
+	Mode   string        `json:"mode"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Failed is true if any check failed.
+func (r *DoctorReport) Failed() bool {
+	return slices.ContainsFunc(r.Checks, func(c CheckResult) bool {
+		return c.Status == CheckFail
+	})
+}
+
+// WriteTable writes the report as a table, with the hints of the checks which did not pass after it.
+func (r *DoctorReport) WriteTable(w io.Writer) error {
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "CHECK\tSTATUS\tDETAIL\n")
+	for _, c := range r.Checks {
+		// Joined errors span several lines
+		message := strings.ReplaceAll(c.Message, "\n", "; ")
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, strings.ToUpper(string(c.Status)), message)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, c := range r.Checks {
+		if c.Hint != "" {
+			if _, err := fmt.Fprintf(w, "\n%s: %s\n", c.Name, c.Hint); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteJSON writes the report as JSON.
+func (r *DoctorReport) WriteJSON(w io.Writer) error {
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
+
+// DoctorParams are the settings of the driver whose prerequisites are checked.
+type DoctorParams struct {
+	URL        string
+	ApiKey     string
+	NodeApiKey string
+	VmName     string
+	VmId       string
+	KubeletDir string
+}
+
+// doctor checks the prerequisites of the driver which most often cause failed installations.
+type doctor struct {
+	params     *DoctorParams
+	metadata   kvp.MetadataService
+	identity   kvp.MetadataService
+	httpClient *http.Client
+
+	// identityClient looks up and verifies the VM identity. If nil, there is no API key to do so.
+	identityClient hyperv.Client
+
+	lookPath   func(file string) (string, error)
+	diskIDDir  string
+	mountInfo  string
+
+	// rootCAs are the trusted certificate authorities. If nil, the system pool is used.
+	rootCAs *x509.CertPool
+}
+
+// Doctor runs the checks of the prerequisites of a node, and in controller mode
+// those of the connection to the backend, and returns their outcome.
+func Doctor(ctx context.Context, p *DoctorParams) *DoctorReport {
+
+	d := &doctor{
+		params:     p,
+		metadata:   kvp.New(),
+		httpClient: &http.Client{Timeout: doctorDialTimeout},
+		lookPath:   exec.LookPath,
+		diskIDDir:  diskIDPath,
+		mountInfo:  mountInfoPath,
+	}
+
+	// The VM with the BIOS UUID is looked up with the backend as the driver would, if there is a client
+	apiKey := p.ApiKey
+	if apiKey == "" {
+		apiKey = p.NodeApiKey
+	}
+
+	if apiKey != "" {
+		d.identityClient = d.newClient(apiKey)
+	}
+
+	d.identity = newIdentityChain(&NewDriverParams{VmName: p.VmName, VmId: p.VmId}, d.identityClient)
+
+	return d.run(ctx)
+}
+
+// newClient returns a client of the backend with the given API key.
+func (d *doctor) newClient(apiKey string) hyperv.Client {
+
+	client, err := hyperv.NewClient(d.params.URL, d.httpClient, apiKey, nil)
+	if err != nil {
+		// The URL is checked by checkProviderURL, which fails the backend checks before the client is used
+		return nil
+	}
+
+	return client
+}
+
+func (d *doctor) run(ctx context.Context) *DoctorReport {
+
+	report := &DoctorReport{
+		Mode: "node",
+	}
+
+	if d.params.ApiKey != "" {
+		report.Mode = "controller"
+	}
+
+	report.Checks = append(report.Checks,
+		d.checkKVPPools(),
+		d.checkVMIdentity(ctx),
+		d.checkDiskByID(),
+	)
+
+	report.Checks = append(report.Checks, d.checkBinaries()...)
+	report.Checks = append(report.Checks, d.checkMountPropagation())
+
+	if d.params.ApiKey != "" || d.params.NodeApiKey != "" {
+		report.Checks = append(report.Checks, d.checkBackend(ctx)...)
+	}
+
+	return report
+}
+
+func (d *doctor) checkKVPPools() CheckResult {
+
+	const name = "kvp-pools"
+
+	if !d.metadata.IsPresent() {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckWarn,
+			Message: "Hyper-V KVP pools are not present",
+			Hint:    "Run the Hyper-V KVP daemon (hv_kvp_daemon) on the node, and mount /var/lib/hyperv into the pod. Without it, the VM identity is taken from the BIOS UUID or --vm-name and --vm-id.",
+		}
+	}
+
+	pools, err := d.metadata.All()
+	if err != nil {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckFail,
+			Message: fmt.Sprintf("cannot read KVP pools: %v", err),
+			Hint:    "Check that the pool files in /var/lib/hyperv are readable by the plugin.",
+		}
+	}
+
+	if _, ok := pools[kvp.HostPool]; !ok {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckWarn,
+			Message: fmt.Sprintf("%d KVP pools readable but the host pool is missing", len(pools)),
+			Hint:    "Enable the Key-Value Pair Exchange integration service for the VM in Hyper-V.",
+		}
+	}
+
+	return CheckResult{
+		Name:    name,
+		Status:  CheckPass,
+		Message: fmt.Sprintf("%d KVP pools readable", len(pools)),
+	}
+}
+
+func (d *doctor) checkVMIdentity(ctx context.Context) CheckResult {
+
+	const name = "vm-identity"
+
+	vmName, nameErr := d.metadata.Find(kvp.VM_NAME_KEY)
+	vmId, idErr := d.metadata.Find(kvp.VM_ID_KEY)
+
+	if nameErr == nil && idErr == nil {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckPass,
+			Message: fmt.Sprintf("VM %s (%s) from KVP", vmName, vmId),
+		}
+	}
+
+	vmName, nameErr = d.identity.Find(kvp.VM_NAME_KEY)
+	vmId, idErr = d.identity.Find(kvp.VM_ID_KEY)
+
+	if err := errors.Join(nameErr, idErr); err != nil {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckFail,
+			Message: fmt.Sprintf("cannot determine VM name and ID: %v", err),
+			Hint:    "Enable Hyper-V KVP on the node, or give the VM name and ID with --vm-name and --vm-id.",
+		}
+	}
+
+	if d.identityClient != nil {
+		if err := verifyIdentity(ctx, d.identityClient, vmName, vmId); err != nil {
+			return CheckResult{
+				Name:    name,
+				Status:  CheckFail,
+				Message: err.Error(),
+				Hint:    "The VM name and ID found from the BIOS UUID or flags are not those of a VM on the Hyper-V host. Correct --vm-name and --vm-id, or enable Hyper-V KVP on the node.",
+			}
+		}
+	}
+
+	return CheckResult{
+		Name:    name,
+		Status:  CheckWarn,
+		Message: fmt.Sprintf("VM %s (%s) not in KVP, from the BIOS UUID or flags", vmName, vmId),
+		Hint:    "The VM name and ID keys are missing from the KVP host pool. Check that the Key-Value Pair Exchange integration service is enabled.",
+	}
+}
+
+func (d *doctor) checkDiskByID() CheckResult {
+
+	const name = "disk-by-id"
+
+	entries, err := os.ReadDir(d.diskIDDir)
+	if err != nil {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckWarn,
+			Message: fmt.Sprintf("cannot list %s: %v", d.diskIDDir, err),
+			Hint:    "udev is not creating disk links; attached disks are found from sysfs instead, which is slower. Mount /dev from the host into the pod.",
+		}
+	}
+
+	links := 0
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "scsi-3") {
+			links++
+		}
+	}
+
+	if links == 0 {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckWarn,
+			Message: fmt.Sprintf("no SCSI WWN links in %s", d.diskIDDir),
+			Hint:    "The udev rules for persistent storage (60-persistent-storage.rules) do not create scsi-3<wwn> links for Hyper-V disks; attached disks are found from sysfs instead.",
+		}
+	}
+
+	return CheckResult{
+		Name:    name,
+		Status:  CheckPass,
+		Message: fmt.Sprintf("%d SCSI WWN links in %s", links, d.diskIDDir),
+	}
+}
+
+// checkBinaries checks the tools the node uses to find, format and mount volumes. The tools
+// for ext4, the default filesystem, are required; those for other filesystems are optional.
+func (d *doctor) checkBinaries() []CheckResult {
+
+	var results []CheckResult
+
+	for _, bin := range []string{"findmnt", "blkid", blockdevCmd, "mkfs." + fstypeExt4} {
+		results = append(results, d.checkBinary(bin, true))
+	}
+
+	for _, fsType := range supportedFsTypes {
+		if fsType != fstypeExt4 {
+			results = append(results, d.checkBinary("mkfs."+fsType, false))
+		}
+	}
+
+	return results
+}
+
+func (d *doctor) checkBinary(bin string, required bool) CheckResult {
+
+	name := "binary/" + bin
+
+	path, err := d.lookPath(bin)
+	if err == nil {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckPass,
+			Message: path,
+		}
+	}
+
+	if !required {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckWarn,
+			Message: "not found in $PATH",
+			Hint:    fmt.Sprintf("Volumes cannot be formatted with %s.", strings.TrimPrefix(bin, "mkfs.")),
+		}
+	}
+
+	return CheckResult{
+		Name:    name,
+		Status:  CheckFail,
+		Message: "not found in $PATH",
+		Hint:    "Use the node plugin image, which provides the tools needed to format and mount volumes.",
+	}
+}
+
+// checkMountPropagation checks that the kubelet directory is a shared mount, so that
+// the volumes the plugin mounts are seen by kubelet and the pods.
+func (d *doctor) checkMountPropagation() CheckResult {
+
+	const name = "mount-propagation"
+
+	dir := d.params.KubeletDir
+	if dir == "" {
+		dir = DefaultKubeletDir
+	}
+
+	hint := fmt.Sprintf("Mount %s into the node plugin with mountPropagation: Bidirectional, and make it a shared mount on the host (mount --make-rshared /).", dir)
+
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckFail,
+			Message: fmt.Sprintf("kubelet directory %s: %v", dir, err),
+			Hint:    hint,
+		}
+	}
+
+	infos, err := mount.ParseMountInfo(d.mountInfo)
+	if err != nil {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckFail,
+			Message: fmt.Sprintf("cannot read mounts: %v", err),
+		}
+	}
+
+	// The mount containing the directory is the one with the longest mount point which is a parent of it
+	var containing *mount.MountInfo
+	for i := range infos {
+		mp := infos[i].MountPoint
+		if resolved == mp || mp == "/" || strings.HasPrefix(resolved, mp+"/") {
+			if containing == nil || len(mp) >= len(containing.MountPoint) {
+				containing = &infos[i]
+			}
+		}
+	}
+
+	if containing == nil {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckFail,
+			Message: fmt.Sprintf("no mount contains %s", dir),
+			Hint:    hint,
+		}
+	}
+
+	if !slices.ContainsFunc(containing.OptionalFields, func(f string) bool { return strings.HasPrefix(f, "shared:") }) {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckFail,
+			Message: fmt.Sprintf("%s is on mount %s, which is not shared", dir, containing.MountPoint),
+			Hint:    hint,
+		}
+	}
+
+	return CheckResult{
+		Name:    name,
+		Status:  CheckPass,
+		Message: fmt.Sprintf("%s is on shared mount %s", dir, containing.MountPoint),
+	}
+}
+
+// checkBackend checks the connection to the backend and the API keys. Once a check fails, those depending on it are skipped.
+func (d *doctor) checkBackend(ctx context.Context) []CheckResult {
+
+	skipped := func(names ...string) []CheckResult {
+		results := make([]CheckResult, 0, len(names))
+		for _, n := range names {
+			results = append(results, CheckResult{Name: n, Status: CheckSkip, Message: "skipped after an earlier failure"})
+		}
+		return results
+	}
+
+	dependents := []string{"provider-tls", "backend-version", "api-key"}
+	if d.params.NodeApiKey != "" {
+		dependents = append(dependents, "node-api-key")
+	}
+
+	u, reachable := d.checkProviderURL(ctx)
+	results := []CheckResult{reachable}
+	if reachable.Status == CheckFail {
+		return append(results, skipped(dependents...)...)
+	}
+
+	tlsResult := d.checkTLS(ctx, u)
+	results = append(results, tlsResult)
+	if tlsResult.Status == CheckFail {
+		return append(results, skipped(dependents[1:]...)...)
+	}
+
+	results = append(results, d.checkBackendVersion(ctx))
+
+	if d.params.ApiKey != "" {
+		results = append(results, d.checkApiKey(ctx))
+	} else {
+		results = append(results, CheckResult{Name: "api-key", Status: CheckSkip, Message: "not given; node mode"})
+	}
+
+	if d.params.NodeApiKey != "" {
+		results = append(results, d.checkNodeApiKey(ctx))
+	}
+
+	return results
+}
+
+func (d *doctor) checkProviderURL(ctx context.Context) (*url.URL, CheckResult) {
+
+	const name = "provider-url"
+
+	u, err := url.Parse(d.params.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, CheckResult{
+			Name:    name,
+			Status:  CheckFail,
+			Message: fmt.Sprintf("invalid URL %q", d.params.URL),
+			Hint:    "Give the URL of the Windows service with --url, e.g. https://hyperv-host:8443.",
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: doctorDialTimeout}
+
+	conn, err := dialer.DialContext(ctx, "tcp", hostPort(u))
+	if err != nil {
+		return nil, CheckResult{
+			Name:    name,
+			Status:  CheckFail,
+			Message: fmt.Sprintf("cannot connect to %s: %v", hostPort(u), err),
+			Hint:    "Check that the Windows service is running, and that the Windows firewall on the Hyper-V host allows the port.",
+		}
+	}
+
+	_ = conn.Close()
+
+	return u, CheckResult{
+		Name:    name,
+		Status:  CheckPass,
+		Message: fmt.Sprintf("%s is reachable", hostPort(u)),
+	}
+}
+
+func (d *doctor) checkTLS(ctx context.Context, u *url.URL) CheckResult {
+
+	const name = "provider-tls"
+
+	if u.Scheme != "https" {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckWarn,
+			Message: "the provider URL does not use TLS",
+			Hint:    "The API key is sent in clear. Install the Windows service with a certificate and use an https URL.",
+		}
+	}
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: doctorDialTimeout},
+		Config: &tls.Config{
+			RootCAs:    d.rootCAs,
+			ServerName: u.Hostname(),
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", hostPort(u))
+	if err != nil {
+		hint := "Check the certificate of the Windows service."
+
+		var unknownAuthority x509.UnknownAuthorityError
+		var hostnameErr x509.HostnameError
+
+		switch {
+		case errors.As(err, &unknownAuthority):
+			hint = "The certificate of the Windows service is not signed by a trusted authority. Set .controller.caCert in the Helm chart to its CA certificate."
+		case errors.As(err, &hostnameErr):
+			hint = "The certificate of the Windows service is not valid for the host name in the URL. Use a host name in its subject alternative names."
+		}
+
+		return CheckResult{
+			Name:    name,
+			Status:  CheckFail,
+			Message: fmt.Sprintf("TLS handshake failed: %v", err),
+			Hint:    hint,
+		}
+	}
+
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	leaf := state.PeerCertificates[0]
+
+	return CheckResult{
+		Name:    name,
+		Status:  CheckPass,
+		Message: fmt.Sprintf("certificate %q trusted, expires %s", leaf.Subject.CommonName, leaf.NotAfter.UTC().Format(time.DateOnly)),
+	}
+}
+
+func (d *doctor) checkBackendVersion(ctx context.Context) CheckResult {
+
+	const name = "backend-version"
+
+	health, err := d.newClient("").HealthCheck(ctx)
+	if err != nil {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckFail,
+			Message: fmt.Sprintf("health check failed: %v", err),
+			Hint:    "Refer to the event log on the Hyper-V server.",
+		}
+	}
+
+	switch health.Version {
+	case "":
+		return CheckResult{
+			Name:    name,
+			Status:  CheckWarn,
+			Message: "backend is healthy but does not report its version",
+			Hint:    fmt.Sprintf("Upgrade the Windows service to version %s.", common.Version),
+		}
+
+	case common.Version:
+		return CheckResult{
+			Name:    name,
+			Status:  CheckPass,
+			Message: fmt.Sprintf("backend is healthy, version %s", health.Version),
+		}
+
+	default:
+		return CheckResult{
+			Name:    name,
+			Status:  CheckWarn,
+			Message: fmt.Sprintf("backend version %s differs from plugin version %s", health.Version, common.Version),
+			Hint:    "Upgrade the Windows service and the Helm chart to the same release.",
+		}
+	}
+}
+
+func (d *doctor) checkApiKey(ctx context.Context) CheckResult {
+
+	const name = "api-key"
+
+	if _, err := d.newClient(d.params.ApiKey).GetCapacity(ctx); err != nil {
+		return apiKeyResult(name, err, "The API key was printed when the Windows service was installed. Set it as .controller.apiKey in the Helm chart.")
+	}
+
+	return CheckResult{
+		Name:    name,
+		Status:  CheckPass,
+		Message: "API key accepted",
+	}
+}
+
+// checkNodeApiKey checks the node API key by getting the VM of the node, which is the only call it allows other than for ephemeral volumes.
+func (d *doctor) checkNodeApiKey(ctx context.Context) CheckResult {
+
+	const name = "node-api-key"
+
+	vmId, err := d.identity.Find(kvp.VM_ID_KEY)
+	if err != nil {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckSkip,
+			Message: "VM ID is not known",
+		}
+	}
+
+	if _, err := d.newClient(d.params.NodeApiKey).GetVm(ctx, vmId); err != nil {
+		return apiKeyResult(name, err, "The node API key was printed when the Windows service was installed. Set it as .controller.nodeApiKey in the Helm chart.")
+	}
+
+	return CheckResult{
+		Name:    name,
+		Status:  CheckPass,
+		Message: "node API key accepted",
+	}
+}
+
+func apiKeyResult(name string, err error, hint string) CheckResult {
+
+	restErr := &rest.Error{}
+	if errors.As(err, &restErr) && restErr.Code == codes.PermissionDenied {
+		return CheckResult{
+			Name:    name,
+			Status:  CheckFail,
+			Message: "rejected by the backend",
+			Hint:    hint,
+		}
+	}
+
+	return CheckResult{
+		Name:    name,
+		Status:  CheckFail,
+		Message: fmt.Sprintf("request failed: %v", err),
+	}
+}
+
+// hostPort returns the host and port of a URL, with the default port of its scheme if it has none.
+func hostPort(u *url.URL) string {
+
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	return net.JoinHostPort(u.Hostname(), "80")
+}
@@ -0,0 +1,254 @@
+//go:build linux
+
+package driver
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/linux/kvp"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// newTestDoctor returns a doctor of a node whose prerequisites are all met, with a backend served by the given handler
+func newTestDoctor(t *testing.T, vmId string, backend http.Handler) (*doctor, *httptest.Server) {
+
+	// The KVP daemon creates pools 0 to 4
+	kvpDir := t.TempDir()
+	for i := range kvp.HostPool {
+		require.NoError(t, kvp.NewPoolWriter(kvpDir, i).Write("other", "value"))
+	}
+
+	w := kvp.NewPoolWriter(kvpDir, kvp.HostPool)
+	require.NoError(t, w.Write(kvp.VM_NAME_KEY, "node1"))
+	require.NoError(t, w.Write(kvp.VM_ID_KEY, vmId))
+
+	diskIDDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(diskIDDir, "scsi-360022480c0ffee"), nil, 0600))
+
+	kubeletDir := t.TempDir()
+	mountInfo := filepath.Join(t.TempDir(), "mountinfo")
+	require.NoError(t, os.WriteFile(mountInfo, []byte(
+		"22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw\n"+
+			"50 22 0:40 / "+kubeletDir+" rw,relatime shared:20 - tmpfs tmpfs rw\n",
+	), 0600))
+
+	// The TLS checks close connections without a request, which the server would log
+	server := httptest.NewUnstartedServer(backend)
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	md := kvp.NewForDirectory(kvpDir)
+
+	return &doctor{
+		params: &DoctorParams{
+			URL:        server.URL,
+			ApiKey:     "api-key",
+			KubeletDir: kubeletDir,
+		},
+		metadata:   md,
+		identity:   md,
+		httpClient: server.Client(),
+		lookPath: func(file string) (string, error) {
+			return "/usr/sbin/" + file, nil
+		},
+		diskIDDir: diskIDDir,
+		mountInfo: mountInfo,
+		rootCAs:   rootCAs,
+	}, server
+}
+
+// testBackend serves the routes called by the doctor, accepting the given API keys
+func testBackend(version, apiKey, nodeApiKey string) http.Handler {
+
+	mux := http.NewServeMux()
+
+	authorized := func(key string, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(constants.ApiKeyHeader) != key {
+				w.WriteHeader(http.StatusForbidden)
+				_ = json.NewEncoder(w).Encode(&rest.Error{Code: codes.PermissionDenied, Message: "Invalid API key"})
+				return
+			}
+			next(w, r)
+		}
+	}
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(&rest.HealthyResponse{Status: "ok", Version: version})
+	})
+
+	mux.HandleFunc("GET /capacity", authorized(apiKey, func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(&rest.GetCapacityResponse{AvailableCapacity: constants.TiB})
+	}))
+
+	mux.HandleFunc("GET /vm", authorized(nodeApiKey, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&rest.GetVMResponse{ID: r.URL.Query().Get("id")})
+	}))
+
+	return mux
+}
+
+func requireCheck(t *testing.T, report *DoctorReport, name string, status CheckStatus) CheckResult {
+
+	t.Helper()
+
+	for _, c := range report.Checks {
+		if c.Name == name {
+			require.Equal(t, status, c.Status, "%s: %s", name, c.Message)
+			return c
+		}
+	}
+
+	require.Failf(t, "check not run", "%s", name)
+	return CheckResult{}
+}
+
+func TestDoctorPasses(t *testing.T) {
+
+	vmId := uuid.NewString()
+
+	d, _ := newTestDoctor(t, vmId, testBackend(common.Version, "api-key", "node-api-key"))
+	d.params.NodeApiKey = "node-api-key"
+
+	report := d.run(t.Context())
+
+	require.Equal(t, "controller", report.Mode)
+	require.False(t, report.Failed())
+
+	for _, c := range report.Checks {
+		require.Equal(t, CheckPass, c.Status, "%s: %s", c.Name, c.Message)
+	}
+
+	c := requireCheck(t, report, "vm-identity", CheckPass)
+	require.Contains(t, c.Message, vmId)
+
+	var table strings.Builder
+	require.NoError(t, report.WriteTable(&table))
+	require.Contains(t, table.String(), "provider-tls")
+
+	var out strings.Builder
+	require.NoError(t, report.WriteJSON(&out))
+
+	decoded := &DoctorReport{}
+	require.NoError(t, json.Unmarshal([]byte(out.String()), decoded))
+	require.Equal(t, report, decoded)
+}
+
+func TestDoctorNodeFailures(t *testing.T) {
+
+	d, _ := newTestDoctor(t, uuid.NewString(), testBackend(common.Version, "api-key", ""))
+	d.params.ApiKey = ""
+
+	d.lookPath = func(file string) (string, error) {
+		if file == "blkid" || file == "mkfs.xfs" {
+			return "", exec.ErrNotFound
+		}
+		return "/usr/sbin/" + file, nil
+	}
+
+	require.NoError(t, os.WriteFile(d.mountInfo, []byte("22 1 8:1 / / rw,relatime - ext4 /dev/sda1 rw\n"), 0600))
+	require.NoError(t, os.Remove(filepath.Join(d.diskIDDir, "scsi-360022480c0ffee")))
+
+	report := d.run(t.Context())
+
+	require.Equal(t, "node", report.Mode)
+	require.True(t, report.Failed())
+
+	requireCheck(t, report, "binary/blkid", CheckFail)
+	requireCheck(t, report, "binary/mkfs.xfs", CheckWarn)
+	requireCheck(t, report, "disk-by-id", CheckWarn)
+
+	c := requireCheck(t, report, "mount-propagation", CheckFail)
+	require.Contains(t, c.Hint, "Bidirectional")
+
+	// The backend is not checked without an API key
+	for _, c := range report.Checks {
+		require.NotEqual(t, "provider-url", c.Name)
+	}
+}
+
+func TestDoctorVMIdentityFallback(t *testing.T) {
+
+	d, _ := newTestDoctor(t, uuid.NewString(), testBackend(common.Version, "api-key", ""))
+
+	d.metadata = kvp.NewForDirectory(filepath.Join(t.TempDir(), "missing"))
+	d.identity = kvp.NewChain(d.metadata, kvp.NewStatic("node1", constants.ZeroUUID))
+
+	report := d.run(t.Context())
+
+	requireCheck(t, report, "kvp-pools", CheckWarn)
+	c := requireCheck(t, report, "vm-identity", CheckWarn)
+	require.Contains(t, c.Message, constants.ZeroUUID)
+
+	d.identity = d.metadata
+
+	report = d.run(t.Context())
+
+	requireCheck(t, report, "vm-identity", CheckFail)
+}
+
+func TestDoctorBackendFailures(t *testing.T) {
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		d, _ := newTestDoctor(t, uuid.NewString(), testBackend(common.Version, "api-key", ""))
+		d.rootCAs = x509.NewCertPool()
+
+		report := d.run(t.Context())
+
+		requireCheck(t, report, "provider-url", CheckPass)
+		c := requireCheck(t, report, "provider-tls", CheckFail)
+		require.Contains(t, c.Hint, "trusted authority")
+		requireCheck(t, report, "backend-version", CheckSkip)
+		requireCheck(t, report, "api-key", CheckSkip)
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		d, server := newTestDoctor(t, uuid.NewString(), testBackend(common.Version, "api-key", ""))
+		server.Close()
+
+		report := d.run(t.Context())
+
+		requireCheck(t, report, "provider-url", CheckFail)
+		requireCheck(t, report, "provider-tls", CheckSkip)
+	})
+
+	t.Run("invalid API keys", func(t *testing.T) {
+		d, _ := newTestDoctor(t, uuid.NewString(), testBackend(common.Version, "other-key", "other-node-key"))
+		d.params.NodeApiKey = "node-api-key"
+
+		report := d.run(t.Context())
+
+		requireCheck(t, report, "backend-version", CheckPass)
+		c := requireCheck(t, report, "api-key", CheckFail)
+		require.Equal(t, "rejected by the backend", c.Message)
+		requireCheck(t, report, "node-api-key", CheckFail)
+	})
+
+	t.Run("version mismatch", func(t *testing.T) {
+		d, _ := newTestDoctor(t, uuid.NewString(), testBackend("0.0.0", "api-key", ""))
+
+		report := d.run(t.Context())
+
+		requireCheck(t, report, "backend-version", CheckWarn)
+		require.False(t, report.Failed())
+	})
+}
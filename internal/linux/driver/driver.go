@@ -35,18 +35,23 @@ import (
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/constants"
 	"github.com/fireflycons/hypervcsi/internal/hyperv"
 	"github.com/fireflycons/hypervcsi/internal/linux/kvp"
 	"github.com/fireflycons/hypervcsi/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 )
 
 const (
 	// DefaultDriverName defines the name that is used in Kubernetes and the CSI
 	// system for the canonical, official name of this plugin
-	DefaultDriverName    = "hyperv.csi.fireflycons.io"
+	DefaultDriverName    = constants.DriverName
 	DefaultDriverNameRDN = "io.fireflycons.csi.hyperv"
 
 	defaultVolumesPageSize = 50
@@ -77,12 +82,17 @@ type Driver struct {
 	// `ControllerPublishVolume` to `NodeStageVolume or `NodePublishVolume`
 	publishInfoVolumeName string
 
+	// publishInfoReadOnly is set in the publish context by `ControllerPublishVolume`
+	// when the volume has been attached read-only
+	publishInfoReadOnly string
+
 	// unix socket endpoint
 	endpoint string
 
 	debugAddr              string
 	hostID                 func() string
 	isController           bool
+	ephemeralVolumes       bool
 	defaultVolumesPageSize uint
 	validateAttachment     bool
 
@@ -96,14 +106,52 @@ type Driver struct {
 
 	hypervClient hyperv.Client
 
-	mounter Mounter
+	mounter   Mounter
+	encryptor Encryptor
 
 	healthChecker *HealthChecker
 
+	// orphanCollector finds volumes with no PersistentVolume.
+	// It is nil unless enabled on the controller.
+	orphanCollector *orphanCollector
+
+	// attachmentReconciler detaches volumes with no VolumeAttachment.
+	// It is nil unless enabled on the controller.
+	attachmentReconciler *attachmentReconciler
+
+	// metrics holds the metrics of the orphan collector and attachment reconciler
+	metrics *prometheus.Registry
+
+	// recorder records Kubernetes events. It is nil unless the controller has a Kubernetes client.
+	recorder record.EventRecorder
+
+	// forceDetachGracePeriod is how long a VM must have been stopped before a volume
+	// attached to it may be detached to publish it elsewhere. Zero disables this.
+	forceDetachGracePeriod time.Duration
+
+	// devices finds and removes the block devices of attached disks
+	devices *deviceManager
+
+	// nodeStatus publishes the status of the node plugin to the host.
+	// It is nil unless enabled on a node.
+	nodeStatus *nodeStatus
+
+	// vmStoppedSince is when each VM was first found stopped, keyed by lower case VM ID
+	vmStoppedSince map[string]time.Time
+	vmStoppedMu    sync.Mutex
+
+	// fsckResults holds the result of the filesystem check made
+	// when each volume was staged, keyed by volume ID. It is not
+	// persisted, so is lost when the node plugin restarts.
+	fsckResults sync.Map
+
 	// ready defines whether the driver is ready to function. This value will
 	// be used by the `Identity` service via the `Probe()` method.
-	readyMu     sync.Mutex // protects ready
-	ready       bool
+	readyMu sync.Mutex // protects ready
+	ready   bool
+
+	// volumeLimit is the number of volumes which may be attached to the node,
+	// if it cannot be found from the VM's SCSI controllers. Zero is unlimited.
 	volumeLimit uint
 }
 
@@ -117,8 +165,41 @@ type NewDriverParams struct {
 	ValidateAttachment     bool
 	VolumeLimit            uint
 	Metadata               kvp.MetadataService
+	VmName                 string
+	VmId                   string
 	ApiKey                 string
+	NodeApiKey             string
 	LogLevel               logrus.Level
+
+	// OrphanScanInterval is how often the controller scans for volumes
+	// with no PersistentVolume. Zero disables the scan.
+	OrphanScanInterval time.Duration
+
+	// OrphanGracePeriod is how long a volume must have been orphaned before it is deleted
+	OrphanGracePeriod time.Duration
+
+	// DeleteOrphans enables deletion of orphaned volumes after the grace period
+	DeleteOrphans bool
+
+	// AttachmentScanInterval is how often the controller scans for volumes
+	// attached with no VolumeAttachment. Zero disables the scan.
+	AttachmentScanInterval time.Duration
+
+	// StaleAttachmentDelay is how long an attachment must have had no VolumeAttachment before it is detached
+	StaleAttachmentDelay time.Duration
+
+	// ForceDetachGracePeriod is how long a VM must have been Off before a volume
+	// attached to it may be detached to publish it to another node. Zero disables this.
+	ForceDetachGracePeriod time.Duration
+
+	// PublishNodeStatus enables publishing the status of the node plugin to the host through KVP
+	PublishNodeStatus bool
+
+	// NodeStatusWriter is the KVP pool to which node status is published. If nil, it is the guest pool.
+	NodeStatusWriter kvp.PoolWriter
+
+	// KubeClient is used by the orphan and attachment scans. If nil, one is created from the in-cluster config.
+	KubeClient kubernetes.Interface
 }
 
 // NewDriver returns a CSI plugin that contains the necessary gRPC
@@ -138,33 +219,52 @@ func NewDriver(p *NewDriverParams) (*Driver, error) {
 	log := logging.New(p.LogLevel)
 
 	log.WithFields(logrus.Fields{
-		"endpoint":    p.Endpoint,
-		"driver-name": p.DriverName,
-		"url":         p.URL,
-		"api-key":     common.Redact(p.ApiKey),
-		"log-level":   p.LogLevel,
+		"endpoint":     p.Endpoint,
+		"driver-name":  p.DriverName,
+		"url":          p.URL,
+		"api-key":      common.Redact(p.ApiKey),
+		"node-api-key": common.Redact(p.NodeApiKey),
+		"log-level":    p.LogLevel,
 	}).Info("Startup arguments")
 
+	// The node plugin may only call the backend for ephemeral volumes, with the node API key
+	apiKey := p.ApiKey
+	if apiKey == "" {
+		apiKey = p.NodeApiKey
+	}
+
+	hyperVClient, err := hyperv.NewClient(p.URL, &http.Client{}, apiKey, logrus.NewEntry(log))
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot create Hyper-V client: %w", err)
+	}
+
+	// Without an API key the backend cannot be asked for the VM
+	var identityClient hyperv.Client
+	if apiKey != "" {
+		identityClient = hyperVClient
+	}
+
 	md := p.Metadata
 	if md == nil {
-		md = kvp.New()
+		md = newIdentityChain(p, identityClient)
 	}
 
 	if !md.IsPresent() {
-		log.Error("Hyper-V KVP metadata service is not present; the driver cannot function")
-		return nil, errors.New("hyper-v kvp metadata service is not present")
+		log.Error("no source of VM identity is present; the driver cannot function without Hyper-V KVP, the BIOS UUID or the VM name and ID given explicitly")
+		return nil, errors.New("no source of VM identity is present")
 	}
 
 	vmName, err := md.Find(kvp.VM_NAME_KEY)
 	if err != nil {
-		log.WithError(err).Error("cannot retrieve VM name from Hyper-V KVP metadata service")
-		return nil, fmt.Errorf("cannot retrieve VM name from Hyper-V KVP metadata service: %w", err)
+		log.WithError(err).Error("cannot retrieve VM name")
+		return nil, fmt.Errorf("cannot retrieve VM name: %w", err)
 	}
 
 	vmId, err := md.Find(kvp.VM_ID_KEY)
 	if err != nil {
-		log.WithError(err).Error("cannot retrieve VM ID from Hyper-V KVP metadata service")
-		return nil, fmt.Errorf("cannot retrieve VM ID from Hyper-V KVP metadata service: %w", err)
+		log.WithError(err).Error("cannot retrieve VM ID")
+		return nil, fmt.Errorf("cannot retrieve VM ID: %w", err)
 	}
 
 	logEntry := log.WithFields(logrus.Fields{
@@ -172,32 +272,105 @@ func NewDriver(p *NewDriverParams) (*Driver, error) {
 		"vm_id":   vmId,
 	})
 
-	hyperVClient, err := hyperv.NewClient(p.URL, &http.Client{}, p.ApiKey, logEntry)
+	if identityClient != nil {
+		if err := verifyIdentity(context.Background(), identityClient, vmName, vmId); err != nil {
+			logEntry.WithError(err).Error("VM identity does not match the backend")
+			return nil, fmt.Errorf("cannot verify VM identity: %w", err)
+		}
+	}
 
-	if err != nil {
-		return nil, fmt.Errorf("cannot create Hyper-V client: %w", err)
+	if host, err := md.Host(); err != nil {
+		logEntry.WithError(err).Warn("cannot retrieve host details from Hyper-V KVP")
+	} else {
+		logEntry.WithFields(logrus.Fields{
+			"host_name":          host.HostName,
+			"physical_host_name": host.PhysicalHostNameFullyQualified,
+			"host_os_version":    host.OSVersion(),
+			"nested_level":       host.NestedLevel,
+		}).Info("Running on Hyper-V host")
 	}
 
-	return &Driver{
+	d := &Driver{
 		name:                   driverName,
 		vmName:                 vmName,
 		vmId:                   vmId,
 		publishInfoVolumeName:  driverName + "/volume-name",
+		publishInfoReadOnly:    driverName + "/readonly",
 		endpoint:               p.Endpoint,
 		debugAddr:              p.DebugAddr,
 		defaultVolumesPageSize: defaultVolumesPageSize,
 		hypervClient:           hyperVClient,
 		log:                    logEntry,
 		mounter:                newMounter(logEntry),
+		encryptor:              newEncryptor(logEntry),
 		metadata:               md,
 		isController:           p.ApiKey != "",
+		ephemeralVolumes:       p.NodeApiKey != "",
 		hostID: func() string {
-			// This should not error because we already tested it during initialization
-			id, _ := md.Find(kvp.VM_ID_KEY)
-			return id
+			return vmId
 		},
-		healthChecker: NewHealthChecker(&hvHealthChecker{client: hyperVClient}),
-	}, nil
+		healthChecker:          NewHealthChecker(&hvHealthChecker{client: hyperVClient}),
+		forceDetachGracePeriod: p.ForceDetachGracePeriod,
+		volumeLimit:            p.VolumeLimit,
+	}
+
+	d.devices = newDeviceManager(d.mounter)
+
+	if !d.isController && p.PublishNodeStatus {
+
+		writer := p.NodeStatusWriter
+		if writer == nil {
+			writer = kvp.NewGuestPoolWriter()
+		}
+
+		d.nodeStatus = newNodeStatus(writer, logEntry)
+	}
+
+	if d.isController && (p.OrphanScanInterval > 0 || p.AttachmentScanInterval > 0 || p.ForceDetachGracePeriod > 0) {
+
+		kubeClient := p.KubeClient
+
+		if kubeClient == nil {
+			kubeClient, d.recorder, err = newKubeClient(driverName)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		d.metrics = prometheus.NewRegistry()
+		pageSize := int(p.DefaultVolumesPageSize) //nolint:gosec // conversions are OK here
+
+		if p.OrphanScanInterval > 0 {
+			d.orphanCollector = newOrphanCollector(&orphanCollectorParams{
+				HypervClient:  hyperVClient,
+				KubeClient:    kubeClient,
+				Recorder:      d.recorder,
+				Registerer:    d.metrics,
+				Log:           logEntry,
+				DriverName:    driverName,
+				Interval:      p.OrphanScanInterval,
+				GracePeriod:   p.OrphanGracePeriod,
+				DeleteOrphans: p.DeleteOrphans,
+				PageSize:      pageSize,
+			})
+		}
+
+		if p.AttachmentScanInterval > 0 {
+			d.attachmentReconciler = newAttachmentReconciler(&attachmentReconcilerParams{
+				HypervClient: hyperVClient,
+				KubeClient:   kubeClient,
+				Unpublish:    d.unpublish,
+				Registerer:   d.metrics,
+				Log:          logEntry,
+				DriverName:   driverName,
+				Interval:     p.AttachmentScanInterval,
+				Delay:        p.StaleAttachmentDelay,
+				PageSize:     pageSize,
+			})
+		}
+	}
+
+	return d, nil
 }
 
 // Run starts the CSI plugin by communication over the given endpoint
@@ -271,6 +444,9 @@ func (d *Driver) Run(ctx context.Context) error {
 				}
 				w.WriteHeader(http.StatusOK)
 			})
+			if d.metrics != nil {
+				mux.Handle("/metrics", promhttp.HandlerFor(d.metrics, promhttp.HandlerOpts{}))
+			}
 			d.httpSrv = &http.Server{
 				Addr:              d.debugAddr,
 				Handler:           mux,
@@ -285,12 +461,26 @@ func (d *Driver) Run(ctx context.Context) error {
 	csi.RegisterNodeServer(d.srv, d)
 
 	d.ready = true // we're now ready to go!
+	d.nodeStatus.start(common.Version, func(path string) bool {
+		mounted, err := d.mounter.IsMounted(path)
+		return err == nil && mounted
+	})
 	d.log.WithFields(logrus.Fields{
 		"grpc_addr": grpcAddr,
 		"http_addr": d.debugAddr,
 	}).Info("starting server")
 
 	var eg errgroup.Group
+	if d.orphanCollector != nil {
+		eg.Go(func() error {
+			return d.orphanCollector.Run(ctx)
+		})
+	}
+	if d.attachmentReconciler != nil {
+		eg.Go(func() error {
+			return d.attachmentReconciler.Run(ctx)
+		})
+	}
 	if d.httpSrv != nil {
 		eg.Go(func() error {
 			const shutdownTimeout = 10 * time.Second
@@ -315,6 +505,7 @@ func (d *Driver) Run(ctx context.Context) error {
 			d.readyMu.Lock()
 			d.ready = false
 			d.readyMu.Unlock()
+			d.nodeStatus.stop()
 			d.srv.GracefulStop()
 		}()
 		return d.srv.Serve(grpcListener)
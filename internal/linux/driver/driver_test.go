@@ -81,7 +81,12 @@ func TestDriverSuite(t *testing.T) {
 			vmIdx++
 			return vms[i]
 		},
-		mounter:      fm,
+		mounter: fm,
+		devices: newDeviceManager(fm),
+		encryptor: &fakeEncryptor{
+			luks:   map[string]string{},
+			mapped: map[string]string{},
+		},
 		log:          l.WithField("test_enabed", true),
 		hypervClient: client,
 	}
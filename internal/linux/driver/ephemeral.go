@@ -0,0 +1,168 @@
+//go:build linux
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ephemeralContextKey is set in the volume context by kubelet
+	// for CSI ephemeral inline volumes
+	ephemeralContextKey = "csi.storage.k8s.io/ephemeral"
+
+	// ephemeralSizeAttribute is the volume attribute of an inline
+	// volume which gives the size of the volume, e.g. 10Gi
+	ephemeralSizeAttribute = "size"
+
+	// ephemeralVolumeIDPrefix is the prefix of the volume handle that kubelet generates for
+	// CSI ephemeral inline volumes. Persistent volume IDs are Hyper-V disk identifiers
+	// (UUIDs) so can never have this prefix.
+	ephemeralVolumeIDPrefix = "csi-"
+)
+
+// isEphemeralVolume determines whether a volume ID is that of an ephemeral inline volume.
+// The volume context is not available to NodeUnpublishVolume, so the ID must be used.
+func (d *Driver) isEphemeralVolume(volumeID string) bool {
+	return d.ephemeralVolumes && strings.HasPrefix(volumeID, ephemeralVolumeIDPrefix)
+}
+
+// nodePublishEphemeralVolume creates and attaches a scratch disk for an ephemeral inline volume,
+// then formats and mounts it to the target path. The disk is formatted with the fs type from the
+// volume capability and any mkfs options given in the volume attributes.
+func (d *Driver) nodePublishEphemeralVolume(ctx context.Context, req *csi.NodePublishVolumeRequest, mountOptions []string, log *logrus.Entry) error {
+	if !d.ephemeralVolumes {
+		return status.Error(codes.InvalidArgument, "ephemeral volumes are not enabled on this node")
+	}
+
+	mnt := req.GetVolumeCapability().GetMount()
+
+	fsType := fstypeExt4
+	if mnt.FsType != "" {
+		fsType = mnt.FsType
+	}
+
+	if !slices.Contains(supportedFsTypes, fsType) {
+		return status.Errorf(codes.InvalidArgument, "unsupported fs type %q, must be one of %s", fsType, strings.Join(supportedFsTypes, ", "))
+	}
+
+	size, err := ephemeralVolumeSize(req.VolumeContext)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	target := req.TargetPath
+	mountOptions = append(mountOptions, mnt.MountFlags...)
+
+	log = log.WithFields(logrus.Fields{
+		"volume_mode":   volumeModeFilesystem,
+		"fs_type":       fsType,
+		"mount_options": mountOptions,
+		"storage_size":  common.FormatBytes(size),
+		"ephemeral":     true,
+	})
+
+	mounted, err := d.mounter.IsMounted(target)
+	if err != nil {
+		return err
+	}
+
+	if mounted {
+		log.Info("ephemeral volume is already mounted")
+		return nil
+	}
+
+	log.Info("creating ephemeral volume")
+	vol, err := d.hypervClient.CreateEphemeralVolume(ctx, req.VolumeId, d.hostID(), size)
+	if err != nil {
+		return processErrorReturn(err, log, "create ephemeral volume")
+	}
+
+	source, err := d.devices.find(ctx, log, vol.ID)
+	if err != nil {
+		return status.Errorf(codes.Internal, "ephemeral volume %q was attached but its device did not appear: %v", req.VolumeId, err)
+	}
+
+	log = log.WithField("source", source)
+
+	formatted, err := d.mounter.IsFormatted(source)
+	if err != nil {
+		return err
+	}
+
+	if !formatted {
+		mkfsOptions := volumeMkfsOptions(req.VolumeContext, fsType)
+		log.WithField("mkfs_options", mkfsOptions).Info("formatting ephemeral volume")
+		if err := d.mounter.Format(source, fsType, mkfsOptions...); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	log.Info("mounting ephemeral volume")
+	if err := d.mounter.Mount(source, target, fsType, mountOptions...); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	return nil
+}
+
+// nodeUnpublishEphemeralVolume removes the device of the scratch disk of an ephemeral inline volume
+// once it has been unmounted from the given device, as NodeUnstageVolume does for other volumes,
+// then detaches and deletes the disk. The device is empty if the target was not mounted.
+func (d *Driver) nodeUnpublishEphemeralVolume(ctx context.Context, volumeID, device string, log *logrus.Entry) error {
+
+	if device == "" {
+		log.Info("ephemeral volume is not mounted, so its disk device is not known")
+	} else {
+		resolved, err := d.mounter.ResolveDevice(device)
+		if err != nil {
+			log.WithError(err).Info("disk device is not present")
+		} else if err := d.devices.removeDevice(log, resolved); err != nil {
+			inUse := &deviceInUseError{}
+			if errors.As(err, &inUse) {
+				return status.Errorf(codes.FailedPrecondition, "NodeUnpublishVolume cannot remove disk device: %v", err)
+			}
+
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	log.Info("deleting ephemeral volume")
+	if err := d.hypervClient.DeleteEphemeralVolume(ctx, volumeID, d.hostID()); err != nil {
+		return processErrorReturn(err, log, "delete ephemeral volume")
+	}
+
+	return nil
+}
+
+// ephemeralVolumeSize returns the size of an ephemeral volume from
+// its volume attributes, or the default size if none is given.
+func ephemeralVolumeSize(volumeContext map[string]string) (int64, error) {
+	v, ok := volumeContext[ephemeralSizeAttribute]
+	if !ok || v == "" {
+		return constants.DefaultVolumeSizeInBytes, nil
+	}
+
+	size, err := common.ParseBytes(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for volume attribute %q: %w", v, ephemeralSizeAttribute, err)
+	}
+
+	if size < constants.MinimumVolumeSizeInBytes || size > constants.MaximumVolumeSizeInBytes {
+		return 0, fmt.Errorf("volume attribute %q must be between %s and %s", ephemeralSizeAttribute,
+			common.FormatBytes(constants.MinimumVolumeSizeInBytes), common.FormatBytes(constants.MaximumVolumeSizeInBytes))
+	}
+
+	return size, nil
+}
@@ -6,7 +6,9 @@ package driver
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"strconv"
 	"strings"
@@ -23,7 +25,13 @@ import (
 
 type fakeClient struct {
 	volumes         map[string]*models.GetVHDResponse
+	readers         map[string]map[string]struct{}
+	sharers         map[string]map[string]struct{}
 	nodes           map[int]string
+	vmStates        map[string]rest.VMState
+	vmScsi          map[string]rest.GetVMResponse
+	templates       map[string]int64
+	createOptions   rest.CreateVolumeOptions
 	createVolumeErr *rest.Error
 	listVolumesErr  *rest.Error
 }
@@ -77,18 +85,32 @@ func (f *fakeClient) ListVolumes(_ context.Context, maxEntries int, nextToken st
 	}, nil
 }
 
-func (f *fakeClient) CreateVolume(_ context.Context, name string, sizeBytes int64) (*rest.GetVolumeResponse, error) {
+func (f *fakeClient) CreateVolume(_ context.Context, name string, sizeBytes int64, opts rest.CreateVolumeOptions) (*rest.GetVolumeResponse, error) {
 
 	if f.createVolumeErr != nil {
 		return nil, f.createVolumeErr
 	}
 
+	f.createOptions = opts
+
+	if opts.Template != "" {
+		templateSize, ok := f.templates[opts.Template]
+		if !ok {
+			return nil, &rest.Error{
+				Code:    codes.NotFound,
+				Message: "template not found",
+			}
+		}
+
+		sizeBytes = max(sizeBytes, templateSize)
+	}
+
 	// Idempotency check
 	// Since CreateVolume doesn't know the ID before the backend is called
 	// this check needs to be done here.
 	for _, v := range f.volumes {
 		if v.Name == name {
-			if v.Size == sizeBytes {
+			if v.Size == sizeBytes && v.Shared == opts.Shared {
 				return volumeResponseFromVHD(v), nil
 			}
 			// Same name, different size is an error
@@ -107,6 +129,7 @@ func (f *fakeClient) CreateVolume(_ context.Context, name string, sizeBytes int6
 		Size:           sizeBytes,
 		DiskIdentifier: newId,
 		Path:           path,
+		Shared:         opts.Shared,
 	}
 
 	f.volumes[newId] = vol
@@ -116,9 +139,11 @@ func (f *fakeClient) CreateVolume(_ context.Context, name string, sizeBytes int6
 
 func volumeResponseFromVHD(vol *models.GetVHDResponse) *rest.GetVolumeResponse {
 	return &rest.GetVolumeResponse{
-		Name: vol.Name,
-		ID:   vol.DiskIdentifier,
-		Size: vol.Size,
+		Name:   vol.Name,
+		ID:     vol.DiskIdentifier,
+		Size:   vol.Size,
+		Shared: vol.Shared,
+		Host:   vol.Host,
 	}
 }
 
@@ -130,11 +155,7 @@ func (f *fakeClient) DeleteVolume(_ context.Context, volumeId string) error {
 func (f *fakeClient) GetVolume(_ context.Context, volumeId string) (*rest.GetVolumeResponse, error) {
 
 	if v, ok := f.volumes[volumeId]; ok {
-		return &rest.GetVolumeResponse{
-			Name: v.Name,
-			ID:   v.DiskIdentifier,
-			Size: v.Size,
-		}, nil
+		return volumeResponseFromVHD(v), nil
 	} else {
 		return nil, &rest.Error{
 			Code:    codes.NotFound,
@@ -143,6 +164,46 @@ func (f *fakeClient) GetVolume(_ context.Context, volumeId string) (*rest.GetVol
 	}
 }
 
+func (f *fakeClient) GetVolumeStatus(_ context.Context, volumeId string) (*rest.GetVolumeStatusResponse, error) {
+
+	if v, ok := f.volumes[volumeId]; ok {
+		return &rest.GetVolumeStatusResponse{
+			Name:        v.Name,
+			ID:          v.DiskIdentifier,
+			Size:        v.Size,
+			Host:        v.Host,
+			Attachments: f.attachments(v),
+			Condition: rest.VolumeCondition{
+				Message: "volume is healthy",
+			},
+		}, nil
+	}
+
+	return nil, &rest.Error{
+		Code:    codes.NotFound,
+		Message: fmt.Sprintf("volume %s not found", volumeId),
+	}
+}
+
+func (f *fakeClient) attachments(v *models.GetVHDResponse) []rest.Attachment {
+
+	var attachments []rest.Attachment
+
+	if v.Host != nil {
+		attachments = append(attachments, rest.Attachment{NodeID: *v.Host})
+	}
+
+	for nodeId := range f.sharers[v.DiskIdentifier] {
+		attachments = append(attachments, rest.Attachment{NodeID: nodeId})
+	}
+
+	for nodeId := range f.readers[v.DiskIdentifier] {
+		attachments = append(attachments, rest.Attachment{NodeID: nodeId, ReadOnly: true})
+	}
+
+	return attachments
+}
+
 func (*fakeClient) GetCapacity(_ context.Context) (*rest.GetCapacityResponse, error) {
 	return &rest.GetCapacityResponse{
 		AvailableCapacity: constants.TiB,
@@ -150,7 +211,7 @@ func (*fakeClient) GetCapacity(_ context.Context) (*rest.GetCapacityResponse, er
 	}, nil
 }
 
-func (f *fakeClient) PublishVolume(_ context.Context, volumeId, nodeId string) error {
+func (f *fakeClient) PublishVolume(_ context.Context, volumeId, nodeId string, readOnly bool) error {
 
 	v, ok := f.volumes[volumeId]
 
@@ -162,6 +223,29 @@ func (f *fakeClient) PublishVolume(_ context.Context, volumeId, nodeId string) e
 		}
 	}
 
+	if readOnly {
+		return f.publishReadOnly(v, nodeId)
+	}
+
+	if v.Shared {
+		addAttachment(&f.sharers, volumeId, nodeId)
+		return nil
+	}
+
+	if _, ok := f.readers[volumeId][nodeId]; ok {
+		return &rest.Error{
+			Code:    codes.AlreadyExists,
+			Message: "The disk is already connected read-only",
+		}
+	}
+
+	if len(f.readers[volumeId]) > 0 {
+		return &rest.Error{
+			Code:    codes.FailedPrecondition,
+			Message: "The disk is connected read-only",
+		}
+	}
+
 	// Idempotency check
 	// TODO - In the controller, not here
 	if v.Host != nil && *v.Host == nodeId {
@@ -179,12 +263,47 @@ func (f *fakeClient) PublishVolume(_ context.Context, volumeId, nodeId string) e
 	}
 }
 
+func (f *fakeClient) publishReadOnly(v *models.GetVHDResponse, nodeId string) error {
+
+	if v.Host != nil {
+		if *v.Host == nodeId {
+			return &rest.Error{
+				Code:    codes.AlreadyExists,
+				Message: "The disk is already connected read-write",
+			}
+		}
+
+		return &rest.Error{
+			Code:    codes.FailedPrecondition,
+			Message: "The disk is already connected",
+		}
+	}
+
+	addAttachment(&f.readers, v.DiskIdentifier, nodeId)
+	return nil
+}
+
+func addAttachment(attachments *map[string]map[string]struct{}, volumeId, nodeId string) {
+
+	if *attachments == nil {
+		*attachments = map[string]map[string]struct{}{}
+	}
+
+	if (*attachments)[volumeId] == nil {
+		(*attachments)[volumeId] = map[string]struct{}{}
+	}
+
+	(*attachments)[volumeId][nodeId] = struct{}{}
+}
+
 func (f *fakeClient) UnpublishVolume(ctx context.Context, volumeId, nodeId string) error {
 
 	if v, ok := f.volumes[volumeId]; ok {
 		v.Host = nil
 	}
 
+	delete(f.readers[volumeId], nodeId)
+	delete(f.sharers[volumeId], nodeId)
 	return nil
 }
 
@@ -208,8 +327,13 @@ func (f *fakeClient) GetVm(_ context.Context, nodeId string) (*rest.GetVMRespons
 
 	for _, n := range f.nodes {
 		if strings.EqualFold(n, nodeId) {
+			scsi := f.vmScsi[n]
+
 			return &rest.GetVMResponse{
-				ID: nodeId,
+				ID:              nodeId,
+				State:           f.vmStates[n],
+				ScsiControllers: scsi.ScsiControllers,
+				VolumeDrives:    scsi.VolumeDrives,
 			}, nil
 		}
 	}
@@ -220,11 +344,68 @@ func (f *fakeClient) GetVm(_ context.Context, nodeId string) (*rest.GetVMRespons
 	}
 }
 
+func (f *fakeClient) GetVmByBIOSGUID(ctx context.Context, biosGuid string) (*rest.GetVMResponse, error) {
+
+	for n, vm := range f.vmScsi {
+		if vm.BIOSGUID != "" && strings.EqualFold(vm.BIOSGUID, biosGuid) {
+			return f.GetVm(ctx, n)
+		}
+	}
+
+	return nil, &rest.Error{
+		Code:    codes.NotFound,
+		Message: "Node not found",
+	}
+}
+
+func (f *fakeClient) ListVmAttachments(ctx context.Context, nodeId string) (*rest.ListVMAttachmentsResponse, error) {
+
+	if _, err := f.GetVm(ctx, nodeId); err != nil {
+		return nil, err
+	}
+
+	attachments := []*rest.VMAttachment{}
+
+	for _, v := range f.volumes {
+		for _, a := range f.attachments(v) {
+			if strings.EqualFold(a.NodeID, nodeId) {
+				attachments = append(attachments, &rest.VMAttachment{
+					Path:           v.Path,
+					Name:           v.Name,
+					DiskIdentifier: v.DiskIdentifier,
+					Size:           v.Size,
+					Volume:         true,
+					Shared:         v.Shared,
+				})
+			}
+		}
+	}
+
+	return &rest.ListVMAttachmentsResponse{
+		Attachments: attachments,
+	}, nil
+}
+
+// scsiControllers returns SCSI controllers with the given numbers of drives attached
+func scsiControllers(drives ...int) []models.GetSCSIControllerResopnse {
+
+	controllers := make([]models.GetSCSIControllerResopnse, len(drives))
+
+	for i, n := range drives {
+		controllers[i].ControllerNumber = i
+		for l := range n {
+			controllers[i].Drives = append(controllers[i].Drives, models.AttachedDrive{ControllerNumber: i, ControllerLocation: l})
+		}
+	}
+
+	return controllers
+}
+
 func (f *fakeClient) ListVms(_ context.Context) (*rest.ListVMResponse, error) {
 	vms := make([]*rest.GetVMResponse, 0, len(f.nodes))
 
 	for _, n := range f.nodes {
-		vms = append(vms, &rest.GetVMResponse{ID: n})
+		vms = append(vms, &rest.GetVMResponse{ID: n, State: f.vmStates[n]})
 	}
 
 	return &rest.ListVMResponse{
@@ -232,6 +413,62 @@ func (f *fakeClient) ListVms(_ context.Context) (*rest.ListVMResponse, error) {
 	}, nil
 }
 
+func (f *fakeClient) CreateEphemeralVolume(ctx context.Context, name, nodeId string, sizeBytes int64) (*rest.GetVolumeResponse, error) {
+
+	vol, err := f.CreateVolume(ctx, constants.EphemeralVolumePrefix+name, sizeBytes, rest.CreateVolumeOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.PublishVolume(ctx, vol.ID, nodeId, false); err != nil {
+		return nil, err
+	}
+
+	return vol, nil
+}
+
+func (f *fakeClient) DeleteEphemeralVolume(ctx context.Context, name, nodeId string) error {
+
+	for id, v := range f.volumes {
+		if v.Name == constants.EphemeralVolumePrefix+name {
+			_ = f.UnpublishVolume(ctx, id, nodeId)
+			return f.DeleteVolume(ctx, id)
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeClient) ListTemplates(context.Context) (*rest.ListTemplatesResponse, error) {
+	templates := make([]rest.Template, 0, len(f.templates))
+
+	for name, size := range f.templates {
+		templates = append(templates, rest.Template{Name: name, Size: size})
+	}
+
+	return &rest.ListTemplatesResponse{
+		Templates: templates,
+	}, nil
+}
+
+// The driver does not export or import volumes
+
+func (*fakeClient) ExportVolume(context.Context, string, int64) (*hyperv.VolumeContent, error) {
+	return nil, rest.NewError(codes.Unimplemented, "export volume")
+}
+
+func (*fakeClient) ImportVolume(context.Context, string, string, io.Reader, int64, int64) (*rest.GetVolumeResponse, error) {
+	return nil, rest.NewError(codes.Unimplemented, "import volume")
+}
+
+func (*fakeClient) GetImportOffset(context.Context, string, int64) (int64, error) {
+	return 0, rest.NewError(codes.Unimplemented, "get import offset")
+}
+
+func (*fakeClient) AdoptVolume(context.Context, string, string, string) (*rest.GetVolumeResponse, error) {
+	return nil, rest.NewError(codes.Unimplemented, "adopt volume")
+}
+
 func randString(n int) string {
 	const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 	b := make([]byte, n)
@@ -248,7 +485,7 @@ type fakeMounter struct {
 
 var _ Mounter = (*fakeMounter)(nil)
 
-func (*fakeMounter) Format(source, fsType string) error {
+func (*fakeMounter) Format(source, fsType string, options ...string) error {
 	return nil
 }
 
@@ -308,3 +545,71 @@ func (*fakeMounter) GetStatistics(volumePath string) (volumeStatistics, error) {
 func (*fakeMounter) IsBlockDevice(volumePath string) (bool, error) {
 	return false, nil
 }
+
+func (*fakeMounter) ResolveDevice(devicePath string) (string, error) {
+	return devicePath, nil
+}
+
+func (*fakeMounter) IsReadOnly(device string) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeMounter) GetMountInfo(target string) (*fileSystem, error) {
+	source, ok := f.mounted[target]
+	if !ok {
+		return nil, nil
+	}
+
+	return &fileSystem{
+		Source: source,
+		Target: target,
+	}, nil
+}
+
+func (*fakeMounter) CheckFilesystem(source, fsType string, repair bool) (*fsckResult, error) {
+	return &fsckResult{Clean: true}, nil
+}
+
+func (*fakeMounter) CanaryWrite(dir string) error {
+	return nil
+}
+
+type fakeEncryptor struct {
+	luks   map[string]string
+	mapped map[string]string
+}
+
+var _ Encryptor = (*fakeEncryptor)(nil)
+
+func (f *fakeEncryptor) IsLuks(source string) (bool, error) {
+	_, ok := f.luks[source]
+	return ok, nil
+}
+
+func (f *fakeEncryptor) Format(source, passphrase string) error {
+	f.luks[source] = passphrase
+	return nil
+}
+
+func (f *fakeEncryptor) Open(source, name, passphrase string, readOnly bool) error {
+	if f.luks[source] != passphrase {
+		return errors.New("no key available with this passphrase")
+	}
+
+	f.mapped[name] = source
+	return nil
+}
+
+func (f *fakeEncryptor) Close(name string) error {
+	delete(f.mapped, name)
+	return nil
+}
+
+func (f *fakeEncryptor) IsOpen(name string) (bool, error) {
+	_, ok := f.mapped[name]
+	return ok, nil
+}
+
+func (f *fakeEncryptor) Resize(name, passphrase string) error {
+	return nil
+}
@@ -0,0 +1,101 @@
+//go:build linux
+
+package driver
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// forcedDetachReason is the reason for the event raised when a volume is forcibly detached
+const forcedDetachReason = "ForcedDetach"
+
+// forceDetach detaches a volume from a VM other than the one it is being published to, if that VM
+// has been stopped for the force detach grace period. It returns true if the volume was detached.
+//
+// Hyper-V does not record when a VM was stopped, so the grace period runs from when the
+// controller first finds the VM stopped while publishing a volume attached to it.
+// The attacher retries the publish, which detaches the volume once the grace period has expired.
+func (d *Driver) forceDetach(ctx context.Context, log *logrus.Entry, volumeId, vmId string) (bool, error) {
+
+	if d.forceDetachGracePeriod <= 0 {
+		return false, nil
+	}
+
+	vm, err := d.hypervClient.GetVm(ctx, vmId)
+	if err != nil {
+		log.WithError(err).WithField("host_id", vmId).Warn("cannot get state of VM to which the volume is attached")
+		return false, nil
+	}
+
+	log = log.WithFields(logrus.Fields{
+		"host_id":    vmId,
+		"host_name":  vm.Name,
+		"host_state": vm.State,
+	})
+
+	if vm.State.IsSaved() {
+		log.Info("volume is attached to a saved VM, from which it cannot be detached without discarding the saved state")
+		d.vmStopped(vmId, false)
+		return false, nil
+	}
+
+	stoppedSince, stopped := d.vmStopped(vmId, vm.State.IsStopped())
+	if !stopped {
+		return false, nil
+	}
+
+	if stoppedFor := time.Since(stoppedSince); stoppedFor < d.forceDetachGracePeriod {
+		log.WithField("stopped_for", stoppedFor.Round(time.Second)).Info("volume is attached to a stopped VM and will be detached after the grace period")
+		return false, nil
+	}
+
+	log = log.WithFields(logrus.Fields{
+		"audit":         forcedDetachReason,
+		"stopped_since": stoppedSince.Format(time.RFC3339),
+	})
+
+	if err := d.hypervClient.UnpublishVolume(ctx, volumeId, vmId); err != nil {
+		return false, processErrorReturn(err, log, "force detach volume")
+	}
+
+	log.Warn("volume was forcibly detached from a stopped VM")
+
+	if d.recorder != nil {
+		d.recorder.Eventf(csiDriverReference(d.name), corev1.EventTypeWarning, forcedDetachReason,
+			"Volume %s was forcibly detached from VM %s which has been %s since %s",
+			volumeId, d.vmDescription(ctx, vmId), vm.State, stoppedSince.Format(time.RFC3339))
+	}
+
+	return true, nil
+}
+
+// vmStopped records whether the given VM is stopped, returning when it was first found stopped.
+func (d *Driver) vmStopped(vmId string, stopped bool) (time.Time, bool) {
+
+	d.vmStoppedMu.Lock()
+	defer d.vmStoppedMu.Unlock()
+
+	vmId = strings.ToLower(vmId)
+
+	if !stopped {
+		delete(d.vmStoppedSince, vmId)
+		return time.Time{}, false
+	}
+
+	if d.vmStoppedSince == nil {
+		d.vmStoppedSince = map[string]time.Time{}
+	}
+
+	since, ok := d.vmStoppedSince[vmId]
+	if !ok {
+		since = time.Now()
+		d.vmStoppedSince[vmId] = since
+	}
+
+	return since, true
+}
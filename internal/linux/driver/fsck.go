@@ -0,0 +1,182 @@
+//go:build linux
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// fsckPolicyParameter is the StorageClass parameter which selects whether an
+	// existing filesystem is checked, and optionally repaired, before it is staged.
+	fsckPolicyParameter = "fsckPolicy"
+
+	// fsckPolicyNone stages the filesystem without checking it. This is the default.
+	fsckPolicyNone = "none"
+
+	// fsckPolicyCheck fails the stage if the filesystem has errors.
+	fsckPolicyCheck = "check"
+
+	// fsckPolicyRepair repairs the filesystem automatically, failing
+	// the stage only if errors remain which could not be repaired.
+	fsckPolicyRepair = "repair"
+)
+
+var fsckPolicies = []string{
+	fsckPolicyNone,
+	fsckPolicyCheck,
+	fsckPolicyRepair,
+}
+
+// e2fsck exit codes, which may be combined. See e2fsck(8).
+const (
+	e2fsckErrorsCorrected       = 1
+	e2fsckErrorsCorrectedReboot = 2
+	e2fsckErrorsUncorrected     = 4
+)
+
+// xfs_repair and btrfs check exit with this code when errors are found in no-modify mode.
+const fsckCorruptionFound = 1
+
+// fsckResult is the outcome of checking a filesystem.
+type fsckResult struct {
+	// Clean is true if no errors were found
+	Clean bool
+
+	// Repaired is true if errors were found and all of them were repaired
+	Repaired bool
+
+	// Output is the combined output of the check commands
+	Output string
+}
+
+// String summarises the result for the volume condition
+func (r *fsckResult) String() string {
+	switch {
+	case r.Clean:
+		return "filesystem check passed"
+	case r.Repaired:
+		return "filesystem errors were repaired"
+	default:
+		return "filesystem has errors"
+	}
+}
+
+// CheckFilesystem checks the unmounted filesystem on source for errors, repairing them if asked.
+// An error is returned only if the check could not be run.
+func (m *mounter) CheckFilesystem(source, fsType string, repair bool) (*fsckResult, error) {
+	if source == "" {
+		return nil, errors.New("source is not specified for checking the filesystem")
+	}
+
+	switch fsType {
+	case fstypeExt3, fstypeExt4:
+		return m.e2fsck(source, repair)
+	case fstypeXfs:
+		return m.xfsRepair(source, repair)
+	case fstypeBtrfs:
+		// btrfs check --repair is not considered safe for unattended
+		// use, so btrfs filesystems are only ever checked.
+		return m.checkNoModify("btrfs", "check", "--readonly", source)
+	default:
+		return nil, fmt.Errorf("unsupported fs type %q", fsType)
+	}
+}
+
+func (m *mounter) e2fsck(source string, repair bool) (*fsckResult, error) {
+	mode := "-n"
+	if repair {
+		mode = "-p"
+	}
+
+	out, code, err := m.runFsck("e2fsck", mode, source)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &fsckResult{
+		Output: string(out),
+	}
+
+	switch {
+	case code == 0:
+		result.Clean = true
+	case code&^(e2fsckErrorsCorrected|e2fsckErrorsCorrectedReboot) == 0:
+		result.Repaired = true
+	case code&^(e2fsckErrorsCorrected|e2fsckErrorsCorrectedReboot|e2fsckErrorsUncorrected) != 0:
+		return nil, fmt.Errorf("e2fsck failed with exit code %d output: %q", code, result.Output)
+	}
+
+	return result, nil
+}
+
+func (m *mounter) xfsRepair(source string, repair bool) (*fsckResult, error) {
+	// xfs_repair does not report whether it changed anything,
+	// so always check first and only repair if that finds errors.
+	result, err := m.checkNoModify("xfs_repair", "-n", source)
+	if err != nil || result.Clean || !repair {
+		return result, err
+	}
+
+	out, code, err := m.runFsck("xfs_repair", source)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Output += string(out)
+	if code != 0 {
+		// Exit code 2 means the log must be replayed by mounting the filesystem first
+		return nil, fmt.Errorf("xfs_repair failed with exit code %d output: %q", code, string(out))
+	}
+
+	result.Repaired = true
+	return result, nil
+}
+
+// checkNoModify runs a checker that does not modify the filesystem,
+// and which exits with fsckCorruptionFound if it finds errors.
+func (m *mounter) checkNoModify(cmd string, args ...string) (*fsckResult, error) {
+	out, code, err := m.runFsck(cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	switch code {
+	case 0:
+		return &fsckResult{Clean: true, Output: string(out)}, nil
+	case fsckCorruptionFound:
+		return &fsckResult{Output: string(out)}, nil
+	default:
+		return nil, fmt.Errorf("%s failed with exit code %d output: %q", cmd, code, string(out))
+	}
+}
+
+// runFsck runs the given filesystem checker, returning its output and exit code.
+// An error is returned only if the checker could not be run.
+func (m *mounter) runFsck(cmd string, args ...string) ([]byte, int, error) {
+	if _, err := exec.LookPath(cmd); err != nil {
+		return nil, 0, fmt.Errorf("%q executable not found in $PATH", cmd)
+	}
+
+	m.log.WithFields(logrus.Fields{
+		"cmd":  cmd,
+		"args": args,
+	}).Info("executing filesystem check command")
+
+	out, err := runCommand(cmd, args...)
+	if err != nil {
+		exitError := &exec.ExitError{}
+		if errors.As(err, &exitError) {
+			return out, exitError.ExitCode(), nil
+		}
+
+		return nil, 0, fmt.Errorf("filesystem check failed: %w cmd: '%s %s'", err, cmd, strings.Join(args, " "))
+	}
+
+	return out, 0, nil
+}
@@ -0,0 +1,57 @@
+//go:build linux
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/fireflycons/hypervcsi/internal/linux/kvp"
+)
+
+// newIdentityChain returns the sources of the VM name and ID, tried in turn:
+// Hyper-V KVP, then the BIOS UUID, then the name and ID given explicitly.
+//
+// The BIOS UUID is the BIOS GUID of the VM, not its ID, so the VM is found by
+// its BIOS GUID with the backend. Without a client, the BIOS UUID is not used.
+func newIdentityChain(p *NewDriverParams, client hyperv.Client) kvp.MetadataService {
+
+	var lookup kvp.VMLookup
+
+	if client != nil {
+		lookup = func(biosGuid string) (string, string, error) {
+			vm, err := client.GetVmByBIOSGUID(context.Background(), biosGuid)
+			if err != nil {
+				return "", "", err
+			}
+
+			return vm.ID, vm.Name, nil
+		}
+	}
+
+	return kvp.NewChain(
+		kvp.New(),
+		kvp.NewDMI(lookup),
+		kvp.NewStatic(p.VmName, p.VmId),
+	)
+}
+
+// verifyIdentity checks with the backend that the VM with the given ID has the given name,
+// so that a node does not act for another VM when its identity was found wrongly, such as
+// from a stale BIOS UUID or flags copied from another node.
+func verifyIdentity(ctx context.Context, client hyperv.Client, vmName, vmId string) error {
+
+	vm, err := client.GetVm(ctx, vmId)
+	if err != nil {
+		return fmt.Errorf("cannot find VM %s (%s) with the backend: %w", vmName, vmId, err)
+	}
+
+	// Hyper-V does not distinguish VM names by case
+	if !strings.EqualFold(vm.Name, vmName) {
+		return fmt.Errorf("VM %s is named %q, not %q", vmId, vm.Name, vmName)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+//go:build linux
+
+package driver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// namedVMClient serves GetVm for VMs whose names are keyed by ID
+type namedVMClient struct {
+	hyperv.Client
+	names map[string]string
+}
+
+func (c *namedVMClient) GetVm(_ context.Context, nodeId string) (*rest.GetVMResponse, error) {
+
+	name, ok := c.names[nodeId]
+	if !ok {
+		return nil, rest.NewError(codes.NotFound, "VM not found")
+	}
+
+	return &rest.GetVMResponse{ID: nodeId, Name: name}, nil
+}
+
+func TestVerifyIdentity(t *testing.T) {
+
+	vmId := uuid.NewString()
+	client := &namedVMClient{names: map[string]string{vmId: "Node-1"}}
+
+	t.Run("matching", func(t *testing.T) {
+		require.NoError(t, verifyIdentity(t.Context(), client, "node-1", vmId))
+	})
+
+	t.Run("unknown ID", func(t *testing.T) {
+		require.Error(t, verifyIdentity(t.Context(), client, "node-1", uuid.NewString()))
+	})
+
+	t.Run("other name", func(t *testing.T) {
+		err := verifyIdentity(t.Context(), client, "node-2", vmId)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "Node-1")
+	})
+}
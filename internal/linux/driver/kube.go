@@ -0,0 +1,94 @@
+//go:build linux
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+)
+
+// kubeListPageSize is the number of objects fetched by each list call to the Kubernetes API
+const kubeListPageSize = 500
+
+// newKubeClient returns a clientset for the cluster in which the controller is running,
+// and an event recorder that records events raised by the given component.
+func newKubeClient(component string) (kubernetes.Interface, record.EventRecorder, error) {
+
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot get in-cluster config: %w", err)
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create kubernetes client: %w", err)
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+
+	return kubeClient, broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component}), nil
+}
+
+// csiDriverReference refers to the CSIDriver object of the given driver. Events about
+// volumes with no PersistentVolume, or about VMs, are recorded against it.
+func csiDriverReference(driverName string) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		Kind:       "CSIDriver",
+		APIVersion: "storage.k8s.io/v1",
+		Name:       driverName,
+	}
+}
+
+// runPeriodically calls fn immediately and then at each interval until the context is cancelled.
+func runPeriodically(ctx context.Context, interval time.Duration, fn func(context.Context)) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		fn(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// volumeHandles returns the volume handles of all PersistentVolumes
+// belonging to the given driver, keyed by PV name.
+func volumeHandles(ctx context.Context, kubeClient kubernetes.Interface, driverName string) (map[string]string, error) {
+
+	handles := map[string]string{}
+	opts := metav1.ListOptions{Limit: kubeListPageSize}
+
+	for {
+		pvs, err := kubeClient.CoreV1().PersistentVolumes().List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list persistent volumes: %w", err)
+		}
+
+		for i := range pvs.Items {
+			if csi := pvs.Items[i].Spec.CSI; csi != nil && csi.Driver == driverName {
+				handles[pvs.Items[i].Name] = csi.VolumeHandle
+			}
+		}
+
+		if pvs.Continue == "" {
+			return handles, nil
+		}
+
+		opts.Continue = pvs.Continue
+	}
+}
@@ -0,0 +1,191 @@
+//go:build linux
+
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// encryptionPassphraseKey is the key of the LUKS passphrase
+	// in the node stage and node expand secrets.
+	encryptionPassphraseKey = "encryptionPassphrase"
+
+	cryptsetupCmd = "cryptsetup"
+	mapperDir     = "/dev/mapper"
+)
+
+// Encryptor manages LUKS encryption of block devices
+type Encryptor interface {
+	// IsLuks checks whether the device at the given path is LUKS formatted
+	IsLuks(source string) (bool, error)
+
+	// Format initialises LUKS on the device at the given path with the given passphrase
+	Format(source, passphrase string) error
+
+	// Open unlocks the device at the given path and maps it to /dev/mapper/<name>
+	Open(source, name, passphrase string, readOnly bool) error
+
+	// Close removes the mapping with the given name
+	Close(name string) error
+
+	// IsOpen checks whether a mapping with the given name exists
+	IsOpen(name string) (bool, error)
+
+	// Resize grows the mapping with the given name to the size of the underlying device
+	Resize(name, passphrase string) error
+}
+
+type encryptor struct {
+	log *logrus.Entry
+}
+
+var _ Encryptor = (*encryptor)(nil)
+
+func newEncryptor(log *logrus.Entry) *encryptor {
+	return &encryptor{
+		log: log,
+	}
+}
+
+// luksMapperName returns the name of the device mapper
+// mapping which holds the unlocked volume.
+func luksMapperName(volumeID string) string {
+	return "luks-" + volumeID
+}
+
+// luksMapperPath returns the path of the unlocked device for the volume.
+func luksMapperPath(volumeID string) string {
+	return filepath.Join(mapperDir, luksMapperName(volumeID))
+}
+
+func (e *encryptor) IsLuks(source string) (bool, error) {
+	if source == "" {
+		return false, errors.New("source is not specified")
+	}
+
+	if _, err := exec.LookPath(cryptsetupCmd); err != nil {
+		return false, fmt.Errorf("%q executable not found in $PATH", cryptsetupCmd)
+	}
+
+	// isLuks exits with status 1 if the device is not LUKS
+	out, err := runCommand(cryptsetupCmd, "isLuks", source)
+	if err != nil {
+		exitError := &exec.ExitError{}
+		if errors.As(err, &exitError) && exitError.ExitCode() == 1 {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("checking for LUKS failed: %w cmd: %q output: %q", err, cryptsetupCmd, string(out))
+	}
+
+	return true, nil
+}
+
+func (e *encryptor) Format(source, passphrase string) error {
+	args := []string{"luksFormat", "--batch-mode", "--type", "luks2", "--key-file", "-", source}
+
+	e.log.WithFields(logrus.Fields{
+		"cmd":  cryptsetupCmd,
+		"args": args,
+	}).Info("executing LUKS format command")
+
+	if out, err := runCommandWithInput(passphrase, cryptsetupCmd, args...); err != nil {
+		return fmt.Errorf("LUKS format failed: %w cmd: '%s %s' output: %q",
+			err, cryptsetupCmd, strings.Join(args, " "), string(out))
+	}
+
+	return nil
+}
+
+func (e *encryptor) Open(source, name, passphrase string, readOnly bool) error {
+	args := []string{"luksOpen", "--key-file", "-"}
+	if readOnly {
+		args = append(args, "--readonly")
+	}
+	args = append(args, source, name)
+
+	e.log.WithFields(logrus.Fields{
+		"cmd":  cryptsetupCmd,
+		"args": args,
+	}).Info("executing LUKS open command")
+
+	if out, err := runCommandWithInput(passphrase, cryptsetupCmd, args...); err != nil {
+		return fmt.Errorf("LUKS open failed: %w cmd: '%s %s' output: %q",
+			err, cryptsetupCmd, strings.Join(args, " "), string(out))
+	}
+
+	return nil
+}
+
+func (e *encryptor) Close(name string) error {
+	args := []string{"luksClose", name}
+
+	e.log.WithFields(logrus.Fields{
+		"cmd":  cryptsetupCmd,
+		"args": args,
+	}).Info("executing LUKS close command")
+
+	if out, err := runCommand(cryptsetupCmd, args...); err != nil {
+		return fmt.Errorf("LUKS close failed: %w cmd: '%s %s' output: %q",
+			err, cryptsetupCmd, strings.Join(args, " "), string(out))
+	}
+
+	return nil
+}
+
+func (e *encryptor) IsOpen(name string) (bool, error) {
+	if _, err := exec.LookPath(cryptsetupCmd); err != nil {
+		// Without cryptsetup there can be no mappings to find
+		return false, nil
+	}
+
+	// status exits with status 4 if the mapping does not exist
+	out, err := runCommand(cryptsetupCmd, "status", name)
+	if err != nil {
+		exitError := &exec.ExitError{}
+		if errors.As(err, &exitError) && exitError.ExitCode() == 4 {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("checking LUKS mapping failed: %w cmd: %q output: %q", err, cryptsetupCmd, string(out))
+	}
+
+	return true, nil
+}
+
+func (e *encryptor) Resize(name, passphrase string) error {
+	args := []string{"resize"}
+	if passphrase != "" {
+		// Only needed when the volume key is held in the kernel keyring
+		args = append(args, "--key-file", "-")
+	}
+	args = append(args, name)
+
+	e.log.WithFields(logrus.Fields{
+		"cmd":  cryptsetupCmd,
+		"args": args,
+	}).Info("executing LUKS resize command")
+
+	if out, err := runCommandWithInput(passphrase, cryptsetupCmd, args...); err != nil {
+		return fmt.Errorf("LUKS resize failed: %w cmd: '%s %s' output: %q",
+			err, cryptsetupCmd, strings.Join(args, " "), string(out))
+	}
+
+	return nil
+}
+
+// runCommandWithInput runs a command passing the given input on stdin.
+// This keeps secrets off the command line.
+func runCommandWithInput(input, cmd string, args ...string) ([]byte, error) {
+	//nolint:noctx // no context is ok, for now
+	c := exec.Command(cmd, args...)
+	c.Stdin = strings.NewReader(input)
+	return c.CombinedOutput()
+}
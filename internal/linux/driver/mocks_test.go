@@ -187,17 +187,148 @@ func (_m *MockMounter) EXPECT() *MockMounter_Expecter {
 	return &MockMounter_Expecter{mock: &_m.Mock}
 }
 
+// CanaryWrite provides a mock function for the type MockMounter
+func (_mock *MockMounter) CanaryWrite(dir string) error {
+	ret := _mock.Called(dir)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CanaryWrite")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(string) error); ok {
+		r0 = returnFunc(dir)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockMounter_CanaryWrite_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CanaryWrite'
+type MockMounter_CanaryWrite_Call struct {
+	*mock.Call
+}
+
+// CanaryWrite is a helper method to define mock.On call
+//   - dir string
+func (_e *MockMounter_Expecter) CanaryWrite(dir interface{}) *MockMounter_CanaryWrite_Call {
+	return &MockMounter_CanaryWrite_Call{Call: _e.mock.On("CanaryWrite", dir)}
+}
+
+func (_c *MockMounter_CanaryWrite_Call) Run(run func(dir string)) *MockMounter_CanaryWrite_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		run(
+			arg0,
+		)
+	})
+	return _c
+}
+
+func (_c *MockMounter_CanaryWrite_Call) Return(err error) *MockMounter_CanaryWrite_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockMounter_CanaryWrite_Call) RunAndReturn(run func(dir string) error) *MockMounter_CanaryWrite_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// CheckFilesystem provides a mock function for the type MockMounter
+func (_mock *MockMounter) CheckFilesystem(source string, fsType string, repair bool) (*fsckResult, error) {
+	ret := _mock.Called(source, fsType, repair)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CheckFilesystem")
+	}
+
+	var r0 *fsckResult
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(string, string, bool) (*fsckResult, error)); ok {
+		return returnFunc(source, fsType, repair)
+	}
+	if returnFunc, ok := ret.Get(0).(func(string, string, bool) *fsckResult); ok {
+		r0 = returnFunc(source, fsType, repair)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*fsckResult)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(string, string, bool) error); ok {
+		r1 = returnFunc(source, fsType, repair)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockMounter_CheckFilesystem_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CheckFilesystem'
+type MockMounter_CheckFilesystem_Call struct {
+	*mock.Call
+}
+
+// CheckFilesystem is a helper method to define mock.On call
+//   - source string
+//   - fsType string
+//   - repair bool
+func (_e *MockMounter_Expecter) CheckFilesystem(source interface{}, fsType interface{}, repair interface{}) *MockMounter_CheckFilesystem_Call {
+	return &MockMounter_CheckFilesystem_Call{Call: _e.mock.On("CheckFilesystem", source, fsType, repair)}
+}
+
+func (_c *MockMounter_CheckFilesystem_Call) Run(run func(source string, fsType string, repair bool)) *MockMounter_CheckFilesystem_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		var arg1 string
+		if args[1] != nil {
+			arg1 = args[1].(string)
+		}
+		var arg2 bool
+		if args[2] != nil {
+			arg2 = args[2].(bool)
+		}
+		run(
+			arg0,
+			arg1,
+			arg2,
+		)
+	})
+	return _c
+}
+
+func (_c *MockMounter_CheckFilesystem_Call) Return(fsckResultMoqParam *fsckResult, err error) *MockMounter_CheckFilesystem_Call {
+	_c.Call.Return(fsckResultMoqParam, err)
+	return _c
+}
+
+func (_c *MockMounter_CheckFilesystem_Call) RunAndReturn(run func(source string, fsType string, repair bool) (*fsckResult, error)) *MockMounter_CheckFilesystem_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Format provides a mock function for the type MockMounter
-func (_mock *MockMounter) Format(source string, fsType string) error {
-	ret := _mock.Called(source, fsType)
+func (_mock *MockMounter) Format(source string, fsType string, options ...string) error {
+	var tmpRet mock.Arguments
+	if len(options) > 0 {
+		tmpRet = _mock.Called(source, fsType, options)
+	} else {
+		tmpRet = _mock.Called(source, fsType)
+	}
+	ret := tmpRet
 
 	if len(ret) == 0 {
 		panic("no return value specified for Format")
 	}
 
 	var r0 error
-	if returnFunc, ok := ret.Get(0).(func(string, string) error); ok {
-		r0 = returnFunc(source, fsType)
+	if returnFunc, ok := ret.Get(0).(func(string, string, ...string) error); ok {
+		r0 = returnFunc(source, fsType, options...)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -212,11 +343,13 @@ type MockMounter_Format_Call struct {
 // Format is a helper method to define mock.On call
 //   - source string
 //   - fsType string
-func (_e *MockMounter_Expecter) Format(source interface{}, fsType interface{}) *MockMounter_Format_Call {
-	return &MockMounter_Format_Call{Call: _e.mock.On("Format", source, fsType)}
+//   - options ...string
+func (_e *MockMounter_Expecter) Format(source interface{}, fsType interface{}, options ...interface{}) *MockMounter_Format_Call {
+	return &MockMounter_Format_Call{Call: _e.mock.On("Format",
+		append([]interface{}{source, fsType}, options...)...)}
 }
 
-func (_c *MockMounter_Format_Call) Run(run func(source string, fsType string)) *MockMounter_Format_Call {
+func (_c *MockMounter_Format_Call) Run(run func(source string, fsType string, options ...string)) *MockMounter_Format_Call {
 	_c.Call.Run(func(args mock.Arguments) {
 		var arg0 string
 		if args[0] != nil {
@@ -226,9 +359,16 @@ func (_c *MockMounter_Format_Call) Run(run func(source string, fsType string)) *
 		if args[1] != nil {
 			arg1 = args[1].(string)
 		}
+		var arg2 []string
+		var variadicArgs []string
+		if len(args) > 2 {
+			variadicArgs = args[2].([]string)
+		}
+		arg2 = variadicArgs
 		run(
 			arg0,
 			arg1,
+			arg2...,
 		)
 	})
 	return _c
@@ -239,7 +379,7 @@ func (_c *MockMounter_Format_Call) Return(err error) *MockMounter_Format_Call {
 	return _c
 }
 
-func (_c *MockMounter_Format_Call) RunAndReturn(run func(source string, fsType string) error) *MockMounter_Format_Call {
+func (_c *MockMounter_Format_Call) RunAndReturn(run func(source string, fsType string, options ...string) error) *MockMounter_Format_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -310,6 +450,68 @@ func (_c *MockMounter_GetDeviceName_Call) RunAndReturn(run func(mounter mount.In
 	return _c
 }
 
+// GetMountInfo provides a mock function for the type MockMounter
+func (_mock *MockMounter) GetMountInfo(target string) (*fileSystem, error) {
+	ret := _mock.Called(target)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetMountInfo")
+	}
+
+	var r0 *fileSystem
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(string) (*fileSystem, error)); ok {
+		return returnFunc(target)
+	}
+	if returnFunc, ok := ret.Get(0).(func(string) *fileSystem); ok {
+		r0 = returnFunc(target)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*fileSystem)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(string) error); ok {
+		r1 = returnFunc(target)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockMounter_GetMountInfo_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetMountInfo'
+type MockMounter_GetMountInfo_Call struct {
+	*mock.Call
+}
+
+// GetMountInfo is a helper method to define mock.On call
+//   - target string
+func (_e *MockMounter_Expecter) GetMountInfo(target interface{}) *MockMounter_GetMountInfo_Call {
+	return &MockMounter_GetMountInfo_Call{Call: _e.mock.On("GetMountInfo", target)}
+}
+
+func (_c *MockMounter_GetMountInfo_Call) Run(run func(target string)) *MockMounter_GetMountInfo_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		run(
+			arg0,
+		)
+	})
+	return _c
+}
+
+func (_c *MockMounter_GetMountInfo_Call) Return(fileSystemMoqParam *fileSystem, err error) *MockMounter_GetMountInfo_Call {
+	_c.Call.Return(fileSystemMoqParam, err)
+	return _c
+}
+
+func (_c *MockMounter_GetMountInfo_Call) RunAndReturn(run func(target string) (*fileSystem, error)) *MockMounter_GetMountInfo_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // GetStatistics provides a mock function for the type MockMounter
 func (_mock *MockMounter) GetStatistics(volumePath string) (volumeStatistics, error) {
 	ret := _mock.Called(volumePath)
@@ -601,6 +803,66 @@ func (_c *MockMounter_IsMounted_Call) RunAndReturn(run func(target string) (bool
 	return _c
 }
 
+// IsReadOnly provides a mock function for the type MockMounter
+func (_mock *MockMounter) IsReadOnly(device string) (bool, error) {
+	ret := _mock.Called(device)
+
+	if len(ret) == 0 {
+		panic("no return value specified for IsReadOnly")
+	}
+
+	var r0 bool
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(string) (bool, error)); ok {
+		return returnFunc(device)
+	}
+	if returnFunc, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = returnFunc(device)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+	if returnFunc, ok := ret.Get(1).(func(string) error); ok {
+		r1 = returnFunc(device)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockMounter_IsReadOnly_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'IsReadOnly'
+type MockMounter_IsReadOnly_Call struct {
+	*mock.Call
+}
+
+// IsReadOnly is a helper method to define mock.On call
+//   - device string
+func (_e *MockMounter_Expecter) IsReadOnly(device interface{}) *MockMounter_IsReadOnly_Call {
+	return &MockMounter_IsReadOnly_Call{Call: _e.mock.On("IsReadOnly", device)}
+}
+
+func (_c *MockMounter_IsReadOnly_Call) Run(run func(device string)) *MockMounter_IsReadOnly_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		run(
+			arg0,
+		)
+	})
+	return _c
+}
+
+func (_c *MockMounter_IsReadOnly_Call) Return(b bool, err error) *MockMounter_IsReadOnly_Call {
+	_c.Call.Return(b, err)
+	return _c
+}
+
+func (_c *MockMounter_IsReadOnly_Call) RunAndReturn(run func(device string) (bool, error)) *MockMounter_IsReadOnly_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Mount provides a mock function for the type MockMounter
 func (_mock *MockMounter) Mount(source string, target string, fsType string, options ...string) error {
 	var tmpRet mock.Arguments
@@ -679,6 +941,66 @@ func (_c *MockMounter_Mount_Call) RunAndReturn(run func(source string, target st
 	return _c
 }
 
+// ResolveDevice provides a mock function for the type MockMounter
+func (_mock *MockMounter) ResolveDevice(devicePath string) (string, error) {
+	ret := _mock.Called(devicePath)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ResolveDevice")
+	}
+
+	var r0 string
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(string) (string, error)); ok {
+		return returnFunc(devicePath)
+	}
+	if returnFunc, ok := ret.Get(0).(func(string) string); ok {
+		r0 = returnFunc(devicePath)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+	if returnFunc, ok := ret.Get(1).(func(string) error); ok {
+		r1 = returnFunc(devicePath)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockMounter_ResolveDevice_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ResolveDevice'
+type MockMounter_ResolveDevice_Call struct {
+	*mock.Call
+}
+
+// ResolveDevice is a helper method to define mock.On call
+//   - devicePath string
+func (_e *MockMounter_Expecter) ResolveDevice(devicePath interface{}) *MockMounter_ResolveDevice_Call {
+	return &MockMounter_ResolveDevice_Call{Call: _e.mock.On("ResolveDevice", devicePath)}
+}
+
+func (_c *MockMounter_ResolveDevice_Call) Run(run func(devicePath string)) *MockMounter_ResolveDevice_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		run(
+			arg0,
+		)
+	})
+	return _c
+}
+
+func (_c *MockMounter_ResolveDevice_Call) Return(s string, err error) *MockMounter_ResolveDevice_Call {
+	_c.Call.Return(s, err)
+	return _c
+}
+
+func (_c *MockMounter_ResolveDevice_Call) RunAndReturn(run func(devicePath string) (string, error)) *MockMounter_ResolveDevice_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Unmount provides a mock function for the type MockMounter
 func (_mock *MockMounter) Unmount(target string) error {
 	ret := _mock.Called(target)
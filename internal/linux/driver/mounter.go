@@ -28,9 +28,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
@@ -43,11 +45,21 @@ const (
 )
 
 const (
-	fstypeExt4 = "ext4"
-	fstypeExt3 = "ext3"
-	fstypeXfs  = "xfs"
+	fstypeExt4  = "ext4"
+	fstypeExt3  = "ext3"
+	fstypeXfs   = "xfs"
+	fstypeBtrfs = "btrfs"
 )
 
+// supportedFsTypes are the filesystems which volumes may be formatted with.
+// The node image provides the mkfs and resize tools for each of these.
+var supportedFsTypes = []string{
+	fstypeExt4,
+	fstypeExt3,
+	fstypeXfs,
+	fstypeBtrfs,
+}
+
 type prodAttachmentValidator struct{}
 
 func (*prodAttachmentValidator) readFile(name string) ([]byte, error) {
@@ -68,6 +80,7 @@ type findmntResponse struct {
 }
 
 type fileSystem struct {
+	Source      string `json:"source"`
 	Target      string `json:"target"`
 	Propagation string `json:"propagation"`
 	FsType      string `json:"fstype"`
@@ -86,8 +99,9 @@ const (
 
 // Mounter is responsible for formatting and mounting volumes
 type Mounter interface {
-	// Format formats the source with the given filesystem type
-	Format(source, fsType string) error
+	// Format formats the source with the given filesystem type,
+	// passing any additional options to mkfs
+	Format(source, fsType string, options ...string) error
 
 	// Mount mounts source to target with the given fstype and options.
 	Mount(source, target, fsType string, options ...string) error
@@ -115,6 +129,27 @@ type Mounter interface {
 
 	// IsBlockDevice checks whether the device at the path is a block device
 	IsBlockDevice(volumePath string) (bool, error)
+
+	// ResolveDevice follows any symbolic links in the given device path and
+	// returns the device node it refers to. An error is returned if the
+	// device node does not exist.
+	ResolveDevice(devicePath string) (string, error)
+
+	// IsReadOnly checks whether the block device at the given path is read-only,
+	// as it is when the disk has been attached to the VM read-only.
+	IsReadOnly(device string) (bool, error)
+
+	// GetMountInfo returns the source device and options of the mount at the
+	// given target, or nil if nothing is mounted there.
+	GetMountInfo(target string) (*fileSystem, error)
+
+	// CheckFilesystem checks the unmounted filesystem on source for errors, repairing them
+	// if asked. An error is returned only if the check could not be run.
+	CheckFilesystem(source, fsType string, repair bool) (*fsckResult, error)
+
+	// CanaryWrite checks that a file can be written to, synced and removed
+	// from the given directory.
+	CanaryWrite(dir string) error
 }
 
 // TODO(arslan): this is Linux only for now. Refactor this into a package with
@@ -140,7 +175,19 @@ func newMounter(log *logrus.Entry) *mounter {
 	}
 }
 
-func (m *mounter) Format(source, fsType string) error {
+func (m *mounter) Format(source, fsType string, options ...string) error {
+	if fsType == "" {
+		return errors.New("fs type is not specified for formatting the volume")
+	}
+
+	if !slices.Contains(supportedFsTypes, fsType) {
+		return fmt.Errorf("unsupported fs type %q", fsType)
+	}
+
+	if source == "" {
+		return errors.New("source is not specified for formatting the volume")
+	}
+
 	mkfsCmd := fmt.Sprintf("mkfs.%s", fsType)
 
 	_, err := exec.LookPath(mkfsCmd)
@@ -153,18 +200,12 @@ func (m *mounter) Format(source, fsType string) error {
 
 	mkfsArgs := []string{}
 
-	if fsType == "" {
-		return errors.New("fs type is not specified for formatting the volume")
-	}
-
-	if source == "" {
-		return errors.New("source is not specified for formatting the volume")
+	if fsType == fstypeExt4 || fsType == fstypeExt3 {
+		mkfsArgs = append(mkfsArgs, "-F")
 	}
 
+	mkfsArgs = append(mkfsArgs, options...)
 	mkfsArgs = append(mkfsArgs, source)
-	if fsType == fstypeExt4 || fsType == fstypeExt3 {
-		mkfsArgs = []string{"-F", source}
-	}
 
 	m.log.WithFields(logrus.Fields{
 		"cmd":  mkfsCmd,
@@ -429,6 +470,106 @@ func (*mounter) IsBlockDevice(devicePath string) (bool, error) {
 	return (stat.Mode & unix.S_IFMT) == unix.S_IFBLK, nil
 }
 
+func (*mounter) ResolveDevice(devicePath string) (string, error) {
+	device, err := filepath.EvalSymlinks(devicePath)
+	if err != nil {
+		return "", fmt.Errorf("error evaluating the symbolic link %q: %w", devicePath, err)
+	}
+
+	return device, nil
+}
+
+func (m *mounter) IsReadOnly(device string) (bool, error) {
+	_, deviceName := filepath.Split(device)
+	if deviceName == "" {
+		return false, fmt.Errorf("error device name is empty for path %s", device)
+	}
+
+	roFilePath := fmt.Sprintf("/sys/class/block/%s/ro", deviceName)
+	content, err := m.attachmentValidator.readFile(roFilePath)
+	if err != nil {
+		return false, fmt.Errorf("error reading the device read-only file %q: %w", roFilePath, err)
+	}
+
+	return strings.TrimSpace(string(content)) == "1", nil
+}
+
+func (m *mounter) GetMountInfo(target string) (*fileSystem, error) {
+	if target == "" {
+		return nil, errors.New("target is not specified for reading the mount")
+	}
+
+	findmntCmd := "findmnt"
+	findmntArgs := []string{"-o", "SOURCE,TARGET,FSTYPE,OPTIONS", "-M", target, "-J"}
+
+	m.log.WithFields(logrus.Fields{
+		"cmd":  findmntCmd,
+		"args": findmntArgs,
+	}).Debug("reading mount information")
+
+	out, err := runCommand(findmntCmd, findmntArgs...)
+	if err != nil {
+		// findmnt exits with non zero exit status if it couldn't find anything
+		if strings.TrimSpace(string(out)) == "" {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("reading mount information failed: %w cmd: %q output: %q",
+			err, findmntCmd, string(out))
+	}
+
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	var resp *findmntResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal data: %q: %w", string(out), err)
+	}
+
+	for _, fs := range resp.FileSystems {
+		if fs.Target == target {
+			// Bind mounts are reported as device[/path]
+			if i := strings.Index(fs.Source, "["); i > 0 {
+				fs.Source = fs.Source[:i]
+			}
+			return &fs, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (*mounter) CanaryWrite(dir string) error {
+	f, err := os.CreateTemp(dir, ".hyperv-csi-canary-")
+	if err != nil {
+		return fmt.Errorf("cannot create canary file in %q: %w", dir, err)
+	}
+
+	name := f.Name()
+	defer os.Remove(name)
+
+	if _, err := f.WriteString(time.Now().UTC().Format(time.RFC3339Nano)); err != nil {
+		f.Close()
+		return fmt.Errorf("cannot write canary file %q: %w", name, err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("cannot sync canary file %q: %w", name, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot close canary file %q: %w", name, err)
+	}
+
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("cannot remove canary file %q: %w", name, err)
+	}
+
+	return nil
+}
+
 func runCommand(cmd string, args ...string) ([]byte, error) {
 	//nolint:noctx // no context is ok, for now
 	return exec.Command(cmd, args...).CombinedOutput()
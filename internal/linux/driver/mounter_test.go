@@ -120,3 +120,12 @@ func (s *driverTestSuite) Test_mounter_IsAttached() {
 		})
 	}
 }
+
+func (s *driverTestSuite) Test_mounter_FormatUnsupportedFsType() {
+	m := &mounter{
+		log: logrus.New().WithField("test_enabed", true),
+	}
+
+	err := m.Format("/dev/sdb", "ntfs")
+	s.Require().EqualError(err, `unsupported fs type "ntfs"`)
+}
@@ -24,9 +24,12 @@ package driver
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/google/uuid"
@@ -90,27 +93,39 @@ func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRe
 		volumeName = volName
 	}
 
+	// A disk attached read-only cannot be formatted, resized or have its journal replayed
+	readOnly := req.GetPublishContext()[d.publishInfoReadOnly] == "true" || isReadOnlyAccessMode(req.VolumeCapability)
+
 	// If it is a block volume, we do nothing for stage volume
 	// because we bind mount the absolute device path to a file
 	if _, ok := req.GetVolumeCapability().GetAccessType().(*csi.VolumeCapability_Block); ok {
+		d.nodeStatus.staged(req.VolumeId, req.StagingTargetPath)
 		return &csi.NodeStageVolumeResponse{}, nil
 	}
 
-	source, err := hypervDiskByID(req.VolumeId)
+	source, err := d.devices.find(ctx, log, req.VolumeId)
 	if err != nil {
-		return nil, fmt.Errorf("cannot determine udev disk ID: %w", err)
+		return nil, status.Errorf(codes.Internal, "cannot find device of volume %s: %v", volumeName, err)
 	}
 
 	target := req.StagingTargetPath
 
 	mnt := req.VolumeCapability.GetMount()
-	options := mnt.MountFlags
+	options := slices.Clone(mnt.MountFlags)
 
 	fsType := fstypeExt4
 	if mnt.FsType != "" {
 		fsType = mnt.FsType
 	}
 
+	if !slices.Contains(supportedFsTypes, fsType) {
+		return nil, status.Errorf(codes.InvalidArgument, "NodeStageVolume unsupported fs type %q, must be one of %s", fsType, strings.Join(supportedFsTypes, ", "))
+	}
+
+	if readOnly {
+		options = append(options, readOnlyMountOptions(fsType)...)
+	}
+
 	log = d.log.WithFields(logrus.Fields{
 		"volume_mode":     volumeModeFilesystem,
 		"volume_name":     volumeName,
@@ -119,6 +134,7 @@ func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRe
 		"source":          source,
 		"fs_type":         fsType,
 		"mount_options":   options,
+		"read_only":       readOnly,
 	})
 
 	log.Info("checking if the disk needs formatting")
@@ -130,16 +146,28 @@ func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRe
 			break
 		}
 	}
+
+	if !noFormat && d.validateAttachment {
+		//nolint:govet // intentional redeclaration of err
+		if err := d.mounter.IsAttached(source); err != nil {
+			return nil, fmt.Errorf("error retrieving the attachement status %q: %w", source, err)
+		}
+	}
+
+	// The filesystem of an encrypted volume is created on the
+	// device mapper device which unlocks it, not on the disk itself
+	if req.VolumeContext[encryptedParameter] == "true" {
+		source, err = d.openEncryptedVolume(req.VolumeId, source, req.Secrets, !noFormat && !readOnly, readOnly, log)
+		if err != nil {
+			return nil, err
+		}
+
+		log = log.WithField("mapper_device", source)
+	}
+
 	if noFormat {
 		log.Info("skipping formatting the source device")
 	} else {
-		if d.validateAttachment {
-			//nolint:govet // intentional redeclaration of err
-			if err := d.mounter.IsAttached(source); err != nil {
-				return nil, fmt.Errorf("error retrieving the attachement status %q: %w", source, err)
-			}
-		}
-
 		//nolint:govet // intentional redeclaration of err
 		formatted, err := d.mounter.IsFormatted(source)
 		if err != nil {
@@ -147,12 +175,22 @@ func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRe
 		}
 
 		if !formatted {
-			log.Info("formatting the volume for staging")
-			if err := d.mounter.Format(source, fsType); err != nil {
+			if readOnly {
+				return nil, status.Errorf(codes.FailedPrecondition, "volume %q is attached read-only and is not formatted", req.VolumeId)
+			}
+
+			mkfsOptions := volumeMkfsOptions(req.VolumeContext, fsType)
+			log.WithField("mkfs_options", mkfsOptions).Info("formatting the volume for staging")
+			if err := d.mounter.Format(source, fsType, mkfsOptions...); err != nil {
 				return nil, status.Error(codes.Internal, err.Error())
 			}
 		} else {
 			log.Info("source device is already formatted")
+
+			policy := req.VolumeContext[fsckPolicyParameter]
+			if err := d.checkFilesystem(req.VolumeId, source, target, fsType, policy, readOnly, log); err != nil {
+				return nil, err
+			}
 		}
 	}
 
@@ -171,7 +209,7 @@ func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRe
 		log.Info("source device is already mounted to the target path")
 	}
 
-	if _, err := os.Stat(source); err == nil {
+	if _, err := os.Stat(source); err == nil && !readOnly {
 		r := mountutil.NewResizeFs(utilexec.New())
 		needResize, err := r.NeedResize(source, target)
 
@@ -188,6 +226,8 @@ func (d *Driver) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRe
 		}
 	}
 
+	d.nodeStatus.staged(req.VolumeId, req.StagingTargetPath)
+
 	log.Info("formatting and mounting stage volume is finished")
 	return &csi.NodeStageVolumeResponse{}, nil
 }
@@ -224,6 +264,31 @@ func (d *Driver) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolu
 		log.Info("staging target path is already unmounted")
 	}
 
+	mapperName := luksMapperName(req.VolumeId)
+	open, err := d.encryptor.IsOpen(mapperName)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to check LUKS mapping %q: %v", mapperName, err)
+	}
+
+	if open {
+		log.Info("closing the LUKS mapping")
+		if err := d.encryptor.Close(mapperName); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	if err := d.devices.remove(log, req.VolumeId); err != nil {
+		inUse := &deviceInUseError{}
+		if errors.As(err, &inUse) {
+			return nil, status.Errorf(codes.FailedPrecondition, "NodeUnstageVolume cannot remove disk device: %v", err)
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	d.fsckResults.Delete(req.VolumeId)
+	d.nodeStatus.unstaged(req.VolumeId)
+
 	log.Info("unmounting stage volume is finished")
 	return &csi.NodeUnstageVolumeResponse{}, nil
 }
@@ -234,7 +299,10 @@ func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolu
 		return nil, status.Error(codes.InvalidArgument, "NodePublishVolume Volume ID must be provided")
 	}
 
-	if req.StagingTargetPath == "" {
+	// Ephemeral inline volumes are not staged
+	ephemeral := req.GetVolumeContext()[ephemeralContextKey] == "true"
+
+	if req.StagingTargetPath == "" && !ephemeral {
 		return nil, status.Error(codes.InvalidArgument, "NodePublishVolume Staging Target Path must be provided")
 	}
 
@@ -261,10 +329,19 @@ func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolu
 
 	var err error
 	switch req.GetVolumeCapability().GetAccessType().(type) {
-	case *csi.VolumeCapability_Block:
-		err = d.nodePublishVolumeForBlock(req, options, log)
 	case *csi.VolumeCapability_Mount:
+		if ephemeral {
+			err = d.nodePublishEphemeralVolume(ctx, req, options, log)
+			break
+		}
+
 		err = d.nodePublishVolumeForFileSystem(req, options, log)
+	case *csi.VolumeCapability_Block:
+		if ephemeral {
+			return nil, status.Error(codes.InvalidArgument, "ephemeral volumes must have a mount access type")
+		}
+
+		err = d.nodePublishVolumeForBlock(ctx, req, options, log)
 	default:
 		return nil, status.Error(codes.InvalidArgument, "Unknown access type")
 	}
@@ -273,6 +350,8 @@ func (d *Driver) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolu
 		return nil, err
 	}
 
+	d.nodeStatus.published(req.VolumeId, req.TargetPath)
+
 	log.Info("bind mounting the volume is finished")
 	return &csi.NodePublishVolumeResponse{}, nil
 }
@@ -294,11 +373,35 @@ func (d *Driver) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublish
 	})
 	log.Info("node unpublish volume called")
 
+	ephemeral := d.isEphemeralVolume(req.VolumeId)
+
+	// The device of an ephemeral volume is only known from its mount, as it is never staged
+	var ephemeralDevice string
+
+	if ephemeral {
+		fs, err := d.mounter.GetMountInfo(req.TargetPath)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		if fs != nil {
+			ephemeralDevice = fs.Source
+		}
+	}
+
 	err := d.mounter.Unmount(req.TargetPath)
 	if err != nil {
 		return nil, err
 	}
 
+	if ephemeral {
+		if err := d.nodeUnpublishEphemeralVolume(ctx, req.VolumeId, ephemeralDevice, log); err != nil {
+			return nil, err
+		}
+	}
+
+	d.nodeStatus.unpublished(req.VolumeId, req.TargetPath)
+
 	log.Info("unmounting volume is finished")
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
@@ -327,6 +430,13 @@ func (d *Driver) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabi
 				},
 			},
 		},
+		{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{
+					Type: csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+				},
+			},
+		},
 	}
 
 	d.log.WithFields(logrus.Fields{
@@ -342,13 +452,44 @@ func (d *Driver) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabi
 // knows where to place the workload. The result of this function will be used
 // by the CO in ControllerPublishVolume.
 func (d *Driver) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
-	d.log.WithField("method", "node_get_info").Info("node get info called")
+	log := d.log.WithField("method", "node_get_info")
+	log.Info("node get info called")
+
 	return &csi.NodeGetInfoResponse{
 		NodeId:            d.hostID(),
-		MaxVolumesPerNode: int64(d.volumeLimit), //nolint:gosec // conversions are OK here
+		MaxVolumesPerNode: d.maxVolumesPerNode(ctx, log),
 	}, nil
 }
 
+// maxVolumesPerNode returns the number of volumes which may be attached to this node, found from
+// the SCSI controllers of its VM. The node plugin may only get its VM from the backend if it has the
+// node API key. Otherwise, or if the backend does not report the SCSI controllers, the volume limit
+// given to the driver is returned.
+func (d *Driver) maxVolumesPerNode(ctx context.Context, log *logrus.Entry) int64 {
+
+	if d.isController || d.ephemeralVolumes {
+		vm, err := d.hypervClient.GetVm(ctx, d.hostID())
+
+		switch {
+		case err != nil:
+			log.WithError(err).Warn("cannot get SCSI controllers of VM; using configured volume limit")
+		case len(vm.ScsiControllers) == 0:
+			log.Warn("backend did not report SCSI controllers of VM; using configured volume limit")
+		default:
+			log.WithFields(logrus.Fields{
+				"scsi_controllers": len(vm.ScsiControllers),
+				"scsi_drives":      vm.ScsiDrives(),
+				"volume_drives":    vm.VolumeDrives,
+				"max_volumes":      vm.MaxVolumes(),
+			}).Info("found volume limit from SCSI controllers of VM")
+
+			return int64(vm.MaxVolumes())
+		}
+	}
+
+	return int64(d.volumeLimit) //nolint:gosec // conversions are OK here
+}
+
 // NodeGetVolumeStats returns the volume capacity statistics available for the
 // the given volume.
 func (d *Driver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
@@ -387,6 +528,15 @@ func (d *Driver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeS
 		return nil, status.Errorf(codes.Internal, "failed to retrieve capacity statistics for volume path %q: %s", volumePath, err)
 	}
 
+	condition, err := d.nodeVolumeCondition(req.VolumeId, req.StagingTargetPath, isBlock)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to determine condition of volume %q: %s", req.VolumeId, err)
+	}
+
+	if condition.Abnormal {
+		log.WithField("condition", condition.Message).Warn("volume is abnormal")
+	}
+
 	// Print large numbers with comma separators
 	p := message.NewPrinter(language.English)
 
@@ -404,6 +554,7 @@ func (d *Driver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeS
 					Total: stats.totalBytes,
 				},
 			},
+			VolumeCondition: condition,
 		}, nil
 	}
 
@@ -432,9 +583,216 @@ func (d *Driver) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeS
 				Unit:      csi.VolumeUsage_INODES,
 			},
 		},
+		VolumeCondition: condition,
+	}, nil
+}
+
+// nodeVolumeCondition checks the given volume for abnormal states as seen from the node, these being
+//
+//   - The disk device is no longer present
+//   - The staging path is not mounted, or is mounted from a different device
+//   - The filesystem has been remounted read-only, e.g. following I/O errors,
+//     when the disk is not attached read-only
+//   - A file cannot be written to the filesystem
+//
+// Filesystem checks are skipped for block volumes or when no staging path is given.
+// An error is returned only if the checks themselves could not be run.
+func (d *Driver) nodeVolumeCondition(volumeID, stagingPath string, isBlock bool) (*csi.VolumeCondition, error) {
+
+	source, err := hypervDiskByID(volumeID)
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := d.mounter.ResolveDevice(source)
+	if err != nil {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("disk device %s is missing", source),
+		}, nil
+	}
+
+	if isBlock || stagingPath == "" {
+		return &csi.VolumeCondition{
+			Message: "volume is healthy",
+		}, nil
+	}
+
+	// An encrypted volume is mounted from its LUKS mapping
+	mapperName := luksMapperName(volumeID)
+	encrypted, err := d.encryptor.IsOpen(mapperName)
+	if err != nil {
+		return nil, err
+	}
+
+	if encrypted {
+		mapperPath := luksMapperPath(volumeID)
+		if device, err = d.mounter.ResolveDevice(mapperPath); err != nil {
+			return &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  fmt.Sprintf("LUKS mapping %s is missing", mapperPath),
+			}, nil
+		}
+	}
+
+	fs, err := d.mounter.GetMountInfo(stagingPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs == nil {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("staging path %s is not mounted", stagingPath),
+		}, nil
+	}
+
+	mountedDevice, err := d.mounter.ResolveDevice(fs.Source)
+	if err != nil || mountedDevice != device {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("staging path %s is mounted from %s, expected %s", stagingPath, fs.Source, device),
+		}, nil
+	}
+
+	if slices.Contains(strings.Split(fs.Options, ","), "ro") {
+		// A disk attached read-only is expected to be mounted read-only
+		if readOnly, err := d.mounter.IsReadOnly(device); err == nil && readOnly {
+			return &csi.VolumeCondition{
+				Message: d.healthyFilesystemMessage(volumeID),
+			}, nil
+		}
+
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  "filesystem has been remounted read-only",
+		}, nil
+	}
+
+	if err := d.mounter.CanaryWrite(stagingPath); err != nil {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("filesystem is not writable: %v", err),
+		}, nil
+	}
+
+	return &csi.VolumeCondition{
+		Message: d.healthyFilesystemMessage(volumeID),
 	}, nil
 }
 
+// healthyFilesystemMessage returns the condition message for a healthy filesystem
+// volume, including the result of any filesystem check made when it was staged.
+func (d *Driver) healthyFilesystemMessage(volumeID string) string {
+	if result, ok := d.fsckResults.Load(volumeID); ok {
+		return fmt.Sprintf("volume is healthy, %s when staged", result.(*fsckResult))
+	}
+
+	return "volume is healthy"
+}
+
+// checkFilesystem checks the filesystem on source according to the fsck policy before it is
+// staged, recording the result for the volume condition. The check is skipped if the filesystem
+// is already mounted at the staging path. A filesystem on a disk attached read-only is checked
+// but never repaired. An error is returned if the filesystem has errors which were not repaired.
+func (d *Driver) checkFilesystem(volumeID, source, target, fsType, policy string, readOnly bool, log *logrus.Entry) error {
+	if policy == "" || policy == fsckPolicyNone {
+		return nil
+	}
+
+	mounted, err := d.mounter.IsMounted(target)
+	if err != nil {
+		return err
+	}
+
+	if mounted {
+		log.Info("skipping filesystem check as the volume is already mounted")
+		return nil
+	}
+
+	repair := policy == fsckPolicyRepair && !readOnly
+
+	log = log.WithFields(logrus.Fields{
+		"fsck_policy": policy,
+		"fsck_repair": repair,
+	})
+	log.Info("checking the filesystem")
+
+	result, err := d.mounter.CheckFilesystem(source, fsType, repair)
+	if err != nil {
+		return status.Errorf(codes.Internal, "could not check filesystem on volume %q: %v", volumeID, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		"fsck_result": result.String(),
+		"fsck_output": result.Output,
+	}).Info("filesystem check is finished")
+
+	d.fsckResults.Store(volumeID, result)
+
+	if !result.Clean && !result.Repaired {
+		return status.Errorf(codes.FailedPrecondition, "filesystem on volume %q has errors, see the node plugin log for the %s output", volumeID, fsType)
+	}
+
+	return nil
+}
+
+// openEncryptedVolume unlocks the LUKS encrypted disk at the given path, returning the path to the
+// device mapper device which holds the unlocked volume. A disk which is not yet LUKS formatted is
+// formatted only if allowed and if it does not already hold a filesystem, so that existing data is
+// never overwritten.
+func (d *Driver) openEncryptedVolume(volumeID, disk string, secrets map[string]string, allowFormat, readOnly bool, log *logrus.Entry) (string, error) {
+	passphrase := secrets[encryptionPassphraseKey]
+	if passphrase == "" {
+		return "", status.Errorf(codes.InvalidArgument, "NodeStageVolume encrypted volume %q requires the %q secret", volumeID, encryptionPassphraseKey)
+	}
+
+	mapperName := luksMapperName(volumeID)
+	mapperPath := luksMapperPath(volumeID)
+
+	open, err := d.encryptor.IsOpen(mapperName)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to check LUKS mapping %q: %v", mapperName, err)
+	}
+
+	if open {
+		log.Info("LUKS mapping is already open")
+		return mapperPath, nil
+	}
+
+	isLuks, err := d.encryptor.IsLuks(disk)
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+
+	if !isLuks {
+		if !allowFormat {
+			return "", status.Errorf(codes.FailedPrecondition, "encrypted volume %q is not LUKS formatted and cannot be formatted", volumeID)
+		}
+
+		formatted, err := d.mounter.IsFormatted(disk)
+		if err != nil {
+			return "", err
+		}
+
+		if formatted {
+			return "", status.Errorf(codes.FailedPrecondition, "encrypted volume %q already contains an unencrypted filesystem", volumeID)
+		}
+
+		log.Info("LUKS formatting the volume")
+		if err := d.encryptor.Format(disk, passphrase); err != nil {
+			return "", status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	log.Info("opening the LUKS mapping")
+	if err := d.encryptor.Open(disk, mapperName, passphrase, readOnly); err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+
+	return mapperPath, nil
+}
+
 func (d *Driver) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
 
 	volumeID := req.GetVolumeId()
@@ -482,10 +840,25 @@ func (d *Driver) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolume
 		return nil, status.Errorf(codes.NotFound, "NodeExpandVolume device path for volume path %q not found", volumePath)
 	}
 
-	r := mountutil.NewResizeFs(utilexec.New())
 	log = log.WithFields(logrus.Fields{
 		"device_path": devicePath,
 	})
+
+	// An encrypted volume's mapping must be grown to the new size of the disk before its filesystem
+	mapperName := luksMapperName(volumeID)
+	encrypted, err := d.encryptor.IsOpen(mapperName)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "NodeExpandVolume failed to check LUKS mapping %q: %v", mapperName, err)
+	}
+
+	if encrypted {
+		log.Info("resizing LUKS mapping")
+		if err := d.encryptor.Resize(mapperName, req.GetSecrets()[encryptionPassphraseKey]); err != nil {
+			return nil, status.Errorf(codes.Internal, "NodeExpandVolume could not resize LUKS mapping for volume %q: %v", volumeID, err)
+		}
+	}
+
+	r := mountutil.NewResizeFs(utilexec.New())
 	log.Info("resizing volume")
 	if _, err := r.Resize(devicePath, volumePath); err != nil {
 		return nil, status.Errorf(codes.Internal, "NodeExpandVolume could not resize volume %q (%q):  %v", volumeID, req.GetVolumePath(), err)
@@ -531,13 +904,13 @@ func (d *Driver) nodePublishVolumeForFileSystem(req *csi.NodePublishVolumeReques
 	return nil
 }
 
-func (d *Driver) nodePublishVolumeForBlock(req *csi.NodePublishVolumeRequest, mountOptions []string, log *logrus.Entry) error {
+func (d *Driver) nodePublishVolumeForBlock(ctx context.Context, req *csi.NodePublishVolumeRequest, mountOptions []string, log *logrus.Entry) error {
 	volumeName, ok := req.GetPublishContext()[d.publishInfoVolumeName]
 	if !ok {
 		return status.Error(codes.InvalidArgument, fmt.Sprintf("Could not find the volume name from the publish context %q", d.publishInfoVolumeName))
 	}
 
-	source, err := hypervDiskByID(req.VolumeId)
+	source, err := d.devices.find(ctx, log, req.VolumeId)
 	if err != nil {
 		return status.Errorf(codes.Internal, "Failed to find device path for volume %s. %v", volumeName, err)
 	}
@@ -567,8 +940,50 @@ func (d *Driver) nodePublishVolumeForBlock(req *csi.NodePublishVolumeRequest, mo
 	return nil
 }
 
+// readOnlyMountOptions returns the options needed to mount a filesystem on a
+// read-only device. Journal recovery must be skipped as it writes to the device.
+func readOnlyMountOptions(fsType string) []string {
+	switch fsType {
+	case fstypeExt3, fstypeExt4:
+		return []string{"ro", "noload"}
+	case fstypeXfs:
+		return []string{"ro", "norecovery"}
+	case fstypeBtrfs:
+		return []string{"ro", "nologreplay"}
+	default:
+		return []string{"ro"}
+	}
+}
+
+// volumeMkfsOptions returns the additional mkfs options for the given fs type from the
+// volume context. Options given for the fs type take precedence over the general options.
+func volumeMkfsOptions(volumeContext map[string]string, fsType string) []string {
+	options, ok := volumeContext[mkfsOptionsParameter+"."+fsType]
+	if !ok {
+		options = volumeContext[mkfsOptionsParameter]
+	}
+
+	return strings.Fields(options)
+}
+
 // hypervDiskByID converts a Hyper-V DiskIdentifier UUID into the /dev/disk/by-id
 // "scsi-3<wwn>" link that Linux creates for synthetic SCSI disks.
+func hypervDiskByID(guid string) (string, error) {
+
+	wwn, err := hypervWWN(guid)
+	if err != nil {
+		return "", err
+	}
+
+	return diskByIDPath(wwn), nil
+}
+
+// diskByIDPath returns the /dev/disk/by-id link that udev creates for the disk with the given WWN.
+func diskByIDPath(wwn []byte) string {
+	return filepath.Join(diskIDPath, fmt.Sprintf("scsi-3%s", hex.EncodeToString(wwn))) // lowercase
+}
+
+// hypervWWN converts a Hyper-V DiskIdentifier UUID into the WWN of the synthetic SCSI disk.
 //
 // WWN layout (16 bytes total):
 //
@@ -576,7 +991,7 @@ func (d *Driver) nodePublishVolumeForBlock(req *csi.NodePublishVolumeRequest, mo
 //	[4:8]   = UUID.Data1 (reversed for little-endian)
 //	[8:10]  = UUID.Data2 (reversed for little-endian)
 //	[10:16] = last 6 bytes of UUID.Data4 (drop first 2 bytes)
-func hypervDiskByID(guid string) (string, error) {
+func hypervWWN(guid string) ([]byte, error) {
 
 	const (
 		networkAddressAuthority = "\x60"
@@ -587,7 +1002,7 @@ func hypervDiskByID(guid string) (string, error) {
 
 	u, err := uuid.Parse(guid)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	b := u[:] // 16-byte RFC 4122 layout
 
@@ -612,6 +1027,5 @@ func hypervDiskByID(guid string) (string, error) {
 	wwn = append(wwn, b[4:6]...)                          // Data2 (LE)
 	wwn = append(wwn, last6...)
 
-	hexStr := hex.EncodeToString(wwn) // lowercase
-	return filepath.Join(diskIDPath, fmt.Sprintf("scsi-3%s", hexStr)), nil
+	return wwn, nil
 }
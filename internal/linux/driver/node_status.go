@@ -0,0 +1,211 @@
+//go:build linux
+
+package driver
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fireflycons/hypervcsi/internal/linux/kvp"
+	"github.com/sirupsen/logrus"
+)
+
+// Keys of the entries the node plugin publishes in the KVP guest pool.
+// Staged volumes have one entry each, keyed by volume ID. Published volumes
+// have one entry for each target path, keyed by volume ID and the number of the
+// target, since the paths of many targets would not fit in one KVP value.
+const (
+	nodeStatusKeyPrefix      = "hyperv-csi/"
+	nodeVersionKey           = nodeStatusKeyPrefix + "version"
+	nodeHealthKey            = nodeStatusKeyPrefix + "health"
+	stagedVolumeKeyPrefix    = nodeStatusKeyPrefix + "staged/"
+	publishedVolumeKeyPrefix = nodeStatusKeyPrefix + "published/"
+
+	nodeHealthReady   = "Ready"
+	nodeHealthStopped = "Stopped"
+)
+
+// nodeStatus publishes the status of the node plugin to the Hyper-V host through the
+// KVP guest pool: the driver version, its health, and the volumes it has staged and
+// published. The value of a staged volume is its staging path, and that of each
+// target of a published volume is the target path.
+//
+// Failures are logged rather than returned, since the status is informational and the
+// node must continue to work without the KVP daemon. All methods may be called on nil,
+// which the controller has.
+type nodeStatus struct {
+	writer kvp.PoolWriter
+	log    *logrus.Entry
+
+	mu sync.Mutex
+
+	// targets are the numbers of the target paths of each published volume, keyed by volume ID
+	targets map[string]map[string]int
+}
+
+func newNodeStatus(writer kvp.PoolWriter, log *logrus.Entry) *nodeStatus {
+	return &nodeStatus{
+		writer:  writer,
+		log:     log.WithField("component", "node-status"),
+		targets: map[string]map[string]int{},
+	}
+}
+
+// start publishes the driver version and that the node plugin is ready.
+// Entries for volumes staged or published before a restart are kept, as
+// the volumes remain in use, and the target paths of published volumes are
+// read back from the pool, dropping those that are no longer mounted.
+func (n *nodeStatus) start(version string, mounted func(path string) bool) {
+
+	if n == nil {
+		return
+	}
+
+	n.restore(mounted)
+	n.write(nodeVersionKey, version)
+	n.write(nodeHealthKey, nodeHealthReady)
+}
+
+// restore rebuilds the target paths of each published volume from the entries
+// published before a restart, so that publishing another target of the volume
+// does not reuse the number of one it already has.
+func (n *nodeStatus) restore(mounted func(path string) bool) {
+
+	entries, err := n.writer.Entries()
+	if err != nil {
+		n.log.WithError(err).Warn("cannot read node status from KVP guest pool")
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for key, target := range entries {
+		entry, ok := strings.CutPrefix(key, publishedVolumeKeyPrefix)
+		if !ok {
+			continue
+		}
+
+		volumeId, number, _ := strings.Cut(entry, "/")
+		num, err := strconv.Atoi(number)
+
+		if _, dup := n.targets[volumeId][target]; err != nil || dup || target == "" || !mounted(target) {
+			n.delete(key)
+			continue
+		}
+
+		if n.targets[volumeId] == nil {
+			n.targets[volumeId] = map[string]int{}
+		}
+
+		n.targets[volumeId][target] = num
+	}
+}
+
+// stop publishes that the node plugin has stopped.
+func (n *nodeStatus) stop() {
+
+	if n == nil {
+		return
+	}
+
+	n.write(nodeHealthKey, nodeHealthStopped)
+}
+
+func (n *nodeStatus) staged(volumeId, stagingPath string) {
+
+	if n == nil {
+		return
+	}
+
+	n.write(stagedVolumeKeyPrefix+volumeId, stagingPath)
+}
+
+func (n *nodeStatus) unstaged(volumeId string) {
+
+	if n == nil {
+		return
+	}
+
+	n.delete(stagedVolumeKeyPrefix + volumeId)
+}
+
+func (n *nodeStatus) published(volumeId, targetPath string) {
+
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.targets[volumeId] == nil {
+		n.targets[volumeId] = map[string]int{}
+	}
+
+	num, ok := n.targets[volumeId][targetPath]
+	if !ok {
+		num = n.freeNumber(volumeId)
+		n.targets[volumeId][targetPath] = num
+	}
+
+	n.write(publishedTargetKey(volumeId, num), targetPath)
+}
+
+func (n *nodeStatus) unpublished(volumeId, targetPath string) {
+
+	if n == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	num, ok := n.targets[volumeId][targetPath]
+	if !ok {
+		return
+	}
+
+	delete(n.targets[volumeId], targetPath)
+
+	if len(n.targets[volumeId]) == 0 {
+		delete(n.targets, volumeId)
+	}
+
+	n.delete(publishedTargetKey(volumeId, num))
+}
+
+// freeNumber returns the lowest number not given to a target path of a volume.
+func (n *nodeStatus) freeNumber(volumeId string) int {
+
+	used := make(map[int]struct{}, len(n.targets[volumeId]))
+	for _, num := range n.targets[volumeId] {
+		used[num] = struct{}{}
+	}
+
+	num := 0
+	for {
+		if _, ok := used[num]; !ok {
+			return num
+		}
+
+		num++
+	}
+}
+
+// publishedTargetKey returns the key of the entry for a target path of a volume.
+func publishedTargetKey(volumeId string, num int) string {
+	return publishedVolumeKeyPrefix + volumeId + "/" + strconv.Itoa(num)
+}
+func (n *nodeStatus) write(key, value string) {
+	if err := n.writer.Write(key, value); err != nil {
+		n.log.WithError(err).WithField("key", key).Warn("cannot publish node status to KVP guest pool")
+	}
+}
+
+func (n *nodeStatus) delete(key string) {
+	if err := n.writer.Delete(key); err != nil {
+		n.log.WithError(err).WithField("key", key).Warn("cannot remove node status from KVP guest pool")
+	}
+}
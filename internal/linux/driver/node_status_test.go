@@ -0,0 +1,149 @@
+//go:build linux
+
+package driver
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fireflycons/hypervcsi/internal/linux/kvp"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeStatus(t *testing.T) {
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	dir := t.TempDir()
+	n := newNodeStatus(kvp.NewPoolWriter(dir, kvp.GuestPool), logger.WithField("test", true))
+	s := kvp.NewForDirectory(dir)
+
+	read := func(key string) string {
+		v, err := s.Read(kvp.GuestPool, key)
+		require.NoError(t, err)
+		return v
+	}
+
+	requireMissing := func(key string) {
+		_, err := s.Read(kvp.GuestPool, key)
+		require.Error(t, err)
+	}
+
+	mounted := func(string) bool { return true }
+
+	n.start("v1.2.3", mounted)
+	require.Equal(t, "v1.2.3", read(nodeVersionKey))
+	require.Equal(t, nodeHealthReady, read(nodeHealthKey))
+
+	n.staged("vol1", "/staging/vol1")
+	require.Equal(t, "/staging/vol1", read(stagedVolumeKeyPrefix+"vol1"))
+
+	n.published("vol1", "/pods/a/vol1")
+	n.published("vol1", "/pods/b/vol1")
+	require.Equal(t, "/pods/a/vol1", read(publishedVolumeKeyPrefix+"vol1/0"))
+	require.Equal(t, "/pods/b/vol1", read(publishedVolumeKeyPrefix+"vol1/1"))
+
+	// Publishing a target again keeps its entry
+	n.published("vol1", "/pods/a/vol1")
+	require.Equal(t, "/pods/a/vol1", read(publishedVolumeKeyPrefix+"vol1/0"))
+	requireMissing(publishedVolumeKeyPrefix + "vol1/2")
+
+	n.unpublished("vol1", "/pods/a/vol1")
+	requireMissing(publishedVolumeKeyPrefix + "vol1/0")
+	require.Equal(t, "/pods/b/vol1", read(publishedVolumeKeyPrefix+"vol1/1"))
+
+	// The number of an unpublished target is reused
+	n.published("vol1", "/pods/c/vol1")
+	require.Equal(t, "/pods/c/vol1", read(publishedVolumeKeyPrefix+"vol1/0"))
+
+	n.unpublished("vol1", "/pods/b/vol1")
+	n.unpublished("vol1", "/pods/c/vol1")
+	requireMissing(publishedVolumeKeyPrefix + "vol1/0")
+	requireMissing(publishedVolumeKeyPrefix + "vol1/1")
+
+	n.unstaged("vol1")
+	requireMissing(stagedVolumeKeyPrefix + "vol1")
+
+	n.stop()
+	require.Equal(t, nodeHealthStopped, read(nodeHealthKey))
+
+	// The controller has no node status
+	var none *nodeStatus
+	none.start("v1.2.3", mounted)
+	none.staged("vol1", "/staging/vol1")
+	none.published("vol1", "/pods/a/vol1")
+	none.unpublished("vol1", "/pods/a/vol1")
+	none.unstaged("vol1")
+	none.stop()
+}
+
+func TestNodeStatusRestart(t *testing.T) {
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	dir := t.TempDir()
+	w := kvp.NewPoolWriter(dir, kvp.GuestPool)
+	s := kvp.NewForDirectory(dir)
+
+	// Published before the restart, when /pods/c/vol1 was unmounted without the plugin
+	require.NoError(t, w.Write(publishedVolumeKeyPrefix+"vol1/0", "/pods/a/vol1"))
+	require.NoError(t, w.Write(publishedVolumeKeyPrefix+"vol1/1", "/pods/c/vol1"))
+	require.NoError(t, w.Write(publishedVolumeKeyPrefix+"vol2/0", "/pods/c/vol2"))
+
+	n := newNodeStatus(w, logger.WithField("test", true))
+	n.start("v1.2.3", func(path string) bool { return !strings.HasPrefix(path, "/pods/c/") })
+
+	v, err := s.Read(kvp.GuestPool, publishedVolumeKeyPrefix+"vol1/0")
+	require.NoError(t, err)
+	require.Equal(t, "/pods/a/vol1", v)
+
+	_, err = s.Read(kvp.GuestPool, publishedVolumeKeyPrefix+"vol1/1")
+	require.Error(t, err)
+
+	_, err = s.Read(kvp.GuestPool, publishedVolumeKeyPrefix+"vol2/0")
+	require.Error(t, err)
+
+	// A target published before the restart keeps its number when another is added
+	n.published("vol1", "/pods/b/vol1")
+
+	v, err = s.Read(kvp.GuestPool, publishedVolumeKeyPrefix+"vol1/1")
+	require.NoError(t, err)
+	require.Equal(t, "/pods/b/vol1", v)
+
+	// and its entry is removed when it is unpublished
+	n.unpublished("vol1", "/pods/a/vol1")
+
+	_, err = s.Read(kvp.GuestPool, publishedVolumeKeyPrefix+"vol1/0")
+	require.Error(t, err)
+}
+
+func TestNodeStatusManyTargets(t *testing.T) {
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	dir := t.TempDir()
+	n := newNodeStatus(kvp.NewPoolWriter(dir, kvp.GuestPool), logger.WithField("test", true))
+	s := kvp.NewForDirectory(dir)
+
+	// A volume shared by many pods has target paths whose total length
+	// is far longer than the largest KVP value
+	const volumeId = "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	targets := make([]string, 50)
+
+	for i := range targets {
+		targets[i] = fmt.Sprintf("/var/lib/kubelet/pods/%s/volumes/kubernetes.io~csi/pvc-%d/mount", uuid.NewString(), i)
+		n.published(volumeId, targets[i])
+	}
+
+	for i, target := range targets {
+		v, err := s.Read(kvp.GuestPool, publishedTargetKey(volumeId, i))
+		require.NoError(t, err)
+		require.Equal(t, target, v)
+	}
+}
@@ -3,10 +3,22 @@
 package driver
 
 import (
+	"context"
+	"errors"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestHypervDiskByID(t *testing.T) {
@@ -41,3 +53,557 @@ func TestHypervDiskByID(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeVolumeCondition(t *testing.T) {
+
+	const (
+		device      = "/dev/sdb"
+		stagingPath = "/var/lib/kubelet/staging/pv1"
+	)
+
+	volId := uuid.NewString()
+	source, err := hypervDiskByID(volId)
+	require.NoError(t, err)
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	tests := []struct {
+		name     string
+		isBlock  bool
+		setup    func(m *MockMounter)
+		abnormal bool
+		message  string
+	}{
+		{
+			name: "healthy filesystem volume",
+			setup: func(m *MockMounter) {
+				m.EXPECT().ResolveDevice(source).Return(device, nil)
+				m.EXPECT().GetMountInfo(stagingPath).Return(&fileSystem{Source: device, Options: "rw,relatime"}, nil)
+				m.EXPECT().ResolveDevice(device).Return(device, nil)
+				m.EXPECT().CanaryWrite(stagingPath).Return(nil)
+			},
+			message: "volume is healthy",
+		},
+		{
+			name:    "healthy block volume",
+			isBlock: true,
+			setup: func(m *MockMounter) {
+				m.EXPECT().ResolveDevice(source).Return(device, nil)
+			},
+			message: "volume is healthy",
+		},
+		{
+			name: "device missing",
+			setup: func(m *MockMounter) {
+				m.EXPECT().ResolveDevice(source).Return("", errors.New("no such file or directory"))
+			},
+			abnormal: true,
+			message:  "is missing",
+		},
+		{
+			name: "staging path not mounted",
+			setup: func(m *MockMounter) {
+				m.EXPECT().ResolveDevice(source).Return(device, nil)
+				m.EXPECT().GetMountInfo(stagingPath).Return(nil, nil)
+			},
+			abnormal: true,
+			message:  "is not mounted",
+		},
+		{
+			name: "mounted from another device",
+			setup: func(m *MockMounter) {
+				m.EXPECT().ResolveDevice(source).Return(device, nil)
+				m.EXPECT().GetMountInfo(stagingPath).Return(&fileSystem{Source: "/dev/sdc", Options: "rw"}, nil)
+				m.EXPECT().ResolveDevice("/dev/sdc").Return("/dev/sdc", nil)
+			},
+			abnormal: true,
+			message:  "expected /dev/sdb",
+		},
+		{
+			name: "remounted read-only",
+			setup: func(m *MockMounter) {
+				m.EXPECT().ResolveDevice(source).Return(device, nil)
+				m.EXPECT().GetMountInfo(stagingPath).Return(&fileSystem{Source: device, Options: "ro,relatime"}, nil)
+				m.EXPECT().ResolveDevice(device).Return(device, nil)
+				m.EXPECT().IsReadOnly(device).Return(false, nil)
+			},
+			abnormal: true,
+			message:  "read-only",
+		},
+		{
+			name: "attached read-only",
+			setup: func(m *MockMounter) {
+				m.EXPECT().ResolveDevice(source).Return(device, nil)
+				m.EXPECT().GetMountInfo(stagingPath).Return(&fileSystem{Source: device, Options: "ro,relatime"}, nil)
+				m.EXPECT().ResolveDevice(device).Return(device, nil)
+				m.EXPECT().IsReadOnly(device).Return(true, nil)
+			},
+			message: "volume is healthy",
+		},
+		{
+			name: "canary write fails",
+			setup: func(m *MockMounter) {
+				m.EXPECT().ResolveDevice(source).Return(device, nil)
+				m.EXPECT().GetMountInfo(stagingPath).Return(&fileSystem{Source: device, Options: "rw"}, nil)
+				m.EXPECT().ResolveDevice(device).Return(device, nil)
+				m.EXPECT().CanaryWrite(stagingPath).Return(errors.New("input/output error"))
+			},
+			abnormal: true,
+			message:  "not writable",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewMockMounter(t)
+			test.setup(m)
+
+			d := &Driver{
+				log:       logger.WithField("test", true),
+				mounter:   m,
+				encryptor: &fakeEncryptor{},
+			}
+
+			condition, err := d.nodeVolumeCondition(volId, stagingPath, test.isBlock)
+			require.NoError(t, err)
+			require.Equal(t, test.abnormal, condition.Abnormal)
+			require.Contains(t, condition.Message, test.message)
+		})
+	}
+}
+
+func TestNodeStageEncryptedVolume(t *testing.T) {
+
+	const (
+		stagingPath = "/var/lib/kubelet/staging/pv1"
+		passphrase  = "correct horse battery staple"
+	)
+
+	volId := uuid.NewString()
+	disk, err := hypervDiskByID(volId)
+	require.NoError(t, err)
+
+	mapperPath := luksMapperPath(volId)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	stageRequest := func(secrets map[string]string) *csi.NodeStageVolumeRequest {
+		return &csi.NodeStageVolumeRequest{
+			VolumeId:          volId,
+			StagingTargetPath: stagingPath,
+			PublishContext: map[string]string{
+				DefaultDriverName + "/volume-name": "pv1",
+			},
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+			VolumeContext: map[string]string{
+				encryptedParameter: "true",
+			},
+			Secrets: secrets,
+		}
+	}
+
+	newDriver := func(m Mounter, e *fakeEncryptor) *Driver {
+		return &Driver{
+			log:                   logger.WithField("test", true),
+			publishInfoVolumeName: DefaultDriverName + "/volume-name",
+			mounter:               m,
+			devices:               newDeviceManager(&fakeMounter{}),
+			encryptor:             e,
+		}
+	}
+
+	t.Run("formats and opens on first use", func(t *testing.T) {
+		m := NewMockMounter(t)
+		m.EXPECT().IsFormatted(disk).Return(false, nil)
+		m.EXPECT().IsFormatted(mapperPath).Return(false, nil)
+		m.EXPECT().Format(mapperPath, fstypeExt4).Return(nil)
+		m.EXPECT().IsMounted(stagingPath).Return(false, nil)
+		m.EXPECT().Mount(mapperPath, stagingPath, fstypeExt4).Return(nil)
+
+		e := &fakeEncryptor{luks: map[string]string{}, mapped: map[string]string{}}
+		d := newDriver(m, e)
+
+		_, err := d.NodeStageVolume(context.Background(), stageRequest(map[string]string{encryptionPassphraseKey: passphrase}))
+		require.NoError(t, err)
+		require.Equal(t, passphrase, e.luks[disk])
+		require.Equal(t, disk, e.mapped[luksMapperName(volId)])
+	})
+
+	t.Run("unstage closes mapping", func(t *testing.T) {
+		m := NewMockMounter(t)
+		m.EXPECT().IsMounted(stagingPath).Return(true, nil)
+		m.EXPECT().Unmount(stagingPath).Return(nil)
+
+		e := &fakeEncryptor{
+			luks:   map[string]string{disk: passphrase},
+			mapped: map[string]string{luksMapperName(volId): disk},
+		}
+		d := newDriver(m, e)
+
+		_, err := d.NodeUnstageVolume(context.Background(), &csi.NodeUnstageVolumeRequest{
+			VolumeId:          volId,
+			StagingTargetPath: stagingPath,
+		})
+		require.NoError(t, err)
+		require.Empty(t, e.mapped)
+	})
+
+	t.Run("missing passphrase", func(t *testing.T) {
+		d := newDriver(NewMockMounter(t), &fakeEncryptor{})
+
+		_, err := d.NodeStageVolume(context.Background(), stageRequest(nil))
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("refuses to encrypt existing filesystem", func(t *testing.T) {
+		m := NewMockMounter(t)
+		m.EXPECT().IsFormatted(disk).Return(true, nil)
+
+		e := &fakeEncryptor{luks: map[string]string{}, mapped: map[string]string{}}
+		d := newDriver(m, e)
+
+		_, err := d.NodeStageVolume(context.Background(), stageRequest(map[string]string{encryptionPassphraseKey: passphrase}))
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+		require.Empty(t, e.luks)
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		e := &fakeEncryptor{
+			luks:   map[string]string{disk: passphrase},
+			mapped: map[string]string{},
+		}
+		d := newDriver(NewMockMounter(t), e)
+
+		_, err := d.NodeStageVolume(context.Background(), stageRequest(map[string]string{encryptionPassphraseKey: "wrong"}))
+		require.Equal(t, codes.Internal, status.Code(err))
+		require.Empty(t, e.mapped)
+	})
+}
+
+func TestVolumeMkfsOptions(t *testing.T) {
+
+	volumeContext := map[string]string{
+		mkfsOptionsParameter:                     "-L data",
+		mkfsOptionsParameter + "." + fstypeXfs:   "-m reflink=1",
+		mkfsOptionsParameter + "." + fstypeBtrfs: "",
+	}
+
+	tests := []struct {
+		fsType   string
+		expected []string
+	}{
+		{fsType: fstypeExt4, expected: []string{"-L", "data"}},
+		{fsType: fstypeXfs, expected: []string{"-m", "reflink=1"}},
+		{fsType: fstypeBtrfs, expected: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fsType, func(t *testing.T) {
+			require.Equal(t, test.expected, volumeMkfsOptions(volumeContext, test.fsType))
+		})
+	}
+
+	require.Empty(t, volumeMkfsOptions(nil, fstypeExt4))
+}
+
+func TestNodeStageFsckPolicy(t *testing.T) {
+
+	const stagingPath = "/var/lib/kubelet/staging/pv1"
+
+	volId := uuid.NewString()
+	disk, err := hypervDiskByID(volId)
+	require.NoError(t, err)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	stageRequest := func(policy string, readOnly bool) *csi.NodeStageVolumeRequest {
+		req := &csi.NodeStageVolumeRequest{
+			VolumeId:          volId,
+			StagingTargetPath: stagingPath,
+			PublishContext: map[string]string{
+				DefaultDriverName + "/volume-name": "pv1",
+			},
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+			VolumeContext: map[string]string{
+				fsckPolicyParameter: policy,
+			},
+		}
+
+		if readOnly {
+			req.PublishContext[DefaultDriverName+"/readonly"] = "true"
+		}
+
+		return req
+	}
+
+	newDriver := func(m Mounter) *Driver {
+		return &Driver{
+			log:                   logger.WithField("test", true),
+			publishInfoVolumeName: DefaultDriverName + "/volume-name",
+			publishInfoReadOnly:   DefaultDriverName + "/readonly",
+			mounter:               m,
+			devices:               newDeviceManager(&fakeMounter{}),
+			encryptor:             &fakeEncryptor{},
+		}
+	}
+
+	t.Run("clean filesystem is staged and recorded", func(t *testing.T) {
+		m := NewMockMounter(t)
+		m.EXPECT().IsFormatted(disk).Return(true, nil)
+		m.EXPECT().IsMounted(stagingPath).Return(false, nil)
+		m.EXPECT().CheckFilesystem(disk, fstypeExt4, false).Return(&fsckResult{Clean: true}, nil)
+		m.EXPECT().Mount(disk, stagingPath, fstypeExt4).Return(nil)
+
+		d := newDriver(m)
+		_, err := d.NodeStageVolume(context.Background(), stageRequest(fsckPolicyCheck, false))
+		require.NoError(t, err)
+		require.Equal(t, "volume is healthy, filesystem check passed when staged", d.healthyFilesystemMessage(volId))
+	})
+
+	t.Run("check fails stage on errors", func(t *testing.T) {
+		m := NewMockMounter(t)
+		m.EXPECT().IsFormatted(disk).Return(true, nil)
+		m.EXPECT().IsMounted(stagingPath).Return(false, nil)
+		m.EXPECT().CheckFilesystem(disk, fstypeExt4, false).Return(&fsckResult{Output: "bad inode"}, nil)
+
+		_, err := newDriver(m).NodeStageVolume(context.Background(), stageRequest(fsckPolicyCheck, false))
+		require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+
+	t.Run("repair is recorded", func(t *testing.T) {
+		m := NewMockMounter(t)
+		m.EXPECT().IsFormatted(disk).Return(true, nil)
+		m.EXPECT().IsMounted(stagingPath).Return(false, nil)
+		m.EXPECT().CheckFilesystem(disk, fstypeExt4, true).Return(&fsckResult{Repaired: true}, nil)
+		m.EXPECT().Mount(disk, stagingPath, fstypeExt4).Return(nil)
+
+		d := newDriver(m)
+		_, err := d.NodeStageVolume(context.Background(), stageRequest(fsckPolicyRepair, false))
+		require.NoError(t, err)
+		require.Contains(t, d.healthyFilesystemMessage(volId), "repaired")
+	})
+
+	t.Run("read-only volume is not repaired", func(t *testing.T) {
+		m := NewMockMounter(t)
+		m.EXPECT().IsFormatted(disk).Return(true, nil)
+		m.EXPECT().IsMounted(stagingPath).Return(false, nil)
+		m.EXPECT().CheckFilesystem(disk, fstypeExt4, false).Return(&fsckResult{Clean: true}, nil)
+		m.EXPECT().Mount(disk, stagingPath, fstypeExt4, []string{"ro", "noload"}).Return(nil)
+
+		_, err := newDriver(m).NodeStageVolume(context.Background(), stageRequest(fsckPolicyRepair, true))
+		require.NoError(t, err)
+	})
+
+	t.Run("mounted filesystem is not checked", func(t *testing.T) {
+		m := NewMockMounter(t)
+		m.EXPECT().IsFormatted(disk).Return(true, nil)
+		m.EXPECT().IsMounted(stagingPath).Return(true, nil)
+
+		d := newDriver(m)
+		_, err := d.NodeStageVolume(context.Background(), stageRequest(fsckPolicyRepair, false))
+		require.NoError(t, err)
+		require.Equal(t, "volume is healthy", d.healthyFilesystemMessage(volId))
+	})
+}
+
+func TestEphemeralVolume(t *testing.T) {
+
+	const (
+		volumeHandle = "csi-0123456789abcdef"
+		targetPath   = "/var/lib/kubelet/pods/pod1/volumes/kubernetes.io~csi/scratch/mount"
+	)
+
+	nodeId := uuid.NewString()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	newDriver := func(enabled bool) (*Driver, *fakeClient, *fakeMounter) {
+		client := &fakeClient{
+			volumes: map[string]*models.GetVHDResponse{},
+		}
+
+		m := &fakeMounter{
+			mounted: map[string]string{},
+		}
+
+		return &Driver{
+			log:              logger.WithField("test", true),
+			hypervClient:     client,
+			mounter:          m,
+			devices:          newDeviceManager(m),
+			encryptor:        &fakeEncryptor{},
+			ephemeralVolumes: enabled,
+			hostID:           func() string { return nodeId },
+		}, client, m
+	}
+
+	publishRequest := func(size string) *csi.NodePublishVolumeRequest {
+		return &csi.NodePublishVolumeRequest{
+			VolumeId:   volumeHandle,
+			TargetPath: targetPath,
+			VolumeCapability: &csi.VolumeCapability{
+				AccessType: &csi.VolumeCapability_Mount{
+					Mount: &csi.VolumeCapability_MountVolume{},
+				},
+				AccessMode: &csi.VolumeCapability_AccessMode{
+					Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+				},
+			},
+			VolumeContext: map[string]string{
+				ephemeralContextKey:    "true",
+				ephemeralSizeAttribute: size,
+			},
+		}
+	}
+
+	t.Run("publish creates, attaches and mounts volume", func(t *testing.T) {
+		d, client, m := newDriver(true)
+
+		_, err := d.NodePublishVolume(context.Background(), publishRequest("1Gi"))
+		require.NoError(t, err)
+		require.Len(t, client.volumes, 1)
+
+		for _, v := range client.volumes {
+			require.Equal(t, constants.EphemeralVolumePrefix+volumeHandle, v.Name)
+			require.Equal(t, int64(constants.GiB), v.Size)
+			require.Equal(t, nodeId, *v.Host)
+
+			source, err := hypervDiskByID(v.DiskIdentifier)
+			require.NoError(t, err)
+			require.Equal(t, source, m.mounted[targetPath])
+		}
+
+		_, err = d.NodeUnpublishVolume(context.Background(), &csi.NodeUnpublishVolumeRequest{
+			VolumeId:   volumeHandle,
+			TargetPath: targetPath,
+		})
+		require.NoError(t, err)
+		require.Empty(t, client.volumes)
+		require.Empty(t, m.mounted)
+	})
+
+	t.Run("unpublish removes the disk device before deleting the volume", func(t *testing.T) {
+		d, client, m := newDriver(true)
+
+		_, err := d.NodePublishVolume(context.Background(), publishRequest("1Gi"))
+		require.NoError(t, err)
+
+		// The fake mounter does not resolve the udev link, so it is the name of the device
+		device := m.mounted[targetPath]
+		sysDir := t.TempDir()
+		deleteFile := filepath.Join(sysDir, "block", filepath.Base(device), "device", "delete")
+		require.NoError(t, os.MkdirAll(filepath.Dir(deleteFile), 0755))
+		require.NoError(t, os.WriteFile(deleteFile, nil, 0600))
+
+		d.devices.sysDir = sysDir
+		d.devices.flush = func(string) error {
+			require.Len(t, client.volumes, 1, "device flushed after the volume was deleted")
+			return nil
+		}
+
+		_, err = d.NodeUnpublishVolume(context.Background(), &csi.NodeUnpublishVolumeRequest{
+			VolumeId:   volumeHandle,
+			TargetPath: targetPath,
+		})
+		require.NoError(t, err)
+		require.Empty(t, client.volumes)
+
+		data, err := os.ReadFile(deleteFile)
+		require.NoError(t, err)
+		require.Equal(t, "1", string(data))
+	})
+
+	t.Run("invalid size", func(t *testing.T) {
+		d, client, _ := newDriver(true)
+
+		_, err := d.NodePublishVolume(context.Background(), publishRequest("lots"))
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.Empty(t, client.volumes)
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		d, client, _ := newDriver(false)
+
+		_, err := d.NodePublishVolume(context.Background(), publishRequest("1Gi"))
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.Empty(t, client.volumes)
+	})
+}
+
+func TestNodeGetInfoMaxVolumes(t *testing.T) {
+
+	nodeId := uuid.NewString()
+
+	logger := logrus.New()
+	logger.Out = &strings.Builder{}
+
+	newDriver := func(nodeApiKey bool, scsi rest.GetVMResponse) *Driver {
+		return &Driver{
+			log: logger.WithField("test", true),
+			hypervClient: &fakeClient{
+				nodes:  map[int]string{0: nodeId},
+				vmScsi: map[string]rest.GetVMResponse{nodeId: scsi},
+			},
+			hostID:           func() string { return nodeId },
+			ephemeralVolumes: nodeApiKey,
+			volumeLimit:      10,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		nodeApiKey bool
+		scsi       rest.GetVMResponse
+		expected   int64
+	}{
+		{
+			name:       "OS disk and volumes on one controller",
+			nodeApiKey: true,
+			scsi:       rest.GetVMResponse{ScsiControllers: scsiControllers(3), VolumeDrives: 2},
+			expected:   63,
+		},
+		{
+			name:       "two controllers",
+			nodeApiKey: true,
+			scsi:       rest.GetVMResponse{ScsiControllers: scsiControllers(2, 0), VolumeDrives: 0},
+			expected:   126,
+		},
+		{
+			name:       "SCSI controllers not reported",
+			nodeApiKey: true,
+			expected:   10,
+		},
+		{
+			name:     "no node API key",
+			scsi:     rest.GetVMResponse{ScsiControllers: scsiControllers(1)},
+			expected: 10,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := newDriver(test.nodeApiKey, test.scsi).NodeGetInfo(t.Context(), &csi.NodeGetInfoRequest{})
+			require.NoError(t, err)
+			require.Equal(t, nodeId, resp.NodeId)
+			require.Equal(t, test.expected, resp.MaxVolumesPerNode)
+		})
+	}
+}
@@ -0,0 +1,266 @@
+//go:build linux
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// DefaultOrphanGracePeriod is how long a volume must have been orphaned before it may be deleted
+	DefaultOrphanGracePeriod = 24 * time.Hour
+
+	// provisionedVolumePrefix begins the names of the volumes created by the external-provisioner,
+	// which names them after the UID of their claim. Volumes named otherwise were created or adopted
+	// with hvctl, so are not expected to have a PersistentVolume.
+	provisionedVolumePrefix = "pvc-"
+
+	// Reasons for the events raised by the orphan collector
+	orphanedVolumeReason     = "OrphanedVolume"
+	orphanDeletedReason      = "OrphanedVolumeDeleted"
+	orphanDeleteFailedReason = "OrphanedVolumeDeleteFailed"
+)
+
+// orphanCollector periodically compares the volumes in the PV store with the
+// PersistentVolumes in the cluster that belong to this driver. A volume with no
+// PersistentVolume is an orphan, which can happen if a PV is deleted by hand
+// while its reclaim policy is Retain, or if the provisioner failed part way.
+// Orphans are reported as metrics and events, and optionally deleted once they
+// have been orphaned for the grace period.
+//
+// Only volumes named by the external-provisioner are considered. The PV store
+// cannot tell which cluster provisioned a volume, so the volumes of another
+// cluster sharing the store are orphans of this one.
+type orphanCollector struct {
+	hypervClient hyperv.Client
+	kubeClient   kubernetes.Interface
+	recorder     record.EventRecorder
+	log          *logrus.Entry
+
+	driverName    string
+	interval      time.Duration
+	gracePeriod   time.Duration
+	deleteOrphans bool
+	pageSize      int
+
+	// now returns the current time, and is replaced in tests
+	now func() time.Time
+
+	// firstSeen is when each orphan was first found, keyed by volume ID
+	firstSeen map[string]time.Time
+
+	orphans        prometheus.Gauge
+	orphanBytes    prometheus.Gauge
+	deleted        prometheus.Counter
+	deleteFailures prometheus.Counter
+	scanFailures   prometheus.Counter
+}
+
+// orphanCollectorParams defines the parameters that can be passed to newOrphanCollector.
+type orphanCollectorParams struct {
+	HypervClient  hyperv.Client
+	KubeClient    kubernetes.Interface
+	Recorder      record.EventRecorder
+	Registerer    prometheus.Registerer
+	Log           *logrus.Entry
+	DriverName    string
+	Interval      time.Duration
+	GracePeriod   time.Duration
+	DeleteOrphans bool
+	PageSize      int
+}
+
+func newOrphanCollector(p *orphanCollectorParams) *orphanCollector {
+
+	c := &orphanCollector{
+		hypervClient:  p.HypervClient,
+		kubeClient:    p.KubeClient,
+		recorder:      p.Recorder,
+		log:           p.Log.WithField("component", "orphan-collector"),
+		driverName:    p.DriverName,
+		interval:      p.Interval,
+		gracePeriod:   p.GracePeriod,
+		deleteOrphans: p.DeleteOrphans,
+		pageSize:      p.PageSize,
+		now:           time.Now,
+		firstSeen:     map[string]time.Time{},
+		orphans: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "hyperv_csi_orphaned_volumes",
+			Help: "Number of volumes in the PV store with no PersistentVolume.",
+		}),
+		orphanBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "hyperv_csi_orphaned_volumes_bytes",
+			Help: "Total size of the volumes in the PV store with no PersistentVolume.",
+		}),
+		deleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hyperv_csi_orphaned_volumes_deleted_total",
+			Help: "Number of orphaned volumes deleted.",
+		}),
+		deleteFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hyperv_csi_orphaned_volume_delete_failures_total",
+			Help: "Number of failed attempts to delete an orphaned volume.",
+		}),
+		scanFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "hyperv_csi_orphan_scan_failures_total",
+			Help: "Number of scans for orphaned volumes that failed.",
+		}),
+	}
+
+	if c.gracePeriod <= 0 {
+		c.gracePeriod = DefaultOrphanGracePeriod
+	}
+
+	p.Registerer.MustRegister(c.orphans, c.orphanBytes, c.deleted, c.deleteFailures, c.scanFailures)
+
+	return c
+}
+
+// Run scans for orphans at each interval until the context is cancelled.
+func (c *orphanCollector) Run(ctx context.Context) error {
+
+	c.log.WithFields(logrus.Fields{
+		"interval":       c.interval,
+		"grace_period":   c.gracePeriod,
+		"delete_orphans": c.deleteOrphans,
+	}).Info("starting orphaned volume collector")
+
+	runPeriodically(ctx, c.interval, func(ctx context.Context) {
+		if err := c.reconcile(ctx); err != nil {
+			c.scanFailures.Inc()
+			c.log.WithError(err).Error("scan for orphaned volumes failed")
+		}
+	})
+
+	return nil
+}
+
+// reconcile makes one scan for orphans, deleting those whose grace period has expired
+// if deletion is enabled.
+func (c *orphanCollector) reconcile(ctx context.Context) error {
+
+	// List the PVs first so that a volume created between the two calls
+	// is not seen without its PV. The grace period covers the converse,
+	// where the provisioner has created a volume but not yet its PV.
+	pvs, err := volumeHandles(ctx, c.kubeClient, c.driverName)
+	if err != nil {
+		return err
+	}
+
+	handles := map[string]struct{}{}
+	for _, handle := range pvs {
+		handles[strings.ToLower(handle)] = struct{}{}
+	}
+
+	now := c.now()
+	seen := map[string]struct{}{}
+	listed := map[string]struct{}{}
+	var orphanBytes int64
+
+	token := ""
+
+	for {
+		resp, err := c.hypervClient.ListVolumes(ctx, c.pageSize, token)
+		if err != nil {
+			return fmt.Errorf("cannot list volumes: %w", err)
+		}
+
+		for _, vol := range resp.Volumes {
+
+			id := strings.ToLower(vol.DiskIdentifier)
+
+			// A VHD Set is listed once for each VM to which it is attached
+			if _, ok := listed[id]; ok {
+				continue
+			}
+
+			listed[id] = struct{}{}
+
+			if _, ok := handles[id]; ok {
+				continue
+			}
+
+			// Ephemeral inline volumes never have a PV, and volumes from hvctl need not have one
+			if !strings.HasPrefix(vol.Name, provisionedVolumePrefix) || strings.HasPrefix(vol.Name, constants.EphemeralVolumePrefix) {
+				continue
+			}
+
+			seen[vol.DiskIdentifier] = struct{}{}
+			orphanBytes += vol.Size
+
+			log := c.log.WithFields(logrus.Fields{
+				"volume_id":   vol.DiskIdentifier,
+				"volume_name": vol.Name,
+			})
+
+			firstSeen, ok := c.firstSeen[vol.DiskIdentifier]
+			if !ok {
+				firstSeen = now
+				c.firstSeen[vol.DiskIdentifier] = now
+				log.Warn("found orphaned volume")
+				c.event(corev1.EventTypeWarning, orphanedVolumeReason, "Volume %s (%s, %s) has no PersistentVolume",
+					vol.DiskIdentifier, vol.Name, common.FormatBytes(vol.Size))
+			}
+
+			if !c.deleteOrphans || now.Sub(firstSeen) < c.gracePeriod {
+				continue
+			}
+
+			if err := c.hypervClient.DeleteVolume(ctx, vol.DiskIdentifier); err != nil {
+				c.deleteFailures.Inc()
+				log.WithError(err).Error("cannot delete orphaned volume")
+				c.event(corev1.EventTypeWarning, orphanDeleteFailedReason, "Cannot delete orphaned volume %s (%s): %s",
+					vol.DiskIdentifier, vol.Name, err)
+				continue
+			}
+
+			c.deleted.Inc()
+			delete(c.firstSeen, vol.DiskIdentifier)
+			delete(seen, vol.DiskIdentifier)
+			orphanBytes -= vol.Size
+			log.Info("deleted orphaned volume")
+			c.event(corev1.EventTypeNormal, orphanDeletedReason, "Deleted volume %s (%s) which had been orphaned since %s",
+				vol.DiskIdentifier, vol.Name, firstSeen.Format(time.RFC3339))
+		}
+
+		if resp.NextToken == "" {
+			break
+		}
+
+		token = resp.NextToken
+	}
+
+	// Forget volumes which have been deleted or have since gained a PV
+	for id := range c.firstSeen {
+		if _, ok := seen[id]; !ok {
+			delete(c.firstSeen, id)
+		}
+	}
+
+	c.orphans.Set(float64(len(seen)))
+	c.orphanBytes.Set(float64(orphanBytes))
+
+	return nil
+}
+
+// event records an event against the CSIDriver object, since a volume
+// with no PersistentVolume has no object of its own.
+func (c *orphanCollector) event(eventType, reason, messageFmt string, args ...any) {
+
+	if c.recorder == nil {
+		return
+	}
+
+	c.recorder.Eventf(csiDriverReference(c.driverName), eventType, reason, messageFmt, args...)
+}
@@ -0,0 +1,208 @@
+//go:build linux
+
+package driver
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestOrphanCollector(t *testing.T) {
+
+	var (
+		boundId     = uuid.NewString()
+		orphanId    = uuid.NewString()
+		foreignId   = uuid.NewString()
+		ephemeralId = uuid.NewString()
+		adoptedId   = uuid.NewString()
+	)
+
+	newPV := func(name, driver, handle string) *corev1.PersistentVolume {
+		return &corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: corev1.PersistentVolumeSpec{
+				PersistentVolumeSource: corev1.PersistentVolumeSource{
+					CSI: &corev1.CSIPersistentVolumeSource{
+						Driver:       driver,
+						VolumeHandle: handle,
+					},
+				},
+			},
+		}
+	}
+
+	newCollector := func(deleteOrphans bool) (*orphanCollector, *fakeClient, *record.FakeRecorder, *fake.Clientset, *prometheus.Registry) {
+
+		logger := logrus.New()
+		logger.Out = &strings.Builder{}
+
+		client := &fakeClient{
+			volumes: map[string]*models.GetVHDResponse{
+				boundId:     {Name: "pvc-bound", DiskIdentifier: boundId, Size: constants.GiB},
+				orphanId:    {Name: "pvc-orphan", DiskIdentifier: orphanId, Size: 2 * constants.GiB},
+				foreignId:   {Name: "pvc-foreign", DiskIdentifier: foreignId, Size: 4 * constants.GiB},
+				ephemeralId: {Name: constants.EphemeralVolumePrefix + "pod", DiskIdentifier: ephemeralId, Size: constants.GiB},
+				// Not provisioned by the external-provisioner, e.g. adopted with hvctl
+				adoptedId: {Name: "data", DiskIdentifier: adoptedId, Size: constants.GiB},
+			},
+		}
+
+		// A PV of another driver with the same handle does not own the volume.
+		// Volume handles are compared without regard to case.
+		kubeClient := fake.NewClientset(
+			newPV("pvc-bound", DefaultDriverName, strings.ToUpper(boundId)),
+			newPV("pvc-foreign", "other.csi.example.com", foreignId),
+		)
+
+		recorder := record.NewFakeRecorder(10)
+		metrics := prometheus.NewRegistry()
+
+		c := newOrphanCollector(&orphanCollectorParams{
+			HypervClient:  client,
+			KubeClient:    kubeClient,
+			Recorder:      recorder,
+			Registerer:    metrics,
+			Log:           logger.WithField("test", true),
+			DriverName:    DefaultDriverName,
+			Interval:      time.Minute,
+			GracePeriod:   time.Hour,
+			DeleteOrphans: deleteOrphans,
+		})
+
+		return c, client, recorder, kubeClient, metrics
+	}
+
+	t.Run("reports and deletes orphans after the grace period", func(t *testing.T) {
+
+		c, client, recorder, _, metrics := newCollector(true)
+		start := time.Now()
+		c.now = func() time.Time { return start }
+
+		require.NoError(t, c.reconcile(t.Context()))
+		require.Equal(t, float64(2), metricValue(t, metrics, "hyperv_csi_orphaned_volumes"))
+		require.Equal(t, float64(6*constants.GiB), metricValue(t, metrics, "hyperv_csi_orphaned_volumes_bytes"))
+		requireEvents(t, recorder, "Warning OrphanedVolume", "Warning OrphanedVolume")
+
+		// Within the grace period, nothing is deleted or reported again
+		c.now = func() time.Time { return start.Add(30 * time.Minute) }
+		require.NoError(t, c.reconcile(t.Context()))
+		require.Len(t, client.volumes, 5)
+		requireEvents(t, recorder)
+
+		c.now = func() time.Time { return start.Add(time.Hour) }
+		require.NoError(t, c.reconcile(t.Context()))
+		require.Len(t, client.volumes, 3)
+		require.Contains(t, client.volumes, boundId)
+		require.Contains(t, client.volumes, ephemeralId)
+		require.Contains(t, client.volumes, adoptedId)
+		require.Equal(t, float64(0), metricValue(t, metrics, "hyperv_csi_orphaned_volumes"))
+		require.Equal(t, float64(2), metricValue(t, metrics, "hyperv_csi_orphaned_volumes_deleted_total"))
+		requireEvents(t, recorder, "Normal OrphanedVolumeDeleted", "Normal OrphanedVolumeDeleted")
+		require.Empty(t, c.firstSeen)
+	})
+
+	t.Run("only reports orphans when deletion is disabled", func(t *testing.T) {
+
+		c, client, recorder, _, metrics := newCollector(false)
+		start := time.Now()
+		c.now = func() time.Time { return start }
+
+		require.NoError(t, c.reconcile(t.Context()))
+
+		c.now = func() time.Time { return start.Add(48 * time.Hour) }
+		require.NoError(t, c.reconcile(t.Context()))
+
+		require.Len(t, client.volumes, 5)
+		require.Equal(t, float64(2), metricValue(t, metrics, "hyperv_csi_orphaned_volumes"))
+		require.Equal(t, float64(0), metricValue(t, metrics, "hyperv_csi_orphaned_volumes_deleted_total"))
+		requireEvents(t, recorder, "Warning OrphanedVolume", "Warning OrphanedVolume")
+	})
+
+	t.Run("forgets an orphan that gains a PV", func(t *testing.T) {
+
+		c, client, _, kubeClient, _ := newCollector(true)
+		start := time.Now()
+		c.now = func() time.Time { return start }
+
+		require.NoError(t, c.reconcile(t.Context()))
+		require.Contains(t, c.firstSeen, orphanId)
+
+		// e.g. the provisioner had not yet created the PV, or it was statically provisioned
+		_, err := kubeClient.CoreV1().PersistentVolumes().Create(t.Context(), newPV("pvc-orphan", DefaultDriverName, orphanId), metav1.CreateOptions{})
+		require.NoError(t, err)
+
+		c.now = func() time.Time { return start.Add(2 * time.Hour) }
+		require.NoError(t, c.reconcile(t.Context()))
+
+		require.Contains(t, client.volumes, orphanId)
+		require.NotContains(t, c.firstSeen, orphanId)
+		require.NotContains(t, client.volumes, foreignId)
+	})
+
+	t.Run("counts a VHD Set listed for each VM once", func(t *testing.T) {
+
+		c, client, recorder, _, metrics := newCollector(false)
+		sharedId := uuid.NewString()
+		shared := &models.GetVHDResponse{Name: "pvc-shared", DiskIdentifier: sharedId, Size: 8 * constants.GiB, Shared: true}
+		client.volumes[sharedId] = shared
+		client.volumes[sharedId+"-node2"] = shared
+
+		require.NoError(t, c.reconcile(t.Context()))
+		require.Equal(t, float64(3), metricValue(t, metrics, "hyperv_csi_orphaned_volumes"))
+		require.Equal(t, float64(14*constants.GiB), metricValue(t, metrics, "hyperv_csi_orphaned_volumes_bytes"))
+		requireEvents(t, recorder, "Warning OrphanedVolume", "Warning OrphanedVolume", "Warning OrphanedVolume")
+	})
+}
+
+func metricValue(t *testing.T, metrics prometheus.Gatherer, name string) float64 {
+
+	families, err := metrics.Gather()
+	require.NoError(t, err)
+
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+
+		m := f.GetMetric()[0]
+
+		if m.GetGauge() != nil {
+			return m.GetGauge().GetValue()
+		}
+
+		return m.GetCounter().GetValue()
+	}
+
+	require.Failf(t, "metric not found", "%s", name)
+	return 0
+}
+
+func requireEvents(t *testing.T, recorder *record.FakeRecorder, prefixes ...string) {
+
+	for _, prefix := range prefixes {
+		select {
+		case e := <-recorder.Events:
+			require.True(t, strings.HasPrefix(e, prefix), "expected event %q, got %q", prefix, e)
+		default:
+			require.Failf(t, "missing event", "%s", prefix)
+		}
+	}
+
+	select {
+	case e := <-recorder.Events:
+		require.Failf(t, "unexpected event", "%s", e)
+	default:
+	}
+}
@@ -0,0 +1,134 @@
+//go:build linux
+
+package kvp
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// HostPool is the pool in which the host publishes entries about itself and the VM.
+const HostPool = 3
+
+// Keys of the entries the host publishes in the host pool.
+const (
+	HOST_NAME_KEY                   = "HostName"
+	PHYSICAL_HOST_NAME_KEY          = "PhysicalHostName"
+	PHYSICAL_HOST_NAME_FQ_KEY       = "PhysicalHostNameFullyQualified"
+	HOST_EDITION_ID_KEY             = "HostingSystemEditionId"
+	HOST_NESTED_LEVEL_KEY           = "HostingSystemNestedLevel"
+	HOST_OS_MAJOR_KEY               = "HostingSystemOsMajor"
+	HOST_OS_MINOR_KEY               = "HostingSystemOsMinor"
+	HOST_SP_MAJOR_KEY               = "HostingSystemSpMajor"
+	HOST_SP_MINOR_KEY               = "HostingSystemSpMinor"
+	HOST_PROCESSOR_ARCHITECTURE_KEY = "HostingSystemProcessorArchitecture"
+	VM_DYNAMIC_MEMORY_BALANCING_KEY = "VirtualMachineDynamicMemoryBalancingEnabled"
+)
+
+// HostInfo is a typed view of the entries the host publishes in the host pool.
+// Entries the host has not published are left at their zero value.
+type HostInfo struct {
+
+	// HostName is the name of the Hyper-V host
+	HostName string
+
+	// PhysicalHostName is the name of the physical host, which differs
+	// from HostName when the VM is nested
+	PhysicalHostName string
+
+	// PhysicalHostNameFullyQualified is the fully qualified name of the physical host
+	PhysicalHostNameFullyQualified string
+
+	// VirtualMachineName is the name of the VM in Hyper-V
+	VirtualMachineName string
+
+	// VirtualMachineId is the ID of the VM in Hyper-V
+	VirtualMachineId string
+
+	// EditionId is the Windows edition (SKU) of the host
+	EditionId int
+
+	// NestedLevel is the level of virtualization nesting of the host
+	NestedLevel int
+
+	// OSMajor is the major version of the host operating system
+	OSMajor int
+
+	// OSMinor is the minor version of the host operating system
+	OSMinor int
+
+	// SPMajor is the major version of the host service pack
+	SPMajor int
+
+	// SPMinor is the minor version of the host service pack
+	SPMinor int
+
+	// ProcessorArchitecture is the processor architecture of the host, as for Win32_Processor
+	ProcessorArchitecture int
+
+	// DynamicMemoryBalancingEnabled is set if dynamic memory balancing is enabled for the VM
+	DynamicMemoryBalancingEnabled bool
+}
+
+// OSVersion returns the version of the host operating system, e.g. "10.0".
+func (h *HostInfo) OSVersion() string {
+	return fmt.Sprintf("%d.%d", h.OSMajor, h.OSMinor)
+}
+
+// Host returns the entries the host publishes about itself and the VM.
+func (k *kvpMetadataService) Host() (*HostInfo, error) {
+
+	entries, err := k.pool(HostPool)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseHostInfo(entries)
+}
+
+// parseHostInfo parses the entries of the host pool.
+func parseHostInfo(entries map[string]string) (*HostInfo, error) {
+
+	h := &HostInfo{
+		HostName:                       entries[HOST_NAME_KEY],
+		PhysicalHostName:               entries[PHYSICAL_HOST_NAME_KEY],
+		PhysicalHostNameFullyQualified: entries[PHYSICAL_HOST_NAME_FQ_KEY],
+		VirtualMachineName:             entries[VM_NAME_KEY],
+		VirtualMachineId:               entries[VM_ID_KEY],
+	}
+
+	ints := map[string]*int{
+		HOST_EDITION_ID_KEY:             &h.EditionId,
+		HOST_NESTED_LEVEL_KEY:           &h.NestedLevel,
+		HOST_OS_MAJOR_KEY:               &h.OSMajor,
+		HOST_OS_MINOR_KEY:               &h.OSMinor,
+		HOST_SP_MAJOR_KEY:               &h.SPMajor,
+		HOST_SP_MINOR_KEY:               &h.SPMinor,
+		HOST_PROCESSOR_ARCHITECTURE_KEY: &h.ProcessorArchitecture,
+	}
+
+	for key, field := range ints {
+		val, ok := entries[key]
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for key %q: %w", val, key, err)
+		}
+
+		*field = n
+	}
+
+	if val, ok := entries[VM_DYNAMIC_MEMORY_BALANCING_KEY]; ok {
+		enabled, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q for key %q: %w", val, VM_DYNAMIC_MEMORY_BALANCING_KEY, err)
+		}
+
+		h.DynamicMemoryBalancingEnabled = enabled
+	}
+
+	return h, nil
+}
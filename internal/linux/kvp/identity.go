@@ -0,0 +1,340 @@
+//go:build linux
+
+package kvp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// dmiProductUUIDPath is where the kernel exposes the BIOS UUID of the machine
+const dmiProductUUIDPath = "/sys/class/dmi/id/product_uuid"
+
+var (
+	// errNoPools is returned by the sources of VM identity which have no KVP pools
+	errNoPools = errors.New("no KVP pools")
+
+	// errNoSource ends the errors of a chain, so that it is not empty if no source is present
+	errNoSource = errors.New("no other source of VM identity")
+)
+
+// VMLookup returns the ID and name of the VM with the given BIOS GUID, or an error if there is no such VM.
+type VMLookup func(biosGuid string) (vmId string, vmName string, err error)
+
+// chainMetadataService tries each of a list of metadata services in turn.
+type chainMetadataService struct {
+	services []MetadataService
+}
+
+// NewChain creates a metadata service which returns each value from the
+// first of the given services which is present and has it.
+func NewChain(services ...MetadataService) *chainMetadataService {
+	return &chainMetadataService{
+		services: services,
+	}
+}
+
+// IsPresent checks if any of the services is present.
+func (c *chainMetadataService) IsPresent() bool {
+	return len(c.present()) > 0
+}
+
+// Find returns the value of the given key from the first service which has it.
+func (c *chainMetadataService) Find(key string) (string, error) {
+
+	var errs []error
+
+	for _, s := range c.present() {
+		val, err := s.Find(key)
+		if err == nil {
+			return val, nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return "", fmt.Errorf("key %q not found: %w", key, errors.Join(append(errs, errNoSource)...))
+}
+
+// Read reads the value for a given key from a specific KVP pool of the first service which has it.
+func (c *chainMetadataService) Read(poolNumber int, key string) (string, error) {
+
+	var errs []error
+
+	for _, s := range c.present() {
+		val, err := s.Read(poolNumber, key)
+		if err == nil {
+			return val, nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return "", fmt.Errorf("key %q not found in pool %d: %w", key, poolNumber, errors.Join(append(errs, errNoSource)...))
+}
+
+// All returns every key and value of the first service which has KVP pools.
+func (c *chainMetadataService) All() (map[int]map[string]string, error) {
+
+	var errs []error
+
+	for _, s := range c.present() {
+		all, err := s.All()
+		if err == nil {
+			return all, nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return nil, errors.Join(append(errs, errNoPools)...)
+}
+
+// Host returns the host details of the first service which has them.
+func (c *chainMetadataService) Host() (*HostInfo, error) {
+
+	var errs []error
+
+	for _, s := range c.present() {
+		h, err := s.Host()
+		if err == nil {
+			return h, nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return nil, errors.Join(append(errs, errNoPools)...)
+}
+
+// Watch watches the first service which is present.
+func (c *chainMetadataService) Watch(ctx context.Context, interval time.Duration) <-chan Change {
+
+	if present := c.present(); len(present) > 0 {
+		return present[0].Watch(ctx, interval)
+	}
+
+	return closedWatch(ctx)
+}
+
+func (c *chainMetadataService) present() []MetadataService {
+
+	present := make([]MetadataService, 0, len(c.services))
+
+	for _, s := range c.services {
+		if s.IsPresent() {
+			present = append(present, s)
+		}
+	}
+
+	return present
+}
+
+// dmiMetadataService provides the VM name and ID of the VM whose BIOS GUID
+// is the BIOS UUID of this machine. It has no KVP pools.
+type dmiMetadataService struct {
+	path   string
+	lookup VMLookup
+}
+
+// NewDMI creates a metadata service which provides the VM name and ID from the BIOS UUID.
+//
+// The BIOS UUID is the BIOS GUID of the VM, which Hyper-V sets independently of
+// the VM ID, so the VM is found with lookup. The first three fields of the UUID are
+// stored little-endian, and older kernels report them without swapping their byte
+// order, so both orders are tried. If lookup is nil, the service is not present.
+func NewDMI(lookup VMLookup) *dmiMetadataService {
+	return NewDMIForPath(dmiProductUUIDPath, lookup)
+}
+
+// NewDMIForPath creates a metadata service which provides the VM name and ID from the BIOS UUID in the given file.
+func NewDMIForPath(path string, lookup VMLookup) *dmiMetadataService {
+	return &dmiMetadataService{
+		path:   path,
+		lookup: lookup,
+	}
+}
+
+// IsPresent checks if VMs can be looked up and the BIOS UUID can be read.
+func (d *dmiMetadataService) IsPresent() bool {
+	if d.lookup == nil {
+		return false
+	}
+
+	_, err := d.biosUUID()
+	return err == nil
+}
+
+// Find returns the VM name or ID.
+func (d *dmiMetadataService) Find(key string) (string, error) {
+
+	switch key {
+	case VM_ID_KEY:
+		id, _, err := d.identity()
+		return id, err
+
+	case VM_NAME_KEY:
+		_, name, err := d.identity()
+		return name, err
+	}
+
+	return "", fmt.Errorf("key %q not found in BIOS", key)
+}
+
+// Read always fails, as there are no KVP pools.
+func (d *dmiMetadataService) Read(poolNumber int, key string) (string, error) {
+	return "", fmt.Errorf("key %q not found in pool %d: %w", key, poolNumber, errNoPools)
+}
+
+// All always fails, as there are no KVP pools.
+func (d *dmiMetadataService) All() (map[int]map[string]string, error) {
+	return nil, errNoPools
+}
+
+// Host always fails, as there are no KVP pools.
+func (d *dmiMetadataService) Host() (*HostInfo, error) {
+	return nil, errNoPools
+}
+
+// Watch returns a channel which is closed when the context is done, as the BIOS UUID does not change.
+func (d *dmiMetadataService) Watch(ctx context.Context, _ time.Duration) <-chan Change {
+	return closedWatch(ctx)
+}
+
+// identity returns the VM ID and name of the VM with the BIOS UUID as its BIOS GUID.
+func (d *dmiMetadataService) identity() (string, string, error) {
+
+	if d.lookup == nil {
+		// The BIOS UUID is not the VM ID, so it cannot be used without finding the VM
+		return "", "", errors.New("VMs cannot be looked up by BIOS UUID")
+	}
+
+	id, err := d.biosUUID()
+	if err != nil {
+		return "", "", err
+	}
+
+	var errs []error
+
+	for _, candidate := range []uuid.UUID{id, swapUUIDByteOrder(id)} {
+		vmId, vmName, err := d.lookup(candidate.String())
+		if err == nil {
+			return vmId, vmName, nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return "", "", fmt.Errorf("no VM has the BIOS GUID of BIOS UUID %s: %w", id, errors.Join(errs...))
+}
+
+func (d *dmiMetadataService) biosUUID() (uuid.UUID, error) {
+
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to read BIOS UUID: %w", err)
+	}
+
+	id, err := uuid.Parse(strings.TrimSpace(string(data)))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid BIOS UUID: %w", err)
+	}
+
+	if id == uuid.Nil {
+		return uuid.Nil, errors.New("BIOS UUID is not set")
+	}
+
+	return id, nil
+}
+
+// swapUUIDByteOrder swaps the byte order of the first three fields of a UUID,
+// converting between the little-endian SMBIOS encoding and RFC 4122.
+func swapUUIDByteOrder(id uuid.UUID) uuid.UUID {
+
+	swapped := id
+
+	swapped[0], swapped[1], swapped[2], swapped[3] = id[3], id[2], id[1], id[0]
+	swapped[4], swapped[5] = id[5], id[4]
+	swapped[6], swapped[7] = id[7], id[6]
+
+	return swapped
+}
+
+// staticMetadataService provides the VM name and ID given explicitly,
+// e.g. by command line flags or the downward API. It has no KVP pools.
+type staticMetadataService struct {
+	entries map[string]string
+}
+
+// NewStatic creates a metadata service which provides the given VM name and ID.
+// Either may be empty, in which case it is not found.
+func NewStatic(vmName, vmId string) *staticMetadataService {
+
+	entries := map[string]string{}
+
+	if vmName != "" {
+		entries[VM_NAME_KEY] = vmName
+	}
+
+	if vmId != "" {
+		entries[VM_ID_KEY] = vmId
+	}
+
+	return &staticMetadataService{
+		entries: entries,
+	}
+}
+
+// IsPresent checks if either of the VM name or ID was given.
+func (s *staticMetadataService) IsPresent() bool {
+	return len(s.entries) > 0
+}
+
+// Find returns the VM name or ID, if given.
+func (s *staticMetadataService) Find(key string) (string, error) {
+
+	if val, ok := s.entries[key]; ok {
+		return val, nil
+	}
+
+	return "", fmt.Errorf("key %q not given", key)
+}
+
+// Read always fails, as there are no KVP pools.
+func (s *staticMetadataService) Read(poolNumber int, key string) (string, error) {
+	return "", fmt.Errorf("key %q not found in pool %d: %w", key, poolNumber, errNoPools)
+}
+
+// All always fails, as there are no KVP pools.
+func (s *staticMetadataService) All() (map[int]map[string]string, error) {
+	return nil, errNoPools
+}
+
+// Host always fails, as there are no KVP pools.
+func (s *staticMetadataService) Host() (*HostInfo, error) {
+	return nil, errNoPools
+}
+
+// Watch returns a channel which is closed when the context is done, as the values do not change.
+func (s *staticMetadataService) Watch(ctx context.Context, _ time.Duration) <-chan Change {
+	return closedWatch(ctx)
+}
+
+// closedWatch returns a channel on which no changes are sent, and which is closed when the context is done.
+func closedWatch(ctx context.Context) <-chan Change {
+
+	changes := make(chan Change)
+
+	go func() {
+		<-ctx.Done()
+		close(changes)
+	}()
+
+	return changes
+}
@@ -0,0 +1,105 @@
+//go:build linux
+
+package kvp_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fireflycons/hypervcsi/internal/linux/kvp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityChain(t *testing.T) {
+
+	const (
+		// As the BIOS reports it, with the first three fields little-endian
+		biosUUID = "78563412-3412-7856-9abc-def012345678"
+		biosGuid = "12345678-1234-5678-9abc-def012345678"
+		vmId     = "0f8fad5b-d9cb-469f-a165-70867728950e"
+	)
+
+	dir := t.TempDir()
+	uuidFile := filepath.Join(dir, "product_uuid")
+	require.NoError(t, os.WriteFile(uuidFile, []byte(biosUUID+"\n"), 0400))
+
+	lookup := func(guid string) (string, string, error) {
+		if guid == biosGuid {
+			return vmId, "vm1", nil
+		}
+
+		return "", "", errors.New("not found")
+	}
+
+	noKVP := kvp.NewForDirectory(filepath.Join(dir, "missing"))
+
+	t.Run("KVP is preferred", func(t *testing.T) {
+		kvpDir := t.TempDir()
+		require.NoError(t, kvp.NewPoolWriter(kvpDir, 0).Write(kvp.VM_NAME_KEY, "kvp-vm"))
+		require.NoError(t, kvp.NewPoolWriter(kvpDir, 0).Write(kvp.VM_ID_KEY, "kvp-id"))
+
+		c := kvp.NewChain(kvp.NewForDirectory(kvpDir), kvp.NewDMIForPath(uuidFile, lookup), kvp.NewStatic("static-vm", "static-id"))
+
+		require.True(t, c.IsPresent())
+		requireFind(t, c, kvp.VM_NAME_KEY, "kvp-vm")
+		requireFind(t, c, kvp.VM_ID_KEY, "kvp-id")
+	})
+
+	t.Run("BIOS UUID is looked up", func(t *testing.T) {
+		c := kvp.NewChain(noKVP, kvp.NewDMIForPath(uuidFile, lookup), kvp.NewStatic("static-vm", ""))
+
+		require.True(t, c.IsPresent())
+		requireFind(t, c, kvp.VM_NAME_KEY, "vm1")
+		requireFind(t, c, kvp.VM_ID_KEY, vmId)
+
+		_, err := c.Host()
+		require.Error(t, err)
+	})
+
+	t.Run("BIOS UUID without lookup", func(t *testing.T) {
+		dmi := kvp.NewDMIForPath(uuidFile, nil)
+		require.False(t, dmi.IsPresent())
+
+		_, err := dmi.Find(kvp.VM_ID_KEY)
+		require.Error(t, err)
+
+		c := kvp.NewChain(noKVP, dmi, kvp.NewStatic("static-vm", "static-id"))
+
+		requireFind(t, c, kvp.VM_NAME_KEY, "static-vm")
+		requireFind(t, c, kvp.VM_ID_KEY, "static-id")
+	})
+
+	t.Run("BIOS UUID of no VM", func(t *testing.T) {
+		c := kvp.NewChain(noKVP, kvp.NewDMIForPath(uuidFile, func(string) (string, string, error) {
+			return "", "", errors.New("not found")
+		}), kvp.NewStatic("static-vm", "static-id"))
+
+		requireFind(t, c, kvp.VM_NAME_KEY, "static-vm")
+		requireFind(t, c, kvp.VM_ID_KEY, "static-id")
+	})
+
+	t.Run("explicit values only", func(t *testing.T) {
+		c := kvp.NewChain(noKVP, kvp.NewDMIForPath(filepath.Join(dir, "missing"), lookup), kvp.NewStatic("static-vm", ""))
+
+		require.True(t, c.IsPresent())
+		requireFind(t, c, kvp.VM_NAME_KEY, "static-vm")
+
+		_, err := c.Find(kvp.VM_ID_KEY)
+		require.Error(t, err)
+	})
+
+	t.Run("nothing present", func(t *testing.T) {
+		c := kvp.NewChain(noKVP, kvp.NewDMIForPath(filepath.Join(dir, "missing"), lookup), kvp.NewStatic("", ""))
+		require.False(t, c.IsPresent())
+	})
+}
+
+func requireFind(t *testing.T, s kvp.MetadataService, key, expected string) {
+	t.Helper()
+
+	v, err := s.Find(key)
+	require.NoError(t, err)
+	require.Equal(t, expected, v)
+}
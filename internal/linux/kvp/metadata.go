@@ -4,9 +4,19 @@ package kvp
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -22,6 +32,7 @@ const (
 )
 
 // MetadataService defines methods to interact with the Hyper-V KVP metadata service.
+// Implementations are safe for concurrent use.
 type MetadataService interface {
 
 	// IsPresent checks if the Hyper-V KVP metadata service is available.
@@ -32,18 +43,78 @@ type MetadataService interface {
 
 	// Read reads the value for a given key from a specific KVP pool.
 	Read(poolNumber int, key string) (string, error)
+
+	// All returns every key and value, keyed by pool number.
+	All() (map[int]map[string]string, error)
+
+	// Host returns the entries the host publishes about itself and the VM.
+	Host() (*HostInfo, error)
+
+	// Watch polls the KVP pools at the given interval and sends each change to an entry
+	// on the returned channel, which is closed when the context is done.
+	Watch(ctx context.Context, interval time.Duration) <-chan Change
+}
+
+// Change is a change to a KVP entry found by Watch.
+type Change struct {
+
+	// Pool is the number of the pool containing the entry
+	Pool int
+
+	// Key is the key of the entry
+	Key string
+
+	// Value is the new value of the entry. It is empty if the entry was deleted.
+	Value string
+
+	// OldValue is the previous value of the entry. It is empty if the entry was added.
+	OldValue string
+
+	// Deleted is set if the entry was deleted.
+	Deleted bool
+}
+
+type kvpMetadataService struct {
+
+	// dir is the directory containing the pool files
+	dir string
+
+	mu sync.Mutex
+
+	// cache holds the entries last read from each pool, keyed by pool number
+	cache map[int]*cachedPool
+}
+
+// cachedPool holds the entries last read from a pool file.
+type cachedPool struct {
+	modTime time.Time
+	size    int64
+	readAt  time.Time
+	entries map[string]string
 }
 
-type kvpMetadataService struct{}
+// racyWindow is how long after a pool file was modified that a read of it is not cached.
+// File timestamps are coarse, so the file may be modified again without its modification
+// time changing.
+const racyWindow = time.Second
 
 // New creates a new instance of the Hyper-V KVP metadata service.
 func New() *kvpMetadataService {
-	return &kvpMetadataService{}
+	return NewForDirectory(kvpDir)
+}
+
+// NewForDirectory creates a new instance of the Hyper-V KVP metadata service
+// that reads the pool files in the given directory.
+func NewForDirectory(dir string) *kvpMetadataService {
+	return &kvpMetadataService{
+		dir:   dir,
+		cache: map[int]*cachedPool{},
+	}
 }
 
 // IsPresent checks if the Hyper-V KVP metadata service is available.
-func (*kvpMetadataService) IsPresent() bool {
-	_, err := os.Stat(kvpDir)
+func (k *kvpMetadataService) IsPresent() bool {
+	_, err := os.Stat(k.dir)
 	return err == nil
 }
 
@@ -52,7 +123,7 @@ func (k *kvpMetadataService) Find(key string) (string, error) {
 
 	results := make([]string, 0, 1)
 
-	for _, poolNum := range getPoolNumbers() {
+	for _, poolNum := range k.getPoolNumbers() {
 		val, err := k.Read(poolNum, key)
 		if err == nil {
 			results = append(results, val)
@@ -73,24 +144,185 @@ func (k *kvpMetadataService) Find(key string) (string, error) {
 //
 //	vmname, err := Read(3, "VirtualMachineName")
 //	vmid, err := Read(3, "VirtualMachineId")
-func (*kvpMetadataService) Read(poolNumber int, key string) (string, error) {
-	poolFile := filepath.Join(kvpDir, fmt.Sprintf(".kvp_pool_%d", poolNumber))
+func (k *kvpMetadataService) Read(poolNumber int, key string) (string, error) {
+
+	entries, err := k.pool(poolNumber)
+	if err != nil {
+		return "", err
+	}
+
+	if val, ok := entries[key]; ok {
+		return val, nil
+	}
+
+	return "", fmt.Errorf("key %q not found in pool %d", key, poolNumber)
+}
+
+// All returns every key and value, keyed by pool number.
+func (k *kvpMetadataService) All() (map[int]map[string]string, error) {
+
+	all := map[int]map[string]string{}
+
+	for _, poolNum := range k.getPoolNumbers() {
+		entries, err := k.pool(poolNum)
+		if err != nil {
+			return nil, err
+		}
+
+		all[poolNum] = maps.Clone(entries)
+	}
+
+	return all, nil
+}
+
+// Watch polls the KVP pools at the given interval and sends each change to an entry
+// on the returned channel, which is closed when the context is done.
+// Pools which have not changed since they were last read are not read again.
+func (k *kvpMetadataService) Watch(ctx context.Context, interval time.Duration) <-chan Change {
+
+	changes := make(chan Change)
+
+	go func() {
+		defer close(changes)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// Errors are retried at the next poll, as a pool file
+		// may be read while the KVP daemon is recreating it.
+		prev, _ := k.All()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			curr, err := k.All()
+			if err != nil {
+				continue
+			}
+
+			for _, c := range diffPools(prev, curr) {
+				select {
+				case changes <- c:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			prev = curr
+		}
+	}()
+
+	return changes
+}
+
+// diffPools returns the changes between two sets of pools, ordered by pool and key.
+func diffPools(prev, curr map[int]map[string]string) []Change {
+
+	var changes []Change
+
+	for poolNum, entries := range curr {
+		for key, val := range entries {
+			old, ok := prev[poolNum][key]
+
+			switch {
+			case !ok:
+				changes = append(changes, Change{Pool: poolNum, Key: key, Value: val})
+			case old != val:
+				changes = append(changes, Change{Pool: poolNum, Key: key, Value: val, OldValue: old})
+			}
+		}
+	}
+
+	for poolNum, entries := range prev {
+		for key, old := range entries {
+			if _, ok := curr[poolNum][key]; !ok {
+				changes = append(changes, Change{Pool: poolNum, Key: key, OldValue: old, Deleted: true})
+			}
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b Change) int {
+		if a.Pool != b.Pool {
+			return a.Pool - b.Pool
+		}
+
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return changes
+}
+
+// pool returns the entries of the given pool, reading the pool file
+// only if it has changed since it was last read.
+// The returned map must not be modified.
+func (k *kvpMetadataService) pool(poolNumber int) (map[string]string, error) {
+	poolFile := poolPath(k.dir, poolNumber)
 
 	f, err := os.Open(poolFile)
 	if err != nil {
-		return "", fmt.Errorf("failed to open pool file %s: %w", poolFile, err)
+		return nil, fmt.Errorf("failed to open pool file %s: %w", poolFile, err)
 	}
 	defer f.Close()
 
+	unlock, err := lockFile(f, unix.F_RDLCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock pool file %s: %w", poolFile, err)
+	}
+	defer unlock()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading pool file: %w", err)
+	}
+
+	k.mu.Lock()
+	cached := k.cache[poolNumber]
+	k.mu.Unlock()
+
+	if cached != nil &&
+		cached.modTime.Equal(info.ModTime()) &&
+		cached.size == info.Size() &&
+		cached.readAt.Sub(cached.modTime) > racyWindow {
+		return cached.entries, nil
+	}
+
+	readAt := time.Now()
+
+	entries, err := readRecords(f)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	k.cache[poolNumber] = &cachedPool{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		readAt:  readAt,
+		entries: entries,
+	}
+	k.mu.Unlock()
+
+	return entries, nil
+}
+
+// readRecords reads the entries of a pool file. Where a key
+// appears more than once, its first value is returned.
+func readRecords(f io.Reader) (map[string]string, error) {
+
+	entries := map[string]string{}
 	buf := make([]byte, recordSize)
 
 	for {
-		_, err := f.Read(buf)
+		_, err := io.ReadFull(f, buf)
 		if err != nil {
-			if err.Error() == "EOF" {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
 				break
 			}
-			return "", fmt.Errorf("error reading pool file: %w", err)
+			return nil, fmt.Errorf("error reading pool file: %w", err)
 		}
 
 		// Check if record is empty
@@ -107,13 +339,12 @@ func (*kvpMetadataService) Read(poolNumber int, key string) (string, error) {
 			continue
 		}
 
-		if decodedKey == key {
-			decodedVal := decodeCString(valBytes)
-			return decodedVal, nil
+		if _, ok := entries[decodedKey]; !ok {
+			entries[decodedKey] = decodeCString(valBytes)
 		}
 	}
 
-	return "", fmt.Errorf("key %q not found in pool %d", key, poolNumber)
+	return entries, nil
 }
 
 // decodeCString decodes a C-style NULL-terminated string from a fixed buffer.
@@ -127,17 +358,23 @@ func decodeCString(buf []byte) string {
 	return string(buf[:n])
 }
 
-var pools []int
+// getPoolNumbers returns the numbers of the pools in the directory. Pools are numbered
+// consecutively from zero. They are found afresh on each call, as the KVP daemon
+// may not have created them all when the service is created.
+func (k *kvpMetadataService) getPoolNumbers() []int {
+	var pools []int
 
-func getPoolNumbers() []int {
-	if len(pools) == 0 {
-		for i := 0; ; i++ {
-			poolFile := filepath.Join(kvpDir, fmt.Sprintf(".kvp_pool_%d", i))
-			if _, err := os.Stat(poolFile); os.IsNotExist(err) {
-				break
-			}
-			pools = append(pools, i)
+	for i := 0; ; i++ {
+		if _, err := os.Stat(poolPath(k.dir, i)); err != nil {
+			break
 		}
+		pools = append(pools, i)
 	}
+
 	return pools
 }
+
+// poolPath returns the path of the file for the given pool
+func poolPath(dir string, poolNumber int) string {
+	return filepath.Join(dir, fmt.Sprintf(".kvp_pool_%d", poolNumber))
+}
@@ -3,7 +3,9 @@
 package kvp_test
 
 import (
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fireflycons/hypervcsi/internal/linux/kvp"
 	"github.com/stretchr/testify/require"
@@ -25,3 +27,151 @@ func TestMetadata(t *testing.T) {
 	require.NoError(t, err, "FindMeta VirtualMachineId failed")
 	t.Logf("VirtualMachineId: %s", vmID)
 }
+
+func TestAll(t *testing.T) {
+
+	dir := t.TempDir()
+
+	require.NoError(t, kvp.NewPoolWriter(dir, 0).Write("key1", "value1"))
+	require.NoError(t, kvp.NewPoolWriter(dir, 1).Write("key2", "value2"))
+	require.NoError(t, kvp.NewPoolWriter(dir, 1).Write("key3", "value3"))
+
+	s := kvp.NewForDirectory(dir)
+
+	all, err := s.All()
+	require.NoError(t, err)
+	require.Equal(t, map[int]map[string]string{
+		0: {"key1": "value1"},
+		1: {"key2": "value2", "key3": "value3"},
+	}, all)
+
+	// Modifying the result does not affect the service
+	all[0]["key1"] = "changed"
+
+	v, err := s.Read(0, "key1")
+	require.NoError(t, err)
+	require.Equal(t, "value1", v)
+
+	// Pools created since the last call are found
+	require.NoError(t, kvp.NewPoolWriter(dir, 2).Write("key4", "value4"))
+
+	v, err = s.Find("key4")
+	require.NoError(t, err)
+	require.Equal(t, "value4", v)
+}
+
+func TestHost(t *testing.T) {
+
+	dir := t.TempDir()
+
+	for i := range kvp.HostPool {
+		require.NoError(t, kvp.NewPoolWriter(dir, i).Write("other", "value"))
+	}
+
+	w := kvp.NewPoolWriter(dir, kvp.HostPool)
+
+	for key, val := range map[string]string{
+		kvp.HOST_NAME_KEY:                   "host1",
+		kvp.PHYSICAL_HOST_NAME_KEY:          "host1",
+		kvp.PHYSICAL_HOST_NAME_FQ_KEY:       "host1.example.com",
+		kvp.VM_NAME_KEY:                     "vm1",
+		kvp.VM_ID_KEY:                       "6f8a1c0e-6a5b-4a9e-9d1e-0c3f2b7a8d41",
+		kvp.HOST_OS_MAJOR_KEY:               "10",
+		kvp.HOST_OS_MINOR_KEY:               "0",
+		kvp.HOST_NESTED_LEVEL_KEY:           "1",
+		kvp.HOST_PROCESSOR_ARCHITECTURE_KEY: "9",
+		kvp.VM_DYNAMIC_MEMORY_BALANCING_KEY: "true",
+	} {
+		require.NoError(t, w.Write(key, val))
+	}
+
+	s := kvp.NewForDirectory(dir)
+
+	h, err := s.Host()
+	require.NoError(t, err)
+	require.Equal(t, "host1", h.HostName)
+	require.Equal(t, "host1.example.com", h.PhysicalHostNameFullyQualified)
+	require.Equal(t, "vm1", h.VirtualMachineName)
+	require.Equal(t, "10.0", h.OSVersion())
+	require.Equal(t, 1, h.NestedLevel)
+	require.Equal(t, 9, h.ProcessorArchitecture)
+	require.Zero(t, h.SPMajor)
+	require.True(t, h.DynamicMemoryBalancingEnabled)
+
+	require.NoError(t, w.Write(kvp.HOST_OS_MAJOR_KEY, "ten"))
+
+	_, err = s.Host()
+	require.Error(t, err)
+}
+
+func TestWatch(t *testing.T) {
+
+	dir := t.TempDir()
+	w := kvp.NewPoolWriter(dir, 0)
+
+	require.NoError(t, w.Write("unchanged", "value"))
+	require.NoError(t, w.Write("changed", "old"))
+	require.NoError(t, w.Write("deleted", "value"))
+
+	s := kvp.NewForDirectory(dir)
+	changes := s.Watch(t.Context(), 10*time.Millisecond)
+
+	// Let the watch read the initial state
+	time.Sleep(50 * time.Millisecond)
+
+	require.NoError(t, w.Write("changed", "new"))
+	require.NoError(t, w.Write("added", "value"))
+	require.NoError(t, w.Delete("deleted"))
+
+	expected := []kvp.Change{
+		{Pool: 0, Key: "added", Value: "value"},
+		{Pool: 0, Key: "changed", Value: "new", OldValue: "old"},
+		{Pool: 0, Key: "deleted", OldValue: "value", Deleted: true},
+	}
+
+	var received []kvp.Change
+
+	timeout := time.After(5 * time.Second)
+
+	// The changes may be found by more than one poll, but each is sent once
+	for len(received) < len(expected) {
+		select {
+		case c := <-changes:
+			received = append(received, c)
+		case <-timeout:
+			t.Fatalf("timed out waiting for changes, received %v", received)
+		}
+	}
+
+	require.ElementsMatch(t, expected, received)
+}
+
+func TestConcurrentReads(t *testing.T) {
+
+	dir := t.TempDir()
+	w := kvp.NewPoolWriter(dir, 0)
+	require.NoError(t, w.Write("key", "value"))
+
+	s := kvp.NewForDirectory(dir)
+
+	var wg sync.WaitGroup
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range 100 {
+				v, err := s.Read(0, "key")
+				require.NoError(t, err)
+				require.Equal(t, "value", v)
+
+				_, err = s.All()
+				require.NoError(t, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
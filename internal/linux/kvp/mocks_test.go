@@ -1,3 +1,5 @@
+//go:build linux
+
 // Code generated by mockery; DO NOT EDIT.
 // github.com/vektra/mockery
 // template: testify
@@ -5,6 +7,9 @@
 package kvp
 
 import (
+	"context"
+	"time"
+
 	mock "github.com/stretchr/testify/mock"
 )
 
@@ -35,6 +40,61 @@ func (_m *MockMetadataService) EXPECT() *MockMetadataService_Expecter {
 	return &MockMetadataService_Expecter{mock: &_m.Mock}
 }
 
+// All provides a mock function for the type MockMetadataService
+func (_mock *MockMetadataService) All() (map[int]map[string]string, error) {
+	ret := _mock.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for All")
+	}
+
+	var r0 map[int]map[string]string
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func() (map[int]map[string]string, error)); ok {
+		return returnFunc()
+	}
+	if returnFunc, ok := ret.Get(0).(func() map[int]map[string]string); ok {
+		r0 = returnFunc()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[int]map[string]string)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func() error); ok {
+		r1 = returnFunc()
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockMetadataService_All_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'All'
+type MockMetadataService_All_Call struct {
+	*mock.Call
+}
+
+// All is a helper method to define mock.On call
+func (_e *MockMetadataService_Expecter) All() *MockMetadataService_All_Call {
+	return &MockMetadataService_All_Call{Call: _e.mock.On("All")}
+}
+
+func (_c *MockMetadataService_All_Call) Run(run func()) *MockMetadataService_All_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockMetadataService_All_Call) Return(intToStringToString map[int]map[string]string, err error) *MockMetadataService_All_Call {
+	_c.Call.Return(intToStringToString, err)
+	return _c
+}
+
+func (_c *MockMetadataService_All_Call) RunAndReturn(run func() (map[int]map[string]string, error)) *MockMetadataService_All_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // Find provides a mock function for the type MockMetadataService
 func (_mock *MockMetadataService) Find(key string) (string, error) {
 	ret := _mock.Called(key)
@@ -95,6 +155,61 @@ func (_c *MockMetadataService_Find_Call) RunAndReturn(run func(key string) (stri
 	return _c
 }
 
+// Host provides a mock function for the type MockMetadataService
+func (_mock *MockMetadataService) Host() (*HostInfo, error) {
+	ret := _mock.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Host")
+	}
+
+	var r0 *HostInfo
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func() (*HostInfo, error)); ok {
+		return returnFunc()
+	}
+	if returnFunc, ok := ret.Get(0).(func() *HostInfo); ok {
+		r0 = returnFunc()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*HostInfo)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func() error); ok {
+		r1 = returnFunc()
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockMetadataService_Host_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Host'
+type MockMetadataService_Host_Call struct {
+	*mock.Call
+}
+
+// Host is a helper method to define mock.On call
+func (_e *MockMetadataService_Expecter) Host() *MockMetadataService_Host_Call {
+	return &MockMetadataService_Host_Call{Call: _e.mock.On("Host")}
+}
+
+func (_c *MockMetadataService_Host_Call) Run(run func()) *MockMetadataService_Host_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockMetadataService_Host_Call) Return(hostInfo *HostInfo, err error) *MockMetadataService_Host_Call {
+	_c.Call.Return(hostInfo, err)
+	return _c
+}
+
+func (_c *MockMetadataService_Host_Call) RunAndReturn(run func() (*HostInfo, error)) *MockMetadataService_Host_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // IsPresent provides a mock function for the type MockMetadataService
 func (_mock *MockMetadataService) IsPresent() bool {
 	ret := _mock.Called()
@@ -204,3 +319,62 @@ func (_c *MockMetadataService_Read_Call) RunAndReturn(run func(poolNumber int, k
 	_c.Call.Return(run)
 	return _c
 }
+
+// Watch provides a mock function for the type MockMetadataService
+func (_mock *MockMetadataService) Watch(ctx context.Context, interval time.Duration) <-chan Change {
+	ret := _mock.Called(ctx, interval)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Watch")
+	}
+
+	var r0 <-chan Change
+	if returnFunc, ok := ret.Get(0).(func(context.Context, time.Duration) <-chan Change); ok {
+		r0 = returnFunc(ctx, interval)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(<-chan Change)
+		}
+	}
+	return r0
+}
+
+// MockMetadataService_Watch_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Watch'
+type MockMetadataService_Watch_Call struct {
+	*mock.Call
+}
+
+// Watch is a helper method to define mock.On call
+//   - ctx context.Context
+//   - interval time.Duration
+func (_e *MockMetadataService_Expecter) Watch(ctx interface{}, interval interface{}) *MockMetadataService_Watch_Call {
+	return &MockMetadataService_Watch_Call{Call: _e.mock.On("Watch", ctx, interval)}
+}
+
+func (_c *MockMetadataService_Watch_Call) Run(run func(ctx context.Context, interval time.Duration)) *MockMetadataService_Watch_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 time.Duration
+		if args[1] != nil {
+			arg1 = args[1].(time.Duration)
+		}
+		run(
+			arg0,
+			arg1,
+		)
+	})
+	return _c
+}
+
+func (_c *MockMetadataService_Watch_Call) Return(changeCh <-chan Change) *MockMetadataService_Watch_Call {
+	_c.Call.Return(changeCh)
+	return _c
+}
+
+func (_c *MockMetadataService_Watch_Call) RunAndReturn(run func(ctx context.Context, interval time.Duration) <-chan Change) *MockMetadataService_Watch_Call {
+	_c.Call.Return(run)
+	return _c
+}
@@ -0,0 +1,192 @@
+//go:build linux
+
+package kvp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// GuestPool is the pool in which the guest publishes entries for the host.
+// The Hyper-V KVP daemon passes them to the host, where they appear in the
+// GuestExchangeItems of the VM's Msvm_KvpExchangeComponent.
+const GuestPool = 1
+
+// PoolWriter defines methods to write entries to a Hyper-V KVP pool.
+type PoolWriter interface {
+
+	// Write adds the given key to the pool, or replaces its value if it is already present.
+	Write(key, value string) error
+
+	// Delete removes the given key from the pool, if it is present.
+	Delete(key string) error
+
+	// Entries returns every key and value in the pool, which is empty if the pool does not exist.
+	Entries() (map[string]string, error)
+}
+
+type kvpPoolWriter struct {
+	path string
+}
+
+// NewGuestPoolWriter creates a writer for the guest pool.
+func NewGuestPoolWriter() *kvpPoolWriter {
+	return NewPoolWriter(kvpDir, GuestPool)
+}
+
+// NewPoolWriter creates a writer for the given pool in the given directory.
+func NewPoolWriter(dir string, poolNumber int) *kvpPoolWriter {
+	return &kvpPoolWriter{
+		path: poolPath(dir, poolNumber),
+	}
+}
+
+// Write adds the given key to the pool, or replaces its value if it is already present.
+func (w *kvpPoolWriter) Write(key, value string) error {
+
+	record, err := encodeRecord(key, value)
+	if err != nil {
+		return err
+	}
+
+	return w.update(func(records [][]byte) [][]byte {
+		for i, r := range records {
+			if decodeCString(r[:keySize]) == key {
+				records[i] = record
+				return records
+			}
+		}
+
+		return append(records, record)
+	})
+}
+
+// Delete removes the given key from the pool, if it is present.
+func (w *kvpPoolWriter) Delete(key string) error {
+
+	return w.update(func(records [][]byte) [][]byte {
+		kept := records[:0]
+
+		for _, r := range records {
+			if decodeCString(r[:keySize]) != key {
+				kept = append(kept, r)
+			}
+		}
+
+		return kept
+	})
+}
+
+// Entries returns every key and value in the pool, which is empty if the pool does not exist.
+func (w *kvpPoolWriter) Entries() (map[string]string, error) {
+
+	f, err := os.Open(w.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+
+		return nil, fmt.Errorf("failed to open pool file %s: %w", w.path, err)
+	}
+	defer f.Close()
+
+	unlock, err := lockFile(f, unix.F_RDLCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock pool file %s: %w", w.path, err)
+	}
+	defer unlock()
+
+	return readRecords(f)
+}
+
+// update rewrites the records of the pool file while holding a lock
+// that excludes the KVP daemon and readers of the file.
+func (w *kvpPoolWriter) update(fn func([][]byte) [][]byte) error {
+
+	f, err := os.OpenFile(w.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open pool file %s: %w", w.path, err)
+	}
+	defer f.Close()
+
+	unlock, err := lockFile(f, unix.F_WRLCK)
+	if err != nil {
+		return fmt.Errorf("failed to lock pool file %s: %w", w.path, err)
+	}
+	defer unlock()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("error reading pool file: %w", err)
+	}
+
+	var records [][]byte
+
+	for len(data) >= recordSize {
+		if !bytes.Equal(data[:recordSize], make([]byte, recordSize)) {
+			records = append(records, data[:recordSize])
+		}
+
+		data = data[recordSize:]
+	}
+
+	data = bytes.Join(fn(records), nil)
+
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("error writing pool file: %w", err)
+	}
+
+	if err := f.Truncate(int64(len(data))); err != nil {
+		return fmt.Errorf("error writing pool file: %w", err)
+	}
+
+	return nil
+}
+
+// lockFile waits for a lock of the given type on the whole of a pool file, and returns
+// a function to release it. The lock is an open file description lock, which excludes
+// the record locks of the KVP daemon as well as other readers and writers in this process.
+func lockFile(f *os.File, lockType int16) (func(), error) {
+
+	lock := &unix.Flock_t{
+		Type:   lockType,
+		Whence: io.SeekStart,
+	}
+
+	if err := unix.FcntlFlock(f.Fd(), unix.F_OFD_SETLKW, lock); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		lock.Type = unix.F_UNLCK
+		_ = unix.FcntlFlock(f.Fd(), unix.F_OFD_SETLK, lock)
+	}, nil
+}
+
+// encodeRecord encodes a key and value as a pool record of NULL-terminated
+// strings, each padded with NULL bytes to its fixed size.
+func encodeRecord(key, value string) ([]byte, error) {
+
+	if key == "" {
+		return nil, errors.New("key must not be empty")
+	}
+
+	if len(key) >= keySize {
+		return nil, fmt.Errorf("key %q is longer than %d bytes", key, keySize-1)
+	}
+
+	if len(value) >= valueSize {
+		return nil, fmt.Errorf("value of key %q is longer than %d bytes", key, valueSize-1)
+	}
+
+	record := make([]byte, recordSize)
+	copy(record, key)
+	copy(record[keySize:], value)
+
+	return record, nil
+}
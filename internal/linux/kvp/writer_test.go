@@ -0,0 +1,105 @@
+//go:build linux
+
+package kvp_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fireflycons/hypervcsi/internal/linux/kvp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolWriter(t *testing.T) {
+
+	const recordSize = 512 + 2048
+
+	dir := t.TempDir()
+	poolFile := filepath.Join(dir, ".kvp_pool_1")
+
+	w := kvp.NewPoolWriter(dir, kvp.GuestPool)
+	s := kvp.NewForDirectory(dir)
+
+	poolSize := func() int64 {
+		info, err := os.Stat(poolFile)
+		require.NoError(t, err)
+		return info.Size()
+	}
+
+	t.Run("writes new keys", func(t *testing.T) {
+		require.NoError(t, w.Write("key1", "value1"))
+		require.NoError(t, w.Write("key2", "value2"))
+		require.Equal(t, int64(2*recordSize), poolSize())
+
+		v, err := s.Read(kvp.GuestPool, "key1")
+		require.NoError(t, err)
+		require.Equal(t, "value1", v)
+
+		v, err = s.Read(kvp.GuestPool, "key2")
+		require.NoError(t, err)
+		require.Equal(t, "value2", v)
+	})
+
+	t.Run("replaces the value of an existing key", func(t *testing.T) {
+		require.NoError(t, w.Write("key1", "new value"))
+		require.Equal(t, int64(2*recordSize), poolSize())
+
+		v, err := s.Read(kvp.GuestPool, "key1")
+		require.NoError(t, err)
+		require.Equal(t, "new value", v)
+	})
+
+	t.Run("deletes keys", func(t *testing.T) {
+		require.NoError(t, w.Delete("key1"))
+		require.Equal(t, int64(recordSize), poolSize())
+
+		_, err := s.Read(kvp.GuestPool, "key1")
+		require.Error(t, err)
+
+		v, err := s.Read(kvp.GuestPool, "key2")
+		require.NoError(t, err)
+		require.Equal(t, "value2", v)
+
+		// Deleting a missing key is not an error
+		require.NoError(t, w.Delete("key1"))
+		require.Equal(t, int64(recordSize), poolSize())
+	})
+
+	t.Run("reads entries", func(t *testing.T) {
+		entries, err := w.Entries()
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"key2": "value2"}, entries)
+
+		entries, err = kvp.NewPoolWriter(t.TempDir(), kvp.GuestPool).Entries()
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
+	t.Run("rejects keys and values that do not fit", func(t *testing.T) {
+		require.Error(t, w.Write("", "value"))
+		require.Error(t, w.Write(strings.Repeat("k", 512), "value"))
+		require.Error(t, w.Write("key", strings.Repeat("v", 2048)))
+		require.NoError(t, w.Write("key", strings.Repeat("v", 2047)))
+	})
+}
+
+func TestFindInDirectory(t *testing.T) {
+
+	dir := t.TempDir()
+
+	// Pools are numbered from zero
+	require.NoError(t, kvp.NewPoolWriter(dir, 0).Write("other", "value"))
+	require.NoError(t, kvp.NewPoolWriter(dir, 1).Write(kvp.VM_NAME_KEY, "vm1"))
+
+	s := kvp.NewForDirectory(dir)
+	require.True(t, s.IsPresent())
+
+	v, err := s.Find(kvp.VM_NAME_KEY)
+	require.NoError(t, err)
+	require.Equal(t, "vm1", v)
+
+	_, err = s.Find(kvp.VM_ID_KEY)
+	require.Error(t, err)
+}
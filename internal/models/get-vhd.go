@@ -13,8 +13,20 @@ type GetVHDResponse struct {
 	// UUID identifier of the disk
 	DiskIdentifier string `json:"DiskIdentifier"`
 
-	// UUID of the host to which the disk is attached, if it is attached.
+	// UUID of the host to which the disk is attached read-write, if it is attached.
 	Host *string `json:"Host,omitempty"`
+
+	// Set if the disk is a VHD Set that may be attached to several VMs at once.
+	Shared bool `json:"Shared,omitempty"`
+
+	// Size in bytes of the disk file
+	FileSize int64 `json:"FileSize,omitempty"`
+
+	// Path to the parent of a differencing disk
+	ParentPath string `json:"ParentPath,omitempty"`
+
+	// Set by Get-VHD if the disk is in use, e.g. attached to a running VM
+	Attached bool `json:"Attached,omitempty"`
 }
 
 type ListVHDResponse struct {
@@ -0,0 +1,5 @@
+package models
+
+type GetVMNetworkAdapterResponse struct {
+	IPAddresses []string `json:"IPAddresses"`
+}
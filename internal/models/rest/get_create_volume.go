@@ -13,4 +13,30 @@ type GetVolumeResponse struct {
 	// If caller requests less than the minimum VHD size,
 	// then this will be the minimum VHD size.
 	Size int64 `json:"size"`
+
+	// Set if the volume is a VHD Set that may be attached to several VMs at once.
+	Shared bool `json:"shared,omitempty"`
+
+	// ID of the VM to which the volume is attached read-write, if it is attached.
+	Host *string `json:"host,omitempty"`
+}
+
+// CreateVolumeOptions are the optional settings for a new volume.
+// They are passed to the REST service as query parameters.
+type CreateVolumeOptions struct {
+
+	// Shared requests a VHD Set that may be attached to several VMs
+	// at once with SCSI persistent reservations.
+	Shared bool
+
+	// Template is the name of a template VHD from which the volume is created.
+	Template string
+
+	// Differencing creates the volume as a differencing disk whose parent is
+	// the template, rather than as a copy of the template.
+	Differencing bool
+
+	// Namespace is the Kubernetes namespace of the PVC for which the
+	// volume is created, against whose quota the volume is counted.
+	Namespace string
 }
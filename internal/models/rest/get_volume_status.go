@@ -0,0 +1,44 @@
+package rest
+
+// VolumeCondition describes the health of a volume as seen from the Hyper-V server.
+type VolumeCondition struct {
+
+	// Abnormal is set when the volume is in a state that needs attention.
+	Abnormal bool `json:"abnormal"`
+
+	// Message describes the condition of the volume.
+	Message string `json:"message"`
+}
+
+// Attachment describes the attachment of a volume to a node.
+type Attachment struct {
+
+	// ID of the VM to which the volume is attached.
+	NodeID string `json:"nodeId"`
+
+	// ReadOnly is set when the volume is attached read-only.
+	ReadOnly bool `json:"readOnly"`
+}
+
+// GetVolumeStatusResponse is the response returned when the status of a volume is fetched.
+type GetVolumeStatusResponse struct {
+
+	// The name of the volume.
+	Name string `json:"name"`
+
+	// The GUID ID assigned to the volume by Hyper-V
+	ID string `json:"id"`
+
+	// Size of the volume.
+	Size int64 `json:"size"`
+
+	// ID of the VM to which the volume is attached, if it is attached.
+	Host *string `json:"host,omitempty"`
+
+	// Attachments lists every node the volume is attached to. A volume
+	// attached read-only may be attached to more than one node.
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// Condition of the volume.
+	Condition VolumeCondition `json:"condition"`
+}
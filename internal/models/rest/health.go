@@ -3,4 +3,7 @@ package rest
 type HealthyResponse struct {
 	// Status indicates the health status of the service
 	Status string `json:"status"`
+
+	// Version is the version of the Windows service
+	Version string `json:"version,omitempty"`
 }
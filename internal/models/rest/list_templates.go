@@ -0,0 +1,19 @@
+package rest
+
+// Template is a VHD in the templates directory from which volumes may be created.
+type Template struct {
+
+	// The name of the template, which is the file name of the VHD without extension.
+	Name string `json:"name"`
+
+	// Size of the virtual disk. Volumes created from the template are at least this size.
+	Size int64 `json:"size"`
+
+	// Size of the template VHD file.
+	FileSize int64 `json:"fileSize"`
+}
+
+// ListTemplatesResponse is the response returned when templates are listed.
+type ListTemplatesResponse struct {
+	Templates []Template `json:"templates"`
+}
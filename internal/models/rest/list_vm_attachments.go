@@ -0,0 +1,33 @@
+package rest
+
+// VMAttachment is a disk attached to a SCSI controller of a VM
+type VMAttachment struct {
+
+	// ControllerNumber is the number of the SCSI controller to which the disk is attached
+	ControllerNumber int `json:"ControllerNumber"`
+
+	// ControllerLocation is the location on the SCSI controller of the disk
+	ControllerLocation int `json:"ControllerLocation"`
+
+	// Path to the disk file, which is empty for a physical disk
+	Path string `json:"Path"`
+
+	// Name of the disk, which for a volume is the volume name
+	Name string `json:"Name"`
+
+	// UUID identifier of the disk, which for a volume is the volume ID
+	DiskIdentifier string `json:"DiskIdentifier,omitempty"`
+
+	// Size in bytes of the disk
+	Size int64 `json:"Size,omitempty"`
+
+	// Volume is set if the disk is a volume in the PV store
+	Volume bool `json:"Volume"`
+
+	// Shared is set if the disk is a VHD Set that may be attached to several VMs at once
+	Shared bool `json:"Shared,omitempty"`
+}
+
+type ListVMAttachmentsResponse struct {
+	Attachments []*VMAttachment `json:"Attachments"`
+}
@@ -1,12 +1,167 @@
 package rest
 
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+)
+
 type GetVMResponse struct {
+	Name       string  `json:"Name"`
+	ID         string  `json:"Id"`
+	Path       string  `json:"Path"`
+	Generation int     `json:"Generation"`
+	State      VMState `json:"State,omitempty"`
+
+	// BIOSGUID is the UUID which the guest reads from its BIOS, e.g. in /sys/class/dmi/id/product_uuid.
+	// It is not the same as the ID of the VM.
+	BIOSGUID string `json:"BIOSGUID,omitempty"`
+
+	// UptimeSeconds is how long the VM has been running, in whole seconds
+	UptimeSeconds int64 `json:"UptimeSeconds"`
+
+	// ProcessorCount is the number of virtual processors of the VM
+	ProcessorCount int `json:"ProcessorCount"`
+
+	// MemoryAssigned is the memory in bytes currently assigned to the VM, which is zero if it is not running
+	MemoryAssigned int64 `json:"MemoryAssigned"`
+
+	// MemoryStartup is the memory in bytes assigned to the VM when it starts
+	MemoryStartup int64 `json:"MemoryStartup"`
+
+	// MemoryMinimum is the least memory in bytes assigned to the VM if dynamic memory is enabled
+	MemoryMinimum int64 `json:"MemoryMinimum"`
+
+	// MemoryMaximum is the most memory in bytes assigned to the VM if dynamic memory is enabled
+	MemoryMaximum int64 `json:"MemoryMaximum"`
+
+	// DynamicMemoryEnabled is set if the memory assigned to the VM varies with demand
+	DynamicMemoryEnabled bool `json:"DynamicMemoryEnabled"`
+
+	// ScsiControllers are the SCSI controllers of the VM with their attached drives
+	ScsiControllers []models.GetSCSIControllerResopnse `json:"ScsiControllers"`
+
+	// VolumeDrives is the number of occupied locations which hold volumes
+	VolumeDrives int `json:"VolumeDrives"`
+
+	// NetworkAdapters are the network adapters of the VM
+	NetworkAdapters []VMNetworkAdapter `json:"NetworkAdapters"`
+}
+
+// VMNetworkAdapter is a network adapter of a VM
+type VMNetworkAdapter struct {
 	Name       string `json:"Name"`
-	ID         string `json:"Id"`
-	Path       string `json:"Path"`
-	Generation int    `json:"Generation"`
+	SwitchName string `json:"SwitchName"`
+	MacAddress string `json:"MacAddress"`
+
+	// IPAddresses are the addresses of the adapter reported by the guest integration services
+	IPAddresses []string `json:"IPAddresses"`
+
+	// Connected is set if the adapter is connected to a virtual switch
+	Connected bool `json:"Connected"`
+}
+
+// Uptime returns how long the VM has been running.
+func (vm *GetVMResponse) Uptime() time.Duration {
+	return time.Duration(vm.UptimeSeconds) * time.Second
+}
+
+// ScsiDrives returns the number of occupied locations on the SCSI controllers.
+func (vm *GetVMResponse) ScsiDrives() int {
+
+	drives := 0
+
+	for _, c := range vm.ScsiControllers {
+		drives += len(c.Drives)
+	}
+
+	return drives
+}
+
+// FreeScsiLocations returns the number of unoccupied locations on the SCSI controllers.
+func (vm *GetVMResponse) FreeScsiLocations() int {
+	return max(0, len(vm.ScsiControllers)*constants.ScsiLocationsPerController-vm.ScsiDrives())
+}
+
+// MaxVolumes returns the number of volumes which may be attached to the VM: all
+// locations on its SCSI controllers, less those occupied by disks other than
+// volumes, such as the OS disk.
+func (vm *GetVMResponse) MaxVolumes() int {
+	return max(0, len(vm.ScsiControllers)*constants.ScsiLocationsPerController-(vm.ScsiDrives()-vm.VolumeDrives))
 }
 
 type ListVMResponse struct {
 	VMs []*GetVMResponse
 }
+
+// VMState is the state of a VM, e.g. Running or Off
+type VMState string
+
+const (
+	VMStateOther     VMState = "Other"
+	VMStateRunning   VMState = "Running"
+	VMStateOff       VMState = "Off"
+	VMStateStopping  VMState = "Stopping"
+	VMStateSaved     VMState = "Saved"
+	VMStatePaused    VMState = "Paused"
+	VMStateStarting  VMState = "Starting"
+	VMStateReset     VMState = "Reset"
+	VMStateSaving    VMState = "Saving"
+	VMStatePausing   VMState = "Pausing"
+	VMStateResuming  VMState = "Resuming"
+	VMStateFastSaved VMState = "FastSaved"
+)
+
+// vmStates maps the values of the Microsoft.HyperV.PowerShell.VMState
+// enum, which is how ConvertTo-Json serializes the state of a VM
+var vmStates = map[int]VMState{
+	1:     VMStateOther,
+	2:     VMStateRunning,
+	3:     VMStateOff,
+	4:     VMStateStopping,
+	6:     VMStateSaved,
+	9:     VMStatePaused,
+	10:    VMStateStarting,
+	11:    VMStateReset,
+	32773: VMStateSaving,
+	32776: VMStatePausing,
+	32777: VMStateResuming,
+	32779: VMStateFastSaved,
+}
+
+// UnmarshalJSON accepts the state either by name or as a VMState enum value
+func (s *VMState) UnmarshalJSON(b []byte) error {
+
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*s = VMState(name)
+		return nil
+	}
+
+	var value int
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+
+	if state, ok := vmStates[value]; ok {
+		*s = state
+	} else {
+		*s = VMState(strconv.Itoa(value))
+	}
+
+	return nil
+}
+
+// IsStopped is true if the VM is Off, so is not using its disks
+func (s VMState) IsStopped() bool {
+	return s == VMStateOff
+}
+
+// IsSaved is true if the VM is Saved. It is not using its disks, but Hyper-V will not
+// remove a drive from it, as that would invalidate its saved state.
+func (s VMState) IsSaved() bool {
+	return s == VMStateSaved || s == VMStateFastSaved
+}
@@ -0,0 +1,12 @@
+package rest
+
+// ImportVolumeProgress is the response returned when part of the VHDX of
+// a volume being imported has been received, or when the progress is queried.
+type ImportVolumeProgress struct {
+	// Received is the number of bytes of the VHDX received so far,
+	// which is the offset from which the upload resumes.
+	Received int64 `json:"received"`
+
+	// Size of the VHDX being uploaded.
+	Size int64 `json:"size"`
+}
@@ -0,0 +1,110 @@
+//go:build windows
+
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+)
+
+// AdoptVolume moves an existing VHDX on the host, e.g. a disk of an older VM, into the PV store as a
+// volume of the given name, which makes it visible to ListVolumes. The volume is counted against the
+// storage limits as though it were created, and the space it needs if it is on another drive.
+func (s *controllerServer) AdoptVolume(name, path, namespace string) (*rest.GetVolumeResponse, error) {
+
+	log := s.log.WithFields(logrus.Fields{
+		"volume_name": name,
+		"path":        path,
+		"namespace":   namespace,
+		"method":      "adopt_volume",
+	})
+
+	log.Info(messages.CONTROLLER_ADOPT_VOLUME)
+
+	if err := vhd.ValidateVolumeName(name); err != nil {
+		return nil, err
+	}
+
+	unlock := s.lockProvisioning()
+	defer func() { unlock() }()
+
+	if err := s.checkNotExists(name); err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_ADOPT_VOLUME_FAILED, codes.AlreadyExists)
+	}
+
+	disk, err := vhd.GetAdoptable(s.runner, s.PVStore, path)
+
+	if err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_ADOPT_VOLUME_FAILED, codes.InvalidArgument, codes.NotFound)
+	}
+
+	// A VHDX on another drive is copied into the store
+	allocate := int64(0)
+
+	if !strings.EqualFold(filepath.VolumeName(disk.Path), filepath.VolumeName(s.PVStore)) {
+		allocate = disk.FileSize
+	}
+
+	if err := s.checkLimits(namespace, disk.Size, allocate); err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_STORAGE_LIMIT)
+	}
+
+	source := disk.Path
+
+	if allocate > 0 {
+		// Copying may take a long time, in which other volumes must not be held up
+		unlock()
+
+		disk, err = vhd.CopyForAdoption(s.PVStore, disk)
+
+		unlock = s.lockProvisioning()
+
+		if err != nil {
+			return nil, s.processError(err, log, messages.CONTROLLER_ADOPT_VOLUME_FAILED)
+		}
+
+		// Another volume may have been given the name in the meantime
+		if err := s.checkNotExists(name); err != nil {
+			_ = os.Remove(disk.Path)
+			return nil, s.processError(err, log, messages.CONTROLLER_ADOPT_VOLUME_FAILED, codes.AlreadyExists)
+		}
+	}
+
+	vol, err := vhd.Adopt(s.runner, name, s.PVStore, disk)
+
+	if err != nil {
+		if disk.Path != source {
+			_ = os.Remove(disk.Path)
+		}
+
+		return nil, s.processError(err, log, messages.CONTROLLER_ADOPT_VOLUME_FAILED)
+	}
+
+	// The copy is now the volume, so a source which cannot be removed is left behind
+	if disk.Path != source {
+		if err := os.Remove(source); err != nil {
+			log.WithError(err).Warn("cannot remove the adopted VHDX")
+		}
+	}
+
+	if namespace != "" {
+		s.recordNamespace(log, vol.DiskIdentifier, namespace)
+	}
+
+	resp := &rest.GetVolumeResponse{
+		Name: vol.Name,
+		ID:   vol.DiskIdentifier,
+		Size: vol.Size,
+	}
+
+	log.WithField("response", resp).Info(messages.CONTROLLER_VOLUME_ADOPTED)
+
+	return resp, nil
+}
@@ -0,0 +1,145 @@
+//go:build windows
+
+package controller
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+)
+
+func (s *ControllerTestSuite) TestAdoptVolume() {
+
+	s.server.PVStore = s.T().TempDir()
+	oldDisks := s.T().TempDir()
+
+	notFound := func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
+	}
+
+	newDisk := func(name string) *models.GetVHDResponse {
+		path := filepath.Join(oldDisks, name)
+		s.Require().NoError(os.WriteFile(path, []byte(vhd.VHDXSignature), 0600))
+
+		return &models.GetVHDResponse{
+			Path:           path,
+			DiskIdentifier: uuid.NewString(),
+			Size:           10 * constants.GiB,
+			FileSize:       constants.MiB,
+		}
+	}
+
+	s.Run("adopted", func() {
+		disk := newDisk("data.vhdx")
+
+		notFound()
+		s.shell.EXPECT().Execute(mock.Anything).Return("true", "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+		notFound()
+
+		vol, err := s.server.AdoptVolume("pv1", disk.Path, "")
+
+		s.Require().NoError(err)
+		s.Require().Equal(&rest.GetVolumeResponse{Name: "pv1", ID: disk.DiskIdentifier, Size: disk.Size}, vol)
+		s.Require().FileExists(filepath.Join(s.server.PVStore, "pv1;"+disk.DiskIdentifier+constants.VhdType))
+		s.Require().NoFileExists(disk.Path)
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_VOLUME_ADOPTED))
+	})
+
+	s.Run("identifier of existing volume", func() {
+		disk := newDisk("copy.vhdx")
+		reset := *disk
+		reset.DiskIdentifier = uuid.NewString()
+
+		notFound()
+		s.shell.EXPECT().Execute(mock.Anything).Return("true", "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(&reset), "", nil).Once()
+
+		vol, err := s.server.AdoptVolume("pv2", disk.Path, "")
+
+		s.Require().NoError(err)
+		s.Require().Equal(reset.DiskIdentifier, vol.ID)
+		s.Require().FileExists(filepath.Join(s.server.PVStore, "pv2;"+reset.DiskIdentifier+constants.VhdType))
+	})
+
+	s.Run("in use", func() {
+		disk := newDisk("attached.vhdx")
+		disk.Attached = true
+
+		notFound()
+		s.shell.EXPECT().Execute(mock.Anything).Return("true", "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+
+		_, err := s.server.AdoptVolume("pv3", disk.Path, "")
+
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.FailedPrecondition, restErr.Code)
+		s.Require().FileExists(disk.Path)
+	})
+
+	s.Run("disk of a VM which is not running", func() {
+		disk := newDisk("configured.vhdx")
+		drives := []models.AttachedDrive{
+			{VMID: uuid.NewString(), VMName: "old-vm", Path: disk.Path},
+		}
+
+		notFound()
+		s.shell.EXPECT().Execute(mock.Anything).Return("true", "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(drives), "", nil).Once()
+
+		_, err := s.server.AdoptVolume("pv6", disk.Path, "")
+
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.FailedPrecondition, restErr.Code)
+		s.Require().FileExists(disk.Path)
+	})
+
+	s.Run("integrity check cannot run", func() {
+		disk := newDisk("unchecked.vhdx")
+
+		notFound()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "INTERNAL : Test-VHD failed", os.ErrInvalid).Once()
+
+		_, err := s.server.AdoptVolume("pv7", disk.Path, "")
+
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.Internal, restErr.Code)
+	})
+
+	s.Run("not a VHDX", func() {
+		notFound()
+
+		_, err := s.server.AdoptVolume("pv4", filepath.Join(oldDisks, "data.vhd"), "")
+
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.InvalidArgument, restErr.Code)
+	})
+
+	s.Run("already a volume", func() {
+		notFound()
+
+		_, err := s.server.AdoptVolume("pv5", filepath.Join(s.server.PVStore, "pv1;"+uuid.NewString()+constants.VhdType), "")
+
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.AlreadyExists, restErr.Code)
+	})
+}
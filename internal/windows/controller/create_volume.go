@@ -9,8 +9,10 @@ package controller
 import (
 	"errors"
 	"fmt"
+	"os"
 
 	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/models"
 	"github.com/fireflycons/hypervcsi/internal/models/rest"
 	"github.com/fireflycons/hypervcsi/internal/windows/messages"
 	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
@@ -18,15 +20,47 @@ import (
 	"google.golang.org/grpc/codes"
 )
 
-func (s *controllerServer) CreateVolume(name string, size int64) (*rest.GetVolumeResponse, error) {
+func (s *controllerServer) CreateVolume(name string, size int64, opts rest.CreateVolumeOptions) (*rest.GetVolumeResponse, error) {
 
 	log := s.log.WithFields(logrus.Fields{
 		"volume_name":  name,
 		"storage_size": common.FormatBytes(size),
+		"shared":       opts.Shared,
+		"template":     opts.Template,
+		"differencing": opts.Differencing,
+		"namespace":    opts.Namespace,
 		"method":       "create_volume",
 	})
 	log.Info(messages.CONTROLLER_CREATE_VOLUME)
 
+	var template *models.GetVHDResponse
+
+	if opts.Template != "" {
+		if opts.Shared {
+			return nil, rest.NewError(codes.InvalidArgument, "a shared volume cannot be created from a template")
+		}
+
+		var err error
+		template, err = vhd.GetTemplate(s.runner, s.TemplateStore, opts.Template)
+
+		if err != nil {
+			return nil, s.processError(err, log, messages.CONTROLLER_CREATE_VOLUME_FAILED)
+		}
+
+		if template == nil {
+			log.Error(messages.CONTROLLER_TEMPLATE_NOT_FOUND)
+			return nil, rest.NewError(codes.NotFound, fmt.Sprintf("template %q not found", opts.Template))
+		}
+
+		// The volume cannot be smaller than the disk it is created from
+		size = max(size, template.Size)
+	} else if opts.Differencing {
+		return nil, rest.NewError(codes.InvalidArgument, "a differencing volume requires a template")
+	}
+
+	unlock := s.lockProvisioning()
+	defer func() { unlock() }()
+
 	vol, err := vhd.GetByName(s.runner, s.PVStore, name)
 
 	if err != nil {
@@ -45,21 +79,62 @@ func (s *controllerServer) CreateVolume(name string, size int64) (*rest.GetVolum
 			return nil, rest.NewError(codes.AlreadyExists, fmt.Sprintf("invalid option requested size: %d", size))
 		}
 
+		if vol.Shared != opts.Shared {
+			log.Error(messages.CONTROLLER_VOLUME_EXISTS_SHARED)
+			return nil, rest.NewError(codes.AlreadyExists, fmt.Sprintf("invalid option requested shared: %t", opts.Shared))
+		}
+
 		log.Info(messages.CONTROLLER_VOLUME_ALREADY_CREATED)
 
 		return &rest.GetVolumeResponse{
-			Name: vol.Name,
-			ID:   vol.DiskIdentifier,
-			Size: vol.Size,
+			Name:   vol.Name,
+			ID:     vol.DiskIdentifier,
+			Size:   vol.Size,
+			Shared: vol.Shared,
 		}, nil
 	}
 
-	vol, err = vhd.New(
-		s.runner,
-		name,
-		s.PVStore,
-		size,
-	)
+	// Only a copy of a template allocates significant space when it is created
+	allocate := int64(0)
+	if template != nil && !opts.Differencing {
+		allocate = template.FileSize
+	}
+
+	if err := s.checkLimits(opts.Namespace, size, allocate); err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_STORAGE_LIMIT)
+	}
+
+	switch {
+	case template != nil:
+		// Copying a template may take a long time, in which other volumes must not be held up
+		unlock()
+
+		var staged *models.GetVHDResponse
+		staged, err = vhd.StageFromTemplate(s.runner, s.PVStore, template, size, opts.Differencing)
+
+		unlock = s.lockProvisioning()
+
+		if err != nil {
+			break
+		}
+
+		// Another volume may have been given the name, or taken the space, in the meantime
+		if err := s.checkNotExists(name); err != nil {
+			_ = os.Remove(staged.Path)
+			return nil, s.processError(err, log, messages.CONTROLLER_CREATE_VOLUME_FAILED, codes.AlreadyExists)
+		}
+
+		if err := s.checkLimits(opts.Namespace, size, 0); err != nil {
+			_ = os.Remove(staged.Path)
+			return nil, s.processError(err, log, messages.CONTROLLER_STORAGE_LIMIT)
+		}
+
+		vol, err = vhd.CommitStaged(name, s.PVStore, staged)
+	case opts.Shared:
+		vol, err = vhd.NewShared(s.runner, name, s.PVStore, size)
+	default:
+		vol, err = vhd.New(s.runner, name, s.PVStore, size)
+	}
 
 	if err != nil {
 		log.Error(err.Error())
@@ -73,13 +148,41 @@ func (s *controllerServer) CreateVolume(name string, size int64) (*rest.GetVolum
 		return nil, rest.NewError(codes.Internal, err.Error())
 	}
 
+	if opts.Namespace != "" {
+		s.recordNamespace(log, vol.DiskIdentifier, opts.Namespace)
+	}
+
 	resp := &rest.GetVolumeResponse{
-		Name: vol.Name,
-		ID:   vol.DiskIdentifier,
-		Size: vol.Size,
+		Name:   vol.Name,
+		ID:     vol.DiskIdentifier,
+		Size:   vol.Size,
+		Shared: vol.Shared,
 	}
 
 	log.WithField("response", resp).Info(messages.CONTROLLER_VOLUME_CREATED)
 
 	return resp, nil
 }
+
+// checkNotExists returns an AlreadyExists error if there is a volume with the given name
+func (s *controllerServer) checkNotExists(name string) error {
+
+	vol, err := vhd.GetByName(s.runner, s.PVStore, name)
+
+	if err != nil {
+		restErr := &rest.Error{}
+
+		// We generally expect the disk to not be found
+		if errors.As(err, &restErr) && restErr.Code == codes.NotFound {
+			return nil
+		}
+
+		return err
+	}
+
+	if vol != nil {
+		return rest.NewError(codes.AlreadyExists, fmt.Sprintf("volume %s already exists", name))
+	}
+
+	return nil
+}
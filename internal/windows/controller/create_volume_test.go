@@ -38,7 +38,7 @@ func (s *ControllerTestSuite) TestCreate() {
 	s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
 	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(newVhdResponse), "", nil).Once()
 
-	actual, err := s.server.CreateVolume("pv1", size)
+	actual, err := s.server.CreateVolume("pv1", size, rest.CreateVolumeOptions{})
 
 	s.Require().NoError(err)
 	s.Require().Equal(expected, actual)
@@ -68,7 +68,7 @@ func (s *ControllerTestSuite) TestCreateUnderMinSize() {
 	s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
 	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(newVhdResponse), "", nil).Once()
 
-	actual, err := s.server.CreateVolume("pv1", size)
+	actual, err := s.server.CreateVolume("pv1", size, rest.CreateVolumeOptions{})
 
 	s.Require().NoError(err)
 	s.Require().Equal(expected, actual)
@@ -97,7 +97,7 @@ func (s *ControllerTestSuite) TestCreateIdempotent() {
 
 	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(existingVhdResponse), "", nil).Once()
 
-	actual, err := s.server.CreateVolume("pv1", size)
+	actual, err := s.server.CreateVolume("pv1", size, rest.CreateVolumeOptions{})
 
 	s.Require().NoError(err)
 	s.Require().Equal(expected, actual)
@@ -114,7 +114,7 @@ func (s *ControllerTestSuite) TestCreateResourceExhausted() {
 	s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
 	s.shell.EXPECT().Execute(mock.Anything).Return("", "RESOURCE_EXHAUSTED : Insufficient storage", vhd.ErrCapacityExhausted).Once()
 
-	actual, err := s.server.CreateVolume("pv1", size)
+	actual, err := s.server.CreateVolume("pv1", size, rest.CreateVolumeOptions{})
 	s.Require().Nil(actual)
 
 	targetErr := &rest.Error{}
@@ -139,7 +139,7 @@ func (s *ControllerTestSuite) TestCreateWithDifferentSizeWhenDiskExistsIsError()
 
 	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(exitingVhdResponse), "", nil).Once()
 
-	actual, err := s.server.CreateVolume("pv1", size)
+	actual, err := s.server.CreateVolume("pv1", size, rest.CreateVolumeOptions{})
 	s.Require().Nil(actual)
 
 	targetErr := &rest.Error{}
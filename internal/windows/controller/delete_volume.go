@@ -23,11 +23,16 @@ func (s *controllerServer) DeleteVolume(volId string) error {
 		return rest.NewError(codes.InvalidArgument, "DeleteVolume Volume ID must be provided")
 	}
 
+	unlock := s.lockProvisioning()
+	defer unlock()
+
 	err := vhd.Delete(s.runner, s.PVStore, volId)
 	if err != nil {
 		return s.processError(err, log, messages.CONTROLLER_VOLUME_DELETE_FAILED)
 	}
 
+	s.recordNamespace(log, volId, "")
+
 	log.Info(messages.CONTROLLER_VOLUME_DELETED)
 	return nil
 }
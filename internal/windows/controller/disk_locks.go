@@ -0,0 +1,59 @@
+//go:build windows
+
+package controller
+
+import (
+	"strings"
+	"sync"
+)
+
+// diskLocks serialises the attachment of each disk, so that checking whether a disk
+// is attached and attaching or detaching it happen as one step. A disk whose VHD file
+// is read-only is attached to several nodes by separate requests, which otherwise race
+// with a request to attach it read-write. The zero value is ready for use.
+type diskLocks struct {
+	mu    sync.Mutex
+	locks map[string]*diskLock
+}
+
+// diskLock is the lock for one disk, counting the requests holding or waiting for it
+type diskLock struct {
+	sync.Mutex
+
+	refs int
+}
+
+// lock locks the given disk, returning the function that unlocks it.
+// Disk IDs are compared case-insensitively.
+func (l *diskLocks) lock(diskId string) func() {
+
+	key := strings.ToLower(diskId)
+
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*diskLock)
+	}
+
+	dl, ok := l.locks[key]
+	if !ok {
+		dl = &diskLock{}
+		l.locks[key] = dl
+	}
+
+	dl.refs++
+	l.mu.Unlock()
+
+	dl.Lock()
+
+	return func() {
+		dl.Unlock()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		dl.refs--
+		if dl.refs == 0 {
+			delete(l.locks, key)
+		}
+	}
+}
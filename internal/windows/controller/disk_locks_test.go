@@ -0,0 +1,53 @@
+//go:build windows
+
+package controller
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskLocks(t *testing.T) {
+
+	var locks diskLocks
+
+	t.Run("same disk", func(t *testing.T) {
+		unlock := locks.lock("ABC")
+
+		acquired := make(chan struct{})
+		go func() {
+			defer locks.lock("abc")()
+			close(acquired)
+		}()
+
+		select {
+		case <-acquired:
+			t.Fatal("lock acquired while held")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		unlock()
+		<-acquired
+	})
+
+	t.Run("different disks", func(t *testing.T) {
+		unlock := locks.lock("abc")
+		defer unlock()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer locks.lock("def")()
+		}()
+		wg.Wait()
+	})
+
+	t.Run("released locks are removed", func(t *testing.T) {
+		locks.lock("abc")()
+		require.Empty(t, locks.locks)
+	})
+}
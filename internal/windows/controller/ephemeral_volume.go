@@ -0,0 +1,130 @@
+//go:build windows
+
+// NOTES:
+//
+// Ephemeral volumes are requested by the node plugin with the node API key, which is
+// only valid for these calls. The VHD name is always prefixed so that these calls
+// cannot be used to reach persistent volumes. The key is shared by all nodes, so
+// a request made with it must come from an address of the VM it names.
+
+package controller
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+)
+
+// CreateEphemeralVolume creates a volume for a CSI ephemeral inline volume and attaches it to the given node.
+// The function is idempotent.
+func (s *controllerServer) CreateEphemeralVolume(name, nodeId string, size int64) (*rest.GetVolumeResponse, error) {
+
+	log := s.log.WithFields(logrus.Fields{
+		"volume_name":  name,
+		"node_id":      nodeId,
+		"storage_size": common.FormatBytes(size),
+		"method":       "create_ephemeral_volume",
+	})
+	log.Info(messages.CONTROLLER_CREATE_EPHEMERAL_VOLUME)
+
+	if name == "" || nodeId == "" {
+		return nil, rest.NewError(codes.InvalidArgument, "CreateEphemeralVolume volume name and node ID must be provided")
+	}
+
+	vol, err := s.CreateVolume(constants.EphemeralVolumePrefix+name, size, rest.CreateVolumeOptions{})
+	if err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_CREATE_EPHEMERAL_VOLUME_FAILED)
+	}
+
+	if err := s.PublishVolume(vol.ID, nodeId, false); err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_CREATE_EPHEMERAL_VOLUME_FAILED)
+	}
+
+	log.WithField("response", vol).Info(messages.CONTROLLER_EPHEMERAL_VOLUME_CREATED)
+	return vol, nil
+}
+
+// DeleteEphemeralVolume detaches the volume for a CSI ephemeral inline volume from the given node and deletes it.
+// The function is idempotent.
+func (s *controllerServer) DeleteEphemeralVolume(name, nodeId string) error {
+
+	log := s.log.WithFields(logrus.Fields{
+		"volume_name": name,
+		"node_id":     nodeId,
+		"method":      "delete_ephemeral_volume",
+	})
+	log.Info(messages.CONTROLLER_DELETE_EPHEMERAL_VOLUME)
+
+	if name == "" || nodeId == "" {
+		return rest.NewError(codes.InvalidArgument, "DeleteEphemeralVolume volume name and node ID must be provided")
+	}
+
+	vol, err := vhd.GetByName(s.runner, s.PVStore, constants.EphemeralVolumePrefix+name)
+	if err != nil {
+		restErr := s.processError(err, log, messages.CONTROLLER_DELETE_EPHEMERAL_VOLUME_FAILED, codes.NotFound)
+
+		if restErr.Code == codes.NotFound {
+			log.Info(messages.CONTROLLER_EPHEMERAL_VOLUME_DELETED)
+			return nil
+		}
+
+		return restErr
+	}
+
+	if vol == nil {
+		log.Info(messages.CONTROLLER_EPHEMERAL_VOLUME_DELETED)
+		return nil
+	}
+
+	if err := s.UnpublishVolume(vol.DiskIdentifier, nodeId); err != nil {
+		return s.processError(err, log, messages.CONTROLLER_DELETE_EPHEMERAL_VOLUME_FAILED)
+	}
+
+	if err := s.DeleteVolume(vol.DiskIdentifier); err != nil {
+		return s.processError(err, log, messages.CONTROLLER_DELETE_EPHEMERAL_VOLUME_FAILED)
+	}
+
+	log.Info(messages.CONTROLLER_EPHEMERAL_VOLUME_DELETED)
+	return nil
+}
+
+// NodeCallerKey is set in the Gin context of a request made with the node API key
+const NodeCallerKey = "node-caller"
+
+// checkNodeCaller checks that a request made with the node API key comes from an address of
+// the VM with the given ID, so that the key cannot be used to attach disks to another VM.
+// The node plugin uses the host network, so its requests come from the address of its VM.
+// A VM whose integration services do not report its addresses cannot be checked, so is refused.
+func (s *controllerServer) checkNodeCaller(remoteIP, nodeId string) error {
+
+	log := s.log.WithFields(logrus.Fields{
+		"node_id": nodeId,
+		"source":  remoteIP,
+		"method":  "check_node_caller",
+	})
+
+	addresses, err := vhd.GetVMAddresses(s.runner, nodeId)
+
+	if err != nil {
+		return s.processError(err, log, messages.CONTROLLER_NODE_CALLER_DENIED)
+	}
+
+	if ip := net.ParseIP(remoteIP); ip != nil {
+		for _, a := range addresses {
+			if ip.Equal(net.ParseIP(a)) {
+				return nil
+			}
+		}
+	}
+
+	log.Warn(messages.CONTROLLER_NODE_CALLER_DENIED)
+
+	return rest.NewError(codes.PermissionDenied, fmt.Sprintf("node API key is not valid from %s for VM %s", remoteIP, nodeId))
+}
@@ -0,0 +1,126 @@
+//go:build windows
+
+package controller
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+)
+
+func (s *ControllerTestSuite) TestCreateEphemeralVolume() {
+
+	const size = 10 * constants.MiB
+
+	var (
+		volId  = uuid.NewString()
+		nodeId = uuid.NewString()
+		name   = constants.EphemeralVolumePrefix + "csi-1234"
+	)
+
+	newVhdResponse := &models.GetVHDResponse{
+		Path:           fmt.Sprintf("C:\\Temp\\%s;%s.vhdx", name, volId),
+		Name:           name,
+		Size:           size,
+		DiskIdentifier: volId,
+	}
+
+	attachment := &models.AttachedDrive{
+		ID:     volId,
+		VMName: "test",
+		Path:   newVhdResponse.Path,
+	}
+
+	// Get by name, create, get by ID, attach
+	s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
+	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(newVhdResponse), "", nil).Once()
+	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(newVhdResponse), "", nil).Once()
+	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(attachment), "", nil).Once()
+
+	vol, err := s.server.CreateEphemeralVolume("csi-1234", nodeId, size)
+
+	s.Require().NoError(err)
+	s.Require().Equal(volId, vol.ID)
+	s.Require().Equal(name, vol.Name)
+	s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_EPHEMERAL_VOLUME_CREATED))
+}
+
+func (s *ControllerTestSuite) TestDeleteEphemeralVolume() {
+
+	var (
+		volId  = uuid.NewString()
+		nodeId = uuid.NewString()
+		name   = constants.EphemeralVolumePrefix + "csi-1234"
+	)
+
+	getDiskResponse := &models.GetVHDResponse{
+		Path:           fmt.Sprintf("C:\\Temp\\%s;%s.vhdx", name, volId),
+		Name:           name,
+		Size:           10 * constants.MiB,
+		DiskIdentifier: volId,
+	}
+
+	// Get by name, get by ID, detach, delete
+	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(getDiskResponse), "", nil).Once()
+	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(getDiskResponse), "", nil).Once()
+	s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+	s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+
+	err := s.server.DeleteEphemeralVolume("csi-1234", nodeId)
+
+	s.Require().NoError(err)
+	s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_EPHEMERAL_VOLUME_DELETED))
+}
+
+func (s *ControllerTestSuite) TestDeleteEphemeralVolumeNotFound() {
+
+	s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
+
+	err := s.server.DeleteEphemeralVolume("csi-1234", uuid.NewString())
+
+	s.Require().NoError(err)
+	s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_EPHEMERAL_VOLUME_DELETED))
+}
+
+func (s *ControllerTestSuite) TestCheckNodeCaller() {
+
+	nodeId := uuid.NewString()
+
+	adapters := []models.GetVMNetworkAdapterResponse{
+		{IPAddresses: []string{"192.168.1.10", "fe80::215:5dff:fe00:1"}},
+	}
+
+	s.Run("from an address of the node", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(adapters), "", nil).Once()
+
+		s.Require().NoError(s.server.checkNodeCaller("192.168.1.10", nodeId))
+	})
+
+	s.Run("from another address", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(adapters), "", nil).Once()
+
+		err := s.server.checkNodeCaller("192.168.1.11", nodeId)
+		s.Require().Error(err)
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.PermissionDenied, restErr.Code)
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_NODE_CALLER_DENIED))
+	})
+
+	s.Run("VM which does not exist", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+
+		err := s.server.checkNodeCaller("192.168.1.10", nodeId)
+		s.Require().Error(err)
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.PermissionDenied, restErr.Code)
+	})
+}
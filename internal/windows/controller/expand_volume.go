@@ -19,6 +19,9 @@ func (s *controllerServer) ExpandVolume(volumeId string, size int64) (*rest.Expa
 	})
 	log.Info(messages.CONTROLLER_EXPAND_VOLUME)
 
+	unlock := s.lockProvisioning()
+	defer unlock()
+
 	origVol, err := vhd.GetByID(s.runner, s.PVStore, volumeId)
 
 	if err != nil {
@@ -26,6 +29,18 @@ func (s *controllerServer) ExpandVolume(volumeId string, size int64) (*rest.Expa
 		return nil, restErr
 	}
 
+	if size > origVol.Size {
+		namespace, err := s.namespaceOf(origVol)
+
+		if err != nil {
+			return nil, s.processError(err, log, messages.CONTROLLER_EXPAND_VOLUME_FAILED)
+		}
+
+		if err := s.checkLimits(namespace, size-origVol.Size, 0); err != nil {
+			return nil, s.processError(err, log, messages.CONTROLLER_STORAGE_LIMIT)
+		}
+	}
+
 	vol, err := vhd.Resize(s.runner, s.PVStore, volumeId, size)
 
 	if err != nil {
@@ -24,6 +24,15 @@ func (s *controllerServer) GetCapacity() (*rest.GetCapacityResponse, error) {
 		return nil, s.processError(err, log, messages.CONTROLLER_GET_CAPACITY_FAILED)
 	}
 
+	if s.provisioning != nil && s.provisioning.limits.enabled() {
+		usage, err := s.diskUsage()
+		if err != nil {
+			return nil, s.processError(err, log, messages.CONTROLLER_GET_CAPACITY_FAILED)
+		}
+
+		free = min(free, s.provisioning.limits.available(usage))
+	}
+
 	log.Info(messages.CONTROLLER_GOT_CAPACITY)
 
 	return &rest.GetCapacityResponse{
@@ -27,3 +27,24 @@ func (s *controllerServer) GetVm(nodeId string) (*rest.GetVMResponse, error) {
 
 	return vm, nil
 }
+
+// GetVmByBIOSGUID gets the VM with the given BIOS GUID, which its guest reads as the BIOS UUID.
+func (s *controllerServer) GetVmByBIOSGUID(biosGuid string) (*rest.GetVMResponse, error) {
+
+	log := s.log.WithFields(logrus.Fields{
+		"method":   "get_vm",
+		"biosGuid": biosGuid,
+	})
+
+	log.Info(messages.CONTROLLER_GET_VM)
+
+	vm, err := vhd.GetVMByBIOSGUID(s.runner, biosGuid)
+
+	if err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_GET_VM_FAILED)
+	}
+
+	log.Info(messages.CONTROLLER_GOT_VM)
+
+	return vm, nil
+}
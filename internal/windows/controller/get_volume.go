@@ -37,9 +37,11 @@ func (s *controllerServer) GetVolume(name string) (*rest.GetVolumeResponse, erro
 	}
 
 	resp := &rest.GetVolumeResponse{
-		Name: vol.Name,
-		ID:   vol.DiskIdentifier,
-		Size: vol.Size,
+		Name:   vol.Name,
+		ID:     vol.DiskIdentifier,
+		Size:   vol.Size,
+		Shared: vol.Shared,
+		Host:   vol.Host,
 	}
 
 	log.WithField("response", resp).Info(messages.CONTROLLER_GET_VOLUME_OK)
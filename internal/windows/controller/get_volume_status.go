@@ -0,0 +1,145 @@
+//go:build windows
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+)
+
+func (s *controllerServer) GetVolumeStatus(volumeId string) (*rest.GetVolumeStatusResponse, error) {
+
+	log := s.log.WithFields(logrus.Fields{
+		"volume_id": volumeId,
+		"method":    "get_volume_status",
+	})
+
+	log.Info(messages.CONTROLLER_GET_VOLUME_STATUS)
+
+	vol, err := vhd.GetByID(s.runner, s.PVStore, volumeId)
+
+	if err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_GET_VOLUME_FAILED, codes.NotFound)
+	}
+
+	attachments, err := s.volumeAttachments(vol)
+
+	if err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_GET_VOLUME_FAILED)
+	}
+
+	condition, err := s.volumeCondition(vol)
+
+	if err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_GET_VOLUME_FAILED)
+	}
+
+	resp := &rest.GetVolumeStatusResponse{
+		Name:        vol.Name,
+		ID:          vol.DiskIdentifier,
+		Size:        vol.Size,
+		Host:        attachedHost(vol, attachments),
+		Attachments: attachments,
+		Condition:   *condition,
+	}
+
+	if condition.Abnormal {
+		log.WithField("condition", condition.Message).Warn(messages.CONTROLLER_VOLUME_ABNORMAL)
+	}
+
+	log.WithField("response", resp).Info(messages.CONTROLLER_GET_VOLUME_STATUS_OK)
+
+	return resp, nil
+}
+
+// volumeCondition checks the given disk for abnormal states, these being
+//
+//   - The VHD file is missing
+//   - The disk fails the Hyper-V integrity check
+//
+// An error is returned if the checks themselves could not be run.
+func (s *controllerServer) volumeCondition(vol *models.GetVHDResponse) (*rest.VolumeCondition, error) {
+
+	if _, err := os.Stat(vol.Path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &rest.VolumeCondition{
+				Abnormal: true,
+				Message:  fmt.Sprintf("VHD file %s is missing", vol.Path),
+			}, nil
+		}
+
+		return nil, err
+	}
+
+	ok, err := vhd.CheckIntegrity(s.runner, vol.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return &rest.VolumeCondition{
+			Abnormal: true,
+			Message:  "integrity check failed",
+		}, nil
+	}
+
+	return &rest.VolumeCondition{
+		Message: "volume is healthy",
+	}, nil
+}
+
+// volumeAttachments lists the nodes the given disk is attached to, from the drives of
+// all VMs, as Get-PVDisk reports only a single host for a disk. A VHD Set may be attached
+// read-write to several nodes, and a disk whose VHD file is read-only may be attached to
+// several nodes, all of them read-only. Otherwise a disk can only be attached read-write
+// to its host.
+func (s *controllerServer) volumeAttachments(vol *models.GetVHDResponse) ([]rest.Attachment, error) {
+
+	drives, err := vhd.GetAttachments(s.runner, vol.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(drives) == 0 {
+		return nil, nil
+	}
+
+	readOnly := false
+
+	if !vol.Shared {
+		if ro, err := vhd.IsReadOnly(vol.Path); err == nil {
+			readOnly = ro
+		}
+	}
+
+	attachments := make([]rest.Attachment, 0, len(drives))
+	for _, d := range drives {
+		attachments = append(attachments, rest.Attachment{
+			NodeID:   d.VMID,
+			ReadOnly: readOnly,
+		})
+	}
+
+	return attachments, nil
+}
+
+// attachedHost returns the node to which the given disk is attached read-write,
+// which is nil if it is not attached, or may be attached to several nodes.
+func attachedHost(vol *models.GetVHDResponse, attachments []rest.Attachment) *string {
+
+	if vol.Shared || len(attachments) != 1 || attachments[0].ReadOnly {
+		return nil
+	}
+
+	return &attachments[0].NodeID
+}
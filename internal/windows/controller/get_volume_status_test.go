@@ -0,0 +1,135 @@
+//go:build windows
+
+package controller
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+)
+
+func (s *ControllerTestSuite) TestGetVolumeStatus() {
+
+	var (
+		volId  = uuid.NewString()
+		nodeId = uuid.NewString()
+	)
+
+	path := filepath.Join(s.T().TempDir(), "pv1;"+volId+".vhdx")
+	s.Require().NoError(os.WriteFile(path, []byte{}, 0600))
+
+	disk := &models.GetVHDResponse{
+		Path:           path,
+		Name:           "pv1",
+		DiskIdentifier: volId,
+		Size:           10 * constants.MiB,
+	}
+
+	drives := []models.AttachedDrive{
+		{
+			VMID: nodeId,
+			Path: path,
+		},
+	}
+
+	s.Run("healthy", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(drives), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("true", "", nil).Once()
+
+		resp, err := s.server.GetVolumeStatus(volId)
+		s.Require().NoError(err)
+		s.Require().Equal(volId, resp.ID)
+		s.Require().Equal(nodeId, *resp.Host)
+		s.Require().Equal([]rest.Attachment{{NodeID: nodeId}}, resp.Attachments)
+		s.Require().False(resp.Condition.Abnormal)
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_GET_VOLUME_STATUS_OK))
+	})
+
+	s.Run("fails integrity check", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(drives), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("false", "", nil).Once()
+
+		resp, err := s.server.GetVolumeStatus(volId)
+		s.Require().NoError(err)
+		s.Require().True(resp.Condition.Abnormal)
+	})
+
+	s.Run("integrity check cannot run", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(drives), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "INTERNAL : Test-VHD failed", os.ErrInvalid).Once()
+
+		_, err := s.server.GetVolumeStatus(volId)
+		s.Require().Error(err)
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.Internal, restErr.Code)
+	})
+
+	s.Run("missing VHD file", func() {
+		missing := *disk
+		missing.Path = filepath.Join(s.T().TempDir(), "missing.vhdx")
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(missing), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+
+		resp, err := s.server.GetVolumeStatus(volId)
+		s.Require().NoError(err)
+		s.Require().True(resp.Condition.Abnormal)
+		s.Require().Contains(resp.Condition.Message, "missing")
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_VOLUME_ABNORMAL))
+	})
+
+	s.Run("not attached", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("true", "", nil).Once()
+
+		resp, err := s.server.GetVolumeStatus(volId)
+		s.Require().NoError(err)
+		s.Require().Nil(resp.Host)
+		s.Require().Empty(resp.Attachments)
+		s.Require().False(resp.Condition.Abnormal)
+	})
+
+	s.Run("attached read-only to several nodes", func() {
+		otherNode := uuid.NewString()
+		drives := []models.AttachedDrive{
+			{VMID: nodeId, Path: path},
+			{VMID: otherNode, Path: path},
+		}
+
+		s.Require().NoError(os.Chmod(path, 0400))
+		defer func() { _ = os.Chmod(path, 0600) }()
+
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(drives), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("true", "", nil).Once()
+
+		resp, err := s.server.GetVolumeStatus(volId)
+		s.Require().NoError(err)
+		s.Require().Equal([]rest.Attachment{
+			{NodeID: nodeId, ReadOnly: true},
+			{NodeID: otherNode, ReadOnly: true},
+		}, resp.Attachments)
+		s.Require().Nil(resp.Host)
+	})
+
+	s.Run("volume not found", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
+
+		_, err := s.server.GetVolumeStatus(volId)
+		s.Require().Error(err)
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.NotFound, restErr.Code)
+	})
+}
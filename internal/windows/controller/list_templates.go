@@ -0,0 +1,42 @@
+//go:build windows
+
+package controller
+
+import (
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *controllerServer) ListTemplates() (*rest.ListTemplatesResponse, error) {
+
+	log := s.log.WithFields(logrus.Fields{
+		"templates": s.TemplateStore,
+		"method":    "list_templates",
+	})
+
+	log.Info(messages.CONTROLLER_LIST_TEMPLATES)
+
+	templates, err := vhd.ListTemplates(s.runner, s.TemplateStore)
+
+	if err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_LIST_TEMPLATES_FAILED)
+	}
+
+	resp := &rest.ListTemplatesResponse{
+		Templates: make([]rest.Template, 0, len(templates)),
+	}
+
+	for _, t := range templates {
+		resp.Templates = append(resp.Templates, rest.Template{
+			Name:     t.Name,
+			Size:     t.Size,
+			FileSize: t.FileSize,
+		})
+	}
+
+	log.Info(messages.CONTROLLER_TEMPLATES_LISTED)
+
+	return resp, nil
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package controller
+
+import (
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *controllerServer) ListVmAttachments(nodeId string) (*rest.ListVMAttachmentsResponse, error) {
+
+	log := s.log.WithFields(logrus.Fields{
+		"method":  "list_vm_attachments",
+		"node_id": nodeId,
+	})
+
+	log.Info(messages.CONTROLLER_LIST_VM_ATTACHMENTS)
+
+	attachments, err := vhd.GetVMAttachments(s.runner, nodeId)
+
+	if err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_LIST_VM_ATTACHMENTS_FAILED)
+	}
+
+	log.Info(messages.CONTROLLER_VM_ATTACHMENTS_LISTED)
+
+	return attachments, nil
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package controller
+
+import (
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/stretchr/testify/mock"
+)
+
+func (s *ControllerTestSuite) TestListVmAttachments() {
+
+	attachments := &rest.ListVMAttachmentsResponse{
+		Attachments: []*rest.VMAttachment{
+			{
+				ControllerNumber:   0,
+				ControllerLocation: 1,
+				Path:               "C:\\temp\\pv1;" + constants.ZeroUUID + ".vhdx",
+				Name:               "pv1",
+				DiskIdentifier:     constants.ZeroUUID,
+				Size:               constants.MiB * 10,
+				Volume:             true,
+			},
+		},
+	}
+
+	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(attachments), "", nil).Once()
+
+	actual, err := s.server.ListVmAttachments(constants.ZeroUUID)
+	s.Require().NoError(err)
+	s.Require().Equal(attachments, actual)
+	s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_VM_ATTACHMENTS_LISTED))
+}
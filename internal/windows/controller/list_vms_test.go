@@ -6,6 +6,7 @@ import (
 	"github.com/fireflycons/hypervcsi/internal/models/rest"
 	"github.com/fireflycons/hypervcsi/internal/windows/messages"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
 )
 
 func (s *ControllerTestSuite) TestListVms() {
@@ -28,3 +29,36 @@ func (s *ControllerTestSuite) TestListVms() {
 	s.Require().Len(actual.VMs, len(vms.VMs))
 	s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_VMS_LISTED))
 }
+
+func (s *ControllerTestSuite) TestGetVmByBIOSGUID() {
+
+	vms := &rest.ListVMResponse{
+		VMs: []*rest.GetVMResponse{
+			{
+				Name:     "vm1",
+				ID:       "0f8fad5b-d9cb-469f-a165-70867728950e",
+				BIOSGUID: "12345678-1234-5678-9ABC-DEF012345678",
+			},
+		},
+	}
+
+	s.Run("found", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(vms), "", nil).Once()
+
+		actual, err := s.server.GetVmByBIOSGUID("12345678-1234-5678-9abc-def012345678")
+		s.Require().NoError(err)
+		s.Require().Equal(vms.VMs[0].ID, actual.ID)
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_GOT_VM))
+	})
+
+	s.Run("not found", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(vms), "", nil).Once()
+
+		// The VM ID is not its BIOS GUID
+		_, err := s.server.GetVmByBIOSGUID(vms.VMs[0].ID)
+
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.NotFound, restErr.Code)
+	})
+}
@@ -4,12 +4,13 @@ package controller
 
 import (
 	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
 	"github.com/fireflycons/hypervcsi/internal/windows/messages"
 	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
 	"github.com/sirupsen/logrus"
 )
 
-func (s *controllerServer) ListVolumes(maxEntries int32, nextToken string) (*models.ListVHDResponse, error) {
+func (s *controllerServer) ListVolumes(maxEntries int32, nextToken string) (*rest.ListVolumesResponse, error) {
 
 	log := s.log.WithFields(logrus.Fields{
 		"max_entries":        maxEntries,
@@ -25,7 +26,16 @@ func (s *controllerServer) ListVolumes(maxEntries int32, nextToken string) (*mod
 		return nil, s.processError(err, log, messages.CONTROLLER_LIST_VOLUMES_FAILED)
 	}
 
+	resp := &rest.ListVolumesResponse{
+		Volumes:   make([]*models.GetVHDResponse, 0, len(disks.VHDs)),
+		NextToken: disks.NextToken,
+	}
+
+	for i := range disks.VHDs {
+		resp.Volumes = append(resp.Volumes, &disks.VHDs[i])
+	}
+
 	log.Info(messages.CONTROLLER_VOLUMES_LISTED)
 
-	return disks, nil
+	return resp, nil
 }
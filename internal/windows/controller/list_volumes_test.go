@@ -3,11 +3,19 @@
 package controller
 
 import (
+	"context"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/hyperv"
 	"github.com/fireflycons/hypervcsi/internal/models"
 	"github.com/fireflycons/hypervcsi/internal/models/rest"
 	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/mock"
 	"google.golang.org/grpc/codes"
 )
@@ -15,7 +23,8 @@ import (
 func (s *ControllerTestSuite) TestListVolumes() {
 
 	vols := &models.ListVHDResponse{
-		VHDs: make([]models.GetVHDResponse, 10),
+		VHDs:      make([]models.GetVHDResponse, 10),
+		NextToken: "10",
 	}
 
 	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(vols), "", nil).Once()
@@ -23,10 +32,49 @@ func (s *ControllerTestSuite) TestListVolumes() {
 	disks, err := s.server.ListVolumes(0, "")
 
 	s.Require().NoError(err)
-	s.Require().Len(disks.VHDs, len(vols.VHDs))
+	s.Require().Len(disks.Volumes, len(vols.VHDs))
+	s.Require().Equal(vols.NextToken, disks.NextToken)
 	s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_VOLUMES_LISTED))
 }
 
+func (s *ControllerTestSuite) TestListVolumesWithSharedVolume() {
+
+	s.server.PVStore = s.T().TempDir()
+
+	vhdx := models.GetVHDResponse{
+		Name:           "pv1",
+		DiskIdentifier: uuid.NewString(),
+		Size:           constants.GiB,
+	}
+	vhdx.Path = filepath.Join(s.server.PVStore, vhdx.Name+";"+vhdx.DiskIdentifier+constants.VhdType)
+
+	vhds := models.GetVHDResponse{
+		Name:           "pv2",
+		DiskIdentifier: uuid.NewString(),
+		Size:           constants.GiB,
+	}
+	vhds.Path = filepath.Join(s.server.PVStore, vhds.Name+";"+vhds.DiskIdentifier+vhd.VhdSetType)
+
+	for _, path := range []string{vhdx.Path, vhds.Path} {
+		s.Require().NoError(os.WriteFile(path, []byte{}, 0600))
+	}
+
+	// The module lists the VHD Set with the other disks of the store
+	vols := &models.ListVHDResponse{
+		VHDs: []models.GetVHDResponse{vhdx, vhds},
+	}
+
+	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(vols), "", nil).Once()
+
+	disks, err := s.server.ListVolumes(0, "")
+
+	s.Require().NoError(err)
+	s.Require().Len(disks.Volumes, 2)
+	s.Require().False(disks.Volumes[0].Shared)
+	s.Require().Equal(vhds.DiskIdentifier, disks.Volumes[1].DiskIdentifier)
+	s.Require().True(disks.Volumes[1].Shared)
+}
+
 func (s *ControllerTestSuite) TestListVolumesInvalidPath() {
 
 	s.shell.EXPECT().Execute(mock.Anything).Return("", "INVALID_ARGUMENT :", os.ErrInvalid).Once()
@@ -40,3 +88,37 @@ func (s *ControllerTestSuite) TestListVolumesInvalidPath() {
 	s.Require().Equal(codes.InvalidArgument, restErr.Code)
 	s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_LIST_VOLUMES_FAILED))
 }
+
+func (s *ControllerTestSuite) TestListVolumesClientRoundTrip() {
+
+	vols := &models.ListVHDResponse{
+		VHDs: []models.GetVHDResponse{
+			{
+				Name:           "pv1",
+				DiskIdentifier: uuid.NewString(),
+				Size:           constants.GiB,
+			},
+		},
+		NextToken: "1",
+	}
+
+	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(vols), "", nil).Once()
+
+	// The Linux driver must decode the response of the service
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/volumes", s.server.HandleListVolumes)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client, err := hyperv.NewClient(server.URL, server.Client(), "", nil)
+	s.Require().NoError(err)
+
+	resp, err := client.ListVolumes(context.Background(), 1, "")
+
+	s.Require().NoError(err)
+	s.Require().Equal(vols.NextToken, resp.NextToken)
+	s.Require().Len(resp.Volumes, 1)
+	s.Require().Equal(vols.VHDs[0], *resp.Volumes[0])
+}
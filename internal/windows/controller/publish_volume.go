@@ -8,17 +8,25 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func (s *controllerServer) PublishVolume(volumeId, nodeId string) error {
+func (s *controllerServer) PublishVolume(volumeId, nodeId string, readOnly bool) error {
 
 	log := s.log.WithFields(logrus.Fields{
 		"volume_id": volumeId,
 		"node_id":   nodeId,
+		"read_only": readOnly,
 		"method":    "publish_volume",
 	})
 
 	log.Info(messages.CONTROLLER_PUBLISH_VOLUME)
 
-	_, err := vhd.Attach(s.runner, s.PVStore, volumeId, nodeId)
+	defer s.attachLocks.lock(volumeId)()
+
+	attach := vhd.Attach
+	if readOnly {
+		attach = vhd.AttachReadOnly
+	}
+
+	_, err := attach(s.runner, s.PVStore, volumeId, nodeId)
 
 	if err != nil {
 		return s.processError(err, log, messages.CONTROLLER_PUBLISH_VOLUME_FAILED)
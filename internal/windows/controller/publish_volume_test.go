@@ -4,11 +4,13 @@ package controller
 
 import (
 	"os"
+	"path/filepath"
 
 	"github.com/fireflycons/hypervcsi/internal/constants"
 	"github.com/fireflycons/hypervcsi/internal/models"
 	"github.com/fireflycons/hypervcsi/internal/models/rest"
 	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/mock"
 	"google.golang.org/grpc/codes"
@@ -38,12 +40,74 @@ func (s *ControllerTestSuite) TestPublishVolume() {
 	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(getDiskResponse), "", nil).Once()
 	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(attachment), "", nil).Once()
 
-	err := s.server.PublishVolume(volId, nodeId)
+	err := s.server.PublishVolume(volId, nodeId, false)
 
 	s.Require().NoError(err)
 	s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_VOLUME_PUBLISHED))
 }
 
+func (s *ControllerTestSuite) TestPublishVolumeIsIdempotent() {
+
+	var (
+		volId  = uuid.NewString()
+		nodeId = uuid.NewString()
+	)
+
+	getDiskResponse := &models.GetVHDResponse{
+		Path:           "C:\\Temp\\test.vhdx",
+		DiskIdentifier: volId,
+		Name:           "pv1",
+		Size:           10 * constants.MiB,
+		Host:           &nodeId,
+	}
+
+	// The disk is not attached again
+	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(getDiskResponse), "", nil).Once()
+
+	err := s.server.PublishVolume(volId, nodeId, false)
+
+	s.Require().NoError(err)
+	s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_VOLUME_PUBLISHED))
+}
+
+func (s *ControllerTestSuite) TestPublishVolumeFailsIfAttachedToAnotherNode() {
+
+	var (
+		volId     = uuid.NewString()
+		nodeId    = uuid.NewString()
+		otherNode = uuid.NewString()
+		path      = "C:\\Temp\\test.vhdx"
+	)
+
+	getDiskResponse := &models.GetVHDResponse{
+		Path:           path,
+		DiskIdentifier: volId,
+		Name:           "pv1",
+		Size:           10 * constants.MiB,
+		Host:           &otherNode,
+	}
+
+	attachments := []models.AttachedDrive{
+		{
+			VMID:   otherNode,
+			VMName: "worker-2",
+			Path:   path,
+		},
+	}
+
+	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(getDiskResponse), "", nil).Once()
+	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(attachments), "", nil).Once()
+
+	err := s.server.PublishVolume(volId, nodeId, false)
+
+	s.Require().Error(err)
+	restErr := &rest.Error{}
+	s.Require().ErrorAs(err, &restErr)
+	s.Require().Equal(codes.FailedPrecondition, restErr.Code)
+	s.Require().Contains(restErr.Message, "worker-2")
+	s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_PUBLISH_VOLUME_FAILED))
+}
+
 func (s *ControllerTestSuite) TestPublishVolumeFailsIfDiskDoesNotExist() {
 
 	var (
@@ -53,7 +117,7 @@ func (s *ControllerTestSuite) TestPublishVolumeFailsIfDiskDoesNotExist() {
 
 	s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
 
-	err := s.server.PublishVolume(volId, nodeId)
+	err := s.server.PublishVolume(volId, nodeId, false)
 
 	s.Require().Error(err)
 	restErr := &rest.Error{}
@@ -80,7 +144,7 @@ func (s *ControllerTestSuite) TestPublishVolumeFailsIfVMDoesNotExist() {
 	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(getDiskResponse), "", nil).Once()
 	s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : VM does not exist", os.ErrNotExist).Once()
 
-	err := s.server.PublishVolume(volId, nodeId)
+	err := s.server.PublishVolume(volId, nodeId, false)
 
 	s.Require().Error(err)
 	restErr := &rest.Error{}
@@ -107,7 +171,7 @@ func (s *ControllerTestSuite) TestPublishVolumeFailsIfSCSIControllerFull() {
 	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(getDiskResponse), "", nil).Once()
 	s.shell.EXPECT().Execute(mock.Anything).Return("", "RESOURCE_EXHAUSTED : No free slots", os.ErrNotExist).Once()
 
-	err := s.server.PublishVolume(volId, nodeId)
+	err := s.server.PublishVolume(volId, nodeId, false)
 
 	s.Require().Error(err)
 	restErr := &rest.Error{}
@@ -115,3 +179,83 @@ func (s *ControllerTestSuite) TestPublishVolumeFailsIfSCSIControllerFull() {
 	s.Require().Equal(codes.ResourceExhausted, restErr.Code)
 	s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_PUBLISH_VOLUME_FAILED))
 }
+
+func (s *ControllerTestSuite) TestPublishVolumeReadOnly() {
+
+	var (
+		volId      = uuid.NewString()
+		nodeId     = uuid.NewString()
+		otherNode  = uuid.NewString()
+		path       = filepath.Join(s.T().TempDir(), "pv1;"+volId+".vhdx")
+		attachment = &models.AttachedDrive{
+			ID:     volId,
+			VMID:   otherNode,
+			VMName: "other",
+			Path:   path,
+		}
+	)
+
+	s.Require().NoError(os.WriteFile(path, []byte{}, 0600))
+	s.T().Cleanup(func() { _ = os.Chmod(path, 0600) })
+
+	getDiskResponse := &models.GetVHDResponse{
+		Path:           path,
+		DiskIdentifier: volId,
+		Name:           "pv1",
+		Size:           10 * constants.MiB,
+	}
+
+	s.Run("rejected while attached read-write to another node", func() {
+		attached := *getDiskResponse
+		attached.Host = &otherNode
+
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(&attached), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(attachment), "", nil).Once()
+
+		err := s.server.PublishVolume(volId, nodeId, true)
+
+		s.Require().Error(err)
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.FailedPrecondition, restErr.Code)
+	})
+
+	s.Run("attaches read-only", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(getDiskResponse), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(attachment), "", nil).Once()
+
+		err := s.server.PublishVolume(volId, nodeId, true)
+
+		s.Require().NoError(err)
+		readOnly, err := vhd.IsReadOnly(path)
+		s.Require().NoError(err)
+		s.Require().True(readOnly)
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_VOLUME_PUBLISHED))
+	})
+
+	s.Run("read-write rejected while attached read-only", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(getDiskResponse), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(attachment), "", nil).Once()
+
+		err := s.server.PublishVolume(volId, nodeId, false)
+
+		s.Require().Error(err)
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.FailedPrecondition, restErr.Code)
+	})
+
+	s.Run("read-write once readers have detached", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(getDiskResponse), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(attachment), "", nil).Once()
+
+		err := s.server.PublishVolume(volId, nodeId, false)
+
+		s.Require().NoError(err)
+		readOnly, err := vhd.IsReadOnly(path)
+		s.Require().NoError(err)
+		s.Require().False(readOnly)
+	})
+}
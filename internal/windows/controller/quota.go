@@ -0,0 +1,265 @@
+//go:build windows
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
+	"github.com/fireflycons/hypervcsi/internal/windows/win32"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+)
+
+// namespacesFile is the file in the PV store which records the
+// Kubernetes namespace of the PVC for which each volume was created.
+const namespacesFile = ".namespaces.json"
+
+// StorageLimits constrain the total size of the volumes that may be provisioned.
+// Dynamic VHDs only use disk space as it is written to, so without limits
+// far more may be provisioned than the disk can hold.
+type StorageLimits struct {
+
+	// OvercommitRatio is the maximum ratio of the total size of all volumes
+	// to the size of the disk on which the PV store resides, less the reserved
+	// space. Zero means no limit.
+	OvercommitRatio float64
+
+	// ReservedBytes is the space on the disk on which the PV store resides
+	// that must always remain free. Zero means no reservation.
+	ReservedBytes int64
+
+	// NamespaceQuotas is the maximum total size of the volumes
+	// created for PVCs in each namespace.
+	NamespaceQuotas map[string]int64
+}
+
+// provisioning holds the state needed to enforce storage limits.
+// Volumes are created and expanded while holding its lock
+// so that concurrent requests cannot exceed the limits.
+type provisioning struct {
+	sync.Mutex
+
+	limits StorageLimits
+}
+
+// diskUsage is a snapshot of the space used and provisioned in the PV store
+type diskUsage struct {
+	total       int64
+	free        int64
+	provisioned int64
+	namespaces  map[string]int64
+}
+
+// enabled is true if any limit is set
+func (l *StorageLimits) enabled() bool {
+	return l.OvercommitRatio > 0 || l.ReservedBytes > 0 || len(l.NamespaceQuotas) > 0
+}
+
+// check returns a ResourceExhausted error if growing the volumes of the given namespace by
+// size bytes would exceed a limit, or if allocating the given number of bytes on disk would
+// leave less than the reserved space free.
+func (l *StorageLimits) check(usage *diskUsage, namespace string, size, allocate int64) error {
+
+	if l.ReservedBytes > 0 && usage.free-allocate < l.ReservedBytes {
+		return rest.NewError(codes.ResourceExhausted, fmt.Sprintf("%s: free space %s is within the reserved space %s",
+			vhd.ErrCapacityExhausted, common.FormatBytes(usage.free-allocate), common.FormatBytes(l.ReservedBytes)))
+	}
+
+	if limit := l.provisionLimit(usage); usage.provisioned+size > limit {
+		return rest.NewError(codes.ResourceExhausted, fmt.Sprintf("%s: provisioning %s would exceed the overcommit limit %s",
+			vhd.ErrCapacityExhausted, common.FormatBytes(size), common.FormatBytes(limit)))
+	}
+
+	if quota, ok := l.NamespaceQuotas[namespace]; ok && usage.namespaces[namespace]+size > quota {
+		return rest.NewError(codes.ResourceExhausted, fmt.Sprintf("%s: provisioning %s would exceed the quota %s of namespace %s",
+			vhd.ErrCapacityExhausted, common.FormatBytes(size), common.FormatBytes(quota), namespace))
+	}
+
+	return nil
+}
+
+// available returns the size of the largest volume that may be provisioned.
+func (l *StorageLimits) available(usage *diskUsage) int64 {
+
+	available := max(usage.free-l.ReservedBytes, 0)
+
+	if l.OvercommitRatio > 0 {
+		available = min(available, max(l.provisionLimit(usage)-usage.provisioned, 0))
+	}
+
+	return available
+}
+
+// provisionLimit returns the maximum total size of all volumes.
+func (l *StorageLimits) provisionLimit(usage *diskUsage) int64 {
+
+	if l.OvercommitRatio <= 0 {
+		return math.MaxInt64
+	}
+
+	return int64(l.OvercommitRatio * float64(usage.total-l.ReservedBytes))
+}
+
+// lockProvisioning takes the provisioning lock, returning the function that releases it.
+func (s *controllerServer) lockProvisioning() func() {
+
+	if s.provisioning == nil {
+		return func() {}
+	}
+
+	s.provisioning.Lock()
+	return s.provisioning.Unlock
+}
+
+// checkLimits checks that the volumes of the given namespace may grow by size bytes, and that
+// allocate bytes may be written to disk, without exceeding the storage limits.
+// The provisioning lock must be held.
+func (s *controllerServer) checkLimits(namespace string, size, allocate int64) error {
+
+	if s.provisioning == nil || !s.provisioning.limits.enabled() {
+		return nil
+	}
+
+	usage, err := s.diskUsage()
+	if err != nil {
+		return err
+	}
+
+	return s.provisioning.limits.check(usage, namespace, size, allocate)
+}
+
+// diskUsage measures the space used and provisioned in the PV store.
+func (s *controllerServer) diskUsage() (*diskUsage, error) {
+
+	total, free, err := win32.GetDiskSpace(s.PVStore)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get disk space of %s: %w", s.PVStore, err)
+	}
+
+	namespaces, err := s.readNamespaces()
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &diskUsage{
+		total:      total,
+		free:       free,
+		namespaces: map[string]int64{},
+	}
+
+	token := ""
+
+	for {
+		page, err := vhd.List(s.runner, s.PVStore, 0, token)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range page.VHDs {
+			usage.provisioned += v.Size
+
+			if ns, ok := namespaces[v.DiskIdentifier]; ok {
+				usage.namespaces[ns] += v.Size
+			}
+		}
+
+		if page.NextToken == "" {
+			return usage, nil
+		}
+
+		token = page.NextToken
+	}
+}
+
+// namespaceOf returns the namespace recorded for the given volume, if any.
+func (s *controllerServer) namespaceOf(vol *models.GetVHDResponse) (string, error) {
+
+	namespaces, err := s.readNamespaces()
+	if err != nil {
+		return "", err
+	}
+
+	return namespaces[vol.DiskIdentifier], nil
+}
+
+// recordNamespace records the namespace of the PVC for which the given volume was created,
+// or forgets it if namespace is empty. A failure is logged but not returned, as the volume
+// has already been created or deleted. The provisioning lock must be held.
+func (s *controllerServer) recordNamespace(log *logrus.Entry, volumeId, namespace string) {
+
+	if s.provisioning == nil {
+		return
+	}
+
+	if err := s.setNamespace(volumeId, namespace); err != nil {
+		log.WithError(err).Error(messages.CONTROLLER_RECORD_NAMESPACE_FAILED)
+	}
+}
+
+func (s *controllerServer) setNamespace(volumeId, namespace string) error {
+
+	namespaces, err := s.readNamespaces()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := namespaces[volumeId]; !ok && namespace == "" {
+		return nil
+	}
+
+	if namespace == "" {
+		delete(namespaces, volumeId)
+	} else {
+		namespaces[volumeId] = namespace
+	}
+
+	b, err := json.Marshal(namespaces)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.PVStore, namespacesFile)
+	tempPath := path + ".tmp"
+
+	if err := os.WriteFile(tempPath, b, 0600); err != nil {
+		return fmt.Errorf("cannot write %s: %w", tempPath, err)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("cannot write %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (s *controllerServer) readNamespaces() (map[string]string, error) {
+
+	path := filepath.Join(s.PVStore, namespacesFile)
+	namespaces := map[string]string{}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return namespaces, nil
+		}
+
+		return nil, fmt.Errorf("cannot read %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(b, &namespaces); err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", path, err)
+	}
+
+	return namespaces, nil
+}
@@ -0,0 +1,115 @@
+//go:build windows
+
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+)
+
+func (s *ControllerTestSuite) TestStorageLimits() {
+
+	usage := &diskUsage{
+		total:       100 * constants.GiB,
+		free:        60 * constants.GiB,
+		provisioned: 140 * constants.GiB,
+		namespaces: map[string]int64{
+			"team-a": 40 * constants.GiB,
+		},
+	}
+
+	limits := StorageLimits{
+		OvercommitRatio: 2,
+		ReservedBytes:   20 * constants.GiB,
+		NamespaceQuotas: map[string]int64{
+			"team-a": 50 * constants.GiB,
+		},
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		size      int64
+		allocate  int64
+		code      codes.Code
+	}{
+		{name: "within limits", namespace: "team-b", size: 10 * constants.GiB, code: codes.OK},
+		{name: "exceeds overcommit", namespace: "team-b", size: 21 * constants.GiB, code: codes.ResourceExhausted},
+		{name: "allocates reserved space", namespace: "team-b", size: constants.GiB, allocate: 50 * constants.GiB, code: codes.ResourceExhausted},
+		{name: "within namespace quota", namespace: "team-a", size: 10 * constants.GiB, code: codes.OK},
+		{name: "exceeds namespace quota", namespace: "team-a", size: 11 * constants.GiB, code: codes.ResourceExhausted},
+	}
+
+	for _, test := range tests {
+		s.Run(test.name, func() {
+			err := limits.check(usage, test.namespace, test.size, test.allocate)
+
+			if test.code == codes.OK {
+				s.Require().NoError(err)
+				return
+			}
+
+			restErr := &rest.Error{}
+			s.Require().ErrorAs(err, &restErr)
+			s.Require().Equal(test.code, restErr.Code)
+		})
+	}
+
+	s.Run("available is limited by overcommit", func() {
+		s.Require().Equal(int64(20*constants.GiB), limits.available(usage))
+	})
+
+	s.Run("available is limited by reservation", func() {
+		s.Require().Equal(int64(40*constants.GiB), (&StorageLimits{ReservedBytes: 20 * constants.GiB}).available(usage))
+	})
+}
+
+func (s *ControllerTestSuite) TestCreateExceedsNamespaceQuota() {
+
+	var (
+		volId = strings.ToUpper(uuid.NewString())
+		store = s.T().TempDir()
+	)
+
+	s.server.PVStore = store
+	s.server.provisioning = &provisioning{
+		limits: StorageLimits{
+			NamespaceQuotas: map[string]int64{"team-a": 15 * constants.MiB},
+		},
+	}
+
+	s.Require().NoError(s.server.setNamespace(volId, "team-a"))
+	s.Require().FileExists(filepath.Join(store, namespacesFile))
+
+	existing := &models.ListVHDResponse{
+		VHDs: []models.GetVHDResponse{
+			{
+				Name:           "pv1",
+				DiskIdentifier: volId,
+				Size:           10 * constants.MiB,
+			},
+		},
+	}
+
+	// Get existing volume
+	s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
+	// List volumes to measure usage
+	s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(existing), "", nil).Once()
+
+	_, err := s.server.CreateVolume("pv2", 10*constants.MiB, rest.CreateVolumeOptions{Namespace: "team-a"})
+
+	s.Require().Error(err)
+	restErr := &rest.Error{}
+	s.Require().ErrorAs(err, &restErr)
+	s.Require().Equal(codes.ResourceExhausted, restErr.Code)
+	s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_STORAGE_LIMIT))
+}
@@ -3,12 +3,18 @@
 package controller
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"math"
+	"mime"
 	"net/http"
 	"strconv"
 
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/constants"
 	"github.com/fireflycons/hypervcsi/internal/models/rest"
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc/codes"
@@ -19,6 +25,10 @@ import (
 // @Param			X-Api-Key	header	string	true	"API Key"
 // @Param			size		path	int		true	"Volume size"
 // @Param			name		path	string	true	"Volume name"
+// @Param			shared		query	bool	false	"Create a VHD Set that may be attached to several VMs"
+// @Param			template	query	string	false	"Name of a template VHD to create the volume from"
+// @Param			differencing	query	bool	false	"Create a differencing disk on the template rather than a copy"
+// @Param			namespace	query	string	false	"Namespace of the PVC, against whose quota the volume is counted"
 // @Schemes		http
 // @Description	Create a new VHD
 // @Tags			Disks
@@ -27,6 +37,7 @@ import (
 // @Success		201	{object}	rest.GetVolumeResponse
 // @Failure		400	{object}	rest.Error	"Invalid arguments"
 // @Failure		403	{object}	rest.Error	"Access denied"
+// @Failure		404	{object}	rest.Error	"Template not found"
 // @Failure		409	{object}	rest.Error
 // @Failure		500	{object}	rest.Error
 // @Router			/volume/{name}/size/{size} [post]
@@ -58,7 +69,30 @@ func (s *controllerServer) HandleCreateVolume(ctx *gin.Context) {
 		return
 	}
 
-	resp, err := s.CreateVolume(name, sizeBytes)
+	opts := rest.CreateVolumeOptions{}
+
+	if v := ctx.Query("shared"); v != "" {
+		opts.Shared, err = strconv.ParseBool(v)
+
+		if err != nil {
+			abortArgumentError(ctx, fmt.Errorf("invalid shared: %w", err))
+			return
+		}
+	}
+
+	opts.Template = ctx.Query("template")
+	opts.Namespace = ctx.Query("namespace")
+
+	if v := ctx.Query("differencing"); v != "" {
+		opts.Differencing, err = strconv.ParseBool(v)
+
+		if err != nil {
+			abortArgumentError(ctx, fmt.Errorf("invalid differencing: %w", err))
+			return
+		}
+	}
+
+	resp, err := s.CreateVolume(name, sizeBytes, opts)
 	processResponse(ctx, resp, http.StatusCreated, err)
 }
 
@@ -91,6 +125,34 @@ func (s *controllerServer) HandleGetVolume(ctx *gin.Context) {
 	processResponse(ctx, resp, http.StatusOK, err)
 }
 
+// @BasePath		/
+// @Summary		Get the status of a VHD
+// @Param			X-Api-Key	header	string	true	"API Key"
+// @Param			name		path	string	true	"Volume ID"
+// @Schemes		http
+// @Description	Get the attachment and health condition of a VHD
+// @Tags			Disks
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	rest.GetVolumeStatusResponse
+// @Failure		400	{object}	rest.Error	"Invalid arguments"
+// @Failure		403	{object}	rest.Error	"Access denied"
+// @Failure		404	{object}	rest.Error	"Not found"
+// @Failure		500	{object}	rest.Error
+// @Router			/volume/{name}/status [get]
+func (s *controllerServer) HandleGetVolumeStatus(ctx *gin.Context) {
+
+	volId := ctx.Param("name")
+
+	if volId == "" {
+		abortInvalidArgument(ctx, "missing volume ID")
+		return
+	}
+
+	resp, err := s.GetVolumeStatus(volId)
+	processResponse(ctx, resp, http.StatusOK, err)
+}
+
 // @BasePath		/
 // @Summary		Delete a VHD
 // @Param			X-Api-Key	header	string	true	"API Key"
@@ -197,17 +259,33 @@ func (s *controllerServer) HandleGetCapacity(ctx *gin.Context) {
 // @Schemes		http
 // @Param			nodeid	path	string	true	"Node ID"
 // @Param			volid	path	string	true	"Volume ID"
-// @Description	Attaches a volume to a node
+// @Param			readonly	query	bool	false	"Attach the volume read-only"
+// @Description	Attaches a volume to a node. A volume attached read-only may be attached to several nodes.
 // @Tags			Disks
 // @Accept			json
 // @Produce		json
 // @Success		204
+// @Failure		400	{object}	rest.Error	"Invalid arguments"
 // @Failure		403	{object}	rest.Error	"Access denied"
+// @Failure		409	{object}	rest.Error	"Already attached with a different read-only state"
+// @Failure		412	{object}	rest.Error	"Attached to another node"
 // @Failure		500	{object}	rest.Error
 // @Router			/attachment/{nodeid}/volume/{volid} [put]
 func (s *controllerServer) HandlePublishVolume(ctx *gin.Context) {
 
-	err := s.PublishVolume(ctx.Param("volid"), ctx.Param("nodeid"))
+	readOnly := false
+
+	if v := ctx.Query("readonly"); v != "" {
+		var err error
+		readOnly, err = strconv.ParseBool(v)
+
+		if err != nil {
+			abortArgumentError(ctx, fmt.Errorf("invalid readonly: %w", err))
+			return
+		}
+	}
+
+	err := s.PublishVolume(ctx.Param("volid"), ctx.Param("nodeid"), readOnly)
 	processResponse(ctx, nil, http.StatusNoContent, err)
 }
 
@@ -302,7 +380,8 @@ func (s *controllerServer) HandleHealthCheck(ctx *gin.Context) {
 	}
 
 	ctx.JSON(http.StatusOK, rest.HealthyResponse{
-		Status: "ok",
+		Status:  "ok",
+		Version: common.Version,
 	})
 }
 
@@ -324,11 +403,30 @@ func (s *controllerServer) HandleListVMs(ctx *gin.Context) {
 }
 
 // @BasePath		/
-// @Summary		Get Virtual Machine
+// @Summary		List template VHDs
 // @Schemes		http
 // @Param			X-Api-Key	header	string	true	"API Key"
-// @Param			nodeid		path	string	true	"Node ID"
-// @Description	Gets a VM by node ID
+// @Description	Lists the template VHDs from which volumes may be created
+// @Tags			Templates
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	rest.ListTemplatesResponse
+// @Failure		403	{object}	rest.Error	"Access denied"
+// @Failure		500	{object}	rest.Error
+// @Router			/templates [get]
+func (s *controllerServer) HandleListTemplates(ctx *gin.Context) {
+
+	templates, err := s.ListTemplates()
+	processResponse(ctx, templates, http.StatusOK, err)
+}
+
+// @BasePath		/
+// @Summary		Get Virtual Machine
+// @Schemes		http
+// @Param			X-Api-Key	header	string	true	"API Key or Node API Key"
+// @Param			id			query	string	false	"Node ID"
+// @Param			biosguid	query	string	false	"BIOS GUID, which the guest reads as its BIOS UUID"
+// @Description	Gets a VM by node ID, or by the BIOS GUID if no node ID is given
 // @Tags			Virtual Machines
 // @Accept			json
 // @Produce		json
@@ -340,7 +438,15 @@ func (s *controllerServer) HandleGetVM(ctx *gin.Context) {
 	nodeId := ctx.Query("id")
 
 	if nodeId == "" {
-		abortInvalidArgument(ctx, "missing node ID")
+		biosGuid := ctx.Query("biosguid")
+
+		if biosGuid == "" {
+			abortInvalidArgument(ctx, "missing node ID")
+			return
+		}
+
+		vm, err := s.GetVmByBIOSGUID(biosGuid)
+		processResponse(ctx, vm, http.StatusOK, err)
 		return
 	}
 
@@ -348,6 +454,239 @@ func (s *controllerServer) HandleGetVM(ctx *gin.Context) {
 	processResponse(ctx, vm, http.StatusOK, err)
 }
 
+// @BasePath		/
+// @Summary		List the attachments of a Virtual Machine
+// @Schemes		http
+// @Param			X-Api-Key	header	string	true	"API Key"
+// @Param			id			path	string	true	"Node ID"
+// @Description	Lists the disks attached to the SCSI controllers of a VM
+// @Tags			Virtual Machines
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	rest.ListVMAttachmentsResponse
+// @Failure		404	{object}	rest.Error	"VM not found"
+// @Failure		500	{object}	rest.Error
+// @Router			/vm/{id}/attachments [get]
+func (s *controllerServer) HandleListVMAttachments(ctx *gin.Context) {
+
+	attachments, err := s.ListVmAttachments(ctx.Param("id"))
+	processResponse(ctx, attachments, http.StatusOK, err)
+}
+
+// @BasePath		/
+// @Summary		Create an ephemeral volume
+// @Param			X-Api-Key	header	string	true	"API Key or Node API Key"
+// @Param			nodeid		path	string	true	"Node ID"
+// @Param			name		path	string	true	"Ephemeral volume handle"
+// @Param			size		path	int		true	"Volume size"
+// @Schemes		http
+// @Description	Creates a VHD for a CSI ephemeral inline volume and attaches it to a node
+// @Tags			Ephemeral
+// @Accept			json
+// @Produce		json
+// @Success		201	{object}	rest.GetVolumeResponse
+// @Failure		400	{object}	rest.Error	"Invalid arguments"
+// @Failure		403	{object}	rest.Error	"Access denied"
+// @Failure		409	{object}	rest.Error
+// @Failure		500	{object}	rest.Error
+// @Router			/ephemeral/{nodeid}/volume/{name}/size/{size} [put]
+func (s *controllerServer) HandleCreateEphemeralVolume(ctx *gin.Context) {
+
+	size := ctx.Param("size")
+
+	if size == "" {
+		abortInvalidArgument(ctx, "missing volume size")
+		return
+	}
+
+	sizeBytes, err := strconv.ParseInt(size, 10, 64)
+
+	if err != nil {
+		abortArgumentError(ctx, fmt.Errorf("invalid volume size: %w", err))
+		return
+	}
+
+	if sizeBytes < 0 {
+		abortInvalidArgument(ctx, "volume size cannot be negative")
+		return
+	}
+
+	if ctx.GetBool(NodeCallerKey) {
+		if err := s.checkNodeCaller(ctx.RemoteIP(), ctx.Param("nodeid")); err != nil {
+			processResponse(ctx, nil, http.StatusCreated, err)
+			return
+		}
+	}
+
+	resp, err := s.CreateEphemeralVolume(ctx.Param("name"), ctx.Param("nodeid"), sizeBytes)
+	processResponse(ctx, resp, http.StatusCreated, err)
+}
+
+// @BasePath		/
+// @Summary		Delete an ephemeral volume
+// @Param			X-Api-Key	header	string	true	"API Key or Node API Key"
+// @Param			nodeid		path	string	true	"Node ID"
+// @Param			name		path	string	true	"Ephemeral volume handle"
+// @Schemes		http
+// @Description	Detaches the VHD for a CSI ephemeral inline volume from a node and deletes it
+// @Tags			Ephemeral
+// @Accept			json
+// @Produce		json
+// @Success		204
+// @Failure		400	{object}	rest.Error	"Invalid arguments"
+// @Failure		403	{object}	rest.Error	"Access denied"
+// @Failure		500	{object}	rest.Error
+// @Router			/ephemeral/{nodeid}/volume/{name} [delete]
+func (s *controllerServer) HandleDeleteEphemeralVolume(ctx *gin.Context) {
+
+	if ctx.GetBool(NodeCallerKey) {
+		if err := s.checkNodeCaller(ctx.RemoteIP(), ctx.Param("nodeid")); err != nil {
+			processResponse(ctx, nil, http.StatusNoContent, err)
+			return
+		}
+	}
+
+	err := s.DeleteEphemeralVolume(ctx.Param("name"), ctx.Param("nodeid"))
+	processResponse(ctx, nil, http.StatusNoContent, err)
+}
+
+// @BasePath		/
+// @Summary		Export a VHD
+// @Param			X-Api-Key	header	string	true	"API Key"
+// @Param			Range		header	string	false	"Range of bytes to resume an interrupted export, e.g. bytes=1048576-"
+// @Param			name		path	string	true	"Volume ID"
+// @Schemes		http
+// @Description	Streams the VHDX of a volume, which must not be attached. The Repr-Digest header is the SHA-256 digest of the whole VHDX, and the ETag is its hex encoding, for use with If-Range.
+// @Tags			Disks
+// @Produce		octet-stream
+// @Success		200	{file}		file
+// @Success		206	{file}		file	"Range of the VHDX"
+// @Header			200,206	{string}	Repr-Digest	"SHA-256 digest of the whole VHDX (RFC 9530)"
+// @Failure		400	{object}	rest.Error	"Shared or differencing volume"
+// @Failure		403	{object}	rest.Error	"Access denied"
+// @Failure		404	{object}	rest.Error	"Not found"
+// @Failure		412	{object}	rest.Error	"Volume is attached"
+// @Failure		500	{object}	rest.Error
+// @Router			/volume/{name}/content [get]
+func (s *controllerServer) HandleExportVolume(ctx *gin.Context) {
+
+	volId := ctx.Param("name")
+
+	if volId == "" {
+		abortInvalidArgument(ctx, "missing volume ID")
+		return
+	}
+
+	content, err := s.ExportVolume(volId)
+
+	if err != nil {
+		processResponse(ctx, nil, http.StatusOK, err)
+		return
+	}
+
+	defer content.File.Close()
+
+	ctx.Header(constants.ReprDigestHeader, "sha-256=:"+base64.StdEncoding.EncodeToString(content.Digest)+":")
+	ctx.Header("ETag", `"`+hex.EncodeToString(content.Digest)+`"`)
+	ctx.Header("Content-Type", "application/octet-stream")
+	ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": content.FileName}))
+
+	// Serves ranges, so an interrupted export may be resumed
+	http.ServeContent(ctx.Writer, ctx.Request, content.FileName, content.ModTime, content.File)
+}
+
+// @BasePath		/
+// @Summary		Import a VHD
+// @Param			X-Api-Key	header	string	true	"API Key"
+// @Param			Content-Range	header	string	false	"Range of the VHDX in the body, e.g. bytes 0-1048575/10485760, or bytes */10485760 to query the progress of an upload"
+// @Param			name		path	string	true	"Volume name"
+// @Param			namespace	query	string	false	"Namespace against whose quota the volume is counted"
+// @Param			content		body	string	true	"VHDX content"
+// @Schemes		http
+// @Description	Uploads a VHDX as a new volume. The VHDX may be uploaded in one request, or in ranges with Content-Range. An upload from offset 0 starts afresh; otherwise it must resume from the number of bytes received, which 202 responses return. Once the whole VHDX is received it is checked with Test-VHD and given a new disk identifier, which is the ID of the volume.
+// @Tags			Disks
+// @Accept			octet-stream
+// @Produce		json
+// @Success		201	{object}	rest.GetVolumeResponse
+// @Success		202	{object}	rest.ImportVolumeProgress	"Part of the VHDX has been received"
+// @Failure		400	{object}	rest.Error	"Invalid arguments, not a valid VHDX, or not resuming from the bytes received"
+// @Failure		403	{object}	rest.Error	"Access denied"
+// @Failure		409	{object}	rest.Error	"Volume exists or is being imported"
+// @Failure		500	{object}	rest.Error
+// @Router			/volume/{name}/content [put]
+func (s *controllerServer) HandleImportVolume(ctx *gin.Context) {
+
+	// The route shares its wildcard with PUT /volume/:id/size/:size
+	name := ctx.Param("id")
+
+	if name == "" {
+		abortInvalidArgument(ctx, "missing volume name")
+		return
+	}
+
+	offset, length, size, err := parseContentRange(ctx.GetHeader("Content-Range"), ctx.Request.ContentLength)
+
+	if err != nil {
+		abortArgumentError(ctx, err)
+		return
+	}
+
+	var content io.Reader = ctx.Request.Body
+
+	if length < 0 {
+		// Query of the progress of an upload
+		length = 0
+		content = nil
+	}
+
+	vol, progress, err := s.ImportVolume(name, ctx.Query("namespace"), offset, length, size, content)
+
+	if progress != nil {
+		processResponse(ctx, progress, http.StatusAccepted, err)
+		return
+	}
+
+	processResponse(ctx, vol, http.StatusCreated, err)
+}
+
+// @BasePath		/
+// @Summary		Adopt an existing VHDX as a volume
+// @Param			X-Api-Key	header	string	true	"API Key"
+// @Param			name		path	string	true	"Volume name"
+// @Param			path		query	string	true	"Absolute path of the VHDX on the Hyper-V host"
+// @Param			namespace	query	string	false	"Namespace against whose quota the volume is counted"
+// @Schemes		http
+// @Description	Moves a VHDX which is not in the PV store, e.g. a disk of an older VM, into the store as a volume, renaming it name;id.vhdx. The disk identifier becomes the volume ID, unless a volume already has it, in which case the disk is given a new one. The VHDX must pass Test-VHD, must not be a differencing disk and must not be in use.
+// @Tags			Disks
+// @Produce		json
+// @Success		201	{object}	rest.GetVolumeResponse
+// @Failure		400	{object}	rest.Error	"Invalid arguments, or not a valid VHDX"
+// @Failure		403	{object}	rest.Error	"Access denied"
+// @Failure		404	{object}	rest.Error	"VHDX not found"
+// @Failure		409	{object}	rest.Error	"Volume exists"
+// @Failure		412	{object}	rest.Error	"VHDX is in use"
+// @Failure		500	{object}	rest.Error
+// @Router			/volume/{name}/adopt [post]
+func (s *controllerServer) HandleAdoptVolume(ctx *gin.Context) {
+
+	name := ctx.Param("name")
+
+	if name == "" {
+		abortInvalidArgument(ctx, "missing volume name")
+		return
+	}
+
+	path := ctx.Query("path")
+
+	if path == "" {
+		abortInvalidArgument(ctx, "missing path of VHDX")
+		return
+	}
+
+	resp, err := s.AdoptVolume(name, path, ctx.Query("namespace"))
+	processResponse(ctx, resp, http.StatusCreated, err)
+}
+
 func processResponse(ctx *gin.Context, response any, okStatus int, err error) {
 
 	if err != nil {
@@ -4,10 +4,12 @@ package controller
 
 import (
 	"errors"
+	"io"
+	"path/filepath"
 	"slices"
+	"sync"
 
 	"github.com/fireflycons/hypervcsi/internal/constants"
-	"github.com/fireflycons/hypervcsi/internal/models"
 	"github.com/fireflycons/hypervcsi/internal/models/rest"
 	"github.com/fireflycons/hypervcsi/internal/windows/powershell"
 	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
@@ -23,22 +25,32 @@ type ControllerServer interface {
 	/*
 		API methods
 	*/
-	CreateVolume(name string, size int64) (*rest.GetVolumeResponse, error)
+	CreateVolume(name string, size int64, opts rest.CreateVolumeOptions) (*rest.GetVolumeResponse, error)
 	DeleteVolume(volId string) error
 	GetCapacity() (*rest.GetCapacityResponse, error)
-	ListVolumes(maxEntries int32, nextToken string) (*models.ListVHDResponse, error)
+	ListVolumes(maxEntries int32, nextToken string) (*rest.ListVolumesResponse, error)
 	GetVolume(name string) (*rest.GetVolumeResponse, error)
+	GetVolumeStatus(volumeId string) (*rest.GetVolumeStatusResponse, error)
 	ListVms() (*rest.ListVMResponse, error)
 	GetVm(nodeID string) (*rest.GetVMResponse, error)
-	PublishVolume(volumeId, nodeId string) error
+	GetVmByBIOSGUID(biosGuid string) (*rest.GetVMResponse, error)
+	ListVmAttachments(nodeID string) (*rest.ListVMAttachmentsResponse, error)
+	PublishVolume(volumeId, nodeId string, readOnly bool) error
 	UnpublishVolume(volumeId, nodeId string) error
 	ExpandVolume(volumeId string, size int64) (*rest.ExpandVolumeResponse, error)
+	CreateEphemeralVolume(name, nodeId string, size int64) (*rest.GetVolumeResponse, error)
+	DeleteEphemeralVolume(name, nodeId string) error
+	ListTemplates() (*rest.ListTemplatesResponse, error)
+	ExportVolume(volumeId string) (*VolumeContent, error)
+	ImportVolume(name, namespace string, offset, length, size int64, content io.Reader) (*rest.GetVolumeResponse, *rest.ImportVolumeProgress, error)
+	AdoptVolume(name, path, namespace string) (*rest.GetVolumeResponse, error)
 
 	/*
 		GIN routes
 	*/
 	HandleCreateVolume(*gin.Context)
 	HandleGetVolume(*gin.Context)
+	HandleGetVolumeStatus(*gin.Context)
 	HandleDeleteVolume(*gin.Context)
 	HandleListVolumes(*gin.Context)
 	HandleGetCapacity(*gin.Context)
@@ -48,6 +60,13 @@ type ControllerServer interface {
 	HandleHealthCheck(*gin.Context)
 	HandleListVMs(*gin.Context)
 	HandleGetVM(*gin.Context)
+	HandleListVMAttachments(*gin.Context)
+	HandleCreateEphemeralVolume(*gin.Context)
+	HandleDeleteEphemeralVolume(*gin.Context)
+	HandleListTemplates(*gin.Context)
+	HandleExportVolume(*gin.Context)
+	HandleImportVolume(*gin.Context)
+	HandleAdoptVolume(*gin.Context)
 
 	Logger() *logrus.Logger
 	Close()
@@ -60,17 +79,32 @@ type controllerServer struct {
 	// Path to directory containing VHDs
 	PVStore string
 
+	// Path to directory containing template VHDs
+	TemplateStore string
+
+	// Enforces storage limits. May be nil in which case there are no limits.
+	provisioning *provisioning
+
 	// If this is non-nil then there was an error intitializing
 	// the PV storage. All calls to the interface should return an error
 	Err error
 
 	runner powershell.Runner
 
+	// Serialises publishing and unpublishing of each disk
+	attachLocks diskLocks
+
+	// Digests of exported VHDX files by path
+	digests sync.Map
+
+	// Names of the volumes being imported
+	imports sync.Map
+
 	log *logrus.Logger
 }
 
 // NewController creates a new instance of the controller server
-func NewController(logger *logrus.Logger, pvstore string) (*controllerServer, error) {
+func NewController(logger *logrus.Logger, pvstore, templateStore string, limits StorageLimits) (*controllerServer, error) {
 
 	runner, err := powershell.NewRunner(powershell.WithModules(constants.PowerShellModule))
 
@@ -89,23 +123,30 @@ func NewController(logger *logrus.Logger, pvstore string) (*controllerServer, er
 		}
 	}
 
+	if templateStore == "" {
+		templateStore = filepath.Join(pvstore, constants.TemplatesDirectory)
+	}
+
 	logger.WithField("store", pvstore).Info("Selected PV store directory")
+	logger.WithField("templates", templateStore).Info("Selected template directory")
 	return &controllerServer{
-		PVStore: pvstore,
-		log:     logger,
-		runner:  runner,
-		Err:     err,
+		PVStore:       pvstore,
+		TemplateStore: templateStore,
+		provisioning:  &provisioning{limits: limits},
+		log:           logger,
+		runner:        runner,
+		Err:           err,
 	}, nil
 }
 
 // Close releases any resources associated with the controller server
-func (s controllerServer) Close() {
+func (s *controllerServer) Close() {
 	if s.runner != nil {
 		s.runner.Exit()
 	}
 }
 
-func (s controllerServer) Logger() *logrus.Logger {
+func (s *controllerServer) Logger() *logrus.Logger {
 	return s.log
 }
 
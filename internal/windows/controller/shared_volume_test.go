@@ -0,0 +1,110 @@
+//go:build windows
+
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+)
+
+func (s *ControllerTestSuite) TestSharedVolume() {
+
+	var (
+		volId = strings.ToUpper(uuid.NewString())
+		node1 = uuid.NewString()
+		node2 = uuid.NewString()
+		store = s.T().TempDir()
+		path  = filepath.Join(store, "pv1;"+volId+".vhds")
+	)
+
+	s.server.PVStore = store
+	s.Require().NoError(os.WriteFile(path, []byte{}, 0600))
+
+	vhdSet := &models.GetVHDResponse{
+		Path:           path,
+		DiskIdentifier: volId,
+		Size:           10 * constants.MiB,
+	}
+
+	drives := []models.AttachedDrive{
+		{VMID: node1, Path: path, SupportPersistentReservations: true},
+		{VMID: node2, Path: path, SupportPersistentReservations: true},
+	}
+
+	s.Run("publishes to a second node", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(vhdSet), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(drives[0]), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(drives[1]), "", nil).Once()
+
+		err := s.server.PublishVolume(volId, node2, false)
+
+		s.Require().NoError(err)
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_VOLUME_PUBLISHED))
+	})
+
+	s.Run("publish is idempotent", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(vhdSet), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(drives), "", nil).Once()
+
+		err := s.server.PublishVolume(volId, node2, false)
+
+		s.Require().NoError(err)
+	})
+
+	s.Run("cannot publish read-only", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(vhdSet), "", nil).Once()
+
+		err := s.server.PublishVolume(volId, node2, true)
+
+		s.Require().Error(err)
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.InvalidArgument, restErr.Code)
+	})
+
+	s.Run("status lists all attachments", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(vhdSet), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(drives), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("true", "", nil).Once()
+
+		resp, err := s.server.GetVolumeStatus(volId)
+
+		s.Require().NoError(err)
+		s.Require().Equal("pv1", resp.Name)
+		s.Require().Equal([]rest.Attachment{
+			{NodeID: node1},
+			{NodeID: node2},
+		}, resp.Attachments)
+	})
+
+	s.Run("create with different shared setting fails", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(vhdSet), "", nil).Once()
+
+		_, err := s.server.CreateVolume("pv1", vhdSet.Size, rest.CreateVolumeOptions{})
+
+		s.Require().Error(err)
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.AlreadyExists, restErr.Code)
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_VOLUME_EXISTS_SHARED))
+	})
+
+	s.Run("create is idempotent", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(vhdSet), "", nil).Once()
+
+		resp, err := s.server.CreateVolume("pv1", vhdSet.Size, rest.CreateVolumeOptions{Shared: true})
+
+		s.Require().NoError(err)
+		s.Require().True(resp.Shared)
+		s.Require().Equal(volId, resp.ID)
+	})
+}
@@ -0,0 +1,144 @@
+//go:build windows
+
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+)
+
+func (s *ControllerTestSuite) TestTemplates() {
+
+	var (
+		volId     = strings.ToUpper(uuid.NewString())
+		templates = s.T().TempDir()
+		store     = s.T().TempDir()
+		tplPath   = filepath.Join(templates, "fixtures.vhdx")
+	)
+
+	s.server.PVStore = store
+	s.server.TemplateStore = templates
+	s.Require().NoError(os.WriteFile(tplPath, []byte("template"), 0600))
+
+	template := &models.GetVHDResponse{
+		Path:           tplPath,
+		DiskIdentifier: constants.ZeroUUID,
+		Size:           10 * constants.MiB,
+		FileSize:       4 * constants.MiB,
+	}
+
+	s.Run("lists templates", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(template), "", nil).Once()
+
+		resp, err := s.server.ListTemplates()
+
+		s.Require().NoError(err)
+		s.Require().Equal([]rest.Template{
+			{Name: "fixtures", Size: template.Size, FileSize: template.FileSize},
+		}, resp.Templates)
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_TEMPLATES_LISTED))
+	})
+
+	s.Run("creates a copy of the template", func() {
+		created := &models.GetVHDResponse{
+			DiskIdentifier: volId,
+			Size:           20 * constants.MiB,
+		}
+
+		// Get template
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(template), "", nil).Once()
+		// Get existing volume
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
+		// Get capacity
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(models.GetCapacityResponse{FreeSpaceBytes: constants.GiB}), "", nil).Once()
+		// Reset disk identifier, resize, get new disk
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Twice()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(created), "", nil).Once()
+		// Check the name is still free
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
+
+		resp, err := s.server.CreateVolume("pv1", created.Size, rest.CreateVolumeOptions{Template: "fixtures"})
+
+		s.Require().NoError(err)
+		s.Require().Equal(&rest.GetVolumeResponse{Name: "pv1", ID: volId, Size: created.Size}, resp)
+		s.Require().FileExists(filepath.Join(store, "pv1;"+volId+".vhdx"))
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_VOLUME_CREATED))
+	})
+
+	s.Run("name taken while copying the template", func() {
+		created := &models.GetVHDResponse{
+			DiskIdentifier: strings.ToUpper(uuid.NewString()),
+			Size:           template.Size,
+		}
+
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(template), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(models.GetCapacityResponse{FreeSpaceBytes: constants.GiB}), "", nil).Once()
+		// Reset disk identifier, get new disk
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(created), "", nil).Once()
+		// Another request has created the volume
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(&models.GetVHDResponse{Name: "pv2", DiskIdentifier: volId}), "", nil).Once()
+
+		_, err := s.server.CreateVolume("pv2", template.Size, rest.CreateVolumeOptions{Template: "fixtures"})
+
+		s.Require().Error(err)
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.AlreadyExists, restErr.Code)
+
+		staged, err := os.ReadDir(filepath.Join(store, ".creating"))
+		s.Require().NoError(err)
+		s.Require().Empty(staged)
+	})
+
+	s.Run("copy fails when storage is full", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(template), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(models.GetCapacityResponse{FreeSpaceBytes: constants.MiB}), "", nil).Once()
+
+		_, err := s.server.CreateVolume("pv2", template.Size, rest.CreateVolumeOptions{Template: "fixtures"})
+
+		s.Require().Error(err)
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.ResourceExhausted, restErr.Code)
+	})
+
+	s.Run("unknown template is not found", func() {
+		_, err := s.server.CreateVolume("pv3", template.Size, rest.CreateVolumeOptions{Template: "missing"})
+
+		s.Require().Error(err)
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.NotFound, restErr.Code)
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_TEMPLATE_NOT_FOUND))
+	})
+
+	s.Run("template name cannot leave the template directory", func() {
+		_, err := s.server.CreateVolume("pv4", template.Size, rest.CreateVolumeOptions{Template: "..\\fixtures"})
+
+		s.Require().Error(err)
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.InvalidArgument, restErr.Code)
+	})
+
+	s.Run("shared volume cannot use a template", func() {
+		_, err := s.server.CreateVolume("pv5", template.Size, rest.CreateVolumeOptions{Template: "fixtures", Shared: true})
+
+		s.Require().Error(err)
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.InvalidArgument, restErr.Code)
+	})
+}
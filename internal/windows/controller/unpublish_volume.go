@@ -18,6 +18,8 @@ func (s *controllerServer) UnpublishVolume(volumeId, nodeId string) error {
 
 	log.Info(messages.CONTROLLER_UNPUBLISH_VOLUME)
 
+	defer s.attachLocks.lock(volumeId)()
+
 	err := vhd.Detach(s.runner, s.PVStore, volumeId, nodeId)
 
 	if err != nil {
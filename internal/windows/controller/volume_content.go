@@ -0,0 +1,414 @@
+//go:build windows
+
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fireflycons/hypervcsi/internal/common"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+)
+
+// abandonedImportAge is how long an upload may go without being resumed before its partial VHDX is removed
+const abandonedImportAge = 24 * time.Hour
+
+// VolumeContent is the VHDX of a volume being exported
+type VolumeContent struct {
+
+	// File is the open VHDX, which the caller must close
+	File *os.File
+
+	// FileName is the name of the VHDX file for the client to save it as
+	FileName string
+
+	// ModTime is when the VHDX was last written
+	ModTime time.Time
+
+	// Digest is the SHA-256 digest of the whole VHDX
+	Digest []byte
+}
+
+// contentDigest is the digest of a VHDX, which is valid while its size and modification time are unchanged
+type contentDigest struct {
+	size    int64
+	modTime time.Time
+	sum     []byte
+}
+
+// ExportVolume opens the VHDX of a volume for streaming. The volume must not be attached, so that its
+// content is not changing, and it must be a plain VHDX: neither a VHD Set nor a differencing disk.
+func (s *controllerServer) ExportVolume(volumeId string) (*VolumeContent, error) {
+
+	log := s.log.WithFields(logrus.Fields{
+		"volume_id": volumeId,
+		"method":    "export_volume",
+	})
+
+	log.Info(messages.CONTROLLER_EXPORT_VOLUME)
+
+	vol, err := vhd.GetByID(s.runner, s.PVStore, volumeId)
+
+	if err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_EXPORT_VOLUME_FAILED, codes.NotFound)
+	}
+
+	if vol.Shared {
+		return nil, rest.NewError(codes.InvalidArgument, "a shared volume cannot be exported")
+	}
+
+	if vol.ParentPath != "" {
+		return nil, rest.NewError(codes.InvalidArgument, "a differencing volume cannot be exported")
+	}
+
+	attachments, err := s.volumeAttachments(vol)
+
+	if err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_EXPORT_VOLUME_FAILED)
+	}
+
+	if len(attachments) > 0 {
+		return nil, rest.NewError(codes.FailedPrecondition, fmt.Sprintf("volume %s is attached to %s and must be detached to be exported", volumeId, attachments[0].NodeID))
+	}
+
+	if vol.Attached {
+		return nil, rest.NewError(codes.FailedPrecondition, fmt.Sprintf("volume %s is in use and must be detached to be exported", volumeId))
+	}
+
+	f, err := os.Open(vol.Path)
+
+	if err != nil {
+		return nil, s.processError(err, log, messages.CONTROLLER_EXPORT_VOLUME_FAILED)
+	}
+
+	info, err := f.Stat()
+
+	if err == nil {
+		var sum []byte
+
+		if sum, err = s.contentDigest(f, info); err == nil {
+			log.WithField("size", common.FormatBytes(info.Size())).Info(messages.CONTROLLER_VOLUME_EXPORTING)
+
+			return &VolumeContent{
+				File:     f,
+				FileName: vol.Name + filepath.Ext(vol.Path),
+				ModTime:  info.ModTime(),
+				Digest:   sum,
+			}, nil
+		}
+	}
+
+	_ = f.Close()
+	return nil, s.processError(err, log, messages.CONTROLLER_EXPORT_VOLUME_FAILED)
+}
+
+// contentDigest returns the SHA-256 digest of the given open VHDX, leaving it positioned at the start.
+// Digests are remembered, so that an export which is resumed does not read the whole VHDX again.
+func (s *controllerServer) contentDigest(f *os.File, info os.FileInfo) ([]byte, error) {
+
+	if v, ok := s.digests.Load(f.Name()); ok {
+		if d := v.(*contentDigest); d.size == info.Size() && d.modTime.Equal(info.ModTime()) {
+			return d.sum, nil
+		}
+	}
+
+	h := sha256.New()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", f.Name(), err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	d := &contentDigest{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		sum:     h.Sum(nil),
+	}
+
+	s.digests.Store(f.Name(), d)
+
+	return d.sum, nil
+}
+
+// ImportVolume receives the bytes from offset to offset+length of the VHDX of a new volume of the given
+// name, whose whole size is given. An upload from offset zero starts afresh; otherwise it must resume
+// from where the previous upload stopped, which a nil content queries. When the whole VHDX has been
+// received it is validated and becomes the volume, which is returned. Until then the progress is returned.
+func (s *controllerServer) ImportVolume(name, namespace string, offset, length, size int64, content io.Reader) (*rest.GetVolumeResponse, *rest.ImportVolumeProgress, error) {
+
+	log := s.log.WithFields(logrus.Fields{
+		"volume_name": name,
+		"namespace":   namespace,
+		"offset":      offset,
+		"size":        size,
+		"method":      "import_volume",
+	})
+
+	log.Info(messages.CONTROLLER_IMPORT_VOLUME)
+
+	if err := vhd.ValidateVolumeName(name); err != nil {
+		return nil, nil, err
+	}
+
+	if size <= 0 || offset < 0 || length < 0 || offset+length > size {
+		return nil, nil, rest.NewError(codes.InvalidArgument, fmt.Sprintf("invalid range of %d bytes from %d of VHDX of size %d", length, offset, size))
+	}
+
+	// Two uploads of the same volume would write over each other
+	if _, busy := s.imports.LoadOrStore(name, struct{}{}); busy {
+		return nil, nil, rest.NewError(codes.AlreadyExists, fmt.Sprintf("volume %s is already being imported", name))
+	}
+
+	defer s.imports.Delete(name)
+
+	s.removeAbandonedImports(log)
+
+	if err := s.checkNotExists(name); err != nil {
+		return nil, nil, s.processError(err, log, messages.CONTROLLER_IMPORT_VOLUME_FAILED, codes.AlreadyExists)
+	}
+
+	partial := vhd.PartialPath(s.PVStore, name)
+
+	received, err := s.receive(partial, offset, length, size, content)
+
+	if err != nil {
+		return nil, nil, s.processError(err, log, messages.CONTROLLER_IMPORT_VOLUME_FAILED, codes.OutOfRange)
+	}
+
+	if received < size {
+		log.WithField("received", received).Info(messages.CONTROLLER_IMPORT_INCOMPLETE)
+
+		return nil, &rest.ImportVolumeProgress{
+			Received: received,
+			Size:     size,
+		}, nil
+	}
+
+	unlock := s.lockProvisioning()
+	defer unlock()
+
+	if err := s.checkNotExists(name); err != nil {
+		return nil, nil, s.processError(err, log, messages.CONTROLLER_IMPORT_VOLUME_FAILED, codes.AlreadyExists)
+	}
+
+	vol, err := vhd.Import(s.runner, name, s.PVStore, partial)
+
+	if err != nil {
+		return nil, nil, s.processError(err, log, messages.CONTROLLER_IMPORT_VOLUME_FAILED)
+	}
+
+	if err := s.checkImportLimits(namespace, vol.Size); err != nil {
+		if delErr := vhd.Delete(s.runner, s.PVStore, vol.DiskIdentifier); delErr != nil {
+			log.WithError(delErr).Error(messages.CONTROLLER_VOLUME_DELETE_FAILED)
+		}
+
+		return nil, nil, s.processError(err, log, messages.CONTROLLER_STORAGE_LIMIT)
+	}
+
+	if namespace != "" {
+		s.recordNamespace(log, vol.DiskIdentifier, namespace)
+	}
+
+	resp := &rest.GetVolumeResponse{
+		Name: vol.Name,
+		ID:   vol.DiskIdentifier,
+		Size: vol.Size,
+	}
+
+	log.WithField("response", resp).Info(messages.CONTROLLER_VOLUME_IMPORTED)
+
+	return resp, nil, nil
+}
+
+// removeAbandonedImports deletes the partial VHDX of uploads which have not been resumed within
+// abandonedImportAge, other than those being received now, so that they do not fill the PV store.
+func (s *controllerServer) removeAbandonedImports(log *logrus.Entry) {
+
+	names, err := vhd.AbandonedImports(s.PVStore, abandonedImportAge)
+	if err != nil {
+		log.WithError(err).Warn("cannot find abandoned uploads")
+		return
+	}
+
+	for _, name := range names {
+		if _, busy := s.imports.LoadOrStore(name, struct{}{}); busy {
+			continue
+		}
+
+		if err := os.Remove(vhd.PartialPath(s.PVStore, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.WithError(err).WithField("abandoned_name", name).Warn("cannot remove abandoned upload")
+		} else {
+			log.WithField("abandoned_name", name).Info(messages.CONTROLLER_IMPORT_ABANDONED)
+		}
+
+		s.imports.Delete(name)
+	}
+}
+
+// receive writes content to the partial VHDX at the given offset, returning how much of the VHDX has been
+// received. An upload from offset zero is checked to be a VHDX that fits in the PV store before it is written.
+func (s *controllerServer) receive(partial string, offset, length, size int64, content io.Reader) (int64, error) {
+
+	received := int64(0)
+
+	if info, err := os.Stat(partial); err == nil {
+		received = info.Size()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	if content == nil {
+		return received, nil
+	}
+
+	if offset != 0 && offset != received {
+		return received, rest.NewError(codes.OutOfRange, fmt.Sprintf("upload must resume from offset %d", received))
+	}
+
+	flag := os.O_WRONLY | os.O_APPEND
+
+	if offset == 0 {
+		signature := make([]byte, len(vhd.VHDXSignature))
+
+		if _, err := io.ReadFull(content, signature); err != nil || string(signature) != vhd.VHDXSignature {
+			return 0, rest.NewError(codes.InvalidArgument, "content is not a VHDX file")
+		}
+
+		content = io.MultiReader(bytes.NewReader(signature), content)
+
+		if err := s.checkImportCapacity(size); err != nil {
+			return 0, err
+		}
+
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(partial, flag, 0600)
+
+	if err != nil {
+		return 0, fmt.Errorf("cannot open %s: %w", partial, err)
+	}
+
+	// What has been written before an error is kept, so the upload may be resumed
+	n, err := io.Copy(f, io.LimitReader(content, length))
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil && n < length {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return offset + n, fmt.Errorf("upload interrupted after %d bytes: %w", offset+n, err)
+	}
+
+	return offset + n, nil
+}
+
+// checkImportCapacity checks that there is room in the PV store for a VHDX of the given size
+func (s *controllerServer) checkImportCapacity(size int64) error {
+
+	free, err := vhd.GetCapacity(s.runner, s.PVStore)
+
+	if err != nil {
+		return err
+	}
+
+	if free < size {
+		return rest.NewError(codes.ResourceExhausted, fmt.Sprintf("%s: VHDX needs %d bytes", vhd.ErrCapacityExhausted, size))
+	}
+
+	unlock := s.lockProvisioning()
+	defer unlock()
+
+	return s.checkLimits("", 0, size)
+}
+
+// checkImportLimits checks that a volume of the given size which has been imported into the PV store does
+// not exceed the storage limits. The volume is already counted in the provisioned size of the store, but
+// not in that of its namespace. The provisioning lock must be held.
+func (s *controllerServer) checkImportLimits(namespace string, size int64) error {
+
+	if s.provisioning == nil || !s.provisioning.limits.enabled() {
+		return nil
+	}
+
+	usage, err := s.diskUsage()
+
+	if err != nil {
+		return err
+	}
+
+	usage.provisioned -= size
+
+	return s.provisioning.limits.check(usage, namespace, size, 0)
+}
+
+// contentRangeRx matches the Content-Range header of an upload, or of a query of its progress
+var contentRangeRx = regexp.MustCompile(`^bytes (?:(\d+)-(\d+)|\*)/(\d+)$`)
+
+// parseContentRange parses the Content-Range header of an upload into the offset and length of the
+// range and the size of the whole VHDX. A missing header is an upload of the whole VHDX in one request.
+// A header of the form "bytes */size" queries the progress of an upload, which returns a negative length.
+func parseContentRange(header string, contentLength int64) (offset, length, size int64, err error) {
+
+	if header == "" {
+		if contentLength < 0 {
+			return 0, 0, 0, errors.New("the Content-Length or Content-Range header must be given")
+		}
+
+		return 0, contentLength, contentLength, nil
+	}
+
+	m := contentRangeRx.FindStringSubmatch(strings.TrimSpace(header))
+
+	if m == nil {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", header)
+	}
+
+	if size, err = strconv.ParseInt(m[3], 10, 64); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q: %w", header, err)
+	}
+
+	if m[1] == "" {
+		return 0, -1, size, nil
+	}
+
+	offset, err = strconv.ParseInt(m[1], 10, 64)
+
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q: %w", header, err)
+	}
+
+	end, err := strconv.ParseInt(m[2], 10, 64)
+
+	if err != nil || end < offset || end >= size {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", header)
+	}
+
+	length = end - offset + 1
+
+	if contentLength >= 0 && contentLength != length {
+		return 0, 0, 0, fmt.Errorf("content length %d does not match Content-Range %q", contentLength, header)
+	}
+
+	return offset, length, size, nil
+}
@@ -0,0 +1,229 @@
+//go:build windows
+
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/messages"
+	"github.com/fireflycons/hypervcsi/internal/windows/vhd"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+)
+
+func (s *ControllerTestSuite) TestExportVolume() {
+
+	volId := uuid.NewString()
+	data := []byte(vhd.VHDXSignature + strings.Repeat("x", 1024))
+
+	s.server.PVStore = s.T().TempDir()
+	path := filepath.Join(s.server.PVStore, "pv1;"+volId+".vhdx")
+	s.Require().NoError(os.WriteFile(path, data, 0600))
+
+	disk := &models.GetVHDResponse{
+		Path:           path,
+		Name:           "pv1",
+		DiskIdentifier: volId,
+		Size:           10 * constants.MiB,
+	}
+
+	sum := sha256.Sum256(data)
+
+	s.Run("detached", func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+
+		content, err := s.server.ExportVolume(volId)
+		s.Require().NoError(err)
+
+		defer content.File.Close()
+
+		s.Require().Equal("pv1.vhdx", content.FileName)
+		s.Require().Equal(sum[:], content.Digest)
+
+		b, err := io.ReadAll(content.File)
+		s.Require().NoError(err)
+		s.Require().Equal(data, b)
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_VOLUME_EXPORTING))
+	})
+
+	s.Run("attached to a running VM", func() {
+		running := *disk
+		running.Attached = true
+
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(&running), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+
+		_, err := s.server.ExportVolume(volId)
+
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.FailedPrecondition, restErr.Code)
+	})
+
+	s.Run("attached", func() {
+		drives := []models.AttachedDrive{
+			{VMID: uuid.NewString(), Path: path},
+		}
+
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(drives), "", nil).Once()
+
+		_, err := s.server.ExportVolume(volId)
+
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.FailedPrecondition, restErr.Code)
+	})
+}
+
+func (s *ControllerTestSuite) TestImportVolume() {
+
+	const size = 32
+
+	s.server.PVStore = s.T().TempDir()
+	data := []byte(vhd.VHDXSignature + strings.Repeat("x", size-len(vhd.VHDXSignature)))
+
+	notFound := func() {
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "NOT_FOUND : ", os.ErrNotExist).Once()
+	}
+
+	s.Run("not a VHDX", func() {
+		notFound()
+
+		_, _, err := s.server.ImportVolume("pv1", "", 0, size, size, bytes.NewReader(make([]byte, size)))
+
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.InvalidArgument, restErr.Code)
+	})
+
+	s.Run("first part", func() {
+		notFound()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(&models.GetCapacityResponse{FreeSpaceBytes: constants.GiB}), "", nil).Once()
+
+		vol, progress, err := s.server.ImportVolume("pv1", "", 0, 16, size, bytes.NewReader(data[:16]))
+
+		s.Require().NoError(err)
+		s.Require().Nil(vol)
+		s.Require().Equal(&rest.ImportVolumeProgress{Received: 16, Size: size}, progress)
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_IMPORT_INCOMPLETE))
+	})
+
+	s.Run("resume from wrong offset", func() {
+		notFound()
+
+		_, _, err := s.server.ImportVolume("pv1", "", 8, 24, size, bytes.NewReader(data[8:]))
+
+		restErr := &rest.Error{}
+		s.Require().ErrorAs(err, &restErr)
+		s.Require().Equal(codes.OutOfRange, restErr.Code)
+	})
+
+	s.Run("query progress", func() {
+		notFound()
+
+		_, progress, err := s.server.ImportVolume("pv1", "", 0, 0, size, nil)
+
+		s.Require().NoError(err)
+		s.Require().Equal(int64(16), progress.Received)
+	})
+
+	s.Run("complete", func() {
+		volId := uuid.NewString()
+
+		disk := &models.GetVHDResponse{
+			Name:           "pv1",
+			DiskIdentifier: volId,
+			Size:           10 * constants.MiB,
+		}
+
+		notFound()
+		notFound()
+		s.shell.EXPECT().Execute(mock.Anything).Return("true", "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return("", "", nil).Once()
+		s.shell.EXPECT().Execute(mock.Anything).Return(s.JSON(disk), "", nil).Once()
+
+		vol, progress, err := s.server.ImportVolume("pv1", "", 16, 16, size, bytes.NewReader(data[16:]))
+
+		s.Require().NoError(err)
+		s.Require().Nil(progress)
+		s.Require().Equal(&rest.GetVolumeResponse{Name: "pv1", ID: volId, Size: 10 * constants.MiB}, vol)
+
+		b, err := os.ReadFile(filepath.Join(s.server.PVStore, "pv1;"+volId+".vhdx"))
+		s.Require().NoError(err)
+		s.Require().Equal(data, b)
+		s.Require().NoFileExists(vhd.PartialPath(s.server.PVStore, "pv1"))
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_VOLUME_IMPORTED))
+	})
+
+	s.Run("abandoned uploads are removed", func() {
+		abandoned := vhd.PartialPath(s.server.PVStore, "abandoned")
+		recent := vhd.PartialPath(s.server.PVStore, "recent")
+
+		for _, path := range []string{abandoned, recent} {
+			s.Require().NoError(os.WriteFile(path, data[:16], 0600))
+		}
+
+		old := time.Now().Add(-2 * abandonedImportAge)
+		s.Require().NoError(os.Chtimes(abandoned, old, old))
+
+		notFound()
+
+		_, _, err := s.server.ImportVolume("pv2", "", 0, 0, size, nil)
+
+		s.Require().NoError(err)
+		s.Require().NoFileExists(abandoned)
+		s.Require().FileExists(recent)
+		s.Require().True(s.logBuffer.ContainsMessage(messages.CONTROLLER_IMPORT_ABANDONED))
+	})
+}
+
+func (s *ControllerTestSuite) TestParseContentRange() {
+
+	tests := []struct {
+		header        string
+		contentLength int64
+		offset        int64
+		length        int64
+		size          int64
+		wantErr       bool
+	}{
+		{header: "", contentLength: 100, offset: 0, length: 100, size: 100},
+		{header: "", contentLength: -1, wantErr: true},
+		{header: "bytes 0-49/100", contentLength: 50, offset: 0, length: 50, size: 100},
+		{header: "bytes 50-99/100", contentLength: -1, offset: 50, length: 50, size: 100},
+		{header: "bytes */100", contentLength: 0, offset: 0, length: -1, size: 100},
+		{header: "bytes 50-99/100", contentLength: 10, wantErr: true},
+		{header: "bytes 50-100/100", contentLength: -1, wantErr: true},
+		{header: "bytes 60-50/100", contentLength: -1, wantErr: true},
+		{header: "items 0-1/2", contentLength: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.header, func() {
+			offset, length, size, err := parseContentRange(tt.header, tt.contentLength)
+
+			if tt.wantErr {
+				s.Require().Error(err)
+				return
+			}
+
+			s.Require().NoError(err)
+			s.Require().Equal(tt.offset, offset)
+			s.Require().Equal(tt.length, length)
+			s.Require().Equal(tt.size, size)
+		})
+	}
+}
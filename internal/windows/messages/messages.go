@@ -16,19 +16,35 @@ const (
 	CONTROLLER_GET_VOLUME             = "get volume called"
 	CONTROLLER_GET_VOLUME_OK          = "volume was found"
 	CONTROLLER_GET_VOLUME_FAILED      = "unable to get volume"
+	CONTROLLER_GET_VOLUME_STATUS      = "get volume status called"
+	CONTROLLER_GET_VOLUME_STATUS_OK   = "volume status was retrieved"
+	CONTROLLER_VOLUME_ABNORMAL        = "volume is in an abnormal condition"
 	CONTROLLER_VOLUME_EXISTS          = "volume exists with different size"
+	CONTROLLER_VOLUME_EXISTS_SHARED   = "volume exists with different shared setting"
 	CONTROLLER_VOLUME_ALREADY_CREATED = "volume already created"
 	CONTROLLER_VOLUME_CREATED         = "volume was created"
 	CONTROLLER_STORAGE_FULL           = "storage space full"
+	CONTROLLER_TEMPLATE_NOT_FOUND     = "template not found"
+	CONTROLLER_STORAGE_LIMIT          = "storage limit reached"
+
+	CONTROLLER_RECORD_NAMESPACE_FAILED = "unable to record volume namespace"
 
 	CONTROLLER_LIST_VMS        = "list VMs called"
 	CONTROLLER_LIST_VMS_FAILED = "list VMs failed"
 	CONTROLLER_VMS_LISTED      = "VMs were listed"
 
+	CONTROLLER_LIST_TEMPLATES        = "list templates called"
+	CONTROLLER_LIST_TEMPLATES_FAILED = "list templates failed"
+	CONTROLLER_TEMPLATES_LISTED      = "templates were listed"
+
 	CONTROLLER_GET_VM        = "get VM called"
 	CONTROLLER_GET_VM_FAILED = "get VM failed"
 	CONTROLLER_GOT_VM        = "got VM"
 
+	CONTROLLER_LIST_VM_ATTACHMENTS        = "list VM attachments called"
+	CONTROLLER_LIST_VM_ATTACHMENTS_FAILED = "list VM attachments failed"
+	CONTROLLER_VM_ATTACHMENTS_LISTED      = "VM attachments were listed"
+
 	CONTROLLER_VOLUME_DELETE        = "delete volume called"
 	CONTROLLER_VOLUME_DELETED       = "volume was deleted"
 	CONTROLLER_VOLUME_DELETE_FAILED = "unable to delete volume"
@@ -52,4 +68,28 @@ const (
 	CONTROLLER_EXPAND_VOLUME        = "expand volume called"
 	CONTROLLER_EXPAND_VOLUME_FAILED = "unable to expand volume"
 	CONTROLLER_VOLUME_EXPANDED      = "volume waas expanded"
+
+	CONTROLLER_CREATE_EPHEMERAL_VOLUME        = "create ephemeral volume called"
+	CONTROLLER_CREATE_EPHEMERAL_VOLUME_FAILED = "unable to create ephemeral volume"
+	CONTROLLER_EPHEMERAL_VOLUME_CREATED       = "ephemeral volume was created and attached"
+
+	CONTROLLER_DELETE_EPHEMERAL_VOLUME        = "delete ephemeral volume called"
+	CONTROLLER_DELETE_EPHEMERAL_VOLUME_FAILED = "unable to delete ephemeral volume"
+	CONTROLLER_EPHEMERAL_VOLUME_DELETED       = "ephemeral volume was detached and deleted"
+
+	CONTROLLER_NODE_CALLER_DENIED = "node API key used from an address which is not of the node"
+
+	CONTROLLER_EXPORT_VOLUME        = "export volume called"
+	CONTROLLER_EXPORT_VOLUME_FAILED = "unable to export volume"
+	CONTROLLER_VOLUME_EXPORTING     = "volume content is being streamed"
+
+	CONTROLLER_IMPORT_VOLUME        = "import volume called"
+	CONTROLLER_IMPORT_VOLUME_FAILED = "unable to import volume"
+	CONTROLLER_IMPORT_INCOMPLETE    = "part of volume content was received"
+	CONTROLLER_VOLUME_IMPORTED      = "volume was imported"
+	CONTROLLER_IMPORT_ABANDONED     = "abandoned upload of volume content was removed"
+
+	CONTROLLER_ADOPT_VOLUME        = "adopt volume called"
+	CONTROLLER_ADOPT_VOLUME_FAILED = "unable to adopt volume"
+	CONTROLLER_VOLUME_ADOPTED      = "volume was adopted"
 )
@@ -17,7 +17,7 @@ const docTemplate = `{
     "paths": {
         "/attachment/{nodeid}/volume/{volid}": {
             "put": {
-                "description": "Attaches a volume to a node",
+                "description": "Attaches a volume to a node. A volume attached read-only may be attached to several nodes.",
                 "consumes": [
                     "application/json"
                 ],
@@ -49,18 +49,42 @@ const docTemplate = `{
                         "name": "volid",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Attach the volume read-only",
+                        "name": "readonly",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "204": {
                         "description": "No Content"
                     },
+                    "400": {
+                        "description": "Invalid arguments",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
                     "403": {
                         "description": "Access denied",
                         "schema": {
                             "$ref": "#/definitions/rest.Error"
                         }
                     },
+                    "409": {
+                        "description": "Already attached with a different read-only state",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "412": {
+                        "description": "Attached to another node",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -167,6 +191,144 @@ const docTemplate = `{
                 }
             }
         },
+        "/ephemeral/{nodeid}/volume/{name}": {
+            "delete": {
+                "description": "Detaches the VHD for a CSI ephemeral inline volume from a node and deletes it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Ephemeral"
+                ],
+                "summary": "Delete an ephemeral volume",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Key or Node API Key",
+                        "name": "X-Api-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Node ID",
+                        "name": "nodeid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ephemeral volume handle",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Invalid arguments",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Access denied",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/ephemeral/{nodeid}/volume/{name}/size/{size}": {
+            "put": {
+                "description": "Creates a VHD for a CSI ephemeral inline volume and attaches it to a node",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Ephemeral"
+                ],
+                "summary": "Create an ephemeral volume",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Key or Node API Key",
+                        "name": "X-Api-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Node ID",
+                        "name": "nodeid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Ephemeral volume handle",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Volume size",
+                        "name": "size",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/rest.GetVolumeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid arguments",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Access denied",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    }
+                }
+            }
+        },
         "/healthz": {
             "get": {
                 "description": "Checks the health of the service",
@@ -196,9 +358,53 @@ const docTemplate = `{
                 }
             }
         },
+        "/templates": {
+            "get": {
+                "description": "Lists the template VHDs from which volumes may be created",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Templates"
+                ],
+                "summary": "List template VHDs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Key",
+                        "name": "X-Api-Key",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/rest.ListTemplatesResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Access denied",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    }
+                }
+            }
+        },
         "/vm": {
             "get": {
-                "description": "Gets a VM by node ID",
+                "description": "Gets a VM by node ID, or by the BIOS GUID if no node ID is given",
                 "consumes": [
                     "application/json"
                 ],
@@ -209,6 +415,56 @@ const docTemplate = `{
                     "Virtual Machines"
                 ],
                 "summary": "Get Virtual Machine",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Key or Node API Key",
+                        "name": "X-Api-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Node ID",
+                        "name": "id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "BIOS GUID, which the guest reads as its BIOS UUID",
+                        "name": "biosguid",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/rest.GetVMResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/vm/{id}/attachments": {
+            "get": {
+                "description": "Lists the disks attached to the SCSI controllers of a VM",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Virtual Machines"
+                ],
+                "summary": "List the attachments of a Virtual Machine",
                 "parameters": [
                     {
                         "type": "string",
@@ -220,7 +476,7 @@ const docTemplate = `{
                     {
                         "type": "string",
                         "description": "Node ID",
-                        "name": "nodeid",
+                        "name": "id",
                         "in": "path",
                         "required": true
                     }
@@ -229,7 +485,13 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/rest.GetVMResponse"
+                            "$ref": "#/definitions/rest.ListVMAttachmentsResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "VM not found",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
                         }
                     },
                     "500": {
@@ -478,19 +740,16 @@ const docTemplate = `{
                 }
             }
         },
-        "/volume/{name}/size/{size}": {
+        "/volume/{name}/adopt": {
             "post": {
-                "description": "Create a new VHD",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Moves a VHDX which is not in the PV store, e.g. a disk of an older VM, into the store as a volume, renaming it name;id.vhdx. The disk identifier becomes the volume ID, unless a volume already has it, in which case the disk is given a new one. The VHDX must pass Test-VHD, must not be a differencing disk and must not be in use.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Disks"
                 ],
-                "summary": "Create a new VHD",
+                "summary": "Adopt an existing VHDX as a volume",
                 "parameters": [
                     {
                         "type": "string",
@@ -500,18 +759,24 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "integer",
-                        "description": "Volume size",
-                        "name": "size",
+                        "type": "string",
+                        "description": "Volume name",
+                        "name": "name",
                         "in": "path",
                         "required": true
                     },
                     {
                         "type": "string",
-                        "description": "Volume name",
-                        "name": "name",
-                        "in": "path",
+                        "description": "Absolute path of the VHDX on the Hyper-V host",
+                        "name": "path",
+                        "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Namespace against whose quota the volume is counted",
+                        "name": "namespace",
+                        "in": "query"
                     }
                 ],
                 "responses": {
@@ -522,7 +787,7 @@ const docTemplate = `{
                         }
                     },
                     "400": {
-                        "description": "Invalid arguments",
+                        "description": "Invalid arguments, or not a valid VHDX",
                         "schema": {
                             "$ref": "#/definitions/rest.Error"
                         }
@@ -533,7 +798,297 @@ const docTemplate = `{
                             "$ref": "#/definitions/rest.Error"
                         }
                     },
-                    "409": {
+                    "404": {
+                        "description": "VHDX not found",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "409": {
+                        "description": "Volume exists",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "412": {
+                        "description": "VHDX is in use",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/volume/{name}/content": {
+            "get": {
+                "description": "Streams the VHDX of a volume, which must not be attached. The Repr-Digest header is the SHA-256 digest of the whole VHDX, and the ETag is its hex encoding, for use with If-Range.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "Disks"
+                ],
+                "summary": "Export a VHD",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Key",
+                        "name": "X-Api-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Range of bytes to resume an interrupted export, e.g. bytes=1048576-",
+                        "name": "Range",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Volume ID",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        },
+                        "headers": {
+                            "Repr-Digest": {
+                                "type": "string",
+                                "description": "SHA-256 digest of the whole VHDX (RFC 9530)"
+                            }
+                        }
+                    },
+                    "206": {
+                        "description": "Range of the VHDX",
+                        "schema": {
+                            "type": "file"
+                        },
+                        "headers": {
+                            "Repr-Digest": {
+                                "type": "string",
+                                "description": "SHA-256 digest of the whole VHDX (RFC 9530)"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Shared or differencing volume",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Access denied",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "412": {
+                        "description": "Volume is attached",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Uploads a VHDX as a new volume. The VHDX may be uploaded in one request, or in ranges with Content-Range. An upload from offset 0 starts afresh; otherwise it must resume from the number of bytes received, which 202 responses return. Once the whole VHDX is received it is checked with Test-VHD and given a new disk identifier, which is the ID of the volume.",
+                "consumes": [
+                    "application/octet-stream"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Disks"
+                ],
+                "summary": "Import a VHD",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Key",
+                        "name": "X-Api-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Range of the VHDX in the body, e.g. bytes 0-1048575/10485760, or bytes */10485760 to query the progress of an upload",
+                        "name": "Content-Range",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Volume name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Namespace against whose quota the volume is counted",
+                        "name": "namespace",
+                        "in": "query"
+                    },
+                    {
+                        "description": "VHDX content",
+                        "name": "content",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/rest.GetVolumeResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Part of the VHDX has been received",
+                        "schema": {
+                            "$ref": "#/definitions/rest.ImportVolumeProgress"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid arguments, not a valid VHDX, or not resuming from the bytes received",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Access denied",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "409": {
+                        "description": "Volume exists or is being imported",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    }
+                }
+            }
+        },
+        "/volume/{name}/size/{size}": {
+            "post": {
+                "description": "Create a new VHD",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Disks"
+                ],
+                "summary": "Create a new VHD",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Key",
+                        "name": "X-Api-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Volume size",
+                        "name": "size",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Volume name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Create a VHD Set that may be attached to several VMs",
+                        "name": "shared",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name of a template VHD to create the volume from",
+                        "name": "template",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Create a differencing disk on the template rather than a copy",
+                        "name": "differencing",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Namespace of the PVC, against whose quota the volume is counted",
+                        "name": "namespace",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/rest.GetVolumeResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid arguments",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Access denied",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Template not found",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "409": {
                         "description": "Conflict",
                         "schema": {
                             "$ref": "#/definitions/rest.Error"
@@ -548,6 +1103,69 @@ const docTemplate = `{
                 }
             }
         },
+        "/volume/{name}/status": {
+            "get": {
+                "description": "Get the attachment and health condition of a VHD",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Disks"
+                ],
+                "summary": "Get the status of a VHD",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API Key",
+                        "name": "X-Api-Key",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Volume ID",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/rest.GetVolumeStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid arguments",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "403": {
+                        "description": "Access denied",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/rest.Error"
+                        }
+                    }
+                }
+            }
+        },
         "/volumes": {
             "get": {
                 "description": "List volumes",
@@ -612,31 +1230,186 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "models.AttachedDrive": {
+            "type": "object",
+            "properties": {
+                "CimSession": {
+                    "type": "object",
+                    "properties": {
+                        "ComputerName": {
+                            "type": "string"
+                        },
+                        "InstanceId": {
+                            "type": "string"
+                        }
+                    }
+                },
+                "ComputerName": {
+                    "type": "string"
+                },
+                "ControllerLocation": {
+                    "type": "integer"
+                },
+                "ControllerNumber": {
+                    "type": "integer"
+                },
+                "ControllerType": {
+                    "type": "integer"
+                },
+                "DiskNumber": {
+                    "type": "integer"
+                },
+                "Id": {
+                    "type": "string"
+                },
+                "IsDeleted": {
+                    "type": "boolean"
+                },
+                "MaximumIOPS": {
+                    "type": "integer"
+                },
+                "MinimumIOPS": {
+                    "type": "integer"
+                },
+                "Name": {
+                    "type": "string"
+                },
+                "Path": {
+                    "type": "string"
+                },
+                "PoolName": {
+                    "type": "string"
+                },
+                "QoSPolicyID": {
+                    "type": "string"
+                },
+                "SupportPersistentReservations": {
+                    "type": "boolean"
+                },
+                "VMCheckpointId": {
+                    "type": "string"
+                },
+                "VMCheckpointName": {
+                    "type": "string"
+                },
+                "VMId": {
+                    "type": "string"
+                },
+                "VMName": {
+                    "type": "string"
+                },
+                "VMSnapshotId": {
+                    "type": "string"
+                },
+                "VMSnapshotName": {
+                    "type": "string"
+                },
+                "WriteHardeningMethod": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.GetSCSIControllerResopnse": {
+            "type": "object",
+            "properties": {
+                "ComputerName": {
+                    "type": "string"
+                },
+                "ControllerNumber": {
+                    "type": "integer"
+                },
+                "Drives": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.AttachedDrive"
+                    }
+                },
+                "Id": {
+                    "type": "string"
+                },
+                "IsDeleted": {
+                    "type": "boolean"
+                },
+                "IsTemplate": {
+                    "type": "boolean"
+                },
+                "Name": {
+                    "type": "string"
+                },
+                "VMCheckpointId": {
+                    "type": "string"
+                },
+                "VMCheckpointName": {
+                    "type": "string"
+                },
+                "VMId": {
+                    "type": "string"
+                },
+                "VMName": {
+                    "type": "string"
+                },
+                "VMSnapshotId": {
+                    "type": "string"
+                },
+                "VMSnapshotName": {
+                    "type": "string"
+                }
+            }
+        },
         "models.GetVHDResponse": {
             "type": "object",
             "properties": {
+                "Attached": {
+                    "description": "Set by Get-VHD if the disk is in use, e.g. attached to a running VM",
+                    "type": "boolean"
+                },
                 "DiskIdentifier": {
                     "description": "UUID identifier of the disk",
                     "type": "string"
                 },
+                "FileSize": {
+                    "description": "Size in bytes of the disk file",
+                    "type": "integer"
+                },
                 "Host": {
-                    "description": "UUID of the host to which the disk is attached, if it is attached.",
+                    "description": "UUID of the host to which the disk is attached read-write, if it is attached.",
                     "type": "string"
                 },
                 "Name": {
                     "description": "Name of the disk",
                     "type": "string"
                 },
+                "ParentPath": {
+                    "description": "Path to the parent of a differencing disk",
+                    "type": "string"
+                },
                 "Path": {
                     "description": "Path to the disk file",
                     "type": "string"
                 },
+                "Shared": {
+                    "description": "Set if the disk is a VHD Set that may be attached to several VMs at once.",
+                    "type": "boolean"
+                },
                 "Size": {
                     "description": "Size in bytes of the disk",
                     "type": "integer"
                 }
             }
         },
+        "rest.Attachment": {
+            "type": "object",
+            "properties": {
+                "nodeId": {
+                    "description": "ID of the VM to which the volume is attached.",
+                    "type": "string"
+                },
+                "readOnly": {
+                    "description": "ReadOnly is set when the volume is attached read-only.",
+                    "type": "boolean"
+                }
+            }
+        },
         "rest.Error": {
             "type": "object",
             "properties": {
@@ -654,7 +1427,8 @@ const docTemplate = `{
             "type": "object",
             "properties": {
                 "capacityBytes": {
-                    "type": "integer"
+                    "type": "integer",
+                    "format": "int64"
                 },
                 "nodeExpansionRequired": {
                     "type": "boolean"
@@ -666,34 +1440,93 @@ const docTemplate = `{
             "properties": {
                 "availableCapacity": {
                     "description": "AvailableCapacity is the available space in bytes\non the disk where the PV Store resides for creating\nnew persistent volumes.",
-                    "type": "integer"
+                    "type": "integer",
+                    "format": "int64"
                 },
                 "minimumVolumeSize": {
                     "description": "MinimumVolumeSize is the minimum size of a volume that can be provisioned.\nRequests for smaller volumes will result in a volume of this size being provisioned.",
-                    "type": "integer"
+                    "type": "integer",
+                    "format": "int64"
                 }
             }
         },
         "rest.GetVMResponse": {
             "type": "object",
             "properties": {
+                "BIOSGUID": {
+                    "description": "BIOSGUID is the UUID which the guest reads from its BIOS, e.g. in /sys/class/dmi/id/product_uuid.\nIt is not the same as the ID of the VM.",
+                    "type": "string"
+                },
+                "DynamicMemoryEnabled": {
+                    "description": "DynamicMemoryEnabled is set if the memory assigned to the VM varies with demand",
+                    "type": "boolean"
+                },
                 "Generation": {
                     "type": "integer"
                 },
                 "Id": {
                     "type": "string"
                 },
+                "MemoryAssigned": {
+                    "description": "MemoryAssigned is the memory in bytes currently assigned to the VM, which is zero if it is not running",
+                    "type": "integer"
+                },
+                "MemoryMaximum": {
+                    "description": "MemoryMaximum is the most memory in bytes assigned to the VM if dynamic memory is enabled",
+                    "type": "integer"
+                },
+                "MemoryMinimum": {
+                    "description": "MemoryMinimum is the least memory in bytes assigned to the VM if dynamic memory is enabled",
+                    "type": "integer"
+                },
+                "MemoryStartup": {
+                    "description": "MemoryStartup is the memory in bytes assigned to the VM when it starts",
+                    "type": "integer"
+                },
                 "Name": {
                     "type": "string"
                 },
+                "NetworkAdapters": {
+                    "description": "NetworkAdapters are the network adapters of the VM",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/rest.VMNetworkAdapter"
+                    }
+                },
                 "Path": {
                     "type": "string"
+                },
+                "ProcessorCount": {
+                    "description": "ProcessorCount is the number of virtual processors of the VM",
+                    "type": "integer"
+                },
+                "ScsiControllers": {
+                    "description": "ScsiControllers are the SCSI controllers of the VM with their attached drives",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.GetSCSIControllerResopnse"
+                    }
+                },
+                "State": {
+                    "$ref": "#/definitions/rest.VMState"
+                },
+                "UptimeSeconds": {
+                    "description": "UptimeSeconds is how long the VM has been running, in whole seconds",
+                    "type": "integer"
+                },
+                "VolumeDrives": {
+                    "description": "VolumeDrives is the number of occupied locations which hold volumes",
+                    "type": "integer"
                 }
             }
         },
         "rest.GetVolumeResponse": {
             "type": "object",
             "properties": {
+                "host": {
+                    "description": "ID of the VM to which the volume is attached read-write, if it is attached.",
+                    "type": "string"
+                },
                 "id": {
                     "description": "The GUID ID assigned to the volume by Hyper-V",
                     "type": "string"
@@ -702,18 +1535,97 @@ const docTemplate = `{
                     "description": "The name of the volume.",
                     "type": "string"
                 },
+                "shared": {
+                    "description": "Set if the volume is a VHD Set that may be attached to several VMs at once.",
+                    "type": "boolean"
+                },
                 "size": {
                     "description": "Actual size of the created volume.\nIf caller requests less than the minimum VHD size,\nthen this will be the minimum VHD size.",
                     "type": "integer"
                 }
             }
         },
+        "rest.GetVolumeStatusResponse": {
+            "type": "object",
+            "properties": {
+                "attachments": {
+                    "description": "Attachments lists every node the volume is attached to. A volume\nattached read-only may be attached to more than one node.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/rest.Attachment"
+                    }
+                },
+                "condition": {
+                    "description": "Condition of the volume.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/rest.VolumeCondition"
+                        }
+                    ]
+                },
+                "host": {
+                    "description": "ID of the VM to which the volume is attached, if it is attached.",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "The GUID ID assigned to the volume by Hyper-V",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "The name of the volume.",
+                    "type": "string"
+                },
+                "size": {
+                    "description": "Size of the volume.",
+                    "type": "integer"
+                }
+            }
+        },
         "rest.HealthyResponse": {
             "type": "object",
             "properties": {
                 "status": {
                     "description": "Status indicates the health status of the service",
                     "type": "string"
+                },
+                "version": {
+                    "description": "Version is the version of the Windows service",
+                    "type": "string"
+                }
+            }
+        },
+        "rest.ImportVolumeProgress": {
+            "type": "object",
+            "properties": {
+                "received": {
+                    "description": "Received is the number of bytes of the VHDX received so far,\nwhich is the offset from which the upload resumes.",
+                    "type": "integer"
+                },
+                "size": {
+                    "description": "Size of the VHDX being uploaded.",
+                    "type": "integer"
+                }
+            }
+        },
+        "rest.ListTemplatesResponse": {
+            "type": "object",
+            "properties": {
+                "templates": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/rest.Template"
+                    }
+                }
+            }
+        },
+        "rest.ListVMAttachmentsResponse": {
+            "type": "object",
+            "properties": {
+                "Attachments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/rest.VMAttachment"
+                    }
                 }
             }
         },
@@ -743,6 +1655,129 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "rest.Template": {
+            "type": "object",
+            "properties": {
+                "fileSize": {
+                    "description": "Size of the template VHD file.",
+                    "type": "integer"
+                },
+                "name": {
+                    "description": "The name of the template, which is the file name of the VHD without extension.",
+                    "type": "string"
+                },
+                "size": {
+                    "description": "Size of the virtual disk. Volumes created from the template are at least this size.",
+                    "type": "integer"
+                }
+            }
+        },
+        "rest.VMAttachment": {
+            "type": "object",
+            "properties": {
+                "ControllerLocation": {
+                    "description": "ControllerLocation is the location on the SCSI controller of the disk",
+                    "type": "integer"
+                },
+                "ControllerNumber": {
+                    "description": "ControllerNumber is the number of the SCSI controller to which the disk is attached",
+                    "type": "integer"
+                },
+                "DiskIdentifier": {
+                    "description": "UUID identifier of the disk, which for a volume is the volume ID",
+                    "type": "string"
+                },
+                "Name": {
+                    "description": "Name of the disk, which for a volume is the volume name",
+                    "type": "string"
+                },
+                "Path": {
+                    "description": "Path to the disk file, which is empty for a physical disk",
+                    "type": "string"
+                },
+                "Shared": {
+                    "description": "Shared is set if the disk is a VHD Set that may be attached to several VMs at once",
+                    "type": "boolean"
+                },
+                "Size": {
+                    "description": "Size in bytes of the disk",
+                    "type": "integer"
+                },
+                "Volume": {
+                    "description": "Volume is set if the disk is a volume in the PV store",
+                    "type": "boolean"
+                }
+            }
+        },
+        "rest.VMNetworkAdapter": {
+            "type": "object",
+            "properties": {
+                "Connected": {
+                    "description": "Connected is set if the adapter is connected to a virtual switch",
+                    "type": "boolean"
+                },
+                "IPAddresses": {
+                    "description": "IPAddresses are the addresses of the adapter reported by the guest integration services",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "MacAddress": {
+                    "type": "string"
+                },
+                "Name": {
+                    "type": "string"
+                },
+                "SwitchName": {
+                    "type": "string"
+                }
+            }
+        },
+        "rest.VMState": {
+            "type": "string",
+            "enum": [
+                "Other",
+                "Running",
+                "Off",
+                "Stopping",
+                "Saved",
+                "Paused",
+                "Starting",
+                "Reset",
+                "Saving",
+                "Pausing",
+                "Resuming",
+                "FastSaved"
+            ],
+            "x-enum-varnames": [
+                "VMStateOther",
+                "VMStateRunning",
+                "VMStateOff",
+                "VMStateStopping",
+                "VMStateSaved",
+                "VMStatePaused",
+                "VMStateStarting",
+                "VMStateReset",
+                "VMStateSaving",
+                "VMStatePausing",
+                "VMStateResuming",
+                "VMStateFastSaved"
+            ]
+        },
+        "rest.VolumeCondition": {
+            "type": "object",
+            "properties": {
+                "abnormal": {
+                    "description": "Abnormal is set when the volume is in a state that needs attention.",
+                    "type": "boolean"
+                },
+                "message": {
+                    "description": "Message describes the condition of the volume.",
+                    "type": "string"
+                }
+            }
         }
     }
 }`
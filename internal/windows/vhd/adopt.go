@@ -0,0 +1,185 @@
+//go:build windows
+
+package vhd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/powershell"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+)
+
+// adoptingDir is the directory of the PV store which receives the copies of VHDX files being adopted
+// from other drives. Only the PV store itself is searched for disks, so the copies are not listed.
+const adoptingDir = ".adopting"
+
+// GetAdoptable gets a VHDX which is not in the PV store, e.g. a disk from an older VM, and checks that it
+// may be adopted as a volume. It must pass the Hyper-V integrity check, must not be a differencing disk,
+// as its parent would not be in the store, and must not be in use.
+func GetAdoptable(runner powershell.Runner, pvStore, path string) (*models.GetVHDResponse, error) {
+
+	if !filepath.IsAbs(path) {
+		return nil, rest.NewError(codes.InvalidArgument, fmt.Sprintf("path %q is not absolute", path))
+	}
+
+	path = filepath.Clean(path)
+
+	if !strings.EqualFold(filepath.Ext(path), constants.VhdType) {
+		return nil, rest.NewError(codes.InvalidArgument, fmt.Sprintf("%s is not a VHDX", path))
+	}
+
+	if _, _, err := ParseDiskPath(path); err == nil && strings.EqualFold(filepath.Dir(path), filepath.Clean(pvStore)) {
+		return nil, rest.NewError(codes.AlreadyExists, fmt.Sprintf("%s is already a volume", path))
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, rest.NewError(codes.NotFound, fmt.Sprintf("%s does not exist", path))
+		}
+
+		return nil, err
+	}
+
+	ok, err := CheckIntegrity(runner, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, rest.NewError(codes.InvalidArgument, fmt.Sprintf("%s failed the integrity check", path))
+	}
+
+	disk, err := getVHD(runner, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if disk.ParentPath != "" {
+		return nil, rest.NewError(codes.InvalidArgument, "a differencing disk cannot be adopted")
+	}
+
+	if disk.Attached {
+		return nil, rest.NewError(codes.FailedPrecondition, fmt.Sprintf("%s is in use, detach it from its VM first", path))
+	}
+
+	// A VM which is not running does not hold the disk open, but would use it when started
+	attachments, err := GetAttachments(runner, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(attachments) > 0 {
+		return nil, rest.NewError(codes.FailedPrecondition, fmt.Sprintf("%s is a disk of VM %s, detach it from the VM first", path, attachments[0].VMName))
+	}
+
+	return disk, nil
+}
+
+// CopyForAdoption copies a VHDX returned by GetAdoptable which is on another drive into a directory of
+// the PV store whose disks are not listed, so that Adopt only has to rename it. The copy is returned.
+// The source is left in place, and must be removed once the copy has been adopted.
+func CopyForAdoption(pvStore string, disk *models.GetVHDResponse) (*models.GetVHDResponse, error) {
+
+	dir := filepath.Join(pvStore, adoptingDir)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create %s: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, uuid.NewString()+constants.VhdType)
+
+	if err := copyFile(disk.Path, path); err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+
+	copied := *disk
+	copied.Path = path
+
+	return &copied, nil
+}
+
+// Adopt moves a VHDX returned by GetAdoptable into the PV store as a volume of the given name.
+// The disk keeps its identifier, which becomes the volume ID, unless a volume already has it,
+// e.g. when the VHDX is a copy of that volume, in which case the disk is given a new one.
+func Adopt(runner powershell.Runner, name, pvStore string, disk *models.GetVHDResponse) (*models.GetVHDResponse, error) {
+
+	existing, err := GetByID(runner, pvStore, disk.DiskIdentifier)
+
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	if err == nil && existing != nil {
+		err = execute(
+			runner,
+			powershell.NewCmdlet(
+				"Set-VHD",
+				map[string]any{
+					"Path":                disk.Path,
+					"ResetDiskIdentifier": nil,
+					"Force":               nil,
+				},
+			),
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if disk, err = getVHD(runner, disk.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	path := filepath.Join(pvStore, name+";"+disk.DiskIdentifier+constants.VhdType)
+
+	if err := moveFile(disk.Path, path); err != nil {
+		return nil, err
+	}
+
+	adopted := *disk
+	adopted.Name = name
+	adopted.Path = path
+
+	return &adopted, nil
+}
+
+func isNotFound(err error) bool {
+
+	restErr := &rest.Error{}
+	return errors.As(err, &restErr) && restErr.Code == codes.NotFound
+}
+
+// moveFile renames a file, or copies it when it is on another volume, which rename cannot do
+func moveFile(src, dst string) error {
+
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("cannot move VHD %s: %s exists", src, dst)
+	}
+
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+
+	// The copy is now the volume, so a source which cannot be removed is left behind
+	_ = os.Remove(src)
+
+	return nil
+}
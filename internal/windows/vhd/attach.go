@@ -3,8 +3,13 @@
 package vhd
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
 	"github.com/fireflycons/hypervcsi/internal/windows/powershell"
+	"google.golang.org/grpc/codes"
 )
 
 func Attach(runner powershell.Runner, store, diskId, nodeId string) (*models.AttachedDrive, error) {
@@ -19,7 +24,21 @@ func Attach(runner powershell.Runner, store, diskId, nodeId string) (*models.Att
 		return nil, ErrInvalidDiskId
 	}
 
-	// TODO Assert disk is not attached to another node (FAILED_PRECONDITION)
+	if disk.Shared {
+		return attachShared(runner, disk.Path, nodeId)
+	}
+
+	// A disk attached read-only has no host, but must be released by all its readers first
+	if readOnly, err := IsReadOnly(disk.Path); err == nil && readOnly {
+		if err := releaseReadOnly(runner, disk, nodeId); err != nil {
+			return nil, err
+		}
+	}
+
+	// A disk may only be attached read-write to one node
+	if disk.Host != nil {
+		return attachedDrive(runner, disk, nodeId)
+	}
 
 	drive := &models.AttachedDrive{}
 
@@ -35,3 +54,95 @@ func Attach(runner powershell.Runner, store, diskId, nodeId string) (*models.Att
 		),
 	)
 }
+
+// attachedDrive checks a disk that is already attached read-write. Attaching it again
+// to the same node succeeds, but attaching it to any other node is refused.
+func attachedDrive(runner powershell.Runner, disk *models.GetVHDResponse, nodeId string) (*models.AttachedDrive, error) {
+
+	if strings.EqualFold(*disk.Host, nodeId) {
+		return &models.AttachedDrive{
+			Path: disk.Path,
+			VMID: *disk.Host,
+		}, nil
+	}
+
+	vm := *disk.Host
+
+	// Name the VM if possible, which is more use to whoever has to detach it
+	if attachments, err := GetAttachments(runner, disk.Path); err == nil {
+		for _, a := range attachments {
+			if strings.EqualFold(a.VMID, *disk.Host) && a.VMName != "" {
+				vm = fmt.Sprintf("%s (%s)", a.VMName, a.VMID)
+				break
+			}
+		}
+	}
+
+	return nil, &rest.Error{
+		Code:    codes.FailedPrecondition,
+		Message: fmt.Sprintf("disk %s is already attached to VM %s", disk.DiskIdentifier, vm),
+	}
+}
+
+// releaseReadOnly clears the read-only attribute of a disk that is to be attached
+// read-write. This is refused if the disk still has read-only attachments.
+func releaseReadOnly(runner powershell.Runner, disk *models.GetVHDResponse, nodeId string) error {
+
+	attachments, err := GetAttachments(runner, disk.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range attachments {
+		if strings.EqualFold(a.VMID, nodeId) {
+			return &rest.Error{
+				Code:    codes.AlreadyExists,
+				Message: fmt.Sprintf("disk %s is already attached read-only to VM %s", disk.DiskIdentifier, nodeId),
+			}
+		}
+	}
+
+	if len(attachments) > 0 {
+		return &rest.Error{
+			Code:    codes.FailedPrecondition,
+			Message: fmt.Sprintf("disk %s is attached read-only to %d VMs", disk.DiskIdentifier, len(attachments)),
+		}
+	}
+
+	return SetReadOnly(disk.Path, false)
+}
+
+// GetAttachments returns the drives on all VMs that have the VHD at the given path attached.
+func GetAttachments(runner powershell.Runner, path string) ([]models.AttachedDrive, error) {
+
+	drives, err := executeWithReturn(
+		runner,
+		&[]models.AttachedDrive{},
+		powershell.NewCmdlet(
+			"Get-VM",
+			nil,
+		),
+		powershell.NewCmdlet(
+			"Get-VMHardDiskDrive",
+			nil,
+		),
+		powershell.NewCmdlet(
+			"Where-Object",
+			map[string]any{
+				"Property": "Path",
+				"EQ":       nil,
+				"Value":    path,
+			},
+		),
+		powershell.NewCmdlet(
+			"ConvertTo-Json",
+			nil,
+		),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return *drives, nil
+}
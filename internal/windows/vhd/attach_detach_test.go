@@ -3,9 +3,11 @@
 package vhd
 
 import (
+	"slices"
 	"strings"
 
 	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
 	"github.com/fireflycons/hypervcsi/internal/windows/powershell"
 	"github.com/google/uuid"
 	"google.golang.org/grpc/codes"
@@ -25,21 +27,12 @@ func (s *VHDTestSuite) TestAttachDetach() {
 		attached, err := Attach(s.runner, s.pvStore, disk.DiskIdentifier, s.vm.ID)
 		s.Require().NoError(err)
 
-		disks2 := &models.ListVHDResponse{}
-
-		_, err2 := executeWithReturn(
-			s.runner,
-			disks2,
-			powershell.NewCmdlet(
-				"Get-PVAttachments",
-				map[string]any{
-					"VMId": s.vm.ID,
-				},
-			),
-		)
+		vmAttachments, err2 := GetVMAttachments(s.runner, s.vm.ID)
 
 		s.Assert().NoError(err2)
-		s.Assert().NotEmpty(disks2.VHDs)
+		s.Assert().True(slices.ContainsFunc(vmAttachments.Attachments, func(a *rest.VMAttachment) bool {
+			return a.Volume && strings.EqualFold(a.DiskIdentifier, disk.DiskIdentifier)
+		}), "Could not find VM attachment")
 
 		disks, err := List(s.runner, s.pvStore, 0, "")
 		s.Require().NoError(err)
@@ -8,6 +8,12 @@ import (
 
 func Delete(runner powershell.Runner, store, diskId string) error {
 
+	if path, err := findShared(store, "", diskId); err != nil {
+		return err
+	} else if path != "" {
+		return DeleteShared(runner, path)
+	}
+
 	return execute(
 		runner,
 		powershell.NewCmdlet(
@@ -16,6 +16,14 @@ func Detach(runner powershell.Runner, store, diskId, nodeId string) error {
 		return ErrInvalidDiskId
 	}
 
+	if disk.Shared {
+		return removeDrive(runner, disk.Path, nodeId)
+	}
+
+	if readOnly, err := IsReadOnly(disk.Path); err == nil && readOnly {
+		return detachReadOnly(runner, disk.Path, nodeId)
+	}
+
 	return execute(
 		runner,
 		powershell.NewCmdlet(
@@ -9,6 +9,10 @@ import (
 
 func GetByName(runner powershell.Runner, store, name string) (*models.GetVHDResponse, error) {
 
+	if disk, err := GetSharedByName(runner, store, name); err != nil || disk != nil {
+		return disk, err
+	}
+
 	response, err := executeWithReturn(
 		runner,
 		&models.GetVHDResponse{},
@@ -27,6 +31,10 @@ func GetByName(runner powershell.Runner, store, name string) (*models.GetVHDResp
 
 func GetByID(runner powershell.Runner, store, id string) (*models.GetVHDResponse, error) {
 
+	if disk, err := GetSharedByID(runner, store, id); err != nil || disk != nil {
+		return disk, err
+	}
+
 	return executeWithReturn(
 		runner,
 		&models.GetVHDResponse{},
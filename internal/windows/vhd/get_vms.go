@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/fireflycons/hypervcsi/internal/models"
 	"github.com/fireflycons/hypervcsi/internal/models/rest"
 	"github.com/fireflycons/hypervcsi/internal/windows/powershell"
 	"google.golang.org/grpc/codes"
@@ -32,28 +33,96 @@ func GetVMs(runner powershell.Runner) (*rest.ListVMResponse, error) {
 
 // GetVM gets a virtual machine by ID
 func GetVM(runner powershell.Runner, id string) (*rest.GetVMResponse, error) {
+	return findVM(runner, fmt.Sprintf("VM %s", id), func(vm *rest.GetVMResponse) bool {
+		return strings.EqualFold(vm.ID, id)
+	})
+}
 
-	vms, err := executeWithReturn(
-		runner,
-		&rest.ListVMResponse{},
-		powershell.NewCmdlet(
-			"Get-PVVirtualMachines",
-			nil,
-		),
-	)
+// GetVMByBIOSGUID gets a virtual machine by the BIOS GUID which its guest reads as the BIOS UUID
+func GetVMByBIOSGUID(runner powershell.Runner, biosGuid string) (*rest.GetVMResponse, error) {
+	return findVM(runner, fmt.Sprintf("VM with BIOS GUID %s", biosGuid), func(vm *rest.GetVMResponse) bool {
+		return strings.EqualFold(vm.BIOSGUID, biosGuid)
+	})
+}
+
+func findVM(runner powershell.Runner, description string, match func(*rest.GetVMResponse) bool) (*rest.GetVMResponse, error) {
+
+	vms, err := GetVMs(runner)
 
 	if err != nil {
 		return nil, err
 	}
 
 	for _, vm := range vms.VMs {
-		if strings.EqualFold(vm.ID, id) {
+		if match(vm) {
 			return vm, nil
 		}
 	}
 
 	return nil, &rest.Error{
 		Code:    codes.NotFound,
-		Message: fmt.Sprintf("VM %s not found", id),
+		Message: fmt.Sprintf("%s not found", description),
+	}
+}
+
+// GetVMAddresses lists the IP addresses of the network adapters of a virtual machine by ID,
+// as reported by its integration services. A VM which does not exist has no addresses.
+func GetVMAddresses(runner powershell.Runner, id string) ([]string, error) {
+
+	adapters, err := executeWithReturn(
+		runner,
+		&[]models.GetVMNetworkAdapterResponse{},
+		powershell.NewCmdlet(
+			"Get-VM",
+			nil,
+		),
+		powershell.NewCmdlet(
+			"Where-Object",
+			map[string]any{
+				"Property": "Id",
+				"EQ":       nil,
+				"Value":    id,
+			},
+		),
+		powershell.NewCmdlet(
+			"Get-VMNetworkAdapter",
+			nil,
+		),
+		powershell.NewCmdlet(
+			"Select-Object",
+			map[string]any{
+				"Property": "IPAddresses",
+			},
+		),
+		powershell.NewCmdlet(
+			"ConvertTo-Json",
+			nil,
+		),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	for _, a := range *adapters {
+		addresses = append(addresses, a.IPAddresses...)
 	}
+
+	return addresses, nil
+}
+
+// GetVMAttachments lists the disks attached to the SCSI controllers of a virtual machine by ID
+func GetVMAttachments(runner powershell.Runner, id string) (*rest.ListVMAttachmentsResponse, error) {
+
+	return executeWithReturn(
+		runner,
+		&rest.ListVMAttachmentsResponse{},
+		powershell.NewCmdlet(
+			"Get-PVAttachments",
+			map[string]any{
+				"VMId": id,
+			},
+		),
+	)
 }
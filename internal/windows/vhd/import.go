@@ -0,0 +1,167 @@
+//go:build windows
+
+package vhd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fireflycons/hypervcsi/internal/constants"
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/powershell"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+)
+
+// VHDXSignature is the file type identifier at the start of every VHDX file
+const VHDXSignature = "vhdxfile"
+
+// partialSuffix is appended to the name of a volume for the file which receives its
+// VHDX as it is uploaded. This must not match *.vhd*, so the file is not listed as a disk.
+const partialSuffix = ".partial"
+
+// volumeNameRx validates the names of imported volumes, which must be
+// valid as the name part of a VHD file name in the PV store
+var volumeNameRx = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// ValidateVolumeName checks that a volume may be given the given name
+func ValidateVolumeName(name string) error {
+
+	if !volumeNameRx.MatchString(name) {
+		return &rest.Error{
+			Code:    codes.InvalidArgument,
+			Message: fmt.Sprintf("invalid volume name %q", name),
+		}
+	}
+
+	return nil
+}
+
+// PartialPath returns the path of the file which receives the VHDX of the named volume as it is uploaded
+func PartialPath(pvStore, name string) string {
+	return filepath.Join(pvStore, name+partialSuffix)
+}
+
+// AbandonedImports returns the names of the volumes whose uploads to the PV store
+// have not been written to for longer than the given age
+func AbandonedImports(pvStore string, age time.Duration) ([]string, error) {
+
+	paths, err := filepath.Glob(filepath.Join(pvStore, "*"+partialSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		if time.Since(info.ModTime()) > age {
+			names = append(names, strings.TrimSuffix(filepath.Base(path), partialSuffix))
+		}
+	}
+
+	return names, nil
+}
+
+// Import makes a volume of the given name from a completely uploaded VHDX. The VHDX must pass the
+// Hyper-V integrity check and must not be a differencing disk, as its parent would not be in the store.
+// As with a copy of a template, the disk is given a new identifier so that it cannot clash with the
+// volume from which it was exported. The uploaded file is consumed whether or not this succeeds.
+func Import(runner powershell.Runner, name, pvStore, partialPath string) (*models.GetVHDResponse, error) {
+
+	tempPath := filepath.Join(pvStore, name+";"+uuid.NewString()+constants.VhdType)
+
+	if err := os.Rename(partialPath, tempPath); err != nil {
+		_ = os.Remove(partialPath)
+		return nil, fmt.Errorf("cannot rename VHD %s: %w", partialPath, err)
+	}
+
+	disk, err := importVHD(runner, tempPath)
+
+	if err != nil {
+		_ = os.Remove(tempPath)
+		return nil, err
+	}
+
+	path := filepath.Join(pvStore, name+";"+disk.DiskIdentifier+constants.VhdType)
+
+	if err := os.Rename(tempPath, path); err != nil {
+		_ = os.Remove(tempPath)
+		return nil, fmt.Errorf("cannot rename VHD %s: %w", tempPath, err)
+	}
+
+	disk.Name = name
+	disk.Path = path
+
+	return disk, nil
+}
+
+func importVHD(runner powershell.Runner, path string) (*models.GetVHDResponse, error) {
+
+	ok, err := CheckIntegrity(runner, path)
+
+	if err != nil || !ok {
+		return nil, &rest.Error{
+			Code:    codes.InvalidArgument,
+			Message: "uploaded VHDX failed the integrity check",
+		}
+	}
+
+	disk, err := getVHD(runner, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if disk.ParentPath != "" {
+		return nil, &rest.Error{
+			Code:    codes.InvalidArgument,
+			Message: "a differencing disk cannot be imported",
+		}
+	}
+
+	err = execute(
+		runner,
+		powershell.NewCmdlet(
+			"Set-VHD",
+			map[string]any{
+				"Path":                path,
+				"ResetDiskIdentifier": nil,
+				"Force":               nil,
+			},
+		),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getVHD(runner, path)
+}
+
+func getVHD(runner powershell.Runner, path string) (*models.GetVHDResponse, error) {
+
+	return executeWithReturn(
+		runner,
+		&models.GetVHDResponse{},
+		powershell.NewCmdlet(
+			"Get-VHD",
+			map[string]any{
+				"Path": path,
+			},
+		),
+		powershell.NewCmdlet(
+			"ConvertTo-Json",
+			nil,
+		),
+	)
+}
@@ -0,0 +1,33 @@
+//go:build windows
+
+package vhd
+
+import (
+	"github.com/fireflycons/hypervcsi/internal/windows/powershell"
+)
+
+// CheckIntegrity runs the Hyper-V integrity check over the VHD at the given path.
+// It returns true if the disk passes the check.
+func CheckIntegrity(runner powershell.Runner, path string) (bool, error) {
+
+	ok, err := executeWithReturn(
+		runner,
+		new(bool),
+		powershell.NewCmdlet(
+			"Test-VHD",
+			map[string]any{
+				"Path": path,
+			},
+		),
+		powershell.NewCmdlet(
+			"ConvertTo-Json",
+			nil,
+		),
+	)
+
+	if err != nil {
+		return false, err
+	}
+
+	return *ok, nil
+}
@@ -3,6 +3,9 @@
 package vhd
 
 import (
+	"path/filepath"
+	"strings"
+
 	"github.com/fireflycons/hypervcsi/internal/models"
 	"github.com/fireflycons/hypervcsi/internal/windows/powershell"
 )
@@ -26,5 +29,13 @@ func List(runner powershell.Runner, store string, maxEntries int32, nextToken st
 		return nil, err
 	}
 
+	// The module lists VHD Sets with the other disks of the store,
+	// but cannot say that they are shared.
+	for i := range volumes.VHDs {
+		if strings.EqualFold(filepath.Ext(volumes.VHDs[i].Path), VhdSetType) {
+			volumes.VHDs[i].Shared = true
+		}
+	}
+
 	return volumes, nil
 }
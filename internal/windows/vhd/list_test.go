@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	. "github.com/ahmetb/go-linq/v3"
+	"github.com/fireflycons/hypervcsi/internal/constants"
 	"github.com/fireflycons/hypervcsi/internal/models"
 )
 
@@ -69,3 +70,26 @@ func assertCompleteVolumeInfo(suite *VHDTestSuite, l *models.ListVHDResponse) {
 		suite.Assert().NotZero(v.Size, "Size is zero")
 	}
 }
+
+func (s *VHDTestSuite) TestListWithSharedVolume() {
+
+	shared, err := NewShared(s.runner, "shared1", s.pvStore, 10*constants.MiB)
+	s.Require().NoError(err)
+
+	defer func() {
+		s.Require().NoError(DeleteShared(s.runner, shared.Path))
+	}()
+
+	disks, err := List(s.runner, s.pvStore, 0, "")
+
+	s.Require().NoError(err)
+	assertCompleteVolumeInfo(s, disks)
+
+	listed := From(disks.VHDs).
+		Where(func(i any) bool {
+			return strings.EqualFold(i.(models.GetVHDResponse).DiskIdentifier, shared.DiskIdentifier)
+		}).Results()
+
+	s.Require().Len(listed, 1, "VHD Set is not listed once")
+	s.Require().True(listed[0].(models.GetVHDResponse).Shared)
+}
@@ -0,0 +1,180 @@
+//go:build windows
+
+package vhd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/powershell"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	readOnlyFileMode  os.FileMode = 0o444
+	readWriteFileMode os.FileMode = 0o666
+)
+
+// IsReadOnly reports whether the VHD file at the given path has the read-only
+// attribute set. Hyper-V opens such files for shared read access, which
+// permits the disk to be attached to more than one VM at once.
+func IsReadOnly(path string) (bool, error) {
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	return fi.Mode().Perm()&0o200 == 0, nil
+}
+
+// SetReadOnly sets or clears the read-only attribute of the VHD file at the given path.
+func SetReadOnly(path string, readOnly bool) error {
+
+	mode := readWriteFileMode
+	if readOnly {
+		mode = readOnlyFileMode
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("cannot set read-only state of %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// AttachReadOnly attaches the disk with the given ID to the given node read-only.
+// The disk may be attached read-only to any number of nodes, but not while it
+// is attached read-write to any node.
+func AttachReadOnly(runner powershell.Runner, store, diskId, nodeId string) (*models.AttachedDrive, error) {
+
+	disk, err := GetByID(runner, store, diskId)
+	if err != nil {
+		return nil, err
+	}
+
+	if disk == nil {
+		return nil, ErrInvalidDiskId
+	}
+
+	if disk.Shared {
+		return nil, &rest.Error{
+			Code:    codes.InvalidArgument,
+			Message: fmt.Sprintf("disk %s is a VHD Set and cannot be attached read-only", diskId),
+		}
+	}
+
+	readOnly, err := IsReadOnly(disk.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := GetAttachments(runner, disk.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range attachments {
+		if strings.EqualFold(attachments[i].VMID, nodeId) {
+			if readOnly {
+				// Already attached read-only to this node
+				return &attachments[i], nil
+			}
+
+			return nil, &rest.Error{
+				Code:    codes.AlreadyExists,
+				Message: fmt.Sprintf("disk %s is already attached read-write to VM %s", diskId, nodeId),
+			}
+		}
+	}
+
+	if !readOnly {
+		if len(attachments) > 0 {
+			return nil, &rest.Error{
+				Code:    codes.FailedPrecondition,
+				Message: fmt.Sprintf("disk %s is attached read-write to VM %s", diskId, attachments[0].VMID),
+			}
+		}
+
+		if err := SetReadOnly(disk.Path, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return executeWithReturn(
+		runner,
+		&models.AttachedDrive{},
+		powershell.NewCmdlet(
+			"Get-VM",
+			map[string]any{
+				"Id": nodeId,
+			},
+		),
+		powershell.NewCmdlet(
+			"Add-VMHardDiskDrive",
+			map[string]any{
+				"ControllerType": "SCSI",
+				"Path":           disk.Path,
+				"Passthru":       nil,
+			},
+		),
+		powershell.NewCmdlet(
+			"ConvertTo-Json",
+			nil,
+		),
+	)
+}
+
+// detachReadOnly removes a read-only attachment of the disk at the given path from the given node.
+// When the last attachment is removed the read-only attribute is cleared so that the disk
+// may once again be attached read-write.
+func detachReadOnly(runner powershell.Runner, path, nodeId string) error {
+
+	if err := removeDrive(runner, path, nodeId); err != nil {
+		return err
+	}
+
+	attachments, err := GetAttachments(runner, path)
+	if err != nil {
+		return err
+	}
+
+	if len(attachments) == 0 {
+		return SetReadOnly(path, false)
+	}
+
+	return nil
+}
+
+// removeDrive removes the drive for the disk at the given path from the given node.
+func removeDrive(runner powershell.Runner, path, nodeId string) error {
+
+	return execute(
+		runner,
+		powershell.NewCmdlet(
+			"Get-VM",
+			map[string]any{
+				"Id": nodeId,
+			},
+		),
+		powershell.NewCmdlet(
+			"Get-VMHardDiskDrive",
+			nil,
+		),
+		powershell.NewCmdlet(
+			"Where-Object",
+			map[string]any{
+				"Property": "Path",
+				"EQ":       nil,
+				"Value":    path,
+			},
+		),
+		powershell.NewCmdlet(
+			"Remove-VMHardDiskDrive",
+			nil,
+		),
+	)
+}
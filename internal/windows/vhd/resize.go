@@ -11,6 +11,12 @@ import (
 // The filename of the VHD is set to the DiskIdentifier property returned by creation.
 func Resize(runner powershell.Runner, pvStore, id string, size int64) (*models.GetVHDResponse, error) {
 
+	if path, err := findShared(pvStore, "", id); err != nil {
+		return nil, err
+	} else if path != "" {
+		return ResizeShared(runner, path, size)
+	}
+
 	return executeWithReturn(
 		runner,
 		&models.GetVHDResponse{},
@@ -0,0 +1,247 @@
+//go:build windows
+
+package vhd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/powershell"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+)
+
+// VhdSetType is the file extension of a VHD Set. A VHD Set may be attached
+// to several VMs at once with SCSI persistent reservations, which permits
+// clustered software to fence access to the disk.
+const VhdSetType = ".vhds"
+
+// findShared returns the path of the VHD Set in the store with the given name or
+// ID, or an empty string if there is none. VHD Sets are named name;id.vhds in
+// the same way as the VHDs managed by the PowerShell module.
+func findShared(store, name, id string) (string, error) {
+
+	if name == "" {
+		name = "*"
+	}
+
+	if id == "" {
+		id = "*"
+	}
+
+	matches, err := filepath.Glob(filepath.Join(store, name+";"+id+VhdSetType))
+	if err != nil || len(matches) == 0 {
+		return "", err
+	}
+
+	return matches[0], nil
+}
+
+// getShared reads the VHD Set at the given path.
+func getShared(runner powershell.Runner, path string) (*models.GetVHDResponse, error) {
+
+	name, _, err := ParseDiskPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	disk, err := executeWithReturn(
+		runner,
+		&models.GetVHDResponse{},
+		powershell.NewCmdlet(
+			"Get-VHD",
+			map[string]any{
+				"Path": path,
+			},
+		),
+		powershell.NewCmdlet(
+			"ConvertTo-Json",
+			nil,
+		),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	disk.Name = name
+	disk.Path = path
+	disk.Shared = true
+
+	return disk, nil
+}
+
+// GetSharedByID returns the VHD Set with the given ID, or nil if there is none.
+func GetSharedByID(runner powershell.Runner, store, id string) (*models.GetVHDResponse, error) {
+
+	path, err := findShared(store, "", id)
+	if err != nil || path == "" {
+		return nil, err
+	}
+
+	return getShared(runner, path)
+}
+
+// GetSharedByName returns the VHD Set with the given name, or nil if there is none.
+func GetSharedByName(runner powershell.Runner, store, name string) (*models.GetVHDResponse, error) {
+
+	path, err := findShared(store, name, "")
+	if err != nil || path == "" {
+		return nil, err
+	}
+
+	return getShared(runner, path)
+}
+
+// NewShared creates a new dynamic VHD Set in the given directory with the given size.
+// As with VHDs, the filename is set to the DiskIdentifier property returned by creation.
+func NewShared(runner powershell.Runner, name, pvStore string, size int64) (*models.GetVHDResponse, error) {
+
+	tempPath := filepath.Join(pvStore, name+";"+uuid.NewString()+VhdSetType)
+
+	disk, err := executeWithReturn(
+		runner,
+		&models.GetVHDResponse{},
+		powershell.NewCmdlet(
+			"New-VHD",
+			map[string]any{
+				"Path":      tempPath,
+				"SizeBytes": size,
+				"Dynamic":   nil,
+			},
+		),
+		powershell.NewCmdlet(
+			"ConvertTo-Json",
+			nil,
+		),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(pvStore, name+";"+disk.DiskIdentifier+VhdSetType)
+
+	if err := os.Rename(tempPath, path); err != nil {
+		return nil, fmt.Errorf("cannot rename VHD Set %s: %w", tempPath, err)
+	}
+
+	disk.Name = name
+	disk.Path = path
+	disk.Shared = true
+
+	return disk, nil
+}
+
+// attachShared attaches the VHD Set at the given path to the given node with
+// persistent reservations enabled. The set may be attached to any number of nodes.
+func attachShared(runner powershell.Runner, path, nodeId string) (*models.AttachedDrive, error) {
+
+	attachments, err := GetAttachments(runner, path)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range attachments {
+		if strings.EqualFold(attachments[i].VMID, nodeId) {
+			return &attachments[i], nil
+		}
+	}
+
+	return executeWithReturn(
+		runner,
+		&models.AttachedDrive{},
+		powershell.NewCmdlet(
+			"Get-VM",
+			map[string]any{
+				"Id": nodeId,
+			},
+		),
+		powershell.NewCmdlet(
+			"Add-VMHardDiskDrive",
+			map[string]any{
+				"ControllerType":                "SCSI",
+				"Path":                          path,
+				"SupportPersistentReservations": nil,
+				"Passthru":                      nil,
+			},
+		),
+		powershell.NewCmdlet(
+			"ConvertTo-Json",
+			nil,
+		),
+	)
+}
+
+// DeleteShared deletes the VHD Set with the given ID along with the
+// checkpoint files that belong to it. The set must not be attached to any VM.
+func DeleteShared(runner powershell.Runner, path string) error {
+
+	attachments, err := GetAttachments(runner, path)
+	if err != nil {
+		return err
+	}
+
+	if len(attachments) > 0 {
+		return &rest.Error{
+			Code:    codes.FailedPrecondition,
+			Message: fmt.Sprintf("%s: attached to %d VMs", ErrDiskAttached, len(attachments)),
+		}
+	}
+
+	set, err := executeWithReturn(
+		runner,
+		&struct {
+			AllPaths []string `json:"AllPaths"`
+		}{},
+		powershell.NewCmdlet(
+			"Get-VHDSet",
+			map[string]any{
+				"Path":        path,
+				"GetAllPaths": nil,
+			},
+		),
+		powershell.NewCmdlet(
+			"ConvertTo-Json",
+			nil,
+		),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	for _, p := range append(set.AllPaths, path) {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("cannot delete VHD Set file %s: %w", p, err)
+		}
+	}
+
+	return nil
+}
+
+// ResizeShared resizes the VHD Set at the given path.
+func ResizeShared(runner powershell.Runner, path string, size int64) (*models.GetVHDResponse, error) {
+
+	err := execute(
+		runner,
+		powershell.NewCmdlet(
+			"Resize-VHD",
+			map[string]any{
+				"Path":      path,
+				"SizeBytes": size,
+			},
+		),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getShared(runner, path)
+}
@@ -0,0 +1,271 @@
+//go:build windows
+
+package vhd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fireflycons/hypervcsi/internal/models"
+	"github.com/fireflycons/hypervcsi/internal/models/rest"
+	"github.com/fireflycons/hypervcsi/internal/windows/powershell"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+)
+
+// templateNameRx validates template names, which are the file names of the
+// template VHDs without extension. This prevents escaping the templates directory.
+var templateNameRx = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// creatingDir is the directory of the PV store in which volumes are created from templates.
+// Only the PV store itself is searched for disks, so the disks being created are not listed.
+const creatingDir = ".creating"
+
+// templateTypes are the file types that may be used as templates, in order of preference
+var templateTypes = []string{".vhdx", ".vhd"}
+
+// ListTemplates lists the template VHDs in the given directory.
+// A directory that does not exist has no templates.
+func ListTemplates(runner powershell.Runner, dir string) ([]models.GetVHDResponse, error) {
+
+	templates := []models.GetVHDResponse{}
+
+	for _, ext := range templateTypes {
+		matches, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range matches {
+			name := strings.TrimSuffix(filepath.Base(path), ext)
+			if !templateNameRx.MatchString(name) {
+				continue
+			}
+
+			template, err := getTemplate(runner, path, name)
+			if err != nil {
+				return nil, err
+			}
+
+			templates = append(templates, *template)
+		}
+	}
+
+	return templates, nil
+}
+
+// GetTemplate returns the template VHD in the given directory with
+// the given name, or nil if there is none.
+func GetTemplate(runner powershell.Runner, dir, name string) (*models.GetVHDResponse, error) {
+
+	if !templateNameRx.MatchString(name) {
+		return nil, &rest.Error{
+			Code:    codes.InvalidArgument,
+			Message: fmt.Sprintf("invalid template name %q", name),
+		}
+	}
+
+	for _, ext := range templateTypes {
+		path := filepath.Join(dir, name+ext)
+
+		if _, err := os.Stat(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		return getTemplate(runner, path, name)
+	}
+
+	return nil, nil
+}
+
+func getTemplate(runner powershell.Runner, path, name string) (*models.GetVHDResponse, error) {
+
+	template, err := executeWithReturn(
+		runner,
+		&models.GetVHDResponse{},
+		powershell.NewCmdlet(
+			"Get-VHD",
+			map[string]any{
+				"Path": path,
+			},
+		),
+		powershell.NewCmdlet(
+			"ConvertTo-Json",
+			nil,
+		),
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	template.Name = name
+	template.Path = path
+
+	return template, nil
+}
+
+// StageFromTemplate creates a new VHD from the given template in a directory of the given PV store
+// whose disks are not listed, either as a copy of the template or as a differencing disk whose parent
+// is the template. The VHD is expanded to the given size if that is larger than the template.
+// Copying a large template takes a long time, so this is done before the volume is named by CommitStaged.
+func StageFromTemplate(runner powershell.Runner, pvStore string, template *models.GetVHDResponse, size int64, differencing bool) (*models.GetVHDResponse, error) {
+
+	if !differencing {
+		free, err := GetCapacity(runner, pvStore)
+		if err != nil {
+			return nil, err
+		}
+
+		if free < template.FileSize {
+			return nil, &rest.Error{
+				Code:    codes.ResourceExhausted,
+				Message: fmt.Sprintf("%s: template %s needs %d bytes", ErrCapacityExhausted, template.Name, template.FileSize),
+			}
+		}
+	}
+
+	dir := filepath.Join(pvStore, creatingDir)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create %s: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, uuid.NewString()+filepath.Ext(template.Path))
+
+	disk, err := newFromTemplate(runner, path, template, size, differencing)
+
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+
+	disk.Path = path
+
+	return disk, nil
+}
+
+// CommitStaged moves a VHD returned by StageFromTemplate into the PV store as a volume of the given name.
+// As with New, the filename of the VHD is set to the DiskIdentifier property of the disk.
+// The staged VHD is removed if it cannot be moved.
+func CommitStaged(name, pvStore string, disk *models.GetVHDResponse) (*models.GetVHDResponse, error) {
+
+	path := filepath.Join(pvStore, name+";"+disk.DiskIdentifier+filepath.Ext(disk.Path))
+
+	if err := os.Rename(disk.Path, path); err != nil {
+		_ = os.Remove(disk.Path)
+		return nil, fmt.Errorf("cannot rename VHD %s: %w", disk.Path, err)
+	}
+
+	committed := *disk
+	committed.Name = name
+	committed.Path = path
+
+	return &committed, nil
+}
+
+func newFromTemplate(runner powershell.Runner, path string, template *models.GetVHDResponse, size int64, differencing bool) (*models.GetVHDResponse, error) {
+
+	if differencing {
+		err := execute(
+			runner,
+			powershell.NewCmdlet(
+				"New-VHD",
+				map[string]any{
+					"Path":         path,
+					"ParentPath":   template.Path,
+					"Differencing": nil,
+				},
+			),
+		)
+
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if err := copyFile(template.Path, path); err != nil {
+			return nil, err
+		}
+
+		// A copy has the same disk identifier as the template, which is
+		// also the volume ID, so it must be given a new one.
+		err := execute(
+			runner,
+			powershell.NewCmdlet(
+				"Set-VHD",
+				map[string]any{
+					"Path":                path,
+					"ResetDiskIdentifier": nil,
+					"Force":               nil,
+				},
+			),
+		)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if size > template.Size {
+		err := execute(
+			runner,
+			powershell.NewCmdlet(
+				"Resize-VHD",
+				map[string]any{
+					"Path":      path,
+					"SizeBytes": size,
+				},
+			),
+		)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return executeWithReturn(
+		runner,
+		&models.GetVHDResponse{},
+		powershell.NewCmdlet(
+			"Get-VHD",
+			map[string]any{
+				"Path": path,
+			},
+		),
+		powershell.NewCmdlet(
+			"ConvertTo-Json",
+			nil,
+		),
+	)
+}
+
+func copyFile(src, dst string) error {
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("cannot open VHD %s: %w", src, err)
+	}
+
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot create VHD %s: %w", dst, err)
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("cannot copy VHD %s: %w", src, err)
+	}
+
+	return out.Close()
+}
@@ -7,7 +7,7 @@ import (
 	"regexp"
 )
 
-var diskNameRx = regexp.MustCompile(`^(?P<name>[A-Za-z0-9._-]+);(?P<id>[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})\.vhdx?$`)
+var diskNameRx = regexp.MustCompile(`^(?P<name>[A-Za-z0-9._-]+);(?P<id>[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})\.(?:vhdx?|vhds)$`)
 
 func ParseDiskPath(path string) (name, id string, err error) {
 
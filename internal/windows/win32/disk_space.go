@@ -0,0 +1,22 @@
+//go:build windows
+
+package win32
+
+import "golang.org/x/sys/windows"
+
+// GetDiskSpace returns the total size and the free space available
+// to the caller of the disk on which the given path resides.
+func GetDiskSpace(path string) (total, free int64, err error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var available, totalBytes, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &available, &totalBytes, &totalFree); err != nil {
+		return 0, 0, err
+	}
+
+	//nolint:gosec // disk sizes do not overflow int64
+	return int64(totalBytes), int64(available), nil
+}
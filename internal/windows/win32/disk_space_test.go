@@ -0,0 +1,19 @@
+//go:build windows
+
+package win32
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDiskSpace(t *testing.T) {
+	total, free, err := GetDiskSpace(os.TempDir())
+
+	require.NoError(t, err)
+	require.Positive(t, total)
+	require.Positive(t, free)
+	require.LessOrEqual(t, free, total)
+}
@@ -0,0 +1,41 @@
+function Get-DiskHost {
+    <#
+        .SYNOPSIS
+            Gets the ID of the VM to which a disk is attached
+
+        .DESCRIPTION
+            Get-VHD does not say to which VM a disk is attached, and finding the drive
+            means listing the drives of every VM. The hosts of all disks are listed once
+            and reused for DiskHostsLifetime, which Mount-Disk and Dismount-Disk cut short
+            with Clear-DiskHosts. Returns null if the disk is not attached.
+
+        .PARAMETER Path
+            Path to a VHD disk file
+    #>
+    param (
+        [string]$Path
+    )
+
+    $now = [DateTime]::UtcNow
+
+    if (-not $script:DiskHosts -or $now -ge $script:DiskHostsExpiry) {
+
+        # Paths are compared without regard to case, as by -eq
+        $hosts = [Collections.Hashtable]::new([StringComparer]::OrdinalIgnoreCase)
+
+        foreach ($drive in (Get-VM | Get-VMHardDiskDrive)) {
+            if ($drive.Path -and -not $hosts.ContainsKey($drive.Path)) {
+                $hosts[$drive.Path] = $drive.VMId.ToString()
+            }
+        }
+
+        $script:DiskHosts = $hosts
+        $script:DiskHostsExpiry = $now.Add($script:DiskHostsLifetime)
+    }
+
+    $script:DiskHosts[$Path]
+}
+
+function Clear-DiskHosts {
+    $script:DiskHosts = $null
+}
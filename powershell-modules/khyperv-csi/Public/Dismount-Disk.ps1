@@ -46,6 +46,7 @@ function Dismount-Disk {
         $drive = $controller.Drives | Where-Object { $_.Path -eq $DiskPath }
 
         if ($drive) {
+            Clear-DiskHosts
             Remove-VMHardDiskDrive -VMName $vm.Name -ControllerType SCSI -ControllerNumber $drive.ControllerNumber -ControllerLocation $drive.ControllerLocation
             return
         }
@@ -1,5 +1,10 @@
 function Get-Attachments {
 
+    <#
+        .SYNOPSIS
+        Get the disks attached to the SCSI controllers of a VM
+    #>
+
     param (
         [Parameter(Mandatory = $true, ParameterSetName = 'ById')]
         [string]$VMId,
@@ -10,49 +15,49 @@ function Get-Attachments {
 
     try {
         if ($PSCmdlet.ParameterSetName -eq 'ByID') {
-            $VMName = Get-VM -Id $VMId -ErrorAction Stop | Select-Object -ExpandProperty Name
+            $vm = Get-VM -Id $VMId -ErrorAction Stop
         } else {
-            $VMId = (Get-VM -Name $VMName -ErrorAction Stop).Id.Guid
+            $vm = Get-VM -Name $VMName -ErrorAction Stop
         }
     } catch {
         throw "NOT_FOUND : " + $_.Exception.Message
     }
 
-    $attachments = Get-VMScsiController -VMname $VMName |
-        Select-Object -ExpandProperty Drives |
-        ForEach-Object {
-            $vhd = Get-VHD -Path $_.Path
-            [PSCustomObject]@{
-                DiskIdentifier = $vhd.DiskIdentifier
-                Name = (Get-DiskName -Path $_.Path)
-                Size = $vhd.Size
-                Path = $_.Path
-                Host = $VMId
+    try {
+        $attachments = $vm | Get-VMScsiController |
+            Select-Object -ExpandProperty Drives |
+            ForEach-Object {
+                $attachment = [PSCustomObject]@{
+                    ControllerNumber = $_.ControllerNumber
+                    ControllerLocation = $_.ControllerLocation
+                    Path = $_.Path
+                    Name = $_.Name
+                    Volume = $false
+                }
+
+                # Physical disks have no path
+                if ($_.Path) {
+                    $vhd = Get-VHD -Path $_.Path
+                    $attachment.Name = (Get-DiskName -Path $_.Path)
+                    $attachment.Volume = (Split-Path -Leaf (Split-Path -Parent $_.Path)) -eq $script:PVStoreName
+                    $attachment | Add-Member -NotePropertyName DiskIdentifier -NotePropertyValue $vhd.DiskIdentifier
+                    $attachment | Add-Member -NotePropertyName Size -NotePropertyValue $vhd.Size
+                    $attachment | Add-Member -NotePropertyName Shared -NotePropertyValue ($vhd.VhdFormat -eq 'VHDSet')
+                }
+
+                $attachment
             }
-        }
 
-    $result = switch ($attachments | Measure-Object | Select-Object -ExpandProperty Count) {
-        0 {
-            [PSCustomObject]@{
-                VHDs = @()
-                NextToken = ""
-            }
+        switch ($attachments | Measure-Object | Select-Object -ExpandProperty Count) {
+            0 { $attachments = @() }
+            1 { $attachments = @(,$attachments) }
         }
+        [PSCustomObject]@{
+            Attachments = $attachments
+        } | ConvertTo-Json -Compress
 
-        1 {
-            [PSCustomObject]@{
-                VHDs = @($attachments)
-                NextToken = ""
-            }
-        }
+    } catch {
 
-        Default {
-            [PSCustomObject]@{
-                VHDs = $attachments
-                NextToken = ""
-            }
-        }
+        throw "INTERNAL : cannot list attachments of VM $($vm.Id) : " + $_.Exception.Message
     }
-
-    $result | ConvertTo-Json -Compress
-}
\ No newline at end of file
+}
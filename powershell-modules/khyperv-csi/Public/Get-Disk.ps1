@@ -72,6 +72,13 @@ function Get-Disk {
         }
     }
 
+    # A disk whose file is read-only may be attached read-only to several VMs, so has no host.
+    $hostId = $null
+    if (-not (Get-Item -Path $vhd.Path).IsReadOnly) {
+        $hostId = Get-DiskHost -Path $vhd.Path
+    }
+    $vhd | Add-Member -NotePropertyName Host -NotePropertyValue $hostId -Force
+
     if ($AsJson.IsPresent) {
         $vhd | ConvertTo-Json -Compress
     }
@@ -6,18 +6,84 @@ function Get-VirtualMachines {
     #>
 
     try {
-        $vms = Get-VM | Select-Object Name, ID, Path, Generation
+        # The BIOS GUID, which the guest reads as its BIOS UUID, is only in the settings of the VM
+        $biosGuids = @{}
+        Get-CimInstance -Namespace root\virtualization\v2 -ClassName Msvm_VirtualSystemSettingData -Filter "VirtualSystemType = 'Microsoft:Hyper-V:System:Realized'" | ForEach-Object {
+            $biosGuids[$_.VirtualSystemIdentifier] = $_.BIOSGUID.Trim('{', '}')
+        }
+
+        $vms = Get-VM | ForEach-Object {
+            $vm = $_
+
+            $controllers = @($vm | Get-VMScsiController | ForEach-Object {
+                [PSCustomObject]@{
+                    ControllerNumber = $_.ControllerNumber
+                    Name = $_.Name
+                    Id = $_.Id
+                    VMId = $_.VMId
+                    VMName = $_.VMName
+                    Drives = @($_.Drives | ForEach-Object {
+                        [PSCustomObject]@{
+                            Path = $_.Path
+                            DiskNumber = $_.DiskNumber
+                            ControllerLocation = $_.ControllerLocation
+                            ControllerNumber = $_.ControllerNumber
+                            ControllerType = [int]$_.ControllerType
+                            Name = $_.Name
+                            Id = $_.Id
+                            VMId = $_.VMId
+                            VMName = $_.VMName
+                        }
+                    })
+                }
+            })
+            $drives = @($controllers | ForEach-Object { $_.Drives })
+
+            # Drives holding disks of the PV store, as opposed to OS disks and the like
+            $volumes = @($drives | Where-Object { $_.Path -and (Split-Path -Leaf (Split-Path -Parent $_.Path)) -eq $script:PVStoreName })
+
+            $adapters = @($vm | Get-VMNetworkAdapter | ForEach-Object {
+                [PSCustomObject]@{
+                    Name = $_.Name
+                    SwitchName = $_.SwitchName
+                    MacAddress = $_.MacAddress
+                    IPAddresses = @($_.IPAddresses)
+                    Connected = $_.Connected
+                }
+            })
+
+            [PSCustomObject]@{
+                Name = $vm.Name
+                ID = $vm.Id
+                BIOSGUID = $biosGuids[$vm.Id.ToString()]
+                Path = $vm.Path
+                Generation = $vm.Generation
+                State = $vm.State
+                UptimeSeconds = [int64]$vm.Uptime.TotalSeconds
+                ProcessorCount = $vm.ProcessorCount
+                MemoryAssigned = $vm.MemoryAssigned
+                MemoryStartup = $vm.MemoryStartup
+                MemoryMinimum = $vm.MemoryMinimum
+                MemoryMaximum = $vm.MemoryMaximum
+                DynamicMemoryEnabled = $vm.DynamicMemoryEnabled
+                ScsiControllers = $controllers
+                VolumeDrives = $volumes.Count
+                NetworkAdapters = $adapters
+            }
+        }
 
         switch ($vms | Measure-Object | Select-Object -ExpandProperty Count) {
             0 { $vms = @() }
             1 { $vms = @(,$vms) }
         }
+
+        # Drives are nested four levels below the list of VMs
         [PSCustomObject]@{
             VMs = $vms
-        } | ConvertTo-Json -Compress
+        } | ConvertTo-Json -Compress -Depth 6
 
     } catch {
 
-        throw "INTERNAL : cannot list VMs : " +  + $_.Exception.Message
+        throw "INTERNAL : cannot list VMs : " + $_.Exception.Message
     }
-}
\ No newline at end of file
+}
@@ -82,6 +82,7 @@ function Mount-Disk {
     }
 
     # If we get here, then we have a controller and location
+    Clear-DiskHosts
     try {
         $controller | Add-VMHardDiskDrive -Passthru -Path $DiskPath -ControllerLocation $controllerLocation | ConvertTo-Json -Compress
     } catch {